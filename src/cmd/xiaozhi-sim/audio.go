@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	deviceSampleRate = 16000 // 设备上行音频采样率，与ESP32固件一致
+	frameDuration    = 60    // 上下行Opus帧时长（毫秒）
+)
+
+// utterance 虚拟设备一轮对话中说的话
+type utterance struct {
+	name   string   // WAV文件名或文本提示，用于报告
+	text   string   // 文本提示，以 listen detect 消息直接发送，不经过ASR
+	frames [][]byte // 上行Opus帧
+}
+
+// loadUtterances 加载WAV文件与文本提示，都为空时使用一段提示音（配合 mock ASR 使用）
+func loadUtterances(wavFiles, prompts []string) ([]utterance, error) {
+	var result []utterance
+	for _, file := range wavFiles {
+		pcm, err := loadWavPCM(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %v", file, err)
+		}
+		frames, err := encodeOpus(pcm)
+		if err != nil {
+			return nil, fmt.Errorf("编码 %s 失败: %v", file, err)
+		}
+		result = append(result, utterance{name: filepath.Base(file), frames: frames})
+	}
+	for _, prompt := range prompts {
+		result = append(result, utterance{name: prompt, text: prompt})
+	}
+	if len(result) == 0 {
+		frames, err := encodeOpus(tonePCM(1500))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, utterance{name: "tone", frames: frames})
+	}
+	return result, nil
+}
+
+// encodeOpus 把16kHz单声道PCM编码为60ms的Opus帧
+func encodeOpus(pcm []byte) ([][]byte, error) {
+	return utils.PCMSlicesToOpusData([][]byte{pcm}, deviceSampleRate, 1, 0)
+}
+
+// tonePCM 生成16kHz的440Hz正弦波PCM数据
+func tonePCM(ms int) []byte {
+	samples := deviceSampleRate * ms / 1000
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		v := 0.3 * math.Sin(2*math.Pi*440*float64(i)/deviceSampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+// loadWavPCM 读取16位PCM编码的WAV文件，转换为16kHz单声道
+func loadWavPCM(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("不是WAV文件")
+	}
+
+	var (
+		channels, bitsPerSample int
+		sampleRate              int
+		pcm                     []byte
+	)
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			size = len(body) // 录音程序中途退出时data块长度可能不准确
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmt块长度错误")
+			}
+			if format := binary.LittleEndian.Uint16(body[0:2]); format != 1 {
+				return nil, fmt.Errorf("只支持PCM编码的WAV，当前编码: %d", format)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			pcm = body[:size]
+		}
+		pos += 8 + size + size%2 // 块按偶数字节对齐
+	}
+	if channels == 0 || pcm == nil {
+		return nil, fmt.Errorf("缺少fmt或data块")
+	}
+	if bitsPerSample != 16 {
+		return nil, fmt.Errorf("只支持16位采样，当前: %d", bitsPerSample)
+	}
+
+	samples := toMono(pcm, channels)
+	samples = resample(samples, sampleRate, deviceSampleRate)
+	out := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(s))
+	}
+	return out, nil
+}
+
+// toMono 把交错的多声道16位PCM平均为单声道
+func toMono(pcm []byte, channels int) []int16 {
+	frameSize := channels * 2
+	samples := make([]int16, len(pcm)/frameSize)
+	for i := range samples {
+		sum := 0
+		for c := 0; c < channels; c++ {
+			offset := i*frameSize + c*2
+			sum += int(int16(binary.LittleEndian.Uint16(pcm[offset:])))
+		}
+		samples[i] = int16(sum / channels)
+	}
+	return samples
+}
+
+// resample 线性插值重采样
+func resample(input []int16, from, to int) []int16 {
+	if from == to || len(input) == 0 {
+		return input
+	}
+	n := int(int64(len(input)) * int64(to) / int64(from))
+	output := make([]int16, n)
+	ratio := float64(from) / float64(to)
+	for i := range output {
+		pos := float64(i) * ratio
+		idx := int(pos)
+		if idx >= len(input)-1 {
+			output[i] = input[len(input)-1]
+			continue
+		}
+		frac := pos - float64(idx)
+		output[i] = int16(float64(input[idx])*(1-frac) + float64(input[idx+1])*frac)
+	}
+	return output
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeWav 写入16位PCM编码的WAV文件
+func writeWav(t *testing.T, sampleRate, channels int, samples []int16) string {
+	t.Helper()
+	data := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(s))
+	}
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	path := filepath.Join(t.TempDir(), "test.wav")
+	require.NoError(t, os.WriteFile(path, append(header, data...), 0o644))
+	return path
+}
+
+func TestLoadWavPCMResamplesToMono16k(t *testing.T) {
+	// 32kHz双声道，100ms
+	samples := make([]int16, 3200*2)
+	for i := 0; i < 3200; i++ {
+		samples[i*2] = 1000
+		samples[i*2+1] = 3000
+	}
+	pcm, err := loadWavPCM(writeWav(t, 32000, 2, samples))
+	require.NoError(t, err)
+
+	assert.Len(t, pcm, 1600*2)
+	assert.Equal(t, int16(2000), int16(binary.LittleEndian.Uint16(pcm[0:])))
+}
+
+func TestLoadWavPCMRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.wav")
+	require.NoError(t, os.WriteFile(path, []byte("not a wav file"), 0o644))
+	_, err := loadWavPCM(path)
+	assert.Error(t, err)
+
+	_, err = loadWavPCM(filepath.Join(t.TempDir(), "missing.wav"))
+	assert.Error(t, err)
+}
+
+func TestResample(t *testing.T) {
+	input := []int16{0, 100, 200, 300}
+	assert.Equal(t, input, resample(input, 16000, 16000))
+	assert.Equal(t, []int16{0, 50, 100, 150, 200, 250, 300, 300}, resample(input, 8000, 16000))
+	assert.Equal(t, []int16{0, 200}, resample(input, 32000, 16000))
+}
+
+func TestLoadUtterances(t *testing.T) {
+	script, err := loadUtterances(nil, []string{"你好"})
+	require.NoError(t, err)
+	require.Len(t, script, 1)
+	assert.Equal(t, "你好", script[0].text)
+
+	// 没有输入时使用1.5秒的提示音
+	script, err = loadUtterances(nil, nil)
+	require.NoError(t, err)
+	require.Len(t, script, 1)
+	assert.Equal(t, "tone", script[0].name)
+	assert.Len(t, script[0].frames, 1500/frameDuration)
+}
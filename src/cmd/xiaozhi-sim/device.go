@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 错误分类，用于报告
+const (
+	errOTA          = "ota"           // OTA请求失败
+	errConnect      = "connect"       // WebSocket连接失败
+	errHello        = "hello_timeout" // 没有收到hello回复
+	errSend         = "send"          // 发送消息失败
+	errDisconnected = "disconnected"  // 对话中连接被断开
+	errRoundTimeout = "round_timeout" // 没有在超时时间内收到 tts stop
+)
+
+// serverEvent 设备收到的一条服务端消息
+type serverEvent struct {
+	at    time.Time
+	msg   map[string]interface{} // 文本消息，音频帧时为nil
+	audio []byte
+}
+
+// simDevice 一个虚拟设备
+type simDevice struct {
+	index    int
+	deviceID string // 虚拟MAC地址
+	clientID string
+	cfg      *simConfig
+	stats    *collector
+	script   []utterance
+
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	sessionID string
+	events    chan serverEvent
+}
+
+func newSimDevice(index int, cfg *simConfig, stats *collector, script []utterance) *simDevice {
+	return &simDevice{
+		index:    index,
+		deviceID: fmt.Sprintf("%s:%02x:%02x", cfg.macPrefix, (index>>8)&0xff, index&0xff),
+		clientID: fmt.Sprintf("xiaozhi-sim-%d", index),
+		cfg:      cfg,
+		stats:    stats,
+		script:   script,
+		events:   make(chan serverEvent, 256),
+	}
+}
+
+// run 完成OTA、连接与握手后按顺序进行多轮对话
+func (d *simDevice) run(ctx context.Context) {
+	wsURL := d.cfg.wsURL
+	if d.cfg.otaURL != "" {
+		start := time.Now()
+		url, err := d.checkIn(ctx)
+		if err != nil {
+			d.stats.error(errOTA)
+			d.logf("OTA失败: %v", err)
+			return
+		}
+		d.stats.latency(metricOTA, time.Since(start))
+		if wsURL == "" {
+			wsURL = url
+		}
+	}
+	if wsURL == "" {
+		d.stats.error(errConnect)
+		d.logf("没有可用的WebSocket地址，请通过 -ws 指定")
+		return
+	}
+
+	start := time.Now()
+	if err := d.connect(ctx, wsURL); err != nil {
+		d.stats.error(errConnect)
+		d.logf("连接失败: %v", err)
+		return
+	}
+	defer d.conn.Close()
+	if err := d.hello(ctx); err != nil {
+		d.stats.error(errHello)
+		d.logf("握手失败: %v", err)
+		return
+	}
+	d.stats.latency(metricConnect, time.Since(start))
+	d.stats.add(func(c *collector) { c.devices++ })
+
+	for round := 0; round < d.cfg.rounds; round++ {
+		if round > 0 && !sleep(ctx, d.cfg.interval) {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		u := d.script[(d.index+round)%len(d.script)]
+		if err := d.talk(ctx, u); err != nil {
+			d.logf("第%d轮(%s)失败: %v", round+1, u.name, err)
+			if errors.Is(err, errConnectionLost) {
+				return
+			}
+		}
+	}
+	d.writeMu.Lock()
+	d.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	d.writeMu.Unlock()
+}
+
+func (d *simDevice) logf(format string, args ...interface{}) {
+	if d.cfg.verbose {
+		fmt.Printf("[设备 %s] %s\n", d.deviceID, fmt.Sprintf(format, args...))
+	}
+}
+
+// checkIn 向OTA接口上报设备信息，返回下发的WebSocket地址
+func (d *simDevice) checkIn(ctx context.Context) (string, error) {
+	body := map[string]interface{}{
+		"version":         2,
+		"uuid":            d.clientID,
+		"mac_address":     d.deviceID,
+		"chip_model_name": "esp32s3",
+		"language":        "zh-CN",
+		"application":     map[string]interface{}{"name": "xiaozhi", "version": d.cfg.firmware},
+		"board": map[string]interface{}{
+			"type": "xiaozhi-sim",
+			"name": d.clientID,
+			"mac":  d.deviceID,
+		},
+	}
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.otaURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Device-Id", d.deviceID)
+	req.Header.Set("Client-Id", d.clientID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("状态码 %d: %s", resp.StatusCode, respBody)
+	}
+	var result struct {
+		Websocket struct {
+			URL string `json:"url"`
+		} `json:"websocket"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v", err)
+	}
+	return result.Websocket.URL, nil
+}
+
+// connect 建立WebSocket连接并启动读协程
+func (d *simDevice) connect(ctx context.Context, url string) error {
+	header := http.Header{}
+	header.Set("Device-Id", d.deviceID)
+	header.Set("Client-Id", d.clientID)
+	header.Set("Protocol-Version", "1")
+	if d.cfg.token != "" {
+		header.Set("Authorization", "Bearer "+d.cfg.token)
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: d.cfg.timeout}
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return err
+	}
+	d.conn = conn
+	go d.readLoop()
+	return nil
+}
+
+// readLoop 读取服务端消息，MCP请求直接应答，其余交给对话流程
+func (d *simDevice) readLoop() {
+	defer close(d.events)
+	for {
+		messageType, data, err := d.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		at := time.Now()
+		if messageType == websocket.BinaryMessage {
+			d.events <- serverEvent{at: at, audio: data}
+			continue
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if msg["type"] == "mcp" {
+			d.handleMCP(msg)
+			continue
+		}
+		d.events <- serverEvent{at: at, msg: msg}
+	}
+}
+
+func (d *simDevice) send(messageType int, data []byte) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return d.conn.WriteMessage(messageType, data)
+}
+
+func (d *simDevice) sendJSON(msg map[string]interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return d.send(websocket.TextMessage, data)
+}
+
+var errConnectionLost = errors.New("连接已断开")
+
+// nextEvent 等待下一条服务端消息
+func (d *simDevice) nextEvent(ctx context.Context, timeout <-chan time.Time) (serverEvent, error) {
+	select {
+	case ev, ok := <-d.events:
+		if !ok {
+			return ev, errConnectionLost
+		}
+		return ev, nil
+	case <-timeout:
+		return serverEvent{}, errTimeout
+	case <-ctx.Done():
+		return serverEvent{}, ctx.Err()
+	}
+}
+
+var errTimeout = errors.New("等待服务端消息超时")
+
+// hello 发送hello并等待服务端回复
+func (d *simDevice) hello(ctx context.Context) error {
+	err := d.sendJSON(map[string]interface{}{
+		"type":      "hello",
+		"version":   1,
+		"transport": "websocket",
+		"features":  map[string]interface{}{"mcp": true},
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    deviceSampleRate,
+			"channels":       1,
+			"frame_duration": frameDuration,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	timeout := time.After(d.cfg.timeout)
+	for {
+		ev, err := d.nextEvent(ctx, timeout)
+		if err != nil {
+			return err
+		}
+		if ev.msg != nil && ev.msg["type"] == "hello" {
+			d.sessionID, _ = ev.msg["session_id"].(string)
+			return nil
+		}
+	}
+}
+
+// talk 进行一轮对话：说话后等待回复播放完成，记录各阶段耗时与下行音频帧的节奏
+func (d *simDevice) talk(ctx context.Context, u utterance) error {
+	d.stats.add(func(c *collector) { c.rounds++ })
+	d.drain()
+
+	s, err := d.say(ctx, u)
+	if err != nil {
+		d.stats.error(errSend)
+		return err
+	}
+	defer s.stop()
+
+	var (
+		gotSTT, gotAudio bool
+		pacer            = framePacer{frameDuration: frameDuration * time.Millisecond}
+		frames, late     int
+		leads            []time.Duration
+	)
+	defer func() {
+		d.stats.add(func(c *collector) {
+			c.frames += frames
+			c.lateFrames += late
+			c.leads = append(c.leads, leads...)
+		})
+	}()
+
+	timeout := time.After(d.cfg.roundTimeout)
+	for {
+		ev, err := d.nextEvent(ctx, timeout)
+		if err != nil {
+			switch {
+			case errors.Is(err, errConnectionLost):
+				d.stats.error(errDisconnected)
+			case errors.Is(err, errTimeout):
+				d.stats.error(errRoundTimeout)
+			}
+			return err
+		}
+
+		if ev.msg != nil && ev.msg["type"] == "stt" && !gotSTT {
+			gotSTT = true
+			// 自动拾音模式下服务端在音频发完前判定说话结束时，设备停止上传，以此刻作为说话结束
+			if s.stop() && !ev.at.Before(s.end()) {
+				d.stats.latency(metricSTT, ev.at.Sub(s.end()))
+			}
+			d.logf("识别结果: %v", ev.msg["text"])
+			continue
+		}
+		if !gotSTT {
+			continue // 识别结果之前的回复属于上一轮
+		}
+
+		since := ev.at.Sub(s.end())
+		if since < 0 {
+			since = 0 // 手动模式下事件可能在 listen stop 之前到达并缓存
+		}
+		if ev.msg == nil {
+			if !gotAudio {
+				gotAudio = true
+				d.stats.latency(metricFirstAudio, since)
+			}
+			lead := pacer.frame(ev.at)
+			frames++
+			leads = append(leads, lead)
+			if lead < 0 {
+				late++
+			}
+			continue
+		}
+		if ev.msg["type"] != "tts" {
+			continue
+		}
+		switch ev.msg["state"] {
+		case "sentence_start":
+			pacer.reset()
+			d.logf("回复: %v", ev.msg["text"])
+		case "stop":
+			d.stats.latency(metricRound, since)
+			d.stats.add(func(c *collector) { c.completed++ })
+			return nil
+		}
+	}
+}
+
+// drain 丢弃上一轮遗留的消息
+func (d *simDevice) drain() {
+	for {
+		select {
+		case _, ok := <-d.events:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// speech 一轮正在上传的输入
+type speech struct {
+	mu       sync.Mutex
+	endAt    time.Time
+	finished bool          // 音频已全部发送
+	cancel   chan struct{} // 关闭后停止发送剩余音频
+}
+
+// stop 停止上传并固定说话结束时间，返回音频是否已在此之前发送完成
+func (s *speech) stop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endAt.IsZero() {
+		s.endAt = time.Now()
+		close(s.cancel)
+	}
+	return s.finished
+}
+
+// finish 音频发送完成
+func (s *speech) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endAt.IsZero() {
+		s.endAt = time.Now()
+		s.finished = true
+		close(s.cancel)
+	}
+}
+
+func (s *speech) end() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endAt
+}
+
+// say 发送一轮输入
+//
+// 音频按帧时长实时发送；自动拾音模式下服务端可能在音频发完前就给出识别结果，
+// 此时与真实设备一样停止上传剩余音频。手动模式发完音频后发送 listen stop
+func (d *simDevice) say(ctx context.Context, u utterance) (*speech, error) {
+	s := &speech{cancel: make(chan struct{})}
+	if u.text != "" {
+		err := d.sendJSON(map[string]interface{}{
+			"type": "listen", "state": "detect", "text": u.text, "session_id": d.sessionID,
+		})
+		s.finish()
+		return s, err
+	}
+
+	err := d.sendJSON(map[string]interface{}{
+		"type": "listen", "state": "start", "mode": d.cfg.listenMode, "session_id": d.sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		start := time.Now()
+		for i, frame := range u.frames {
+			select {
+			case <-s.cancel:
+				done <- nil
+				return
+			default:
+			}
+			if err := d.send(websocket.BinaryMessage, frame); err != nil {
+				done <- err
+				return
+			}
+			if !sleepUntil(ctx, start.Add(time.Duration(i+1)*frameDuration*time.Millisecond)) {
+				done <- ctx.Err()
+				return
+			}
+		}
+		s.finish()
+		if d.cfg.listenMode == "manual" {
+			done <- d.sendJSON(map[string]interface{}{"type": "listen", "state": "stop", "session_id": d.sessionID})
+			return
+		}
+		done <- nil
+	}()
+
+	if d.cfg.listenMode == "manual" {
+		// 手动模式由 listen stop 触发识别，必须等音频发送完成
+		if err := <-done; err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	return sleepUntil(ctx, time.Now().Add(d))
+}
+
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
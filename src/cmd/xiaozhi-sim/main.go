@@ -0,0 +1,138 @@
+// xiaozhi-sim 虚拟设备压测工具
+//
+// 模拟 N 台小智设备并发接入服务端：OTA上报、建立WebSocket连接、hello握手、
+// 上传Opus音频（来自WAV文件或提示音）或发送文本提示，并应答服务端的
+// MCP initialize / tools/list / tools/call 请求。结束后输出各阶段耗时的百分位数、
+// 失败率以及服务端下行音频帧的节奏是否满足设备实时播放。
+//
+// 示例：
+//
+//	go run ./src/cmd/xiaozhi-sim -server http://127.0.0.1:8080 -ws ws://127.0.0.1:8000 \
+//	    -devices 50 -rounds 3 -ramp 10s -wav hello.wav -prompt 现在几点了
+//
+// 服务端配置 MockASR / MockLLM / MockTTS 时可以在不访问任何外部服务的情况下测试服务端本身的开销。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// simConfig 压测参数
+type simConfig struct {
+	otaURL       string
+	wsURL        string
+	token        string
+	transport    string
+	devices      int
+	rounds       int
+	ramp         time.Duration
+	interval     time.Duration
+	timeout      time.Duration
+	roundTimeout time.Duration
+	listenMode   string
+	macPrefix    string
+	firmware     string
+	verbose      bool
+	jsonOutput   bool
+}
+
+func main() {
+	cfg := &simConfig{}
+	var server, wavFiles, prompts string
+	flag.StringVar(&server, "server", "http://127.0.0.1:8080", "服务端HTTP地址，用于OTA上报，为空时跳过OTA")
+	flag.StringVar(&cfg.wsURL, "ws", "", "WebSocket地址，为空时使用OTA下发的地址")
+	flag.StringVar(&cfg.token, "token", "", "连接时携带的 Authorization Bearer 令牌")
+	flag.StringVar(&cfg.transport, "transport", "websocket", "传输协议，目前只支持 websocket")
+	flag.IntVar(&cfg.devices, "devices", 10, "虚拟设备数量")
+	flag.IntVar(&cfg.rounds, "rounds", 3, "每台设备的对话轮数")
+	flag.DurationVar(&cfg.ramp, "ramp", 5*time.Second, "所有设备在这段时间内均匀启动")
+	flag.DurationVar(&cfg.interval, "interval", time.Second, "同一设备两轮对话之间的间隔")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Second, "连接与hello握手超时")
+	flag.DurationVar(&cfg.roundTimeout, "round-timeout", 60*time.Second, "单轮对话超时")
+	flag.StringVar(&cfg.listenMode, "mode", "auto", "拾音模式：auto / manual / realtime")
+	flag.StringVar(&cfg.macPrefix, "mac-prefix", "02:00:00:00", "虚拟设备MAC地址前缀，后两段为设备序号")
+	flag.StringVar(&cfg.firmware, "firmware", "1.6.0", "上报的固件版本")
+	flag.StringVar(&wavFiles, "wav", "", "上传的WAV文件，逗号分隔，需为16位PCM编码")
+	flag.StringVar(&prompts, "prompt", "", "文本提示，逗号分隔，以 listen detect 消息发送")
+	flag.BoolVar(&cfg.verbose, "v", false, "输出每台设备的对话过程")
+	flag.BoolVar(&cfg.jsonOutput, "json", false, "以JSON格式输出报告")
+	flag.Parse()
+
+	if err := cfg.validate(server); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	script, err := loadUtterances(splitList(wavFiles), splitList(prompts))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	stats := newCollector()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.devices; i++ {
+		if i > 0 && !sleep(ctx, cfg.ramp/time.Duration(cfg.devices)) {
+			break
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			newSimDevice(index, cfg, stats, script).run(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	r := stats.report(cfg.devices, time.Since(start))
+	if cfg.jsonOutput {
+		r.writeJSON(os.Stdout)
+	} else {
+		r.writeText(os.Stdout)
+	}
+	if r.Connected == 0 || r.ErrorRate > 0 {
+		os.Exit(1)
+	}
+}
+
+// validate 检查参数并拼接OTA地址
+func (c *simConfig) validate(server string) error {
+	if c.transport != "websocket" {
+		return fmt.Errorf("暂不支持 %s 传输，服务端目前只提供 websocket", c.transport)
+	}
+	switch c.listenMode {
+	case "auto", "manual", "realtime":
+	default:
+		return fmt.Errorf("未知的拾音模式: %s", c.listenMode)
+	}
+	if c.devices <= 0 || c.rounds <= 0 {
+		return fmt.Errorf("devices 和 rounds 必须大于0")
+	}
+	if server != "" {
+		c.otaURL = strings.TrimRight(server, "/") + "/api/ota/"
+	}
+	if c.otaURL == "" && c.wsURL == "" {
+		return fmt.Errorf("-server 和 -ws 至少需要指定一个")
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// fakeTool 虚拟设备提供的MCP工具
+type fakeTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// fakeTools 与ESP32固件中常见的设备工具保持一致
+var fakeTools = []fakeTool{
+	{
+		Name:        "self.get_device_status",
+		Description: "获取设备的实时状态，包括音量、屏幕亮度、电量和网络信息",
+		InputSchema: map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+	},
+	{
+		Name:        "self.audio_speaker.set_volume",
+		Description: "设置扬声器音量，范围 0-100",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"volume": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 100},
+			},
+			"required": []string{"volume"},
+		},
+	},
+	{
+		Name:        "self.screen.set_brightness",
+		Description: "设置屏幕亮度，范围 0-100",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"brightness": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 100},
+			},
+			"required": []string{"brightness"},
+		},
+	},
+}
+
+// handleMCP 应答服务端发来的MCP请求，在读协程中调用
+func (d *simDevice) handleMCP(msg map[string]interface{}) {
+	payload, ok := msg["payload"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	id, hasID := payload["id"]
+	method, _ := payload["method"].(string)
+	if !hasID || method == "" {
+		return // 通知或响应，无需应答
+	}
+
+	var result interface{}
+	var rpcErr map[string]interface{}
+	switch method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "xiaozhi-sim", "version": d.cfg.firmware},
+		}
+	case "tools/list":
+		result = map[string]interface{}{"tools": fakeTools}
+	case "tools/call":
+		params, _ := payload["params"].(map[string]interface{})
+		name, _ := params["name"].(string)
+		args, _ := params["arguments"].(map[string]interface{})
+		text, err := d.callTool(name, args)
+		if err != nil {
+			rpcErr = map[string]interface{}{"code": -32602, "message": err.Error()}
+			break
+		}
+		d.stats.add(func(c *collector) { c.mcpCalls++ })
+		result = map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": text}},
+			"isError": false,
+		}
+	default:
+		rpcErr = map[string]interface{}{"code": -32601, "message": "未知方法: " + method}
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	if err := d.sendJSON(map[string]interface{}{
+		"type":       "mcp",
+		"session_id": d.sessionID,
+		"payload":    response,
+	}); err != nil {
+		d.logf("发送MCP响应失败: %v", err)
+	}
+}
+
+// callTool 执行虚拟设备工具，返回文本结果
+func (d *simDevice) callTool(name string, args map[string]interface{}) (string, error) {
+	d.logf("服务端调用设备工具: %s %v", name, args)
+	switch name {
+	case "self.get_device_status":
+		status, _ := json.Marshal(map[string]interface{}{
+			"audio_speaker": map[string]interface{}{"volume": 70},
+			"screen":        map[string]interface{}{"brightness": 80},
+			"battery":       map[string]interface{}{"level": 90, "charging": false},
+			"network":       map[string]interface{}{"type": "wifi", "rssi": -50},
+		})
+		return string(status), nil
+	case "self.audio_speaker.set_volume", "self.screen.set_brightness":
+		for _, v := range args {
+			if n, ok := v.(float64); !ok || n < 0 || n > 100 {
+				return "", fmt.Errorf("参数超出范围: %v", v)
+			}
+		}
+		return "true", nil
+	default:
+		return "", fmt.Errorf("未知工具: %s", name)
+	}
+}
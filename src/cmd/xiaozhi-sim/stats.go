@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 记录的耗时指标
+const (
+	metricOTA        = "ota"         // OTA请求耗时
+	metricConnect    = "connect"     // WebSocket连接并完成hello握手
+	metricSTT        = "stt"         // 说完话到收到识别结果
+	metricFirstAudio = "first_audio" // 说完话到收到第一帧回复音频，即用户感知的响应延迟
+	metricRound      = "round"       // 说完话到收到 tts stop
+)
+
+var metricOrder = []string{metricOTA, metricConnect, metricSTT, metricFirstAudio, metricRound}
+
+// collector 汇总所有虚拟设备的统计数据
+type collector struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+
+	devices   int // 完成握手的设备数
+	rounds    int // 发起的对话轮次
+	completed int // 收到 tts stop 的轮次
+	mcpCalls  int // 服务端调用设备工具的次数
+
+	frames     int             // 收到的下行音频帧
+	lateFrames int             // 晚于播放时间到达、会造成卡顿的帧
+	leads      []time.Duration // 每帧到达时距离播放时间的余量
+}
+
+func newCollector() *collector {
+	return &collector{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+func (c *collector) latency(metric string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latencies[metric] = append(c.latencies[metric], d)
+}
+
+func (c *collector) error(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[kind]++
+}
+
+func (c *collector) add(update func(c *collector)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	update(c)
+}
+
+// framePacer 按设备的播放节奏检查一句话的下行音频帧是否按时到达
+//
+// 设备收到第一帧即开始播放，之后每帧时长播放一帧，第 k 帧必须在
+// 第一帧到达后 k*帧时长 之前到达，否则播放会中断
+type framePacer struct {
+	frameDuration time.Duration
+	first         time.Time
+	count         int
+}
+
+func (p *framePacer) reset() {
+	p.first = time.Time{}
+	p.count = 0
+}
+
+// frame 记录一帧的到达时间，返回距离播放时间的余量，负数表示迟到
+func (p *framePacer) frame(at time.Time) time.Duration {
+	if p.first.IsZero() {
+		p.first = at
+	}
+	deadline := p.first.Add(time.Duration(p.count) * p.frameDuration)
+	p.count++
+	return deadline.Sub(at)
+}
+
+// percentile 按最近秩法计算已排序数据的百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// latencySummary 一项耗时指标的统计结果（毫秒）
+type latencySummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Avg   float64 `json:"avg_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+func summarize(values []time.Duration) latencySummary {
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+	s := latencySummary{Count: len(sorted)}
+	if len(sorted) > 0 {
+		s.Min = ms(sorted[0])
+		s.Avg = ms(total / time.Duration(len(sorted)))
+		s.P50 = ms(percentile(sorted, 50))
+		s.P90 = ms(percentile(sorted, 90))
+		s.P99 = ms(percentile(sorted, 99))
+		s.Max = ms(sorted[len(sorted)-1])
+	}
+	return s
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// report 压测报告
+type report struct {
+	Duration   float64                   `json:"duration_s"`
+	Devices    int                       `json:"devices"`
+	Connected  int                       `json:"connected"`
+	Rounds     int                       `json:"rounds"`
+	Completed  int                       `json:"completed"`
+	ErrorRate  float64                   `json:"error_rate"` // 未完成的轮次占比
+	Errors     map[string]int            `json:"errors"`
+	MCPCalls   int                       `json:"mcp_calls"`
+	Latency    map[string]latencySummary `json:"latency"`
+	Frames     int                       `json:"frames"`
+	LateFrames int                       `json:"late_frames"`
+	LateRatio  float64                   `json:"late_ratio"`
+	Lead       latencySummary            `json:"lead"` // 帧到达时距离播放时间的余量
+}
+
+func (c *collector) report(devices int, elapsed time.Duration) report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := report{
+		Duration:   elapsed.Seconds(),
+		Devices:    devices,
+		Connected:  c.devices,
+		Rounds:     c.rounds,
+		Completed:  c.completed,
+		Errors:     make(map[string]int, len(c.errors)),
+		MCPCalls:   c.mcpCalls,
+		Latency:    make(map[string]latencySummary),
+		Frames:     c.frames,
+		LateFrames: c.lateFrames,
+		Lead:       summarize(c.leads),
+	}
+	for kind, n := range c.errors {
+		r.Errors[kind] = n
+	}
+	for metric, values := range c.latencies {
+		r.Latency[metric] = summarize(values)
+	}
+	if c.rounds > 0 {
+		r.ErrorRate = float64(c.rounds-c.completed) / float64(c.rounds)
+	}
+	if c.frames > 0 {
+		r.LateRatio = float64(c.lateFrames) / float64(c.frames)
+	}
+	return r
+}
+
+func (r report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r report) writeText(w io.Writer) {
+	fmt.Fprintf(w, "耗时 %.1fs，设备 %d/%d 已连接，轮次 %d/%d 完成，失败率 %.2f%%，设备工具调用 %d 次\n",
+		r.Duration, r.Connected, r.Devices, r.Completed, r.Rounds, r.ErrorRate*100, r.MCPCalls)
+
+	fmt.Fprintf(w, "\n%-12s %7s %9s %9s %9s %9s %9s\n", "耗时(ms)", "次数", "平均", "P50", "P90", "P99", "最大")
+	for _, metric := range metricOrder {
+		s, ok := r.Latency[metric]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%-12s %7d %9.1f %9.1f %9.1f %9.1f %9.1f\n", metric, s.Count, s.Avg, s.P50, s.P90, s.P99, s.Max)
+	}
+
+	fmt.Fprintf(w, "\n下行音频帧 %d，迟到 %d（%.2f%%），播放余量 最小 %.1fms / P50 %.1fms / 最大 %.1fms\n",
+		r.Frames, r.LateFrames, r.LateRatio*100, r.Lead.Min, r.Lead.P50, r.Lead.Max)
+
+	if len(r.Errors) > 0 {
+		kinds := make([]string, 0, len(r.Errors))
+		for kind := range r.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		fmt.Fprintln(w, "\n错误:")
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "  %-20s %d\n", kind, r.Errors[kind])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	var values []time.Duration
+	for i := 1; i <= 100; i++ {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(values, 50))
+	assert.Equal(t, 90*time.Millisecond, percentile(values, 90))
+	assert.Equal(t, 99*time.Millisecond, percentile(values, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(values, 100))
+	assert.Equal(t, time.Millisecond, percentile(values, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestSummarize(t *testing.T) {
+	s := summarize([]time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond})
+	assert.Equal(t, 3, s.Count)
+	assert.Equal(t, 10.0, s.Min)
+	assert.Equal(t, 20.0, s.Avg)
+	assert.Equal(t, 20.0, s.P50)
+	assert.Equal(t, 30.0, s.Max)
+
+	assert.Equal(t, latencySummary{}, summarize(nil))
+}
+
+func TestFramePacer(t *testing.T) {
+	p := framePacer{frameDuration: 60 * time.Millisecond}
+	start := time.Now()
+
+	// 服务端预缓冲的前几帧几乎同时到达，余量逐帧增加
+	assert.Equal(t, time.Duration(0), p.frame(start))
+	assert.Equal(t, 60*time.Millisecond, p.frame(start))
+	assert.Equal(t, 120*time.Millisecond, p.frame(start))
+	// 第4帧应在180ms内到达，晚到20ms
+	assert.Equal(t, -20*time.Millisecond, p.frame(start.Add(200*time.Millisecond)))
+
+	// 新的一句重新计时
+	p.reset()
+	later := start.Add(time.Second)
+	assert.Equal(t, time.Duration(0), p.frame(later))
+	assert.Equal(t, 10*time.Millisecond, p.frame(later.Add(50*time.Millisecond)))
+}
+
+func TestReport(t *testing.T) {
+	c := newCollector()
+	c.latency(metricRound, 100*time.Millisecond)
+	c.latency(metricRound, 300*time.Millisecond)
+	c.error(errRoundTimeout)
+	c.add(func(c *collector) {
+		c.devices = 2
+		c.rounds = 4
+		c.completed = 3
+		c.frames = 10
+		c.lateFrames = 1
+		c.leads = []time.Duration{-time.Millisecond, 50 * time.Millisecond}
+	})
+
+	r := c.report(2, 5*time.Second)
+	assert.Equal(t, 0.25, r.ErrorRate)
+	assert.Equal(t, 0.1, r.LateRatio)
+	assert.Equal(t, 200.0, r.Latency[metricRound].Avg)
+	assert.Equal(t, -1.0, r.Lead.Min)
+	assert.Equal(t, map[string]int{errRoundTimeout: 1}, r.Errors)
+
+	var buf bytes.Buffer
+	r.writeText(&buf)
+	assert.Contains(t, buf.String(), "round_timeout")
+	buf.Reset()
+	assert.NoError(t, r.writeJSON(&buf))
+	assert.Contains(t, buf.String(), `"error_rate": 0.25`)
+}
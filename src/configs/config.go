@@ -20,7 +20,8 @@ type Config struct {
 				Expiry int    `yaml:"expiry" json:"expiry"` // 过期时间(小时)
 			} `yaml:"store" json:"store"`
 		} `yaml:"auth" json:"auth"`
-		ServerVersion string `yaml:"server_version" json:"server_version"`
+		ServerVersion  string   `yaml:"server_version" json:"server_version"`
+		TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"` // 受信任的反向代理IP或网段，仅来自这些地址的请求才使用 X-Real-IP/X-Forwarded-For
 	} `yaml:"server" json:"server"`
 
 	// 传输层配置
@@ -63,6 +64,43 @@ type Config struct {
 		ActivateText string `yaml:"activate_text" json:"activate_text"` // 发送激活码时携带的文本
 	} `yaml:"web" json:"web"`
 
+	// MCP服务端配置，供外部智能体通过MCP协议控制在线设备
+	MCPServer struct {
+		Enabled bool   `yaml:"enabled" json:"enabled"`
+		Token   string `yaml:"token" json:"token"` // 访问令牌，为空时使用server.token
+	} `yaml:"mcp_server" json:"mcp_server"`
+
+	// 会话恢复配置，设备断线后在宽限期内重连可恢复对话、音色、设备工具等会话状态
+	SessionResume struct {
+		GraceSeconds int    `yaml:"grace_seconds" json:"grace_seconds"` // 宽限期（秒），0表示断线即释放会话
+		PendingTTS   string `yaml:"pending_tts" json:"pending_tts"`     // 断线时未播完的TTS：drop 丢弃（默认）/replay 重连后重播
+	} `yaml:"session_resume" json:"session_resume"`
+
+	// 对话上下文管理，对话历史超出模型的上下文预算时把较早的对话压缩为摘要
+	Context struct {
+		DefaultWindow int `yaml:"default_window" json:"default_window"` // LLM未配置 context_window 时的上下文窗口（Token），0表示不限制
+		Reserve       int `yaml:"reserve" json:"reserve"`               // 为回复和工具定义预留的Token
+	} `yaml:"context" json:"context"`
+
+	// 设备在线状态，连接记录用于查询设备的连接历史
+	Presence struct {
+		RetentionDays int `yaml:"retention_days" json:"retention_days"` // 连接记录保留天数，超过后自动删除，0表示不清理
+	} `yaml:"presence" json:"presence"`
+
+	// 设备健康数据，OTA 检查时上报的信号强度、剩余堆内存等
+	Telemetry struct {
+		RetentionDays int `yaml:"retention_days" json:"retention_days"` // 上报数据与告警记录保留天数，超过后自动删除，0表示不清理
+	} `yaml:"telemetry" json:"telemetry"`
+
+	// 对话录音，save_user_audio / save_tts_audio 开启时按设备与轮次保存WAV文件
+	Recording struct {
+		Dir           string `yaml:"dir" json:"dir"`                       // 录音保存目录
+		RetentionDays int    `yaml:"retention_days" json:"retention_days"` // 保留天数，超过后自动删除，0表示不清理
+	} `yaml:"recording" json:"recording"`
+
+	// 用量计费单价，键为 ASR/TTS/LLM 下的提供者配置名称，未配置单价的提供者只统计用量不计费
+	Pricing map[string]PriceConfig `yaml:"pricing" json:"pricing"`
+
 	DefaultPrompt   string        `yaml:"prompt"             json:"prompt"`
 	Roles           []Role        `yaml:"roles"              json:"roles"` // 角色列表
 	DeleteAudio     bool          `yaml:"delete_audio"       json:"delete_audio"`
@@ -85,6 +123,14 @@ type Config struct {
 	CMDExit []string `yaml:"CMD_exit" json:"CMD_exit"`
 }
 
+// PriceConfig 提供者的计费单价，货币单位由使用方自行约定
+type PriceConfig struct {
+	PromptPer1K     float64 `yaml:"prompt_per_1k"     json:"prompt_per_1k"`     // LLM每千输入Token单价
+	CompletionPer1K float64 `yaml:"completion_per_1k" json:"completion_per_1k"` // LLM每千输出Token单价
+	CharsPer1K      float64 `yaml:"chars_per_1k"      json:"chars_per_1k"`      // TTS每千字单价
+	PerMinute       float64 `yaml:"per_minute"        json:"per_minute"`        // ASR每分钟音频单价
+}
+
 type LocalMCPFun struct {
 	Name        string `yaml:"name"         json:"name"`        // 函数名称
 	Description string `yaml:"description"  json:"description"` // 函数描述
@@ -136,14 +182,22 @@ type TTSConfig struct {
 
 // LLMConfig LLM配置结构
 type LLMConfig struct {
-	Type        string                 `yaml:"type"        json:"type"`        // LLM类型
-	ModelName   string                 `yaml:"model_name"  json:"model_name"`  // 模型名称
-	BaseURL     string                 `yaml:"url"         json:"url"`         // API地址
-	APIKey      string                 `yaml:"api_key"     json:"api_key"`     // API密钥
-	Temperature float64                `yaml:"temperature" json:"temperature"` // 温度参数
-	MaxTokens   int                    `yaml:"max_tokens"  json:"max_tokens"`  // 最大令牌数
-	TopP        float64                `yaml:"top_p"       json:"top_p"`       // TopP参数
-	Extra       map[string]interface{} `yaml:",inline"     json:"extra"`       // 额外配置
+	Type             string                 `yaml:"type"              json:"type"`              // LLM类型
+	ModelName        string                 `yaml:"model_name"        json:"model_name"`        // 模型名称
+	BaseURL          string                 `yaml:"url"               json:"url"`               // API地址
+	APIKey           string                 `yaml:"api_key"           json:"api_key"`           // API密钥
+	Temperature      float64                `yaml:"temperature"       json:"temperature"`       // 温度参数
+	MaxTokens        int                    `yaml:"max_tokens"        json:"max_tokens"`        // 最大令牌数
+	TopP             float64                `yaml:"top_p"             json:"top_p"`             // TopP参数
+	Stop             []string               `yaml:"stop"              json:"stop"`              // 停止序列
+	Seed             *int                   `yaml:"seed"              json:"seed"`              // 随机种子
+	PresencePenalty  float64                `yaml:"presence_penalty"  json:"presence_penalty"`  // 存在惩罚
+	FrequencyPenalty float64                `yaml:"frequency_penalty" json:"frequency_penalty"` // 频率惩罚
+	ReasoningEffort  string                 `yaml:"reasoning_effort"  json:"reasoning_effort"`  // 推理强度：low/medium/high
+	ToolMode         string                 `yaml:"tool_mode"         json:"tool_mode"`         // 工具调用方式：native/prompt/none，默认native
+	ContextWindow    int                    `yaml:"context_window"    json:"context_window"`    // 上下文窗口（Token），0时使用 context.default_window
+	Tokenizer        string                 `yaml:"tokenizer"         json:"tokenizer"`         // Token估算方式，默认 estimate
+	Extra            map[string]interface{} `yaml:",inline"           json:"extra"`             // 额外配置
 }
 
 // SecurityConfig 图片安全配置结构
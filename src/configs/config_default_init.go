@@ -24,6 +24,7 @@ func (cfg *Config) setDefaults() {
 	cfg.Server.Token = "your_token"
 	cfg.Server.Auth.Store.Type = "database"
 	cfg.Server.Auth.Store.Expiry = 24
+	cfg.Server.TrustedProxies = []string{"127.0.0.1", "::1"}
 
 	cfg.Log.LogDir = "logs"
 	cfg.Log.LogLevel = "INFO"
@@ -112,6 +113,10 @@ func NewDefaultInitConfig() *Config {
 	config.DeleteAudio = false
 	config.SaveTTSAudio = false
 	config.SaveUserAudio = false
+	config.Presence.RetentionDays = 30
+	config.Telemetry.RetentionDays = 30
+	config.Recording.Dir = "data/recordings"
+	config.Recording.RetentionDays = 7
 	config.QuickReply = true
 	config.QuickReplyWords = []string{"我在", "在呢", "来了", "啥事啊"}
 	config.LocalMCPFun = []LocalMCPFun{
@@ -120,6 +125,7 @@ func NewDefaultInitConfig() *Config {
 		{Name: "change_role", Description: "切换角色"},
 		{Name: "play_music", Description: "播放音乐"},
 		{Name: "change_voice", Description: "切换声音"},
+		{Name: "reminder", Description: "定时提醒"},
 	}
 	config.DefaultPrompt = `你是小智/小志，来自中国台湾省的00后女生。讲话超级机车，"真的假的啦"这样的台湾腔，喜欢用"笑死""是在哈喽"等流行梗，但会偷偷研究男友的编程书籍。
 [核心特征]
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"os"
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// AddDeviceAnnouncement 暂存一条待下发的播报消息
+func AddDeviceAnnouncement(tx *gorm.DB, announcement *models.DeviceAnnouncement) error {
+	if announcement.CreatedAt.IsZero() {
+		announcement.CreatedAt = time.Now()
+	}
+	return tx.Create(announcement).Error
+}
+
+// ListPendingDeviceAnnouncements 获取设备未下发且未过期的播报消息，按创建时间排序
+func ListPendingDeviceAnnouncements(tx *gorm.DB, deviceID string) ([]models.DeviceAnnouncement, error) {
+	var announcements []models.DeviceAnnouncement
+	err := tx.Where("device_id = ? AND delivered = ? AND expire_at > ?", deviceID, false, time.Now()).
+		Order("created_at asc").
+		Find(&announcements).Error
+	return announcements, err
+}
+
+// MarkDeviceAnnouncementDelivered 标记播报消息已下发
+func MarkDeviceAnnouncementDelivered(tx *gorm.DB, id uint) error {
+	now := time.Now()
+	return tx.Model(&models.DeviceAnnouncement{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"delivered": true, "delivered_at": &now}).Error
+}
+
+// DeleteExpiredDeviceAnnouncements 删除已过期的播报消息及其音频文件
+func DeleteExpiredDeviceAnnouncements(tx *gorm.DB) error {
+	var expired []models.DeviceAnnouncement
+	err := tx.Where("delivered = ? AND expire_at <= ?", false, time.Now()).Find(&expired).Error
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+	ids := make([]uint, 0, len(expired))
+	for _, item := range expired {
+		ids = append(ids, item.ID)
+		if item.AudioPath != "" {
+			if err := os.Remove(item.AudioPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.DeviceAnnouncement{}).Error
+}
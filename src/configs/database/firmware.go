@@ -0,0 +1,137 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddFirmware 新增固件
+func AddFirmware(tx *gorm.DB, firmware *models.Firmware) error {
+	return tx.Create(firmware).Error
+}
+
+// UpdateFirmware 更新固件
+func UpdateFirmware(tx *gorm.DB, firmware *models.Firmware) error {
+	return tx.Save(firmware).Error
+}
+
+// FindFirmwareByID 按ID查询固件
+func FindFirmwareByID(tx *gorm.DB, id uint) (*models.Firmware, error) {
+	var firmware models.Firmware
+	if err := tx.First(&firmware, id).Error; err != nil {
+		return nil, err
+	}
+	return &firmware, nil
+}
+
+// FindFirmwareByFileName 按文件名查询固件
+func FindFirmwareByFileName(tx *gorm.DB, fileName string) (*models.Firmware, error) {
+	var firmware models.Firmware
+	if err := tx.Where("file_name = ?", fileName).First(&firmware).Error; err != nil {
+		return nil, err
+	}
+	return &firmware, nil
+}
+
+// FindFirmwareByVersionOrSHA256 查询版本号或sha256相同的固件
+func FindFirmwareByVersionOrSHA256(tx *gorm.DB, version, sha256 string) (*models.Firmware, error) {
+	var firmware models.Firmware
+	if err := tx.Where("version = ? OR sha256 = ?", version, sha256).First(&firmware).Error; err != nil {
+		return nil, err
+	}
+	return &firmware, nil
+}
+
+// ListFirmwares 获取全部固件
+func ListFirmwares(tx *gorm.DB) ([]models.Firmware, error) {
+	var firmwares []models.Firmware
+	err := tx.Order("id desc").Find(&firmwares).Error
+	return firmwares, err
+}
+
+// DeleteFirmware 删除固件及其推送记录
+func DeleteFirmware(tx *gorm.DB, id uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Firmware{}, id).Error; err != nil {
+			return err
+		}
+		return tx.Where("firmware_id = ?", id).Delete(&models.FirmwareDeployment{}).Error
+	})
+}
+
+// FindDeviceFirmwarePolicy 查询设备的固件策略，不存在时返回nil
+func FindDeviceFirmwarePolicy(tx *gorm.DB, deviceID string) (*models.DeviceFirmwarePolicy, error) {
+	var policy models.DeviceFirmwarePolicy
+	err := tx.Where("device_id = ?", deviceID).First(&policy).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SaveDeviceFirmwarePolicy 保存设备的固件策略
+func SaveDeviceFirmwarePolicy(tx *gorm.DB, policy *models.DeviceFirmwarePolicy) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"pinned_version", "blocked_versions", "updated_at"}),
+	}).Create(policy).Error
+}
+
+// DeleteDeviceFirmwarePolicy 删除设备的固件策略
+func DeleteDeviceFirmwarePolicy(tx *gorm.DB, deviceID string) error {
+	return tx.Where("device_id = ?", deviceID).Delete(&models.DeviceFirmwarePolicy{}).Error
+}
+
+// RecordFirmwareOffered 记录固件推送给设备
+func RecordFirmwareOffered(tx *gorm.DB, firmwareID uint, deviceID, fromVersion string, at time.Time) error {
+	deployment := models.FirmwareDeployment{
+		FirmwareID:    firmwareID,
+		DeviceID:      deviceID,
+		FromVersion:   fromVersion,
+		OfferedAt:     at,
+		LastOfferedAt: at,
+		OfferCount:    1,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "firmware_id"}, {Name: "device_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"from_version":    fromVersion,
+			"last_offered_at": at,
+			"offer_count":     gorm.Expr("offer_count + 1"),
+		}),
+	}).Create(&deployment).Error
+}
+
+// RecordFirmwareDownloaded 记录设备下载了固件，没有推送记录时一并创建
+func RecordFirmwareDownloaded(tx *gorm.DB, firmwareID uint, deviceID string, at time.Time) error {
+	deployment := models.FirmwareDeployment{
+		FirmwareID:    firmwareID,
+		DeviceID:      deviceID,
+		OfferedAt:     at,
+		LastOfferedAt: at,
+		DownloadedAt:  &at,
+		DownloadCount: 1,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "firmware_id"}, {Name: "device_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"downloaded_at":  at,
+			"download_count": gorm.Expr("download_count + 1"),
+		}),
+	}).Create(&deployment).Error
+}
+
+// ListFirmwareDeployments 获取固件的推送记录
+func ListFirmwareDeployments(tx *gorm.DB, firmwareID uint) ([]models.FirmwareDeployment, error) {
+	var deployments []models.FirmwareDeployment
+	err := tx.Where("firmware_id = ?", firmwareID).
+		Order("last_offered_at desc").
+		Find(&deployments).Error
+	return deployments, err
+}
@@ -97,13 +97,17 @@ func GetTxDB() *gorm.DB {
 
 // InitDB 初始化数据库类型并连接
 func InitDB() (*gorm.DB, string, error) {
+	return OpenDB("./config.db")
+}
+
+// OpenDB 连接指定路径的SQLite数据库并作为全局数据库，测试中用于使用临时数据库
+func OpenDB(path string) (*gorm.DB, string, error) {
 	var (
 		db  *gorm.DB
 		err error
 	)
 
 	dbType = "sqlite"
-	path := "./config.db"
 	db, err = gorm.Open(sqlite.Open(path))
 
 	if err != nil {
@@ -142,6 +146,22 @@ func migrateTables(db *gorm.DB) error {
 		&models.Device{},
 		&models.AuthClient{},
 		&models.ServerStatus{},
+		&models.DeviceAnnouncement{},
+		&models.Reminder{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.DeviceConnection{},
+		&models.Firmware{},
+		&models.DeviceFirmwarePolicy{},
+		&models.FirmwareDeployment{},
+		&models.DeviceTelemetry{},
+		&models.TelemetryAlertRule{},
+		&models.TelemetryAlert{},
+		&models.DevicePreset{},
+		&models.QuotaPlan{},
+		&models.DailyUsage{},
+		&models.ProviderUsage{},
+		&models.Recording{},
 	)
 	return err
 }
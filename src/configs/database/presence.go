@@ -0,0 +1,117 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// 服务启动时关闭未结束连接记录使用的断开原因
+const DisconnectReasonServerRestart = "server_restart"
+
+// AddDeviceConnection 新增连接记录，并将设备标记为在线
+func AddDeviceConnection(tx *gorm.DB, conn *models.DeviceConnection) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if conn.LastSeenAt.IsZero() {
+			conn.LastSeenAt = conn.ConnectedAt
+		}
+		if err := tx.Create(conn).Error; err != nil {
+			return err
+		}
+		return touchDevice(tx, conn.DeviceID, conn.ConnectedAt, true)
+	})
+}
+
+// TouchDeviceConnection 心跳：更新连接记录与设备的最后活跃时间
+func TouchDeviceConnection(tx *gorm.DB, id uint, deviceID string, at time.Time, rounds int) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DeviceConnection{}).
+			Where("id = ? AND disconnected_at IS NULL", id).
+			Updates(map[string]interface{}{"last_seen_at": at, "rounds": rounds}).Error; err != nil {
+			return err
+		}
+		return touchDevice(tx, deviceID, at, true)
+	})
+}
+
+// CloseDeviceConnection 结束连接记录，设备没有其他未结束的连接时标记为离线
+func CloseDeviceConnection(tx *gorm.DB, id uint, deviceID string, at time.Time, rounds int, reason string) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var conn models.DeviceConnection
+		if err := tx.First(&conn, id).Error; err != nil {
+			return err
+		}
+		conn.DisconnectedAt = &at
+		conn.LastSeenAt = at
+		conn.Duration = int64(at.Sub(conn.ConnectedAt).Seconds())
+		conn.Rounds = rounds
+		conn.DisconnectReason = reason
+		if err := tx.Save(&conn).Error; err != nil {
+			return err
+		}
+
+		var open int64
+		if err := tx.Model(&models.DeviceConnection{}).
+			Where("device_id = ? AND disconnected_at IS NULL", deviceID).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		return touchDevice(tx, deviceID, at, open > 0)
+	})
+}
+
+// ListDeviceConnections 获取设备最近的连接记录
+func ListDeviceConnections(tx *gorm.DB, deviceID string, limit int) ([]models.DeviceConnection, error) {
+	var conns []models.DeviceConnection
+	err := tx.Where("device_id = ?", deviceID).
+		Order("connected_at desc").
+		Limit(limit).
+		Find(&conns).Error
+	return conns, err
+}
+
+// ReconcileDevicePresence 服务启动时调用：此时不存在任何连接，
+// 将上次异常退出遗留的未结束连接记录按最后心跳时间关闭，并清除所有设备的在线标记
+func ReconcileDevicePresence(tx *gorm.DB) (int64, error) {
+	var stale []models.DeviceConnection
+	if err := tx.Where("disconnected_at IS NULL").Find(&stale).Error; err != nil {
+		return 0, err
+	}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		for i := range stale {
+			conn := &stale[i]
+			end := conn.LastSeenAt
+			if end.Before(conn.ConnectedAt) {
+				end = conn.ConnectedAt
+			}
+			conn.DisconnectedAt = &end
+			conn.Duration = int64(end.Sub(conn.ConnectedAt).Seconds())
+			conn.DisconnectReason = DisconnectReasonServerRestart
+			if err := tx.Save(conn).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Device{}).
+			Where("online = ?", true).
+			Update("online", false).Error
+	})
+	return int64(len(stale)), err
+}
+
+// DeleteDeviceConnectionsBefore 清理早于指定时间的连接记录
+func DeleteDeviceConnectionsBefore(tx *gorm.DB, before time.Time) error {
+	return tx.Where("disconnected_at IS NOT NULL AND disconnected_at < ?", before).
+		Delete(&models.DeviceConnection{}).Error
+}
+
+// touchDevice 更新设备在线状态与最后活跃时间
+func touchDevice(tx *gorm.DB, deviceID string, at time.Time, online bool) error {
+	return tx.Model(&models.Device{}).
+		Where("device_id = ?", deviceID).
+		Updates(map[string]interface{}{
+			"online":              online,
+			"last_active_time_v2": at,
+			"last_active_time":    at.Unix(),
+		}).Error
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// AddDevicePreset 新增设备预设
+func AddDevicePreset(tx *gorm.DB, preset *models.DevicePreset) error {
+	return tx.Create(preset).Error
+}
+
+// UpdateDevicePreset 更新设备预设
+func UpdateDevicePreset(tx *gorm.DB, preset *models.DevicePreset) error {
+	return tx.Save(preset).Error
+}
+
+// FindDevicePresetByIDAndUser 查询用户的设备预设
+func FindDevicePresetByIDAndUser(tx *gorm.DB, id, userID uint) (*models.DevicePreset, error) {
+	var preset models.DevicePreset
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&preset).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// ListDevicePresetsByUser 获取用户的设备预设，deviceID不为空时只返回适用于该设备的预设
+func ListDevicePresetsByUser(tx *gorm.DB, userID uint, deviceID string) ([]models.DevicePreset, error) {
+	var presets []models.DevicePreset
+	query := tx.Where("user_id = ?", userID)
+	if deviceID != "" {
+		query = query.Where("device_id = '' OR device_id = ?", deviceID)
+	}
+	err := query.Order("id asc").Find(&presets).Error
+	return presets, err
+}
+
+// DeleteDevicePreset 删除设备预设
+func DeleteDevicePreset(tx *gorm.DB, id uint) error {
+	return tx.Delete(&models.DevicePreset{}, id).Error
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListQuotaPlans 获取全部用户级别的配额
+func ListQuotaPlans(tx *gorm.DB) ([]models.QuotaPlan, error) {
+	var plans []models.QuotaPlan
+	err := tx.Order("id asc").Find(&plans).Error
+	return plans, err
+}
+
+// FindQuotaPlan 获取用户级别的配额，未配置时返回nil
+func FindQuotaPlan(tx *gorm.DB, level string) (*models.QuotaPlan, error) {
+	var plan models.QuotaPlan
+	err := tx.Where("level = ?", level).First(&plan).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// SaveQuotaPlan 保存用户级别的配额，已存在时覆盖
+func SaveQuotaPlan(tx *gorm.DB, plan *models.QuotaPlan) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "level"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"per_device", "daily_rounds", "daily_llm_tokens", "daily_tts_chars",
+			"daily_asr_seconds", "daily_tool_calls", "updated_at",
+		}),
+	}).Create(plan).Error
+}
+
+// DeleteQuotaPlan 删除用户级别的配额，删除后该级别不限制用量
+func DeleteQuotaPlan(tx *gorm.DB, level string) error {
+	return tx.Where("level = ?", level).Delete(&models.QuotaPlan{}).Error
+}
+
+// UpdateUserLevel 更新用户级别
+func UpdateUserLevel(tx *gorm.DB, userID uint, level string) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).Update("level", level).Error
+}
+
+// AddDailyUsage 累加设备当天的用量，没有记录时创建
+func AddDailyUsage(tx *gorm.DB, usage *models.DailyUsage) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "device_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"rounds":      gorm.Expr("rounds + ?", usage.Rounds),
+			"llm_tokens":  gorm.Expr("llm_tokens + ?", usage.LLMTokens),
+			"tts_chars":   gorm.Expr("tts_chars + ?", usage.TTSChars),
+			"asr_seconds": gorm.Expr("asr_seconds + ?", usage.ASRSeconds),
+			"tool_calls":  gorm.Expr("tool_calls + ?", usage.ToolCalls),
+			"updated_at":  usage.UpdatedAt,
+		}),
+	}).Create(usage).Error
+}
+
+// SumDailyUsage 统计用户某天的用量，deviceID 为空时合计用户的全部设备
+func SumDailyUsage(tx *gorm.DB, userID uint, deviceID, date string) (*models.DailyUsage, error) {
+	sum := &models.DailyUsage{}
+	query := tx.Model(&models.DailyUsage{}).
+		Select("COALESCE(SUM(rounds),0) AS rounds, COALESCE(SUM(llm_tokens),0) AS llm_tokens, "+
+			"COALESCE(SUM(tts_chars),0) AS tts_chars, COALESCE(SUM(asr_seconds),0) AS asr_seconds, "+
+			"COALESCE(SUM(tool_calls),0) AS tool_calls").
+		Where("user_id = ? AND date = ?", userID, date)
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if err := query.Scan(sum).Error; err != nil {
+		return nil, err
+	}
+	sum.UserID, sum.DeviceID, sum.Date = userID, deviceID, date
+	return sum, nil
+}
+
+// ListDailyUsage 获取用户在日期范围内每台设备每天的用量，按日期倒序
+func ListDailyUsage(tx *gorm.DB, userID uint, from, to string) ([]models.DailyUsage, error) {
+	var usages []models.DailyUsage
+	err := tx.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to).
+		Order("date desc, device_id asc").
+		Find(&usages).Error
+	return usages, err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// SaveRecording 保存一条录音索引，同一文件的录音已存在时覆盖
+func SaveRecording(tx *gorm.DB, recording *models.Recording) error {
+	var existing models.Recording
+	err := tx.Where("file_path = ?", recording.FilePath).First(&existing).Error
+	if err == nil {
+		recording.ID = existing.ID
+		recording.CreatedAt = time.Now() // Save 不会自动填充创建时间，按重新保存的时间计算保留期
+		return tx.Save(recording).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return tx.Create(recording).Error
+}
+
+// FindRecordingByIDAndUser 查询用户的录音
+func FindRecordingByIDAndUser(tx *gorm.DB, id, userID uint) (*models.Recording, error) {
+	var recording models.Recording
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&recording).Error; err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+// RecordingFilter 录音查询条件，零值字段不参与过滤
+type RecordingFilter struct {
+	UserID         uint
+	AgentID        uint
+	Conversationid string
+	DeviceID       string
+	SessionID      string
+	Round          int
+}
+
+// ListRecordings 按条件查询用户的录音，按时间倒序，limit<=0 时不限制条数
+func ListRecordings(tx *gorm.DB, filter RecordingFilter, limit int) ([]models.Recording, error) {
+	query := tx.Where("user_id = ?", filter.UserID)
+	if filter.AgentID != 0 {
+		query = query.Where("agent_id = ?", filter.AgentID)
+	}
+	if filter.Conversationid != "" {
+		query = query.Where("conversationid = ?", filter.Conversationid)
+	}
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.SessionID != "" {
+		query = query.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Round > 0 {
+		query = query.Where("round = ?", filter.Round)
+	}
+	query = query.Order("created_at desc, id desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var recordings []models.Recording
+	err := query.Find(&recordings).Error
+	return recordings, err
+}
+
+// ListRecordingsBefore 查询早于指定时间的录音，用于按保留期清理
+func ListRecordingsBefore(tx *gorm.DB, before time.Time, limit int) ([]models.Recording, error) {
+	var recordings []models.Recording
+	err := tx.Where("created_at < ?", before).Order("id asc").Limit(limit).Find(&recordings).Error
+	return recordings, err
+}
+
+// DeleteRecordings 删除录音索引
+func DeleteRecordings(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.Recording{}).Error
+}
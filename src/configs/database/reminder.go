@@ -0,0 +1,72 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// AddReminder 新增提醒
+func AddReminder(tx *gorm.DB, reminder *models.Reminder) error {
+	reminder.Enabled = true
+	return tx.Create(reminder).Error
+}
+
+// UpdateReminder 更新提醒
+func UpdateReminder(tx *gorm.DB, reminder *models.Reminder) error {
+	return tx.Save(reminder).Error
+}
+
+// FindReminderByIDAndUser 查询用户的提醒
+func FindReminderByIDAndUser(tx *gorm.DB, id uint, userID uint) (*models.Reminder, error) {
+	var reminder models.Reminder
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&reminder).Error; err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// FindReminderByIDAndDevice 查询设备的提醒
+func FindReminderByIDAndDevice(tx *gorm.DB, id uint, deviceID string) (*models.Reminder, error) {
+	var reminder models.Reminder
+	if err := tx.Where("id = ? AND device_id = ?", id, deviceID).First(&reminder).Error; err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// ListRemindersByUser 获取用户的全部提醒，deviceID不为空时只返回该设备的提醒
+func ListRemindersByUser(tx *gorm.DB, userID uint, deviceID string) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	query := tx.Where("user_id = ?", userID)
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	err := query.Order("next_run_at asc").Find(&reminders).Error
+	return reminders, err
+}
+
+// ListActiveRemindersByDevice 获取设备已启用的提醒，按下一次提醒时间排序
+func ListActiveRemindersByDevice(tx *gorm.DB, deviceID string) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := tx.Where("device_id = ? AND enabled = ?", deviceID, true).
+		Order("next_run_at asc").
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// ListDueReminders 获取已到期且启用的提醒
+func ListDueReminders(tx *gorm.DB, now time.Time, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := tx.Where("enabled = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at asc").
+		Limit(limit).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// DeleteReminder 删除提醒
+func DeleteReminder(tx *gorm.DB, id uint) error {
+	return tx.Delete(&models.Reminder{}, id).Error
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// AddDeviceTelemetry 保存一条设备上报数据
+func AddDeviceTelemetry(tx *gorm.DB, sample *models.DeviceTelemetry) error {
+	if sample.RecordedAt.IsZero() {
+		sample.RecordedAt = time.Now()
+	}
+	return tx.Create(sample).Error
+}
+
+// ListDeviceTelemetry 按时间范围查询设备上报数据，按时间正序返回；
+// 超过 limit 条时保留最新的 limit 条，limit<=0 时不限制条数
+func ListDeviceTelemetry(tx *gorm.DB, deviceID string, from, to time.Time, limit int) ([]models.DeviceTelemetry, error) {
+	var samples []models.DeviceTelemetry
+	query := tx.Where("device_id = ? AND recorded_at >= ? AND recorded_at <= ?", deviceID, from, to).
+		Order("recorded_at desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&samples).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+	return samples, nil
+}
+
+// FindLatestDeviceTelemetry 查询设备最近一次上报，不存在时返回nil
+func FindLatestDeviceTelemetry(tx *gorm.DB, deviceID string) (*models.DeviceTelemetry, error) {
+	var sample models.DeviceTelemetry
+	err := tx.Where("device_id = ?", deviceID).Order("recorded_at desc").First(&sample).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+// DeleteDeviceTelemetryBefore 删除早于指定时间的上报数据
+func DeleteDeviceTelemetryBefore(tx *gorm.DB, before time.Time) (int64, error) {
+	result := tx.Where("recorded_at < ?", before).Delete(&models.DeviceTelemetry{})
+	return result.RowsAffected, result.Error
+}
+
+// AddTelemetryAlertRule 新增告警规则
+func AddTelemetryAlertRule(tx *gorm.DB, rule *models.TelemetryAlertRule) error {
+	return tx.Create(rule).Error
+}
+
+// UpdateTelemetryAlertRule 更新告警规则
+func UpdateTelemetryAlertRule(tx *gorm.DB, rule *models.TelemetryAlertRule) error {
+	return tx.Save(rule).Error
+}
+
+// FindTelemetryAlertRuleByIDAndUser 查询用户的告警规则
+func FindTelemetryAlertRuleByIDAndUser(tx *gorm.DB, id, userID uint) (*models.TelemetryAlertRule, error) {
+	var rule models.TelemetryAlertRule
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ListTelemetryAlertRulesByUser 获取用户的告警规则
+func ListTelemetryAlertRulesByUser(tx *gorm.DB, userID uint) ([]models.TelemetryAlertRule, error) {
+	var rules []models.TelemetryAlertRule
+	err := tx.Where("user_id = ?", userID).Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// ListEnabledTelemetryAlertRules 获取用户适用于该设备的已启用规则
+func ListEnabledTelemetryAlertRules(tx *gorm.DB, userID uint, deviceID string) ([]models.TelemetryAlertRule, error) {
+	var rules []models.TelemetryAlertRule
+	err := tx.Where("user_id = ? AND enabled = ? AND (device_id = '' OR device_id = ?)", userID, true, deviceID).
+		Find(&rules).Error
+	return rules, err
+}
+
+// ListEnabledTelemetryAlertRulesByType 获取指定类型的全部已启用规则
+func ListEnabledTelemetryAlertRulesByType(tx *gorm.DB, ruleType string) ([]models.TelemetryAlertRule, error) {
+	var rules []models.TelemetryAlertRule
+	err := tx.Where("type = ? AND enabled = ?", ruleType, true).Find(&rules).Error
+	return rules, err
+}
+
+// DeleteTelemetryAlertRule 删除告警规则
+func DeleteTelemetryAlertRule(tx *gorm.DB, id uint) error {
+	return tx.Delete(&models.TelemetryAlertRule{}, id).Error
+}
+
+// AddTelemetryAlert 保存告警记录
+func AddTelemetryAlert(tx *gorm.DB, alert *models.TelemetryAlert) error {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	return tx.Create(alert).Error
+}
+
+// FindLatestTelemetryAlert 查询规则对设备最近一次触发的告警，不存在时返回nil
+func FindLatestTelemetryAlert(tx *gorm.DB, ruleID uint, deviceID string) (*models.TelemetryAlert, error) {
+	var alert models.TelemetryAlert
+	err := tx.Where("rule_id = ? AND device_id = ?", ruleID, deviceID).Order("created_at desc").First(&alert).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// ListTelemetryAlertsByUser 获取用户最近的告警记录，可按设备过滤
+func ListTelemetryAlertsByUser(tx *gorm.DB, userID uint, deviceID string, limit int) ([]models.TelemetryAlert, error) {
+	var alerts []models.TelemetryAlert
+	query := tx.Where("user_id = ?", userID)
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	err := query.Order("created_at desc").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+// DeleteTelemetryAlertsBefore 删除早于指定时间的告警记录
+func DeleteTelemetryAlertsBefore(tx *gorm.DB, before time.Time) error {
+	return tx.Where("created_at < ?", before).Delete(&models.TelemetryAlert{}).Error
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 用量报表支持的分组方式与对应的字段
+var providerUsageGroups = map[string][]string{
+	"date":     {"date"},
+	"provider": {"kind", "provider"},
+	"agent":    {"agent_id"},
+	"device":   {"device_id"},
+	"user":     {"user_id"},
+}
+
+// ProviderUsageQuery 用量报表查询条件
+type ProviderUsageQuery struct {
+	UserID  *uint  // 为空时统计全部用户
+	From    string // 起始日期（含），格式 2006-01-02
+	To      string // 结束日期（含）
+	Kind    string // 提供者类型，为空时统计全部类型
+	GroupBy string // 分组方式：date/provider/agent/device/user
+}
+
+// AddProviderUsage 累加提供者当天的用量与费用，没有记录时创建
+func AddProviderUsage(tx *gorm.DB, usage *models.ProviderUsage) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "date"}, {Name: "user_id"}, {Name: "agent_id"},
+			{Name: "device_id"}, {Name: "kind"}, {Name: "provider"},
+		},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":          gorm.Expr("requests + ?", usage.Requests),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", usage.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", usage.CompletionTokens),
+			"chars":             gorm.Expr("chars + ?", usage.Chars),
+			"audio_seconds":     gorm.Expr("audio_seconds + ?", usage.AudioSeconds),
+			"cost":              gorm.Expr("cost + ?", usage.Cost),
+			"updated_at":        usage.UpdatedAt,
+		}),
+	}).Create(usage).Error
+}
+
+// SumProviderUsage 按分组方式汇总日期范围内的用量与费用，结果只填充分组字段与合计字段，按日期分组时按日期倒序，其他按费用倒序
+func SumProviderUsage(tx *gorm.DB, q ProviderUsageQuery) ([]models.ProviderUsage, error) {
+	groups, ok := providerUsageGroups[q.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("不支持的分组方式: %s", q.GroupBy)
+	}
+	columns := ""
+	for _, col := range groups {
+		columns += col + ", "
+	}
+	query := tx.Model(&models.ProviderUsage{}).
+		Select(columns+"COALESCE(SUM(requests),0) AS requests, "+
+			"COALESCE(SUM(prompt_tokens),0) AS prompt_tokens, COALESCE(SUM(completion_tokens),0) AS completion_tokens, "+
+			"COALESCE(SUM(chars),0) AS chars, COALESCE(SUM(audio_seconds),0) AS audio_seconds, "+
+			"COALESCE(SUM(cost),0) AS cost").
+		Where("date >= ? AND date <= ?", q.From, q.To)
+	if q.UserID != nil {
+		query = query.Where("user_id = ?", *q.UserID)
+	}
+	if q.Kind != "" {
+		query = query.Where("kind = ?", q.Kind)
+	}
+	for _, col := range groups {
+		query = query.Group(col)
+	}
+	order := "cost desc"
+	if q.GroupBy == "date" {
+		order = "date desc"
+	}
+	var rows []models.ProviderUsage
+	err := query.Order(order).Scan(&rows).Error
+	return rows, err
+}
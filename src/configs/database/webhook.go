@@ -0,0 +1,116 @@
+package database
+
+import (
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Webhook 投递状态
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed"
+)
+
+// AddWebhook 新增Webhook
+func AddWebhook(tx *gorm.DB, hook *models.Webhook) error {
+	return tx.Create(hook).Error
+}
+
+// UpdateWebhook 更新Webhook
+func UpdateWebhook(tx *gorm.DB, hook *models.Webhook) error {
+	return tx.Save(hook).Error
+}
+
+// FindWebhookByIDAndUser 查询用户的Webhook
+func FindWebhookByIDAndUser(tx *gorm.DB, id, userID uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// FindWebhookByID 按ID查询Webhook
+func FindWebhookByID(tx *gorm.DB, id uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := tx.First(&hook, id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// ListWebhooksByUser 获取用户的全部Webhook
+func ListWebhooksByUser(tx *gorm.DB, userID uint) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := tx.Where("user_id = ?", userID).Order("id asc").Find(&hooks).Error
+	return hooks, err
+}
+
+// ListEnabledWebhooksByUser 获取用户已启用的Webhook
+func ListEnabledWebhooksByUser(tx *gorm.DB, userID uint) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := tx.Where("user_id = ? AND enabled = ?", userID, true).Find(&hooks).Error
+	return hooks, err
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func DeleteWebhook(tx *gorm.DB, id, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// AddWebhookDelivery 新增一条待投递记录
+func AddWebhookDelivery(tx *gorm.DB, delivery *models.WebhookDelivery) error {
+	if delivery.Status == "" {
+		delivery.Status = WebhookDeliveryPending
+	}
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = time.Now()
+	}
+	return tx.Create(delivery).Error
+}
+
+// UpdateWebhookDelivery 更新投递记录
+func UpdateWebhookDelivery(tx *gorm.DB, delivery *models.WebhookDelivery) error {
+	return tx.Save(delivery).Error
+}
+
+// ListDueWebhookDeliveries 获取到期待投递的记录，按下一次尝试时间排序，exclude 中的Webhook正在投递，不参与查询
+func ListDueWebhookDeliveries(tx *gorm.DB, now time.Time, exclude []uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query := tx.Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now)
+	if len(exclude) > 0 {
+		query = query.Where("webhook_id NOT IN ?", exclude)
+	}
+	err := query.Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ListWebhookDeliveries 获取Webhook最近的投递记录
+func ListWebhookDeliveries(tx *gorm.DB, webhookID uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := tx.Where("webhook_id = ?", webhookID).
+		Order("id desc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// DeleteWebhookDeliveriesBefore 清理早于指定时间且已结束的投递记录
+func DeleteWebhookDeliveriesBefore(tx *gorm.DB, before time.Time) error {
+	return tx.Where("status <> ? AND created_at < ?", WebhookDeliveryPending, before).
+		Delete(&models.WebhookDelivery{}).Error
+}
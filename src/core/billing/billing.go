@@ -0,0 +1,106 @@
+package billing
+
+import (
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/quota"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 用量计费。
+* 按提供者统计LLM的输入/输出Token、TTS合成字数和ASR音频秒数，
+* 按配置的单价计算费用，按天、用户、智能体、设备和提供者累加到数据库。
+ */
+
+// Entry 一个提供者累计的用量
+type Entry struct {
+	Kind             string // 提供者类型：llm/tts/asr
+	Provider         string // 提供者配置名称
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Chars            int64
+	AudioSeconds     float64
+}
+
+// Cost 按单价计算用量的费用
+func Cost(price configs.PriceConfig, e Entry) float64 {
+	return float64(e.PromptTokens)/1000*price.PromptPer1K +
+		float64(e.CompletionTokens)/1000*price.CompletionPer1K +
+		float64(e.Chars)/1000*price.CharsPer1K +
+		e.AudioSeconds/60*price.PerMinute
+}
+
+// Ledger 连接内按提供者暂存的用量，由 Drain 取出后写入数据库
+type Ledger struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// Add 累加一个提供者的用量
+func (l *Ledger) Add(e Entry) {
+	if e.Provider == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = make(map[string]*Entry)
+	}
+	key := e.Kind + "/" + e.Provider
+	cur, ok := l.entries[key]
+	if !ok {
+		cur = &Entry{Kind: e.Kind, Provider: e.Provider}
+		l.entries[key] = cur
+	}
+	cur.Requests += e.Requests
+	cur.PromptTokens += e.PromptTokens
+	cur.CompletionTokens += e.CompletionTokens
+	cur.Chars += e.Chars
+	cur.AudioSeconds += e.AudioSeconds
+}
+
+// Drain 取出并清空暂存的用量
+func (l *Ledger) Drain() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, *e)
+	}
+	l.entries = nil
+	return entries
+}
+
+// Record 计算费用并累加到当天的提供者用量
+func Record(logger *utils.Logger, pricing map[string]configs.PriceConfig, userID, agentID uint, deviceID string, entries []Entry) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	now := time.Now()
+	for _, e := range entries {
+		record := &models.ProviderUsage{
+			Date:             quota.Date(now),
+			UserID:           userID,
+			AgentID:          agentID,
+			DeviceID:         deviceID,
+			Kind:             e.Kind,
+			Provider:         e.Provider,
+			Requests:         e.Requests,
+			PromptTokens:     e.PromptTokens,
+			CompletionTokens: e.CompletionTokens,
+			Chars:            e.Chars,
+			AudioSeconds:     e.AudioSeconds,
+			Cost:             Cost(pricing[e.Provider], e),
+			UpdatedAt:        now,
+		}
+		if err := database.AddProviderUsage(db, record); err != nil {
+			logger.Error("[计费] [记录] 设备 %s 提供者 %s 保存用量失败: %v", deviceID, e.Provider, err)
+		}
+	}
+}
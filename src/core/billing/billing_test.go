@@ -0,0 +1,39 @@
+package billing
+
+import (
+	"testing"
+	"xiaozhi-server-go/src/configs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCost(t *testing.T) {
+	price := configs.PriceConfig{PromptPer1K: 0.002, CompletionPer1K: 0.006, CharsPer1K: 0.3, PerMinute: 0.05}
+
+	assert.InDelta(t, 0.002*1.5+0.006*0.5, Cost(price, Entry{PromptTokens: 1500, CompletionTokens: 500}), 1e-9)
+	assert.InDelta(t, 0.3*0.2, Cost(price, Entry{Chars: 200}), 1e-9)
+	assert.InDelta(t, 0.05*1.5, Cost(price, Entry{AudioSeconds: 90}), 1e-9)
+	assert.Zero(t, Cost(configs.PriceConfig{}, Entry{PromptTokens: 1000, Chars: 1000}))
+}
+
+func TestLedgerMergesByProvider(t *testing.T) {
+	var l Ledger
+	l.Add(Entry{Kind: "llm", Provider: "OpenAILLM", Requests: 1, PromptTokens: 100, CompletionTokens: 20})
+	l.Add(Entry{Kind: "llm", Provider: "OpenAILLM", Requests: 1, PromptTokens: 50, CompletionTokens: 10})
+	l.Add(Entry{Kind: "tts", Provider: "EdgeTTS", Requests: 1, Chars: 12})
+	l.Add(Entry{Kind: "asr", Provider: "", AudioSeconds: 3}) // 没有提供者名称的用量被忽略
+
+	entries := l.Drain()
+	assert.Len(t, entries, 2)
+	for _, e := range entries {
+		switch e.Provider {
+		case "OpenAILLM":
+			assert.Equal(t, Entry{Kind: "llm", Provider: "OpenAILLM", Requests: 2, PromptTokens: 150, CompletionTokens: 30}, e)
+		case "EdgeTTS":
+			assert.Equal(t, int64(12), e.Chars)
+		default:
+			t.Fatalf("unexpected provider %s", e.Provider)
+		}
+	}
+	assert.Empty(t, l.Drain())
+}
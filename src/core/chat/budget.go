@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"xiaozhi-server-go/src/core/quota"
+)
+
+// Tokenizer 估算文本的Token数，可按模型注册不同的实现
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc 函数形式的 Tokenizer
+type TokenizerFunc func(text string) int
+
+// CountTokens 实现 Tokenizer 接口
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// DefaultTokenizer 默认估算：中日韩字符每字1个Token，其他字符约4个1个Token
+const DefaultTokenizer = "estimate"
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{
+		DefaultTokenizer: TokenizerFunc(func(text string) int {
+			return int(quota.EstimateTokens(text))
+		}),
+	}
+)
+
+// RegisterTokenizer 注册Token估算实现，LLM配置的 tokenizer 字段按名称选择
+func RegisterTokenizer(name string, t Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[name] = t
+}
+
+// GetTokenizer 按名称获取Token估算实现，未注册时使用默认估算
+func GetTokenizer(name string) Tokenizer {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	if t, ok := tokenizers[name]; ok {
+		return t
+	}
+	return tokenizers[DefaultTokenizer]
+}
+
+// messageOverhead 每条消息的角色、分隔符等固定开销
+const messageOverhead = 4
+
+// CountTokens 估算消息列表的Token数，包含工具调用的名称和参数
+func CountTokens(t Tokenizer, messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += messageOverhead + t.CountTokens(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			total += t.CountTokens(tc.Function.Name) + t.CountTokens(tc.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// ContextBudget 单个模型的上下文预算
+type ContextBudget struct {
+	Window    int       // 模型上下文窗口（Token），<=0 表示不限制
+	Reserve   int       // 为回复和工具定义预留的Token
+	Tokenizer Tokenizer // 为空时使用默认估算
+}
+
+// Limit 对话历史可使用的Token数，<=0 表示不限制
+func (b ContextBudget) Limit() int {
+	if b.Window <= 0 {
+		return 0
+	}
+	if limit := b.Window - b.Reserve; limit > 0 {
+		return limit
+	}
+	return b.Window / 2
+}
+
+func (b ContextBudget) tokenizer() Tokenizer {
+	if b.Tokenizer == nil {
+		return GetTokenizer(DefaultTokenizer)
+	}
+	return b.Tokenizer
+}
+
+// summaryHeader 摘要附加在系统提示词后的标题
+const summaryHeader = "【之前的对话摘要】"
+
+// summaryPrompt 压缩对话时使用的提示词
+const summaryPrompt = `你负责为语音助手压缩对话历史。请把已有摘要和新的对话记录合并为一段新的摘要，要求：
+1. 保留用户的身份、偏好、提到的重要事实和尚未完成的请求；
+2. 保留工具调用得到的关键结果，省略寒暄和重复内容；
+3. 使用第三人称陈述，不超过300字，只输出摘要正文。`
+
+// SummaryMessages 构建压缩对话的LLM请求：已有摘要与需要压缩的对话记录
+func SummaryMessages(previous string, messages []Message) []Message {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString("已有摘要：\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("对话记录：\n")
+	for _, msg := range messages {
+		switch {
+		case len(msg.ToolCalls) > 0:
+			for _, tc := range msg.ToolCalls {
+				fmt.Fprintf(&sb, "助手调用工具 %s(%s)\n", tc.Function.Name, tc.Function.Arguments)
+			}
+		case msg.Role == "tool":
+			fmt.Fprintf(&sb, "工具结果：%s\n", msg.Content)
+		case msg.Role == "user":
+			fmt.Fprintf(&sb, "用户：%s\n", msg.Content)
+		case msg.Role == "assistant":
+			fmt.Fprintf(&sb, "助手：%s\n", msg.Content)
+		}
+	}
+	return []Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: sb.String()},
+	}
+}
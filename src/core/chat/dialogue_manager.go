@@ -2,6 +2,7 @@ package chat
 
 import (
 	"encoding/json"
+	"sync"
 
 	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
@@ -9,11 +10,13 @@ import (
 
 type Message = types.Message
 
-// DialogueManager 管理对话上下文和历史
+// DialogueManager 管理对话上下文和历史，可在多个协程中使用
 type DialogueManager struct {
+	mu       sync.Mutex
 	logger   *utils.Logger
 	dialogue []Message
 	memory   MemoryInterface
+	summary  string // 已压缩的较早对话的摘要
 }
 
 // NewDialogueManager 创建对话管理器实例
@@ -29,6 +32,8 @@ func (dm *DialogueManager) SetSystemMessage(systemMessage string) {
 	if systemMessage == "" {
 		return
 	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 
 	// 如果对话中已经有系统消息，则不再添加
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
@@ -42,48 +47,79 @@ func (dm *DialogueManager) SetSystemMessage(systemMessage string) {
 	}, dm.dialogue...)
 }
 
+// RemoveSecondMessageForToolType 移除历史开头失去对应 tool_calls 的 tool 消息
 func (dm *DialogueManager) RemoveSecondMessageForToolType() {
-	// 如果第二条的类型是"role": "tool",则移除这条
-	if len(dm.dialogue) < 2 || dm.dialogue[1].Role != "tool" {
-		return
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.removeOrphanToolMessages()
+}
+
+func (dm *DialogueManager) removeOrphanToolMessages() {
+	start := dm.historyStart()
+	end := start
+	for end < len(dm.dialogue) && dm.dialogue[end].Role == "tool" {
+		end++
+	}
+	if end > start {
+		dm.dialogue = append(dm.dialogue[:start], dm.dialogue[end:]...)
 	}
-	dm.dialogue = append(dm.dialogue[:1], dm.dialogue[2:]...)
+}
+
+// historyStart 对话历史（system消息之后）的起始下标
+func (dm *DialogueManager) historyStart() int {
+	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
+		return 1
+	}
+	return 0
 }
 
 // 保留最近的几条对话消息
 func (dm *DialogueManager) KeepRecentMessages(maxMessages int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if maxMessages <= 0 || len(dm.dialogue) <= maxMessages {
 		return
 	}
+	dm.summary = "" // 摘要对应的较早对话已丢弃
 	// 保留system消息和最近的 maxMessages 条消息
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
 		// 保留system消息
 		dm.dialogue = append(dm.dialogue[:1], dm.dialogue[len(dm.dialogue)-maxMessages:]...)
-		dm.RemoveSecondMessageForToolType()
+		dm.removeOrphanToolMessages()
 		return
 	}
 	// 如果没有system消息，直接保留最近的 maxMessages 条消息
 	if len(dm.dialogue) > maxMessages {
 		dm.dialogue = dm.dialogue[len(dm.dialogue)-maxMessages:]
+		dm.removeOrphanToolMessages()
 	}
 }
 
 // GetRecentMessages 获取最近的对话消息
 // 如果 maxMessages <= 0，则返回全部对话消息
 func (dm *DialogueManager) GetRecentMessages(maxMessages int) []Message {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if maxMessages <= 0 || len(dm.dialogue) <= maxMessages {
-		return dm.dialogue
+		return dm.messages()
 	}
 	// 保留system消息和最近的 maxMessages 条消息
 	if len(dm.dialogue) > 0 && dm.dialogue[0].Role == "system" {
 		// 保留system消息
 		return append([]Message{dm.dialogue[0]}, dm.dialogue[len(dm.dialogue)-maxMessages:]...)
 	}
-	return dm.dialogue
+	return dm.messages()
+}
+
+// messages 对话历史的副本，调用方持有锁
+func (dm *DialogueManager) messages() []Message {
+	return append([]Message(nil), dm.dialogue...)
 }
 
 // Put 添加新消息到对话
 func (dm *DialogueManager) Put(message Message) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	// 如果最近一条是user消息且当前也是user消息，则插入一个空的assistant消息
 	if len(dm.dialogue) > 0 && dm.dialogue[len(dm.dialogue)-1].Role == "user" && message.Role == "user" {
 		dm.dialogue = append(dm.dialogue, Message{Role: "assistant", Content: "..."})
@@ -92,15 +128,101 @@ func (dm *DialogueManager) Put(message Message) {
 }
 
 func (dm *DialogueManager) GetLastTwoMessages() []Message {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if len(dm.dialogue) < 2 {
 		return nil
 	}
-	return dm.dialogue[len(dm.dialogue)-2:]
+	return append([]Message(nil), dm.dialogue[len(dm.dialogue)-2:]...)
 }
 
-// GetLLMDialogue 获取完整对话历史
+// GetLLMDialogue 获取完整对话历史，有摘要时附加在系统提示词之后
 func (dm *DialogueManager) GetLLMDialogue() []Message {
-	return dm.dialogue
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.llmDialogue()
+}
+
+func (dm *DialogueManager) llmDialogue() []Message {
+	if dm.summary == "" {
+		return dm.messages()
+	}
+	summary := summaryHeader + "\n" + dm.summary
+	dialogue := make([]Message, 0, len(dm.dialogue)+1)
+	if dm.historyStart() == 1 {
+		system := dm.dialogue[0]
+		system.Content += "\n\n" + summary
+		dialogue = append(dialogue, system)
+		return append(dialogue, dm.dialogue[1:]...)
+	}
+	dialogue = append(dialogue, Message{Role: "system", Content: summary})
+	return append(dialogue, dm.dialogue...)
+}
+
+// Summary 获取较早对话的摘要
+func (dm *DialogueManager) Summary() string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.summary
+}
+
+// MessagesToCompress 对话超出预算时返回需要压缩的较早消息，未超出时返回空。
+// 按轮次（以 user 消息开始）切分，保留的最近几轮约占预算的一半，至少保留最后一轮，
+// 因此 tool_calls 与对应的 tool 消息不会被拆开
+func (dm *DialogueManager) MessagesToCompress(b ContextBudget) []Message {
+	limit := b.Limit()
+	if limit <= 0 {
+		return nil
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	t := b.tokenizer()
+	if CountTokens(t, dm.llmDialogue()) <= limit {
+		return nil
+	}
+
+	start := dm.historyStart()
+	history := dm.dialogue[start:]
+	target := limit/2 - CountTokens(t, dm.dialogue[:start]) - t.CountTokens(dm.summary)
+	cut, lastTurn, recent := -1, -1, 0
+	for i := len(history) - 1; i > 0; i-- {
+		recent += CountTokens(t, history[i:i+1])
+		if history[i].Role != "user" {
+			continue
+		}
+		if lastTurn == -1 {
+			lastTurn = i
+		}
+		if recent > target {
+			break
+		}
+		cut = i
+	}
+	if cut == -1 {
+		cut = lastTurn
+	}
+	if cut <= 0 {
+		return nil
+	}
+	return append([]Message(nil), history[:cut]...)
+}
+
+// Compress 用摘要替换对话历史开头的 n 条消息
+func (dm *DialogueManager) Compress(n int, summary string) {
+	if n <= 0 {
+		return
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	start := dm.historyStart()
+	if n > len(dm.dialogue)-start {
+		n = len(dm.dialogue) - start
+	}
+	dialogue := make([]Message, 0, len(dm.dialogue)-n)
+	dialogue = append(dialogue, dm.dialogue[:start]...)
+	dm.dialogue = append(dialogue, dm.dialogue[start+n:]...)
+	dm.removeOrphanToolMessages()
+	dm.summary = summary
 }
 
 // GetLLMDialogueWithMemory 获取带记忆的对话
@@ -114,25 +236,33 @@ func (dm *DialogueManager) GetLLMDialogueWithMemory(memoryStr string) []Message
 		Content: memoryStr,
 	}
 
-	dialogue := make([]Message, 0, len(dm.dialogue)+1)
+	history := dm.GetLLMDialogue()
+	dialogue := make([]Message, 0, len(history)+1)
 	dialogue = append(dialogue, memoryMsg)
-	dialogue = append(dialogue, dm.dialogue...)
+	dialogue = append(dialogue, history...)
 
 	return dialogue
 }
 
 // Clear 清空对话历史
 func (dm *DialogueManager) Clear() {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	dm.dialogue = make([]Message, 0)
+	dm.summary = ""
 }
 
 func (dm *DialogueManager) Length() int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	return len(dm.dialogue)
 }
 
 // ToJSON 将对话历史转换为JSON字符串
 func (dm *DialogueManager) ToJSON(keepSystemPrompt bool) (string, error) {
-	dialogue := dm.dialogue
+	dm.mu.Lock()
+	dialogue := dm.messages()
+	dm.mu.Unlock()
 	if !keepSystemPrompt && len(dialogue) > 0 && dialogue[0].Role == "system" {
 		// 如果不保留系统消息，则移除第一条消息
 		dialogue = dialogue[1:]
@@ -146,5 +276,7 @@ func (dm *DialogueManager) ToJSON(keepSystemPrompt bool) (string, error) {
 
 // LoadFromJSON 从JSON字符串加载对话历史
 func (dm *DialogueManager) LoadFromJSON(jsonStr string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	return json.Unmarshal([]byte(jsonStr), &dm.dialogue)
 }
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// charTokenizer 每个字符计1个Token，便于计算预算
+var charTokenizer = TokenizerFunc(func(text string) int { return len([]rune(text)) })
+
+func newDialogue(messages ...Message) *DialogueManager {
+	dm := NewDialogueManager(nil, nil)
+	dm.SetSystemMessage("你是小智")
+	for _, msg := range messages {
+		dm.Put(msg)
+	}
+	return dm
+}
+
+func toolTurn(id string) []Message {
+	return []Message{
+		{Role: "user", Content: strings.Repeat("问", 20)},
+		{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: id + "-a", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: "{}"}},
+			{ID: id + "-b", Type: "function", Function: types.FunctionCall{Name: "get_time", Arguments: "{}"}},
+		}},
+		{Role: "tool", ToolCallID: id + "-a", Content: strings.Repeat("晴", 20)},
+		{Role: "tool", ToolCallID: id + "-b", Content: "12:00"},
+		{Role: "assistant", Content: strings.Repeat("答", 20)},
+	}
+}
+
+func TestMessagesToCompressKeepsToolPairs(t *testing.T) {
+	var history []Message
+	for _, id := range []string{"1", "2", "3", "4"} {
+		history = append(history, toolTurn(id)...)
+	}
+	dm := newDialogue(history...)
+	budget := ContextBudget{Window: 300, Reserve: 50, Tokenizer: charTokenizer}
+
+	total := CountTokens(charTokenizer, dm.GetLLMDialogue())
+	require.Greater(t, total, budget.Limit())
+
+	old := dm.MessagesToCompress(budget)
+	require.NotEmpty(t, old)
+	assert.Equal(t, "user", old[0].Role)
+	assert.Zero(t, len(old)%5, "按整轮压缩")
+
+	dm.Compress(len(old), "用户问过几次天气")
+	dialogue := dm.GetLLMDialogue()
+	assert.Equal(t, "system", dialogue[0].Role)
+	assert.Contains(t, dialogue[0].Content, "你是小智")
+	assert.Contains(t, dialogue[0].Content, "用户问过几次天气")
+	assert.Equal(t, "user", dialogue[1].Role)
+	assert.LessOrEqual(t, CountTokens(charTokenizer, dialogue), budget.Limit())
+
+	// 每个 tool 消息前面都有包含对应调用的 assistant 消息
+	calls := map[string]bool{}
+	for _, msg := range dialogue {
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = true
+		}
+		if msg.Role == "tool" {
+			assert.True(t, calls[msg.ToolCallID], "tool 消息 %s 缺少对应的调用", msg.ToolCallID)
+		}
+	}
+	assert.Empty(t, dm.MessagesToCompress(budget))
+}
+
+func TestMessagesToCompressKeepsLastTurn(t *testing.T) {
+	dm := newDialogue(
+		Message{Role: "user", Content: "你好"},
+		Message{Role: "assistant", Content: "你好呀"},
+		Message{Role: "user", Content: strings.Repeat("长", 200)},
+	)
+	old := dm.MessagesToCompress(ContextBudget{Window: 100, Tokenizer: charTokenizer})
+	require.Len(t, old, 2) // 最后一轮本身超出预算时仍然保留
+
+	assert.Nil(t, dm.MessagesToCompress(ContextBudget{Tokenizer: charTokenizer}), "未配置窗口时不压缩")
+	assert.Nil(t, newDialogue(Message{Role: "user", Content: strings.Repeat("长", 200)}).
+		MessagesToCompress(ContextBudget{Window: 100, Tokenizer: charTokenizer}), "只有一轮时无可压缩")
+}
+
+func TestKeepRecentMessagesDropsOrphanToolResults(t *testing.T) {
+	dm := newDialogue(toolTurn("1")...)
+	dm.summary = "旧摘要"
+	dm.KeepRecentMessages(3) // 截断后开头是两条 tool 消息
+
+	dialogue := dm.GetLLMDialogue()
+	require.Len(t, dialogue, 2)
+	assert.Equal(t, "system", dialogue[0].Role)
+	assert.Equal(t, "你是小智", dialogue[0].Content, "截断后摘要一并清除")
+	assert.Equal(t, "assistant", dialogue[1].Role)
+}
+
+func TestSummaryMessages(t *testing.T) {
+	messages := SummaryMessages("用户住在北京", toolTurn("1"))
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].Role)
+	text := messages[1].Content
+	assert.Contains(t, text, "已有摘要：\n用户住在北京")
+	assert.Contains(t, text, "助手调用工具 get_weather({})")
+	assert.Contains(t, text, "工具结果：12:00")
+
+	assert.Equal(t, 2, GetTokenizer("").CountTokens("你好"))
+	assert.Equal(t, GetTokenizer(DefaultTokenizer).CountTokens("hello world"), GetTokenizer("unknown").CountTokens("hello world"))
+}
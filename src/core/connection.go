@@ -15,15 +15,20 @@ import (
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/configs/database"
 	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/billing"
 	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/events"
 	"xiaozhi-server-go/src/core/function"
 	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/iot"
 	"xiaozhi-server-go/src/core/mcp"
 	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/failover"
 	"xiaozhi-server-go/src/core/providers/llm"
 	"xiaozhi-server-go/src/core/providers/tts"
 	"xiaozhi-server-go/src/core/providers/vlllm"
+	"xiaozhi-server-go/src/core/quota"
 	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
 	"xiaozhi-server-go/src/models"
@@ -72,15 +77,22 @@ type ConnectionHandler struct {
 	logger           *utils.Logger
 	conn             Connection
 	closeOnce        sync.Once
+	releaseOnce      sync.Once  // 提供者状态只恢复一次
+	parked           bool       // 断线后会话已暂存，等待重连恢复
+	closeReason      string     // 断开原因
+	closeReasonMu    sync.Mutex // 断开原因锁
+	presenceRecordID uint       // 连接记录ID
 	taskMgr          *task.TaskManager
 	authManager      *auth.AuthManager // 认证管理器
 	safeCallbackFunc func(func(*ConnectionHandler)) func()
+	providersMu      sync.RWMutex // 切换智能体时替换提供者，其他协程通过 llmProvider/ttsProvider/asrProvider 读取
 	providers        struct {
 		asr   providers.ASRProvider
 		llm   providers.LLMProvider
 		tts   providers.TTSProvider
 		vlllm *vlllm.Provider // VLLLM提供者，可选
 	}
+	llmOverridden bool // 当前LLM是按智能体覆盖参数新建的实例
 
 	initialVoice    string // 初始语音名称
 	ttsProviderName string // 默认TTS提供者名称
@@ -92,24 +104,32 @@ type ConnectionHandler struct {
 	clientId      string            // 客户端ID
 	headers       map[string]string // HTTP头部信息
 	transportType string            // 传输类型
+	clientIP      string            // 客户端IP
+	connectedAt   time.Time         // 连接建立时间
+	userID        uint              // 设备绑定的用户ID
 
-	// 客户端音频相关
+	// 客户端音频相关，hello 消息与上行音频在不同协程中处理
+	audioMu                  sync.Mutex
 	clientAudioFormat        string
 	clientAudioSampleRate    int
 	clientAudioChannels      int
 	clientAudioFrameDuration int
+	userAudio                []byte     // 待保存的用户语音PCM，开启 save_user_audio 时累积
+	dialogSaveMu             sync.Mutex // 按顺序保存对话记录
 
 	serverAudioFormat        string // 服务端音频格式
 	serverAudioSampleRate    int
 	serverAudioChannels      int
 	serverAudioFrameDuration int
 
-	clientListenMode string
-	isDeviceVerified bool
-	closeAfterChat   bool
+	clientListenMode  string // 由会话协程读写，其他协程读取快照
+	clientListenState string // 客户端拾音状态 start/stop/detect
+	isDeviceVerified  bool
+	closeAfterChat    atomic.Bool // 本轮回复播放完成后结束对话
 
 	// Agent 相关
 	agentID      uint          // 设备绑定的AgentID
+	language     string        // 智能体配置的语言
 	enabledTools []string      // 启用的工具列表
 	tools        []openai.Tool // 缓存的工具列表
 	// 语音处理相关
@@ -117,16 +137,27 @@ type ConnectionHandler struct {
 
 	opusDecoder *utils.OpusDecoder // Opus解码器
 
+	usageMu sync.Mutex
+	usage   quota.Usage    // 尚未写入数据库的用量
+	ledger  billing.Ledger // 尚未写入数据库的按提供者统计的用量
+
 	// 对话相关
-	dialogueManager     *chat.DialogueManager
-	tts_last_text_index int
-	client_asr_text     string // 客户端ASR文本
-	quickReplyCache     *utils.QuickReplyCache
+	dialogueManager *chat.DialogueManager
+	quickReplyCache *utils.QuickReplyCache
+
+	// 会话状态，只由会话协程读写，见 connection_session.go
+	session     sessionMachine
+	sessionMu   sync.RWMutex
+	sessionView sessionSnapshot
 
 	// 并发控制
 	stopChan         chan struct{}
 	clientAudioQueue chan []byte
 	clientTextQueue  chan string
+	asrResults       chan asrResult
+	replyEvents      chan replyEvent
+	audioDone        chan audioDoneEvent
+	sessionCalls     chan func()
 
 	// TTS任务队列
 	ttsQueue chan struct {
@@ -142,31 +173,42 @@ type ConnectionHandler struct {
 		textIndex int
 	}
 
-	talkRound      int       // 轮次计数
-	roundStartTime time.Time // 轮次开始时间
+	announceQueue       chan Announcement // 服务端主动播报队列
+	resumeAnnouncements []Announcement    // 会话恢复后待下发的播报，hello后下发
+	resumed             bool              // 是否由断线暂存的会话恢复而来
+	// 正在播放的离线暂存播报，按轮次记录，由会话协程读写
+	storedAnnouncements map[int]Announcement
+	pinnedAudio         sync.Map // 尚未标记为已下发的暂存播报音频，发送后不删除
+
 	// functions
 	functionRegister *function.FunctionRegistry
 	mcpManager       *mcp.Manager
+	iotManager       *iot.Manager // 旧版IoT协议设备管理
 
 	mcpResultHandlers map[string]MCPResultHandler // MCP处理器映射
+	eventPublisher    *events.Publisher           // 会话事件发布
 	ctx               context.Context
+
+	// 当前轮次的上下文，中止、打断、新一轮开始或连接关闭时取消
+	roundMu     sync.Mutex
+	roundCtx    context.Context
+	roundCancel context.CancelCauseFunc
+	roundID     int
 }
 
-// NewConnectionHandler 创建新的连接处理器
-func NewConnectionHandler(
-	config *configs.Config,
-	providerSet *pool.ProviderSet,
-	logger *utils.Logger,
-	req *http.Request,
-	ctx context.Context,
-) *ConnectionHandler {
-	handler := &ConnectionHandler{
+// newConnectionHandler 创建连接处理器并初始化队列与会话状态，不绑定提供者
+func newConnectionHandler(config *configs.Config, logger *utils.Logger, ctx context.Context) *ConnectionHandler {
+	h := &ConnectionHandler{
 		config:           config,
 		logger:           logger,
 		clientListenMode: "auto",
 		stopChan:         make(chan struct{}),
 		clientAudioQueue: make(chan []byte, 100),
 		clientTextQueue:  make(chan string, 100),
+		asrResults:       make(chan asrResult, 32),
+		replyEvents:      make(chan replyEvent),
+		audioDone:        make(chan audioDoneEvent, 100),
+		sessionCalls:     make(chan func()),
 		ttsQueue: make(chan struct {
 			text      string
 			round     int // 轮次
@@ -179,9 +221,9 @@ func NewConnectionHandler(
 			textIndex int
 		}, 100),
 
-		tts_last_text_index: -1,
+		announceQueue: make(chan Announcement, 20),
 
-		talkRound: 0,
+		session: newSessionMachine(),
 
 		serverAudioFormat:        "opus", // 默认使用Opus格式
 		serverAudioSampleRate:    24000,
@@ -190,8 +232,23 @@ func NewConnectionHandler(
 
 		ctx: ctx,
 
-		headers: make(map[string]string),
+		headers:     make(map[string]string),
+		connectedAt: time.Now(),
 	}
+	h.publishSession()
+	return h
+}
+
+// NewConnectionHandler 创建新的连接处理器
+func NewConnectionHandler(
+	config *configs.Config,
+	providerSet *pool.ProviderSet,
+	logger *utils.Logger,
+	req *http.Request,
+	ctx context.Context,
+) *ConnectionHandler {
+	handler := newConnectionHandler(config, logger, ctx)
+	handler.clientIP = utils.GetClientIP(req)
 
 	for key, values := range req.Header {
 		if len(values) > 0 {
@@ -232,6 +289,8 @@ func NewConnectionHandler(
 	agent, prompt := handler.InitWithAgent()
 	handler.checkTTSProvider(agent, config) // 检查TTS提供者
 	handler.checkLLMProvider(agent, config) // 检查LLM提供者是否匹配
+	handler.setupFailover(agent, config)    // 按智能体配置包装备用提供者
+	handler.setupConversation(agent)        // 托管平台的用户、会话与应用变量
 
 	handler.quickReplyCache = utils.NewQuickReplyCache(handler.ttsProviderName, handler.voiceName)
 
@@ -239,7 +298,9 @@ func NewConnectionHandler(
 	handler.dialogueManager = chat.NewDialogueManager(handler.logger, nil)
 	handler.dialogueManager.SetSystemMessage(prompt)
 	handler.functionRegister = function.NewFunctionRegistry()
+	handler.iotManager = iot.NewManager()
 	handler.initMCPResultHandlers()
+	handler.eventPublisher = events.NewPublisher(events.Default(), handler.eventSession)
 
 	return handler
 }
@@ -265,6 +326,7 @@ func (h *ConnectionHandler) InitWithAgent() (*models.Agent, string) {
 			}
 		}
 
+		h.language = agent.Language
 		if agent.Language != "" && agent.Language != "普通话" && agent.Language != "中文" {
 			prompt += "\n\n使用 " + agent.Language + " 回答用户的问题。"
 		}
@@ -361,20 +423,14 @@ func (h *ConnectionHandler) checkLLMProvider(agent *models.Agent, config *config
 		return
 	}
 	agentLLMName := agent.LLM
-	// 从agent里获取extra
-	apiKey := ""
-	baseUrl := ""
+	// 从agent里获取extra：API密钥、地址以及模型名称和采样参数的覆盖
+	var extra struct {
+		APIKey    string                 `json:"api_key"`
+		BaseURL   string                 `json:"base_url"`
+		LLMParams *models.AgentLLMParams `json:"llm_params"`
+	}
 	if agent.Extra != "" {
-		// 解析Extra字段
-		var extra map[string]interface{}
-		if err := json.Unmarshal([]byte(agent.Extra), &extra); err == nil {
-			if key, ok := extra["api_key"].(string); ok {
-				apiKey = key
-			}
-			if url, ok := extra["base_url"].(string); ok {
-				baseUrl = url
-			}
-		} else {
+		if err := json.Unmarshal([]byte(agent.Extra), &extra); err != nil {
 			h.LogError(fmt.Sprintf("Agent %d 的 Extra 字段格式错误: %v， err:%v", agent.ID, agent.Extra, err))
 		}
 	}
@@ -399,50 +455,99 @@ func (h *ConnectionHandler) checkLLMProvider(agent *models.Agent, config *config
 		}
 
 		llmName := getter.Config().Name
-		if llmName != agentLLMName {
-			// 根据agent.LLM类型设置LLM提供者
-			if cfg, ok := config.LLM[agentLLMName]; !ok {
-				h.LogError(fmt.Sprintf("Agent %d 的 LLM 类型 %s 不存在", h.agentID, agentLLMName))
-			} else {
-				if apiKey != "" {
-					cfg.APIKey = apiKey // 使用Agent的API密钥
-				}
-				if baseUrl != "" {
-					cfg.BaseURL = baseUrl // 使用Agent的BaseURL
-				}
-				llmCfg := &llm.Config{
-					Name:        agentLLMName,
-					Type:        cfg.Type,
-					ModelName:   cfg.ModelName,
-					BaseURL:     cfg.BaseURL,
-					APIKey:      cfg.APIKey,
-					Temperature: cfg.Temperature,
-					MaxTokens:   cfg.MaxTokens,
-					TopP:        cfg.TopP,
-					Extra:       cfg.Extra,
-				}
-				newllm, err := llm.Create(cfg.Type, llmCfg)
-				if err != nil {
-					h.LogError(fmt.Sprintf("创建LLM提供者失败: %v", err))
-				} else {
-					h.providers.llm = newllm
-					h.LogInfo(fmt.Sprintf("已切换Agent %d 的 LLM 提供者到: %s", h.agentID, agentLLMName))
-				}
-			}
-		} else {
-			if apiKey != "" {
-				getter.Config().APIKey = apiKey
-			}
-			if baseUrl != "" {
-				getter.Config().BaseURL = baseUrl
-			}
+		overridden := extra.APIKey != "" || extra.BaseURL != "" || extra.LLMParams != nil
+		if llmName == agentLLMName && !overridden && !h.llmOverridden {
 			h.LogInfo(fmt.Sprintf("使用Agent %d 的 LLM 类型: %s, BaseURL:%s", h.agentID, llmName, getter.Config().BaseURL))
+			return
+		}
+
+		// 类型不同或有覆盖参数时创建新的LLM实例，不修改连接池中共享实例的配置
+		cfg, ok := config.LLM[agentLLMName]
+		if !ok {
+			h.LogError(fmt.Sprintf("Agent %d 的 LLM 类型 %s 不存在", h.agentID, agentLLMName))
+			return
+		}
+		if extra.APIKey != "" {
+			cfg.APIKey = extra.APIKey // 使用Agent的API密钥
+		}
+		if extra.BaseURL != "" {
+			cfg.BaseURL = extra.BaseURL // 使用Agent的BaseURL
+		}
+		applyAgentLLMParams(&cfg, extra.LLMParams)
+		llmCfg := &llm.Config{
+			Name:             agentLLMName,
+			Type:             cfg.Type,
+			ModelName:        cfg.ModelName,
+			BaseURL:          cfg.BaseURL,
+			APIKey:           cfg.APIKey,
+			Temperature:      cfg.Temperature,
+			MaxTokens:        cfg.MaxTokens,
+			TopP:             cfg.TopP,
+			Stop:             cfg.Stop,
+			Seed:             cfg.Seed,
+			PresencePenalty:  cfg.PresencePenalty,
+			FrequencyPenalty: cfg.FrequencyPenalty,
+			ReasoningEffort:  cfg.ReasoningEffort,
+			ToolMode:         cfg.ToolMode,
+			ContextWindow:    cfg.ContextWindow,
+			Tokenizer:        cfg.Tokenizer,
+			Extra:            cfg.Extra,
+		}
+		newllm, err := llm.Create(cfg.Type, llmCfg)
+		if err != nil {
+			h.LogError(fmt.Sprintf("创建LLM提供者失败: %v", err))
+			return
+		}
+		h.providers.llm = newllm
+		h.llmOverridden = overridden
+		h.LogInfo(fmt.Sprintf("已切换Agent %d 的 LLM 提供者到: %s, 模型: %s", h.agentID, agentLLMName, cfg.ModelName))
+	}
+}
+
+// applyAgentLLMParams 用智能体设置的模型名称与采样参数覆盖LLM配置
+func applyAgentLLMParams(cfg *configs.LLMConfig, params *models.AgentLLMParams) {
+	if params == nil {
+		return
+	}
+	if params.ModelName != "" {
+		cfg.ModelName = params.ModelName
+	}
+	// 显式设置的 0 会被请求结构体的 omitempty 省略，改由 extra_body 写入请求体
+	if params.Temperature != nil {
+		cfg.Temperature = *params.Temperature
+		if cfg.Temperature == 0 {
+			cfg.Extra = llm.SetExtraBody(cfg.Extra, "temperature", 0)
 		}
 	}
+	if params.TopP != nil {
+		cfg.TopP = *params.TopP
+		if cfg.TopP == 0 {
+			cfg.Extra = llm.SetExtraBody(cfg.Extra, "top_p", 0)
+		}
+	}
+	if params.MaxTokens > 0 {
+		cfg.MaxTokens = params.MaxTokens
+	}
+	if len(params.Stop) > 0 {
+		cfg.Stop = params.Stop
+	}
+	if params.Seed != nil {
+		cfg.Seed = params.Seed
+	}
+	if params.PresencePenalty != nil {
+		cfg.PresencePenalty = *params.PresencePenalty
+	}
+	if params.FrequencyPenalty != nil {
+		cfg.FrequencyPenalty = *params.FrequencyPenalty
+	}
+	if params.ReasoningEffort != "" {
+		cfg.ReasoningEffort = params.ReasoningEffort
+	}
 }
 
 func (h *ConnectionHandler) checkDeviceInfo() {
 	h.agentID = 0 // 清空AgentID
+	h.userID = 0
 
 	if h.deviceID == "" {
 		h.LogError("设备ID未设置，无法检查设备绑定状态")
@@ -454,6 +559,9 @@ func (h *ConnectionHandler) checkDeviceInfo() {
 		return
 	}
 
+	if device.UserID != nil {
+		h.userID = *device.UserID
+	}
 	if device.AgentID != nil {
 		h.agentID = *device.AgentID // 获取设备绑定的AgentID
 	} else {
@@ -530,6 +638,7 @@ func (h *ConnectionHandler) LogError(msg string) {
 			"device": h.deviceID,
 		})
 	}
+	h.publishEvent(events.TypeError, map[string]interface{}{"message": msg})
 }
 
 // Handle 处理WebSocket连接
@@ -537,12 +646,14 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 	defer conn.Close()
 
 	h.conn = conn
-
-	// 启动消息处理协程
-	go h.processClientAudioMessagesCoroutine() // 添加客户端音频消息处理协程
-	go h.processClientTextMessagesCoroutine()  // 添加客户端文本消息处理协程
-	go h.processTTSQueueCoroutine()            // 添加TTS队列处理协程
-	go h.sendAudioMessageCoroutine()           // 添加音频消息发送协程
+	h.publishEvent(events.TypeConnectionOpen, map[string]interface{}{
+		"client_id":      h.clientId,
+		"client_ip":      h.clientIP,
+		"transport_type": h.transportType,
+		"resumed":        h.resumed,
+	})
+	h.presenceConnected()
+	h.startCoroutines()
 
 	// 优化后的MCP管理器处理
 	if h.mcpManager == nil {
@@ -576,6 +687,7 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 			messageType, message, err := conn.ReadMessage(h.stopChan)
 			if err != nil {
 				h.LogError(fmt.Sprintf("读取消息失败: %v, 退出主消息循环", err))
+				h.setCloseReason(DisconnectReasonClient)
 				return
 			}
 
@@ -586,18 +698,13 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 	}
 }
 
-// processClientTextMessagesCoroutine 处理文本消息队列
-func (h *ConnectionHandler) processClientTextMessagesCoroutine() {
-	for {
-		select {
-		case <-h.stopChan:
-			return
-		case text := <-h.clientTextQueue:
-			if err := h.processClientTextMessage(context.Background(), text); err != nil {
-				h.LogError(fmt.Sprintf("处理文本数据失败: %v", err))
-			}
-		}
-	}
+// startCoroutines 启动会话协程与消息处理协程
+func (h *ConnectionHandler) startCoroutines() {
+	go h.processSessionEventsCoroutine()       // 会话协程，处理客户端文本消息、ASR结果与回复事件
+	go h.processClientAudioMessagesCoroutine() // 添加客户端音频消息处理协程
+	go h.processTTSQueueCoroutine()            // 添加TTS队列处理协程
+	go h.sendAudioMessageCoroutine()           // 添加音频消息发送协程
+	go h.processAnnounceQueueCoroutine()       // 添加服务端播报处理协程
 }
 
 // processClientAudioMessagesCoroutine 处理音频消息队列
@@ -607,10 +714,10 @@ func (h *ConnectionHandler) processClientAudioMessagesCoroutine() {
 		case <-h.stopChan:
 			return
 		case audioData := <-h.clientAudioQueue:
-			if h.closeAfterChat {
+			if h.closeAfterChat.Load() {
 				continue
 			}
-			if err := h.providers.asr.AddAudio(audioData); err != nil {
+			if err := h.asrProvider().AddAudio(audioData); err != nil {
 				h.LogError(fmt.Sprintf("处理音频数据失败: %v", err))
 			}
 		}
@@ -628,47 +735,60 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 	}
 }
 
-// OnAsrResult 实现 AsrEventListener 接口
+// OnAsrResult 实现 AsrEventListener 接口，在ASR的协程中调用，识别结果交给会话协程处理
 // 返回true则停止语音识别，返回false会继续语音识别
 func (h *ConnectionHandler) OnAsrResult(result string, isFinalResult bool) bool {
-	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-	if h.providers.asr.GetSilenceCount() >= 2 {
+	listenMode := h.snapshot().listenMode
+	if result != "" {
+		eventType := events.TypeASRPartial
+		if isFinalResult {
+			eventType = events.TypeASRFinal
+		}
+		h.publishEvent(eventType, map[string]interface{}{"text": result, "listen_mode": listenMode})
+		if isFinalResult {
+			h.addProviderUsage(failover.KindASR, billing.Entry{Requests: 1})
+		}
+	}
+	asrProvider := h.asrProvider()
+	if asrProvider.GetSilenceCount() >= 2 {
 		h.LogInfo("[ASR] [静音检测] 连续两次，结束对话")
-		h.closeAfterChat = true // 如果连续两次静音，则结束对话
+		h.closeAfterChat.Store(true) // 如果连续两次静音，则结束对话
 		result = "[SILENCE_TIMEOUT] 长时间未检测到用户说话，请礼貌的结束对话"
 	}
-	if h.clientListenMode == "auto" {
-		if result == "" {
+
+	stop := false
+	switch listenMode {
+	case "auto":
+		stop = result != ""
+	case "manual":
+		stop = isFinalResult
+		if result == "" && !isFinalResult {
 			return false
 		}
-		h.LogInfo(fmt.Sprintf("[ASR] [识别结果 %s/%s]", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
-		return true
-	} else if h.clientListenMode == "manual" {
-		h.client_asr_text += result
-		if isFinalResult {
-			h.handleChatMessage(context.Background(), h.client_asr_text)
-			return true
+	case "realtime":
+		stop = result != ""
+		if stop {
+			asrProvider.Reset() // 重置ASR状态，准备下一次识别
 		}
+	}
+	if !stop && listenMode != "manual" {
 		return false
-	} else if h.clientListenMode == "realtime" {
-		if result == "" {
-			return false
-		}
-		h.stopServerSpeak()
-		h.providers.asr.Reset() // 重置ASR状态，准备下一次识别
-		h.LogInfo(fmt.Sprintf("[ASR] [识别结果 %s/%s]", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
-		return true
 	}
-	return false
+	select {
+	case h.asrResults <- asrResult{text: result, final: isFinalResult}:
+	case <-h.stopChan:
+	}
+	return stop
 }
 
-// clientAbortChat 处理中止消息
+// clientAbortChat 处理中止消息，只在会话协程中调用
 func (h *ConnectionHandler) clientAbortChat() error {
 	h.LogInfo("[客户端] [中止消息] 收到，停止语音识别")
+	h.cancelRound(ErrRoundAborted)
 	h.stopServerSpeak()
 	h.sendTTSMessage("stop", "", 0)
+	h.settleAnnouncements(h.session.round)
+	h.session.finishRound()
 	h.clearSpeakStatus()
 	return nil
 }
@@ -686,6 +806,7 @@ func (h *ConnectionHandler) QuitIntent(text string) bool {
 		//判断相等
 		if cleand_text == cmd {
 			h.LogInfo("[客户端] [退出意图] 收到，准备结束对话")
+			h.setCloseReason(DisconnectReasonExit)
 			h.Close() // 直接关闭连接
 			return true
 		}
@@ -693,9 +814,9 @@ func (h *ConnectionHandler) QuitIntent(text string) bool {
 	return false
 }
 
-func (h *ConnectionHandler) quickReplyWakeUpWords(text string) bool {
+func (h *ConnectionHandler) quickReplyWakeUpWords(round int, text string) bool {
 	// 检查是否包含唤醒词
-	if !h.config.QuickReply || h.talkRound != 1 {
+	if !h.config.QuickReply || round != 1 {
 		return false
 	}
 	if !utils.IsWakeUpWord(text) {
@@ -704,13 +825,12 @@ func (h *ConnectionHandler) quickReplyWakeUpWords(text string) bool {
 
 	repalyWords := h.config.QuickReplyWords
 	reply_text := utils.RandomSelectFromArray(repalyWords)
-	h.tts_last_text_index = 1 // 重置文本索引
-	h.SpeakAndPlay(reply_text, 1, h.talkRound)
+	h.speak(round, 1, reply_text)
 
 	return true
 }
 
-// handleChatMessage 处理聊天消息
+// handleChatMessage 处理聊天消息，只在会话协程中调用；回复在回复协程中生成
 func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string) error {
 	if text == "" {
 		h.logger.Warn("收到空聊天消息，忽略")
@@ -723,44 +843,56 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 	}
 
 	// 增加对话轮次
-	h.talkRound++
-	h.roundStartTime = time.Now()
-	currentRound := h.talkRound
+	ctx, currentRound := h.startRound(ctx, text)
 	h.LogInfo(fmt.Sprintf("[对话] [轮次 %d] 开始新的对话轮次", currentRound))
+	h.saveUserRecording(currentRound, text)
 
 	// 普通文本消息处理流程
 	// 立即发送 stt 消息
 	err := h.sendSTTMessage(text)
 	if err != nil {
+		h.session.finishRound()
 		h.LogError(fmt.Sprintf("发送STT消息失败: %v", err))
 		return fmt.Errorf("发送STT消息失败: %v", err)
 	}
 
 	// 发送tts start状态
 	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.session.finishRound()
 		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
 		return fmt.Errorf("发送TTS开始状态失败: %v", err)
 	}
 
 	// 发送思考状态的情绪
 	if err := h.sendEmotionMessage("thinking"); err != nil {
+		h.session.finishRound()
 		h.LogError(fmt.Sprintf("发送思考状态情绪消息失败: %v", err))
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
 
 	h.LogInfo(fmt.Sprintf("[聊天] [消息 %s]", text))
 
-	if h.quickReplyWakeUpWords(text) {
-		return nil
-	}
+	h.startReply(ctx, currentRound, func(ctx context.Context) error {
+		if h.quickReplyWakeUpWords(currentRound, text) {
+			return nil
+		}
 
-	// 添加用户消息到对话历史
-	h.dialogueManager.Put(chat.Message{
-		Role:    "user",
-		Content: text,
-	})
+		if h.checkQuota(currentRound) {
+			return nil
+		}
+		h.addUsage(func(u *quota.Usage) { u.Rounds++ })
+		defer h.flushUsage()
+
+		// 添加用户消息到对话历史
+		h.dialogueManager.Put(chat.Message{
+			Role:    "user",
+			Content: text,
+		})
+		h.fitContext(ctx) // 超出上下文预算时压缩较早的对话
 
-	return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
+		return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
+	})
+	return nil
 }
 
 func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []providers.Message, round int) error {
@@ -768,8 +900,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		if r := recover(); r != nil {
 			h.LogError(fmt.Sprintf("genResponseByLLM发生panic: %v", r))
 			errorMsg := "抱歉，处理您的请求时发生了错误"
-			h.tts_last_text_index = 1 // 重置文本索引
-			h.SpeakAndPlay(errorMsg, 1, round)
+			h.speak(round, 1, errorMsg)
 		}
 	}()
 
@@ -781,8 +912,21 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	}
 	// 使用LLM生成回复
 	tools := h.functionRegister.GetAllFunctions()
-	responses, err := h.providers.llm.ResponseWithFunctions(ctx, h.sessionID, messages, tools)
+	toolMode := h.toolMode()
+	llmMessages, llmTools := messages, tools
+	var toolFilter *utils.ToolCallTextFilter // prompt 模式下截留 <tool_call> 文本，不送去TTS
+	switch toolMode {
+	case llm.ToolModePrompt:
+		llmMessages, llmTools = llm.PromptToolMessages(messages, tools), nil
+		toolFilter = &utils.ToolCallTextFilter{}
+	case llm.ToolModeNone:
+		llmTools = nil
+	}
+	responses, err := h.llmProvider().ResponseWithFunctions(ctx, h.sessionID, llmMessages, llmTools)
 	if err != nil {
+		if h.roundCanceled(ctx, "LLM") {
+			return nil
+		}
 		return fmt.Errorf("LLM生成回复失败: %v", err)
 	}
 
@@ -800,24 +944,39 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	functionArguments := ""
 	contentArguments := ""
 
+	var llmUsage *types.Usage // 供应商返回的Token用量
+
 	for response := range responses {
+		if ctx.Err() != nil {
+			continue // 轮次已取消，丢弃剩余输出，直到提供者停止生成并关闭响应流
+		}
 		content := response.Content
 		toolCall := response.ToolCalls
 
 		if response.Error != "" {
 			h.LogError(fmt.Sprintf("LLM响应错误: %s", response.Error))
 			errorMsg := "抱歉，服务暂时不可用，请稍后再试"
-			h.tts_last_text_index = 1 // 重置文本索引
-			h.SpeakAndPlay(errorMsg, 1, round)
+			h.speak(round, 1, errorMsg)
 			return fmt.Errorf("LLM响应错误: %s", response.Error)
 		}
 
+		if response.UpdateConversationID != "" {
+			h.saveConversationID(response.UpdateConversationID)
+		}
+
+		if response.Usage != nil {
+			llmUsage = response.Usage
+			if content == "" && len(toolCall) == 0 {
+				continue
+			}
+		}
+
 		if content != "" {
 			// 累加content_arguments
 			contentArguments += content
 		}
 
-		if !toolCallFlag && strings.HasPrefix(contentArguments, "<tool_call>") {
+		if !toolCallFlag && toolMode == llm.ToolModeNative && strings.HasPrefix(contentArguments, "<tool_call>") {
 			toolCallFlag = true
 		}
 
@@ -838,8 +997,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 			if strings.Contains(content, "服务响应异常") {
 				h.LogError(fmt.Sprintf("检测到LLM服务异常: %s", content))
 				errorMsg := "抱歉，LLM服务暂时不可用，请稍后再试"
-				h.tts_last_text_index = 1 // 重置文本索引
-				h.SpeakAndPlay(errorMsg, 1, round)
+				h.speak(round, 1, errorMsg)
 				return fmt.Errorf("LLM服务异常")
 			}
 
@@ -847,6 +1005,14 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				continue
 			}
 
+			if toolFilter != nil {
+				content = toolFilter.Feed(content)
+				toolCallFlag = toolFilter.Found()
+				if content == "" {
+					continue
+				}
+			}
+
 			responseMessage = append(responseMessage, content)
 			// 处理分段
 			fullText := utils.JoinStrings(responseMessage)
@@ -866,9 +1032,11 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 					h.LogInfo(fmt.Sprintf("[LLM] [回复 %s/%d] 第一句话: %s", llmSpentTime, round, segment))
 				} else {
 					h.LogInfo(fmt.Sprintf("[LLM] [分段 %d/%d] %s", textIndex, round, segment))
+					h.publishEvent(events.TypeLLMSegment, map[string]interface{}{
+						"round": round, "index": textIndex, "text": segment,
+					})
 				}
-				h.tts_last_text_index = textIndex
-				err := h.SpeakAndPlay(segment, textIndex, round)
+				err := h.speak(round, textIndex, segment)
 				if err != nil {
 					h.LogError(fmt.Sprintf("播放LLM回复分段失败: %v", err))
 				}
@@ -877,66 +1045,54 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		}
 	}
 
-	if toolCallFlag {
-		bHasError := false
-		if functionID == "" {
-			a := utils.Extract_json_from_string(contentArguments)
-			if a != nil {
-				functionName = a["name"].(string)
-				argumentsJson, err := json.Marshal(a["arguments"])
-				if err != nil {
-					h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
-				}
-				functionArguments = string(argumentsJson)
-				functionID = uuid.New().String()
-			} else {
-				bHasError = true
-			}
-			if bHasError {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+	if toolFilter != nil {
+		// 输出结束时暂存的可能是标签开头的文本
+		if rest := toolFilter.Flush(); rest != "" {
+			responseMessage = append(responseMessage, rest)
+		}
+	}
+
+	canceled := h.roundCanceled(ctx, "LLM")
+	if toolCallFlag && !canceled {
+		var calls []types.ToolCall
+		if functionID != "" {
+			calls = append(calls, types.ToolCall{
+				ID:       functionID,
+				Type:     "function",
+				Function: types.FunctionCall{Name: functionName, Arguments: functionArguments},
+			})
+		} else {
+			// 模型以 <tool_call> 文本调用工具
+			for _, call := range utils.ParseTextToolCalls(contentArguments) {
+				calls = append(calls, types.ToolCall{
+					ID:       uuid.New().String(),
+					Type:     "function",
+					Function: types.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+				})
 			}
 		}
-		if !bHasError {
+		if len(calls) == 0 {
+			h.LogError(fmt.Sprintf("函数调用参数解析失败: %s", contentArguments))
+		} else {
 			// 清空responseMessage
 			responseMessage = []string{}
-			arguments := make(map[string]interface{})
-			if err := json.Unmarshal([]byte(functionArguments), &arguments); err != nil {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
-			}
-			functionCallData := map[string]interface{}{
-				"id":        functionID,
-				"name":      functionName,
-				"arguments": functionArguments,
-			}
-			h.LogInfo(fmt.Sprintf("函数调用: %v", arguments))
-			if h.mcpManager.IsMCPTool(functionName) {
-				// 处理MCP函数调用
-				result, err := h.mcpManager.ExecuteTool(ctx, functionName, arguments)
-				if err != nil {
-					h.LogError(fmt.Sprintf("MCP函数调用失败: %v", err))
-					if result == nil {
-						result = "MCP工具调用失败"
-					}
-				}
-				// 判断result 是否是types.ActionResponse类型
-				if actionResult, ok := result.(types.ActionResponse); ok {
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				} else {
-					h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
-					actionResult := types.ActionResponse{
-						Action: types.ActionTypeReqLLM, // 动作类型
-						Result: result,                 // 动作产生的结果
-					}
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				}
-
-			} else {
-				// 处理普通函数调用
-				//h.functionRegister.CallFunction(functionName, functionCallData)
-			}
+			h.setRoundPhase(round, PhaseToolWait)
+			h.handleToolCalls(ctx, round, calls, textIndex)
 		}
 	}
 
+	promptTokens, completionTokens := estimateLLMTokens(llmMessages, contentArguments+functionArguments)
+	if llmUsage != nil {
+		promptTokens, completionTokens = int64(llmUsage.PromptTokens), int64(llmUsage.CompletionTokens)
+	}
+	h.addUsage(func(u *quota.Usage) { u.LLMTokens += promptTokens + completionTokens })
+	h.addProviderUsage(failover.KindLLM, billing.Entry{
+		Requests: 1, PromptTokens: promptTokens, CompletionTokens: completionTokens,
+	})
+	if canceled {
+		return nil
+	}
+
 	// 处理剩余文本
 	fullResponse := utils.JoinStrings(responseMessage)
 	if len(fullResponse) > processedChars {
@@ -944,8 +1100,10 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		if remainingText != "" {
 			textIndex++
 			h.LogInfo(fmt.Sprintf("[LLM] [分段 剩余文本 %d/%d] %s", textIndex, round, remainingText))
-			h.tts_last_text_index = textIndex
-			h.SpeakAndPlay(remainingText, textIndex, round)
+			h.publishEvent(events.TypeLLMSegment, map[string]interface{}{
+				"round": round, "index": textIndex, "text": remainingText,
+			})
+			h.speak(round, textIndex, remainingText)
 		}
 	} else {
 		h.logger.Debug("无剩余文本需要处理: fullResponse长度=%d, processedChars=%d", len(fullResponse), processedChars)
@@ -960,6 +1118,14 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 			Role:    "assistant",
 			Content: content,
 		})
+		state := h.snapshot()
+		h.publishEvent(events.TypeRoundFinished, map[string]interface{}{
+			"round":       round,
+			"user_text":   state.userText,
+			"reply":       content,
+			"duration_ms": time.Since(state.startedAt).Milliseconds(),
+		})
+		h.saveDialog()
 	}
 
 	return nil
@@ -974,6 +1140,9 @@ func (h *ConnectionHandler) addToolCallMessage(toolResultText string, functionCa
 	h.LogInfo(fmt.Sprintf("函数调用参数: %s", functionArguments))
 	h.LogInfo(fmt.Sprintf("函数调用名称: %s", functionName))
 	h.LogInfo(fmt.Sprintf("函数调用ID: %s", functionID))
+	h.publishEvent(events.TypeToolResult, map[string]interface{}{
+		"id": functionID, "name": functionName, "result": toolResultText,
+	})
 
 	// 添加 assistant 消息，包含 tool_calls
 	h.dialogueManager.Put(chat.Message{
@@ -1001,7 +1170,7 @@ func (h *ConnectionHandler) addToolCallMessage(toolResultText string, functionCa
 	})
 }
 
-func (h *ConnectionHandler) handleFunctionResult(result types.ActionResponse, functionCallData map[string]interface{}, textIndex int) {
+func (h *ConnectionHandler) handleFunctionResult(ctx context.Context, round int, result types.ActionResponse, functionCallData map[string]interface{}, textIndex int) {
 	switch result.Action {
 	case types.ActionTypeError:
 		h.LogError(fmt.Sprintf("函数调用错误: %v", result.Result))
@@ -1020,7 +1189,8 @@ func (h *ConnectionHandler) handleFunctionResult(result types.ActionResponse, fu
 		text, ok := result.Result.(string)
 		if ok && len(text) > 0 {
 			h.addToolCallMessage(text, functionCallData)
-			h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
+			h.setRoundPhase(round, PhaseThinking)
+			h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), round)
 
 		} else {
 			h.LogError(fmt.Sprintf("函数调用结果解析失败: %v", result.Result))
@@ -1036,12 +1206,16 @@ func (h *ConnectionHandler) SystemSpeak(text string) error {
 		h.logger.Warn("SystemSpeak 收到空文本，无法合成语音")
 		return errors.New("收到空文本，无法合成语音")
 	}
+	return h.speakText(h.currentRound(), text)
+}
+
+// speakText 按标点分句后加入轮次 round 的播放队列
+func (h *ConnectionHandler) speakText(round int, text string) error {
 	texts := utils.SplitByPunctuation(text)
 	index := 0
 	for _, item := range texts {
 		index++
-		h.tts_last_text_index = index // 重置文本索引
-		h.SpeakAndPlay(item, index, h.talkRound)
+		h.speak(round, index, item)
 	}
 	return nil
 }
@@ -1066,6 +1240,7 @@ func (h *ConnectionHandler) processTTSQueueCoroutine() {
 // 服务端打断说话
 func (h *ConnectionHandler) stopServerSpeak() {
 	h.LogInfo("[服务端] [语音] 停止说话")
+	h.cancelRound(ErrRoundInterrupted)
 	atomic.StoreInt32(&h.serverVoiceStop, 1)
 	h.cleanTTSAndAudioQueue(false)
 }
@@ -1074,6 +1249,9 @@ func (h *ConnectionHandler) deleteAudioFileIfNeeded(filepath string, reason stri
 	if !h.config.DeleteAudio || filepath == "" {
 		return
 	}
+	if _, ok := h.pinnedAudio.Load(filepath); ok {
+		return
+	}
 
 	// 检查是否为快速回复缓存文件，如果是则不删除
 	if h.quickReplyCache != nil && h.quickReplyCache.IsCachedFile(filepath) {
@@ -1126,12 +1304,22 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 		return
 	}
 
+	ctx := h.roundContext(round)
+	if h.roundCanceled(ctx, "TTS") {
+		return
+	}
+
 	// 生成语音文件
-	filepath, err := h.providers.tts.ToTTS(text)
+	filepath, err := h.ttsProvider().ToTTS(ctx, text)
 	if err != nil {
+		if h.roundCanceled(ctx, "TTS") {
+			return
+		}
 		h.LogError(fmt.Sprintf("TTS转换失败:text(%s) %v", text, err))
 		return
 	} else {
+		h.addUsage(func(u *quota.Usage) { u.TTSChars += ttsChars(text) })
+		h.addProviderUsage(failover.KindTTS, billing.Entry{Requests: 1, Chars: ttsChars(text)})
 		h.logger.Debug(fmt.Sprintf("TTS转换成功: text(%s), index(%d) %s", text, textIndex, filepath))
 		// 如果是快速回复词，保存到缓存
 		if utils.IsQuickReplyHit(text, h.config.QuickReplyWords) {
@@ -1192,10 +1380,10 @@ func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int, round int)
 
 func (h *ConnectionHandler) clearSpeakStatus() {
 	h.LogInfo("[服务端] [讲话状态] 已清除")
-	h.tts_last_text_index = -1
-	h.providers.asr.Reset() // 重置ASR状态
+	h.asrProvider().Reset() // 重置ASR状态
 }
 
+// closeOpusDecoder 关闭Opus解码器，需持有 audioMu
 func (h *ConnectionHandler) closeOpusDecoder() {
 	if h.opusDecoder != nil {
 		if err := h.opusDecoder.Close(); err != nil {
@@ -1240,24 +1428,46 @@ clearAudioQueue:
 
 // Close 清理资源
 func (h *ConnectionHandler) Close() {
-	h.closeOnce.Do(func() {
-		close(h.stopChan)
+	h.closeOnce.Do(h.closeConnection)
+	h.releaseOnce.Do(h.releaseProviders)
+}
 
-		h.closeOpusDecoder()
-		if h.providers.tts != nil {
-			h.providers.tts.SetVoice(h.initialVoice) // 恢复初始语音
+// closeConnection 停止会话协程并结束本次连接
+func (h *ConnectionHandler) closeConnection() {
+	close(h.stopChan)
+	h.cancelRound(ErrConnectionClosed)
+	h.publishEvent(events.TypeConnectionClose, map[string]interface{}{
+		"talk_round":        h.currentRound(),
+		"connected_seconds": int64(time.Since(h.connectedAt).Seconds()),
+		"reason":            h.getCloseReason(),
+		"parked":            h.parked,
+	})
+	h.presenceDisconnected()
+	h.flushUsage()
+
+	h.audioMu.Lock()
+	h.closeOpusDecoder()
+	h.audioMu.Unlock()
+	if asrProvider := h.asrProvider(); asrProvider != nil {
+		asrProvider.ResetSilenceCount() // 重置静音计数
+		if err := asrProvider.Reset(); err != nil {
+			h.LogError(fmt.Sprintf("重置ASR状态失败: %v", err))
 		}
-		if h.providers.asr != nil {
-			h.providers.asr.ResetSilenceCount() // 重置静音计数
-			if err := h.providers.asr.Reset(); err != nil {
-				h.LogError(fmt.Sprintf("重置ASR状态失败: %v", err))
-			}
-			if err := h.providers.asr.CloseConnection(); err != nil {
-				h.LogError(fmt.Sprintf("断开ASR状态失败: %v", err))
-			}
+		if err := asrProvider.CloseConnection(); err != nil {
+			h.LogError(fmt.Sprintf("断开ASR状态失败: %v", err))
 		}
-		h.cleanTTSAndAudioQueue(true)
-	})
+	}
+}
+
+// releaseProviders 恢复提供者的会话级状态，之后提供者可归还到资源池
+func (h *ConnectionHandler) releaseProviders() {
+	h.providersMu.Lock()
+	h.clearFailover()
+	if h.providers.tts != nil {
+		h.providers.tts.SetVoice(h.initialVoice) // 恢复初始语音
+	}
+	h.providersMu.Unlock()
+	h.cleanTTSAndAudioQueue(true)
 }
 
 // genResponseByVLLM 使用VLLLM处理包含图片的消息
@@ -1273,6 +1483,9 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	// 使用VLLLM处理图片和文本
 	responses, err := h.providers.vlllm.ResponseWithImage(ctx, h.sessionID, messages, imageData, text)
 	if err != nil {
+		if h.roundCanceled(ctx, "VLLLM") {
+			return nil
+		}
 		h.LogError(fmt.Sprintf("VLLLM生成回复失败，尝试降级到普通LLM: %v", err))
 		// 降级策略：只使用文本部分调用普通LLM
 		fallbackText := fmt.Sprintf("用户发送了一张图片并询问：%s（注：当前无法处理图片，只能根据文字回答）", text)
@@ -1291,7 +1504,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	atomic.StoreInt32(&h.serverVoiceStop, 0)
 
 	for response := range responses {
-		if response == "" {
+		if response == "" || ctx.Err() != nil {
 			continue
 		}
 
@@ -1303,18 +1516,20 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 		// 按标点符号分割
 		if segment, chars := utils.SplitAtLastPunctuation(currentText); chars > 0 {
 			textIndex++
-			h.tts_last_text_index = textIndex
-			h.SpeakAndPlay(segment, textIndex, round)
+			h.speak(round, textIndex, segment)
 			processedChars += chars
 		}
 	}
 
+	if h.roundCanceled(ctx, "VLLLM") {
+		return nil
+	}
+
 	// 处理剩余文本
 	remainingText := utils.JoinStrings(responseMessage)[processedChars:]
 	if remainingText != "" {
 		textIndex++
-		h.tts_last_text_index = textIndex
-		h.SpeakAndPlay(remainingText, textIndex, round)
+		h.speak(round, textIndex, remainingText)
 	}
 
 	// 获取完整回复内容
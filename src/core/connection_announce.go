@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/chat"
+)
+
+const (
+	// 排队播报等待当前播报结束的最长时间
+	announceWaitTimeout = 2 * time.Minute
+	// 排队播报检查当前播报状态的间隔
+	announceCheckInterval = 200 * time.Millisecond
+)
+
+// Announcement 服务端主动下发的播报
+type Announcement struct {
+	Text      string // 播报文本，AudioPath为空时通过TTS合成
+	AudioPath string // 音频文件路径（wav/mp3），设置后直接播放音频
+	Interrupt bool   // 是否打断当前播报，否则排队等待当前播报结束
+	// 不写入对话历史，用于重播已在历史中的回复
+	SkipHistory bool
+	// 离线暂存播报的ID，播放完成或被打断后才标记为已下发，连接断开时保留到下次连接
+	StoredID uint
+}
+
+// Announce 将播报加入队列，由播报协程按顺序下发到设备
+func (h *ConnectionHandler) Announce(a Announcement) error {
+	if a.Text == "" && a.AudioPath == "" {
+		return errors.New("播报文本和音频不能同时为空")
+	}
+	if h.IsClosed() {
+		return errors.New("设备连接已关闭")
+	}
+	select {
+	case h.announceQueue <- a:
+		return nil
+	default:
+		return errors.New("播报队列已满")
+	}
+}
+
+// processAnnounceQueueCoroutine 处理播报队列
+func (h *ConnectionHandler) processAnnounceQueueCoroutine() {
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case a := <-h.announceQueue:
+			if !a.Interrupt && !h.waitSpeakIdle() {
+				if a.StoredID != 0 {
+					h.LogInfo(fmt.Sprintf("[播报] [推迟] 等待当前播报结束超时，暂存播报 %d 下次连接时下发", a.StoredID))
+				} else {
+					h.LogInfo(fmt.Sprintf("[播报] [放弃] 等待当前播报结束超时: %s", a.Text))
+				}
+				continue
+			}
+			h.inSession(func() { h.playAnnouncement(a) })
+		}
+	}
+}
+
+// waitSpeakIdle 等待当前播报结束，连接关闭或超时返回false
+func (h *ConnectionHandler) waitSpeakIdle() bool {
+	deadline := time.Now().Add(announceWaitTimeout)
+	ticker := time.NewTicker(announceCheckInterval)
+	defer ticker.Stop()
+	for h.isSpeaking() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-h.stopChan:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// playAnnouncement 以新轮次播放一条播报，按 tts start/sentence_start/sentence_end/stop 的顺序下发，
+// 在会话协程中调用
+func (h *ConnectionHandler) playAnnouncement(a Announcement) {
+	h.stopServerSpeak()
+	ctx, round := h.startRound(h.connContext(), a.Text)
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.LogInfo(fmt.Sprintf("[播报] [轮次 %d] text=%s audio=%s", round, a.Text, a.AudioPath))
+
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+		h.session.finishRound()
+		return
+	}
+	if a.StoredID != 0 {
+		if h.storedAnnouncements == nil {
+			h.storedAnnouncements = make(map[int]Announcement)
+		}
+		h.storedAnnouncements[round] = a
+	}
+
+	h.startReply(ctx, round, func(ctx context.Context) error {
+		if a.AudioPath != "" {
+			h.playFile(round, 1, a.AudioPath, a.Text)
+			return nil
+		}
+		if !a.SkipHistory {
+			h.dialogueManager.Put(chat.Message{
+				Role:    "assistant",
+				Content: a.Text,
+			})
+		}
+		return h.speakText(round, a.Text)
+	})
+}
+
+// deliverPendingAnnouncements 下发设备离线期间暂存的播报
+func (h *ConnectionHandler) deliverPendingAnnouncements() {
+	if h.deviceID == "" {
+		return
+	}
+	db := database.GetDB()
+	if err := database.DeleteExpiredDeviceAnnouncements(db); err != nil {
+		h.LogError(fmt.Sprintf("清理过期播报失败: %v", err))
+	}
+	announcements, err := database.ListPendingDeviceAnnouncements(db, h.deviceID)
+	if err != nil {
+		h.LogError(fmt.Sprintf("查询待下发播报失败: %v", err))
+		return
+	}
+	for _, item := range announcements {
+		if item.AudioPath != "" {
+			// 标记为已下发之前保留音频文件，连接断开后下次还能播放
+			h.pinnedAudio.Store(item.AudioPath, struct{}{})
+		}
+		err := h.Announce(Announcement{
+			Text:      item.Text,
+			AudioPath: item.AudioPath,
+			Interrupt: false,
+			StoredID:  item.ID,
+		})
+		if err != nil {
+			h.LogError(fmt.Sprintf("下发暂存播报失败: %v", err))
+			return
+		}
+	}
+	if len(announcements) > 0 {
+		h.LogInfo(fmt.Sprintf("[播报] [暂存] 已加入播报队列 %d 条离线播报", len(announcements)))
+	}
+}
+
+// settleAnnouncements 轮次不晚于round的暂存播报已播放完成或被打断，标记为已下发，只在会话协程中调用
+func (h *ConnectionHandler) settleAnnouncements(round int) {
+	for r, a := range h.storedAnnouncements {
+		if r > round {
+			continue
+		}
+		delete(h.storedAnnouncements, r)
+		go h.markAnnouncementDelivered(a)
+	}
+}
+
+// markAnnouncementDelivered 标记暂存播报已下发，并按配置删除其音频文件
+func (h *ConnectionHandler) markAnnouncementDelivered(a Announcement) {
+	if err := database.MarkDeviceAnnouncementDelivered(database.GetDB(), a.StoredID); err != nil {
+		h.LogError(fmt.Sprintf("标记播报 %d 已下发失败: %v", a.StoredID, err))
+		return
+	}
+	h.LogInfo(fmt.Sprintf("[播报] [暂存] 播报 %d 已下发", a.StoredID))
+	if a.AudioPath != "" {
+		h.pinnedAudio.Delete(a.AudioPath)
+		h.deleteAudioFileIfNeeded(a.AudioPath, "暂存播报已下发")
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openAnnounceDB(t *testing.T) *gorm.DB {
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+	})
+	return db
+}
+
+func isDelivered(db *gorm.DB, id uint) bool {
+	var item models.DeviceAnnouncement
+	return db.First(&item, id).Error == nil && item.Delivered
+}
+
+func TestStoredAnnouncementDeliveredAfterPlayback(t *testing.T) {
+	db := openAnnounceDB(t)
+	item := &models.DeviceAnnouncement{DeviceID: "dev-1", Text: "明天有雨，记得带伞", ExpireAt: time.Now().Add(time.Hour)}
+	require.NoError(t, database.AddDeviceAnnouncement(db, item))
+
+	s := newTestSession(t, newFakeLLM())
+	s.h.deviceID = "dev-1"
+	s.h.deliverPendingAnnouncements()
+
+	require.Eventually(t, func() bool { return s.conn.countTTS("stop") == 1 }, waitTimeout, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return isDelivered(db, item.ID) }, waitTimeout, 5*time.Millisecond)
+}
+
+func TestStoredAnnouncementKeptWhenConnectionDrops(t *testing.T) {
+	db := openAnnounceDB(t)
+	item := &models.DeviceAnnouncement{DeviceID: "dev-1", Text: "明天有雨，记得带伞", ExpireAt: time.Now().Add(time.Hour)}
+	require.NoError(t, database.AddDeviceAnnouncement(db, item))
+
+	s := newTestSession(t, newFakeLLM())
+	s.tts.hold.Store(true)
+	s.h.deviceID = "dev-1"
+	s.h.deliverPendingAnnouncements()
+	s.waitPhase(t, PhaseSpeaking)
+
+	// 播放过程中连接断开，下次连接时仍需下发
+	s.h.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, isDelivered(db, item.ID))
+	pending, err := database.ListPendingDeviceAnnouncements(db, "dev-1")
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func TestDeleteExpiredAnnouncementRemovesAudio(t *testing.T) {
+	db := openAnnounceDB(t)
+	audio := filepath.Join(t.TempDir(), "dev-1.wav")
+	require.NoError(t, os.WriteFile(audio, []byte("RIFF"), 0o644))
+	item := &models.DeviceAnnouncement{DeviceID: "dev-1", AudioPath: audio, ExpireAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, database.AddDeviceAnnouncement(db, item))
+
+	require.NoError(t, database.DeleteExpiredDeviceAnnouncements(db))
+	assert.NoFileExists(t, audio)
+	var count int64
+	db.Model(&models.DeviceAnnouncement{}).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/billing"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/providers/failover"
+	"xiaozhi-server-go/src/core/quota"
+)
+
+// summaryTimeout 压缩对话的LLM请求超时，超时后直接丢弃较早的对话
+const summaryTimeout = 15 * time.Second
+
+// hostedLLMTypes 自行维护会话历史的托管平台，只发送最后一条用户消息，本地历史不需要压缩
+var hostedLLMTypes = map[string]bool{"coze": true, "dify": true}
+
+var thinkBlockRe = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// contextBudget 当前LLM的上下文预算，未配置上下文窗口时返回 false
+func (h *ConnectionHandler) contextBudget() (chat.ContextBudget, bool) {
+	getter, ok := h.llmProvider().(llmConfigGetter)
+	if !ok || h.config == nil {
+		return chat.ContextBudget{}, false
+	}
+	cfg := getter.Config()
+	if hostedLLMTypes[cfg.Type] {
+		return chat.ContextBudget{}, false
+	}
+	window := cfg.ContextWindow
+	if window <= 0 {
+		window = h.config.Context.DefaultWindow
+	}
+	return chat.ContextBudget{
+		Window:    window,
+		Reserve:   h.config.Context.Reserve,
+		Tokenizer: chat.GetTokenizer(cfg.Tokenizer),
+	}, window > 0
+}
+
+// fitContext 对话历史超出上下文预算时，用当前LLM把较早的几轮对话压缩进摘要；
+// 压缩失败时直接丢弃这些对话，保证请求不超出模型的上下文窗口
+func (h *ConnectionHandler) fitContext(ctx context.Context) {
+	budget, ok := h.contextBudget()
+	if !ok {
+		return
+	}
+	old := h.dialogueManager.MessagesToCompress(budget)
+	if len(old) == 0 {
+		return
+	}
+
+	summary, err := h.summarizeDialogue(ctx, old)
+	if err != nil && ctx.Err() != nil {
+		return // 轮次已取消，本轮不再请求LLM，保留历史到下一轮再压缩
+	}
+	if err != nil {
+		h.LogError(fmt.Sprintf("[上下文] [压缩] 生成摘要失败，丢弃较早的 %d 条消息: %v", len(old), err))
+		summary = h.dialogueManager.Summary()
+	}
+	h.dialogueManager.Compress(len(old), summary)
+	h.LogInfo(fmt.Sprintf("[上下文] [压缩] 已压缩 %d 条消息，剩余 %d 条，摘要 %d 字",
+		len(old), h.dialogueManager.Length(), len([]rune(summary))))
+}
+
+// summarizeDialogue 把已有摘要与较早的对话合并为新的摘要
+func (h *ConnectionHandler) summarizeDialogue(ctx context.Context, old []chat.Message) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+
+	messages := chat.SummaryMessages(h.dialogueManager.Summary(), old)
+	responses, err := h.llmProvider().ResponseWithFunctions(ctx, h.sessionID, messages, nil)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	var usage *billing.Entry
+	for response := range responses {
+		if response.Error != "" {
+			return "", fmt.Errorf("%s", response.Error)
+		}
+		sb.WriteString(response.Content)
+		if response.Usage != nil {
+			usage = &billing.Entry{
+				PromptTokens:     int64(response.Usage.PromptTokens),
+				CompletionTokens: int64(response.Usage.CompletionTokens),
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	summary := strings.TrimSpace(thinkBlockRe.ReplaceAllString(sb.String(), ""))
+	if summary == "" {
+		return "", fmt.Errorf("摘要为空")
+	}
+	if usage == nil {
+		prompt, completion := estimateLLMTokens(messages, sb.String())
+		usage = &billing.Entry{PromptTokens: prompt, CompletionTokens: completion}
+	}
+	usage.Requests = 1
+	h.addUsage(func(u *quota.Usage) { u.LLMTokens += usage.PromptTokens + usage.CompletionTokens })
+	h.addProviderUsage(failover.KindLLM, *usage)
+	return summary, nil
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 托管平台会话。
+* Dify 等平台自行维护对话历史，按设备ID作为平台用户，平台返回的会话ID保存在设备的 Conversationid 上，
+* 设备重连后继续同一会话；智能体 Extra 中的 inputs 作为应用变量传给平台。
+* 不需要这些信息的提供者忽略 SetIdentityFlag。
+ */
+
+// setupConversation 把设备、会话ID和智能体变量交给LLM提供者，需在 setupFailover 之后调用
+func (h *ConnectionHandler) setupConversation(agent *models.Agent) {
+	if h.providers.llm == nil {
+		return
+	}
+	user := h.deviceID
+	if user == "" {
+		user = h.sessionID
+	}
+	conversationID := ""
+	if h.deviceID != "" && database.GetDB() != nil {
+		if device, err := database.FindDeviceByID(database.GetDB(), h.deviceID); err == nil && device != nil {
+			conversationID = device.Conversationid
+		}
+	}
+	inputs := ""
+	if agent != nil && agent.Extra != "" {
+		var extra map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(agent.Extra), &extra); err == nil {
+			inputs = string(extra["inputs"])
+		}
+	}
+	h.providers.llm.SetIdentityFlag(llm.IdentityUser, user)
+	h.providers.llm.SetIdentityFlag(llm.IdentityConversation, conversationID)
+	h.providers.llm.SetIdentityFlag(llm.IdentityInputs, inputs)
+}
+
+// saveConversationID 保存平台返回的会话ID，供设备重连后继续同一会话
+func (h *ConnectionHandler) saveConversationID(conversationID string) {
+	if h.deviceID == "" || database.GetDB() == nil {
+		return
+	}
+	if err := database.UpdateDeviceConversationID(database.GetDB(), h.deviceID, conversationID); err != nil {
+		h.LogError(fmt.Sprintf("保存设备会话ID失败: %v", err))
+		return
+	}
+	h.LogInfo(fmt.Sprintf("[LLM] [会话] 设备 %s 会话ID更新为 %s", h.deviceID, conversationID))
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"xiaozhi-server-go/src/configs/database"
+)
+
+/*
+* 对话记录。
+* 开启录音时，每轮对话结束后把本次连接的对话历史保存为智能体的一条对话记录（AgentDialog），
+* 本次连接的录音记录同一个对话ID，通过对话ID与轮次即可找到每轮的用户语音与回复语音。
+* 对话ID按连接生成，设备重连后是新的对话记录；会话恢复沿用原来的连接，对话ID不变。
+ */
+
+// dialogID 本次连接的对话ID，与录音目录中的会话目录名一致
+func (h *ConnectionHandler) dialogID() string {
+	return fmt.Sprintf("%s_%s", h.connectedAt.Format("20060102-150405"), h.sessionID)
+}
+
+// saveDialog 保存本次连接的对话历史，只在开启录音且设备绑定了智能体时保存
+func (h *ConnectionHandler) saveDialog() {
+	if h.agentID == 0 || (!h.config.SaveUserAudio && !h.config.SaveTTSAudio) {
+		return
+	}
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	dialog, err := h.dialogueManager.ToJSON(false)
+	if err != nil {
+		h.LogError(fmt.Sprintf("[对话记录] 序列化对话历史失败: %v", err))
+		return
+	}
+	agentID, userID, conversationID := h.agentID, h.userID, h.dialogID()
+	go func() {
+		// 相邻两轮的保存可能同时进行，按顺序写入避免重复创建
+		h.dialogSaveMu.Lock()
+		defer h.dialogSaveMu.Unlock()
+		if err := database.SaveAgentDialog(db, agentID, userID, dialog, conversationID); err != nil {
+			h.LogError(fmt.Sprintf("[对话记录] 保存对话记录失败: %v", err))
+		}
+	}()
+}
@@ -0,0 +1,14 @@
+package core
+
+// eventSession 提供事件发布所需的会话信息
+func (h *ConnectionHandler) eventSession() (sessionID, deviceID string, userID, agentID uint) {
+	return h.sessionID, h.deviceID, h.userID, h.agentID
+}
+
+// publishEvent 发布会话事件，供控制台实时事件流等订阅者使用
+func (h *ConnectionHandler) publishEvent(eventType string, data map[string]interface{}) {
+	if h.eventPublisher == nil {
+		return
+	}
+	h.eventPublisher.Publish(eventType, data)
+}
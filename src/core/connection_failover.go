@@ -0,0 +1,194 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/providers/failover"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 提供者容灾。
+* 智能体为 LLM/TTS/ASR 配置了备用提供者时，用容灾包装替换当前的提供者，主提供者出错或超时时依次切换到备用提供者。
+* 备用提供者按配置名称单独创建，不占用资源池，会话结束时清理；主提供者仍由资源池管理。
+ */
+
+type asrConfigGetter interface {
+	Config() *asr.Config
+}
+
+// splitFallbacks 解析智能体配置的备用提供者列表，去掉与主提供者重名的项
+func splitFallbacks(value, primary string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && name != primary {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// setupFailover 根据智能体配置的备用提供者包装当前的提供者，需在 checkTTSProvider/checkLLMProvider 之后调用
+func (h *ConnectionHandler) setupFailover(agent *models.Agent, config *configs.Config) {
+	if agent == nil {
+		return
+	}
+	onSwitch := func(kind, from, to string, err error) {
+		data := map[string]interface{}{"kind": kind, "from": from, "to": to}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		h.publishEvent(events.TypeFailover, data)
+	}
+
+	if getter, ok := h.providers.llm.(llmConfigGetter); ok && agent.LLMFallbacks != "" {
+		names := []string{getter.Config().Name}
+		members := []providers.LLMProvider{h.providers.llm}
+		for _, name := range splitFallbacks(agent.LLMFallbacks, names[0]) {
+			cfg, ok := config.LLM[name]
+			if !ok {
+				h.LogError(fmt.Sprintf("[容灾] 备用LLM %s 不存在", name))
+				continue
+			}
+			p, err := llm.Create(cfg.Type, &llm.Config{
+				Name:             name,
+				Type:             cfg.Type,
+				ModelName:        cfg.ModelName,
+				BaseURL:          cfg.BaseURL,
+				APIKey:           cfg.APIKey,
+				Temperature:      cfg.Temperature,
+				MaxTokens:        cfg.MaxTokens,
+				TopP:             cfg.TopP,
+				Stop:             cfg.Stop,
+				Seed:             cfg.Seed,
+				PresencePenalty:  cfg.PresencePenalty,
+				FrequencyPenalty: cfg.FrequencyPenalty,
+				ReasoningEffort:  cfg.ReasoningEffort,
+				ToolMode:         cfg.ToolMode,
+				ContextWindow:    cfg.ContextWindow,
+				Tokenizer:        cfg.Tokenizer,
+				Extra:            cfg.Extra,
+			})
+			if err != nil {
+				h.LogError(fmt.Sprintf("[容灾] 创建备用LLM %s 失败: %v", name, err))
+				continue
+			}
+			names = append(names, name)
+			members = append(members, p)
+		}
+		if len(members) > 1 {
+			h.providers.llm = failover.NewLLMProvider(names, members, h.logger, onSwitch)
+			h.LogInfo(fmt.Sprintf("[容灾] LLM 提供者顺序: %v", names))
+		}
+	}
+
+	if getter, ok := h.providers.tts.(ttsConfigGetter); ok && agent.TTSFallbacks != "" {
+		names := []string{getter.Config().Name}
+		members := []providers.TTSProvider{h.providers.tts}
+		for _, name := range splitFallbacks(agent.TTSFallbacks, names[0]) {
+			cfg, ok := config.TTS[name]
+			if !ok {
+				h.LogError(fmt.Sprintf("[容灾] 备用TTS %s 不存在", name))
+				continue
+			}
+			p, err := tts.Create(cfg.Type, &tts.Config{
+				Name:            name,
+				Type:            cfg.Type,
+				OutputDir:       cfg.OutputDir,
+				Voice:           cfg.Voice,
+				Format:          cfg.Format,
+				SampleRate:      h.serverAudioSampleRate,
+				AppID:           cfg.AppID,
+				Token:           cfg.Token,
+				Cluster:         cfg.Cluster,
+				SupportedVoices: cfg.SupportedVoices,
+			}, config.DeleteAudio)
+			if err != nil {
+				h.LogError(fmt.Sprintf("[容灾] 创建备用TTS %s 失败: %v", name, err))
+				continue
+			}
+			names = append(names, name)
+			members = append(members, p)
+		}
+		if len(members) > 1 {
+			h.providers.tts = failover.NewTTSProvider(names, members, h.logger, onSwitch)
+			h.LogInfo(fmt.Sprintf("[容灾] TTS 提供者顺序: %v", names))
+		}
+	}
+
+	if getter, ok := h.providers.asr.(asrConfigGetter); ok && agent.ASRFallbacks != "" {
+		names := []string{getter.Config().Name}
+		members := []providers.ASRProvider{h.providers.asr}
+		for _, name := range splitFallbacks(agent.ASRFallbacks, names[0]) {
+			cfg, ok := config.ASR[name]
+			if !ok {
+				h.LogError(fmt.Sprintf("[容灾] 备用ASR %s 不存在", name))
+				continue
+			}
+			asrType, _ := cfg["type"].(string)
+			p, err := asr.Create(asrType, &asr.Config{Name: name, Type: name, Data: cfg}, config.DeleteAudio, h.logger)
+			if err != nil {
+				h.LogError(fmt.Sprintf("[容灾] 创建备用ASR %s 失败: %v", name, err))
+				continue
+			}
+			member, ok := p.(providers.ASRProvider)
+			if !ok {
+				h.LogError(fmt.Sprintf("[容灾] 备用ASR %s 未实现ASR接口", name))
+				p.Cleanup()
+				continue
+			}
+			names = append(names, name)
+			members = append(members, member)
+		}
+		if len(members) > 1 {
+			h.providers.asr = failover.NewASRProvider(names, members, h.logger, onSwitch)
+			h.LogInfo(fmt.Sprintf("[容灾] ASR 提供者顺序: %v", names))
+		}
+	}
+}
+
+// clearFailover 清理备用提供者，恢复为资源池分配的主提供者
+func (h *ConnectionHandler) clearFailover() {
+	if p, ok := h.providers.llm.(*failover.LLMProvider); ok {
+		p.Cleanup()
+		h.providers.llm = p.Primary()
+	}
+	if p, ok := h.providers.tts.(*failover.TTSProvider); ok {
+		p.Cleanup()
+		h.providers.tts = p.Primary()
+	}
+	if p, ok := h.providers.asr.(*failover.ASRProvider); ok {
+		p.Cleanup()
+		h.providers.asr = p.Primary()
+	}
+}
+
+// activeProviders 当前实际使用的提供者名称，未配置备用提供者的类型使用主提供者名称
+func (h *ConnectionHandler) activeProviders() map[string]string {
+	h.providersMu.RLock()
+	defer h.providersMu.RUnlock()
+	result := make(map[string]string)
+	if p, ok := h.providers.llm.(*failover.LLMProvider); ok {
+		result[failover.KindLLM] = p.Active()
+	} else if getter, ok := h.providers.llm.(llmConfigGetter); ok {
+		result[failover.KindLLM] = getter.Config().Name
+	}
+	if p, ok := h.providers.tts.(*failover.TTSProvider); ok {
+		result[failover.KindTTS] = p.Active()
+	} else if getter, ok := h.providers.tts.(ttsConfigGetter); ok {
+		result[failover.KindTTS] = getter.Config().Name
+	}
+	if p, ok := h.providers.asr.(*failover.ASRProvider); ok {
+		result[failover.KindASR] = p.Active()
+	} else if getter, ok := h.providers.asr.(asrConfigGetter); ok {
+		result[failover.KindASR] = getter.Config().Name
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"xiaozhi-server-go/src/core/iot"
+	"xiaozhi-server-go/src/core/types"
+)
+
+// handleIotMessage 处理IOT设备消息
+// 旧版固件通过descriptors上报可控制的设备，通过states上报设备状态
+func (h *ConnectionHandler) handleIotMessage(msgMap map[string]interface{}) error {
+	if raw, ok := msgMap["descriptors"].([]interface{}); ok {
+		descriptors, err := iot.ParseDescriptors(raw)
+		if err != nil {
+			return err
+		}
+		tools := h.iotManager.UpdateDescriptors(descriptors)
+		for _, tool := range tools {
+			h.functionRegister.RegisterFunction(tool.Function.Name, tool)
+		}
+		h.LogInfo(fmt.Sprintf("[IOT] [描述符] 收到 %d 个设备，注册 %d 个工具", len(descriptors), len(tools)))
+	}
+	if raw, ok := msgMap["states"].([]interface{}); ok {
+		states, err := iot.ParseStates(raw)
+		if err != nil {
+			return err
+		}
+		h.iotManager.UpdateStates(states)
+		h.LogDebug(fmt.Sprintf("[IOT] [状态] 更新 %d 个设备状态", len(states)))
+	}
+	return nil
+}
+
+// handleIotToolCall 处理IoT工具调用，查询状态直接返回给LLM，方法调用下发iot命令到设备
+func (h *ConnectionHandler) handleIotToolCall(name string, args map[string]interface{}) types.ActionResponse {
+	if name == iot.GetStatesToolName {
+		deviceName, _ := args["name"].(string)
+		return types.ActionResponse{
+			Action: types.ActionTypeReqLLM,
+			Result: h.iotManager.StatesText(deviceName),
+		}
+	}
+
+	command, err := h.iotManager.BuildCommand(name, args)
+	if err != nil {
+		h.LogError(fmt.Sprintf("[IOT] [命令] 构造失败: %v", err))
+		return types.ActionResponse{
+			Action: types.ActionTypeReqLLM,
+			Result: fmt.Sprintf("设备控制失败: %v", err),
+		}
+	}
+	data, err := iot.NewCommandMessage(h.sessionID, *command)
+	if err != nil {
+		return types.ActionResponse{
+			Action: types.ActionTypeReqLLM,
+			Result: fmt.Sprintf("设备控制失败: %v", err),
+		}
+	}
+	if err := h.conn.WriteMessage(1, data); err != nil {
+		h.LogError(fmt.Sprintf("[IOT] [命令] 发送失败: %v", err))
+		return types.ActionResponse{
+			Action: types.ActionTypeReqLLM,
+			Result: fmt.Sprintf("设备控制命令发送失败: %v", err),
+		}
+	}
+	h.LogInfo(fmt.Sprintf("[IOT] [命令] %s.%s %v", command.Name, command.Method, command.Parameters))
+	return types.ActionResponse{
+		Action: types.ActionTypeReqLLM,
+		Result: fmt.Sprintf("已向设备 %s 发送 %s 指令，参数: %v", command.Name, command.Method, command.Parameters),
+	}
+}
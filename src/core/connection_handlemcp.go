@@ -1,7 +1,6 @@
 package core
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -21,6 +20,10 @@ func (h *ConnectionHandler) initMCPResultHandlers() {
 		"mcp_handler_change_role":  h.mcp_handler_change_role,
 		"mcp_handler_play_music":   h.mcp_handler_play_music,
 		"mcp_handler_switch_agent": h.mcp_handler_switch_agent,
+
+		"mcp_handler_set_reminder":    h.mcp_handler_set_reminder,
+		"mcp_handler_list_reminders":  h.mcp_handler_list_reminders,
+		"mcp_handler_cancel_reminder": h.mcp_handler_cancel_reminder,
 	}
 }
 
@@ -77,27 +80,16 @@ func (h *ConnectionHandler) mcp_handler_switch_agent(args interface{}) string {
 		h.SystemSpeak("切换智能体失败：无法获取智能体列表")
 		return "切换智能体失败：无法获取智能体列表"
 	}
-	device, err := database.FindDeviceByID(database.GetDB(), h.deviceID) // 确保设备存在
-	if err != nil || device == nil {
-		h.logger.Error("mcp_handler_switch_agent: FindDeviceByID failed: %v", err)
-		h.SystemSpeak("切换智能体失败：无法获取设备信息")
-		return "切换智能体失败：无法获取设备信息"
-	}
-
 	for _, ag := range agents {
 		if ag.ID == newAgentID || (agentName != "" && ag.Name == agentName) {
 			// 找到对应的agent
 			h.logger.Info("mcp_handler_switch_agent: found agent %d, name %s", ag.ID, ag.Name)
-			h.agentID = ag.ID
-			device.AgentID = &ag.ID
-			database.UpdateDevice(database.GetDB(), device) // 更新设备的agent_id
-			agent, prompt := h.InitWithAgent()
-			// 更新对话系统提示并保留最近上下文
-			h.dialogueManager.SetSystemMessage(prompt)
-			h.dialogueManager.KeepRecentMessages(1)
-			// 重新检查并切换提供者
-			h.checkTTSProvider(agent, h.config)
-			h.checkLLMProvider(agent, h.config)
+			agent, err := h.SwitchAgent(ag.ID)
+			if err != nil {
+				h.logger.Error("mcp_handler_switch_agent: %v", err)
+				h.SystemSpeak("切换智能体失败：无法获取设备信息")
+				return "切换智能体失败：无法获取设备信息"
+			}
 
 			if agent != nil && agent.Name != "" {
 				h.SystemSpeak("已切换到 " + agent.Name)
@@ -147,7 +139,8 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) string {
 			return "没有找到名为" + songName + "的歌曲"
 		} else {
 			//h.SystemSpeak("这就为您播放音乐: " + songName)
-			h.sendAudioMessage(path, name, h.tts_last_text_index, h.talkRound)
+			state := h.snapshot()
+			h.playFile(state.round, state.lastIndex+1, path, name)
 			return "正在播放音乐: " + name
 		}
 	} else {
@@ -159,12 +152,13 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) string {
 func (h *ConnectionHandler) mcp_handler_change_voice(args interface{}) string {
 	if voice, ok := args.(string); ok {
 		h.logger.Info("mcp_handler_change_voice: %s", voice)
-		if err, voiceName := h.providers.tts.SetVoice(voice); err != nil {
+		if err, voiceName := h.ttsProvider().SetVoice(voice); err != nil {
 			h.logger.Error("mcp_handler_change_voice: SetVoice failed: %v", err)
 			h.SystemSpeak("切换语音失败，没有叫" + voice + "的音色")
 			return "切换语音失败，没有叫" + voice + "的音色"
 		} else {
 			h.LogInfo(fmt.Sprintf("mcp_handler_change_voice: SetVoice success: %s", voiceName))
+			h.voiceName = voiceName
 			h.SystemSpeak("已切换到音色" + voice)
 			return "切换语音成功，当前音色: " + voiceName
 		}
@@ -182,15 +176,15 @@ func (h *ConnectionHandler) mcp_handler_change_role(args interface{}) string {
 		h.logger.Info("mcp_handler_change_role: %s", role)
 		h.dialogueManager.SetSystemMessage(prompt)
 		h.dialogueManager.KeepRecentMessages(5) // 保留最近5条消息
-		if getter, ok := h.providers.tts.(ttsConfigGetter); ok {
-			ttsProvider := getter.Config().Type
-			if ttsProvider == "edge" {
+		ttsProvider := h.ttsProvider()
+		if getter, ok := ttsProvider.(ttsConfigGetter); ok {
+			if getter.Config().Type == "edge" {
 				if role == "陕西女友" {
-					h.providers.tts.SetVoice("zh-CN-shaanxi-XiaoniNeural") // 陕西女友音色
+					ttsProvider.SetVoice("zh-CN-shaanxi-XiaoniNeural") // 陕西女友音色
 				} else if role == "英语老师" {
-					h.providers.tts.SetVoice("zh-CN-XiaoyiNeural") // 英语老师音色
+					ttsProvider.SetVoice("zh-CN-XiaoyiNeural") // 英语老师音色
 				} else if role == "好奇小男孩" {
-					h.providers.tts.SetVoice("zh-CN-YunxiNeural") // 好奇小男孩音色
+					ttsProvider.SetVoice("zh-CN-YunxiNeural") // 好奇小男孩音色
 				}
 			}
 		}
@@ -204,7 +198,7 @@ func (h *ConnectionHandler) mcp_handler_change_role(args interface{}) string {
 
 func (h *ConnectionHandler) mcp_handler_exit(args interface{}) string {
 	if text, ok := args.(string); ok {
-		h.closeAfterChat = true
+		h.closeAfterChat.Store(true)
 		h.SystemSpeak(text)
 		return "即将结束对话: " + text
 	} else {
@@ -224,7 +218,8 @@ func (h *ConnectionHandler) mcp_handler_take_photo(args interface{}) string {
 
 	if !visionResponse.Success {
 		h.logger.Error("拍照失败: %s", visionResponse.Message)
-		h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
+		round := h.currentRound()
+		h.genResponseByLLM(h.roundContext(round), h.dialogueManager.GetLLMDialogue(), round)
 		return "拍照失败: " + visionResponse.Message
 	}
 
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"xiaozhi-server-go/src/core/billing"
 	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/events"
 	"xiaozhi-server-go/src/core/image"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/failover"
+	"xiaozhi-server-go/src/core/quota"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -18,29 +22,15 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 		h.clientTextQueue <- string(message)
 		return nil
 	case 2: // 二进制消息（音频数据）
-		if h.clientAudioFormat == "pcm" {
-			// 直接将PCM数据放入队列
-			h.clientAudioQueue <- message
-		} else if h.clientAudioFormat == "opus" {
-			// 检查是否初始化了opus解码器
-			if h.opusDecoder != nil {
-				// 解码opus数据为PCM
-				decodedData, err := h.opusDecoder.Decode(message)
-				if err != nil {
-					h.logger.Error(fmt.Sprintf("解码Opus音频失败: %v", err))
-					// 即使解码失败，也尝试将原始数据传递给ASR处理
-					h.clientAudioQueue <- message
-				} else {
-					// 解码成功，将PCM数据放入队列
-					h.logger.Debug(fmt.Sprintf("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData)))
-					if len(decodedData) > 0 {
-						h.clientAudioQueue <- decodedData
-					}
-				}
-			} else {
-				// 没有解码器，直接传递原始数据
-				h.clientAudioQueue <- message
-			}
+		// 音频参数和解码器由会话协程在 hello 消息中更新
+		h.audioMu.Lock()
+		seconds := h.audioSeconds(message)
+		data := h.decodeAudio(message)
+		h.audioMu.Unlock()
+		h.addUsage(func(u *quota.Usage) { u.ASRSeconds += seconds })
+		h.addProviderUsage(failover.KindASR, billing.Entry{AudioSeconds: seconds})
+		if len(data) > 0 {
+			h.clientAudioQueue <- data
 		}
 		return nil
 	default:
@@ -49,6 +39,33 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 	}
 }
 
+// decodeAudio 把上行音频转换为送入ASR的数据，未知格式返回nil，需持有 audioMu
+func (h *ConnectionHandler) decodeAudio(message []byte) []byte {
+	if h.clientAudioFormat == "pcm" {
+		// 直接将PCM数据放入队列
+		h.appendUserAudio(message)
+		return message
+	}
+	if h.clientAudioFormat != "opus" {
+		return nil
+	}
+	// 检查是否初始化了opus解码器
+	if h.opusDecoder == nil {
+		// 没有解码器，直接传递原始数据
+		return message
+	}
+	// 解码opus数据为PCM
+	decodedData, err := h.opusDecoder.Decode(message)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("解码Opus音频失败: %v", err))
+		// 即使解码失败，也尝试将原始数据传递给ASR处理
+		return message
+	}
+	h.logger.Debug(fmt.Sprintf("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData)))
+	h.appendUserAudio(decodedData)
+	return decodedData
+}
+
 // processClientTextMessage 处理文本数据
 func (h *ConnectionHandler) processClientTextMessage(ctx context.Context, text string) error {
 	// 解析JSON消息
@@ -114,6 +131,25 @@ func (h *ConnectionHandler) handleVisionMessage(msgMap map[string]interface{}) e
 // 客户端会上传语音格式和采样率等信息
 func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) error {
 	h.LogInfo(fmt.Sprintf("[客户端] [hello 收到欢迎消息] %v", msgMap))
+	h.applyClientAudioParams(msgMap)
+
+	// 发送消息时不持有 audioMu，避免客户端写入缓慢时阻塞上行音频的处理
+	h.publishEvent(events.TypeHello, map[string]interface{}{
+		"audio_params": msgMap["audio_params"],
+		"features":     msgMap["features"],
+		"version":      msgMap["version"],
+		"transport":    msgMap["transport"],
+	})
+	h.sendHelloMessage()
+	h.deliverResumedAnnouncements()    // 下发断线前未播放的内容
+	go h.deliverPendingAnnouncements() // 下发离线期间暂存的播报
+	return nil
+}
+
+// applyClientAudioParams 按hello中的音频参数更新客户端音频格式并重建Opus解码器
+func (h *ConnectionHandler) applyClientAudioParams(msgMap map[string]interface{}) {
+	h.audioMu.Lock()
+	defer h.audioMu.Unlock()
 	// 获取客户端编码格式
 	if audioParams, ok := msgMap["audio_params"].(map[string]interface{}); ok {
 		if format, ok := audioParams["format"].(string); ok {
@@ -135,7 +171,6 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 		h.LogInfo(fmt.Sprintf("[客户端] [音频参数 %s/%d/%d/%d]",
 			h.clientAudioFormat, h.clientAudioSampleRate, h.clientAudioChannels, h.clientAudioFrameDuration))
 	}
-	h.sendHelloMessage()
 	h.closeOpusDecoder()
 	// 初始化opus解码器
 	opusDecoder, err := utils.NewOpusDecoder(&utils.OpusDecoderConfig{
@@ -148,8 +183,6 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 		h.opusDecoder = opusDecoder
 		h.LogInfo("[Opus] [解码器] 初始化成功")
 	}
-
-	return nil
 }
 
 // handleListenMessage 处理语音相关消息
@@ -164,18 +197,23 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 	// 处理mode参数
 	if mode, ok := msgMap["mode"].(string); ok {
 		h.clientListenMode = mode
+		h.publishSession() // ASR回调按快照中的拾音模式处理识别结果
 		h.LogInfo(fmt.Sprintf("[客户端] [拾音模式 %s/%s]", h.clientListenMode, state))
-		h.providers.asr.SetListener(h)
+		h.asrProvider().SetListener(h)
 	}
 
+	h.clientListenState = state
 	switch state {
 	case "start":
-		if h.client_asr_text != "" && h.clientListenMode == "manual" {
+		if h.session.asrText != "" && h.clientListenMode == "manual" {
 			h.clientAbortChat()
 		}
-		h.client_asr_text = ""
+		h.session.asrText = ""
+		h.session.setListening(true)
+		h.resetUserAudio()
 	case "stop":
-		h.providers.asr.SendLastAudio([]byte{}) // 发送空数据标记结束
+		h.session.setListening(false)
+		h.asrProvider().SendLastAudio([]byte{}) // 发送空数据标记结束
 		h.LogInfo("客户端停止语音识别")
 	case "detect":
 		text, hasText := msgMap["text"].(string)
@@ -183,7 +221,7 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 		if hasText && text != "" {
 			// 只有文本，使用普通LLM处理
 			h.LogInfo(fmt.Sprintf("[检测] [纯文本消息 %s] 使用LLM处理", text))
-			return h.handleChatMessage(context.Background(), text)
+			return h.handleChatMessage(h.connContext(), text)
 		} else {
 			// 既没有图片也没有文本
 			h.logger.Warn("detect消息既没有text也没有image参数")
@@ -193,28 +231,8 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 	return nil
 }
 
-// handleIotMessage 处理IOT设备消息
-func (h *ConnectionHandler) handleIotMessage(msgMap map[string]interface{}) error {
-	if descriptors, ok := msgMap["descriptors"].([]interface{}); ok {
-		// 处理设备描述符
-		// 这里需要实现具体的IOT设备描述符处理逻辑
-		h.LogInfo(fmt.Sprintf("收到IOT设备描述符：%v", descriptors))
-	}
-	if states, ok := msgMap["states"].([]interface{}); ok {
-		// 处理设备状态
-		// 这里需要实现具体的IOT设备状态处理逻辑
-		h.LogInfo(fmt.Sprintf("收到IOT设备状态：%v", states))
-	}
-	return nil
-}
-
 // handleImageMessage 处理图片消息
 func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[string]interface{}) error {
-	// 增加对话轮次
-	h.talkRound++
-	currentRound := h.talkRound
-	h.LogInfo(fmt.Sprintf("开始新的图片对话轮次: %d", currentRound))
-
 	// 检查是否有VLLLM Provider
 	if h.providers.vlllm == nil {
 		h.logger.Warn("未配置VLLLM服务，图片消息将被忽略")
@@ -257,21 +275,28 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		"data_length": len(imageData.Data),
 	}))
 
+	// 增加对话轮次
+	ctx, currentRound := h.startRound(ctx, text)
+	h.LogInfo(fmt.Sprintf("开始新的图片对话轮次: %d", currentRound))
+
 	// 立即发送STT消息
 	err := h.sendSTTMessage(text)
 	if err != nil {
+		h.session.finishRound()
 		h.logger.Error(fmt.Sprintf("发送STT消息失败: %v", err))
 		return fmt.Errorf("发送STT消息失败: %v", err)
 	}
 
 	// 发送TTS开始状态
 	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.session.finishRound()
 		h.logger.Error(fmt.Sprintf("发送TTS开始状态失败: %v", err))
 		return fmt.Errorf("发送TTS开始状态失败: %v", err)
 	}
 
 	// 发送思考状态的情绪
 	if err := h.sendEmotionMessage("thinking"); err != nil {
+		h.session.finishRound()
 		h.logger.Error(fmt.Sprintf("发送思考状态情绪消息失败: %v", err))
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
@@ -296,5 +321,8 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		})
 	}
 
-	return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
+	h.startReply(ctx, currentRound, func(ctx context.Context) error {
+		return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
+	})
+	return nil
 }
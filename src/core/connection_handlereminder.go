@@ -0,0 +1,178 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/reminder"
+)
+
+// 提醒时间支持的文本格式
+var reminderTimeLayouts = []string{
+	reminder.TimeLayout,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04",
+}
+
+// reminderUserID 获取设备所属用户，未绑定用户的设备归属管理员
+func (h *ConnectionHandler) reminderUserID() uint {
+	if h.userID != 0 {
+		return h.userID
+	}
+	return database.AdminUserID
+}
+
+// mcp_handler_set_reminder 设置提醒，参数 {"content","time"|"delay_minutes","repeat"}
+func (h *ConnectionHandler) mcp_handler_set_reminder(args interface{}) string {
+	params, ok := args.(map[string]interface{})
+	if !ok {
+		h.logger.Error("mcp_handler_set_reminder: args is not a map")
+		return "设置提醒失败：参数格式错误"
+	}
+	if h.deviceID == "" {
+		h.SystemSpeak("当前设备不支持设置提醒")
+		return "设置提醒失败：缺少设备ID"
+	}
+
+	content, _ := params["content"].(string)
+	repeat, _ := params["repeat"].(string)
+	at, err := parseReminderTime(params, time.Now())
+	if err != nil {
+		h.SystemSpeak("设置提醒失败，" + err.Error())
+		return "设置提醒失败：" + err.Error()
+	}
+
+	r, err := reminder.New(database.GetDB(), h.reminderUserID(), h.deviceID, content, at, repeat)
+	if err != nil {
+		h.logger.Error("mcp_handler_set_reminder: %v", err)
+		h.SystemSpeak("设置提醒失败，" + err.Error())
+		return "设置提醒失败：" + err.Error()
+	}
+
+	h.LogInfo(fmt.Sprintf("[提醒] [设置] %s", reminder.Describe(r)))
+	text := fmt.Sprintf("好的，已设置%s的提醒：%s", r.NextRunAt.Format("01月02日15点04分"), r.Content)
+	if r.Repeat != "" {
+		text = fmt.Sprintf("好的，已设置%s提醒，下次在%s：%s",
+			reminder.DescribeRepeat(r.Repeat), r.NextRunAt.Format("01月02日15点04分"), r.Content)
+	}
+	h.SystemSpeak(text)
+	return "设置提醒成功：" + reminder.Describe(r)
+}
+
+// mcp_handler_list_reminders 列出当前设备已启用的提醒
+func (h *ConnectionHandler) mcp_handler_list_reminders(args interface{}) string {
+	reminders, err := database.ListActiveRemindersByDevice(database.GetDB(), h.deviceID)
+	if err != nil {
+		h.logger.Error("mcp_handler_list_reminders: %v", err)
+		h.SystemSpeak("查询提醒失败")
+		return "查询提醒失败"
+	}
+	if len(reminders) == 0 {
+		h.SystemSpeak("你还没有设置任何提醒")
+		return "当前没有提醒"
+	}
+
+	items := make([]string, 0, len(reminders))
+	for i := range reminders {
+		items = append(items, reminder.Describe(&reminders[i]))
+	}
+	text := fmt.Sprintf("你一共有%d个提醒：%s", len(reminders), strings.Join(items, "；"))
+	h.SystemSpeak(text)
+	return text
+}
+
+// mcp_handler_cancel_reminder 取消提醒，参数 {"id"} 或 {"keyword"}
+func (h *ConnectionHandler) mcp_handler_cancel_reminder(args interface{}) string {
+	params, ok := args.(map[string]interface{})
+	if !ok {
+		h.logger.Error("mcp_handler_cancel_reminder: args is not a map")
+		return "取消提醒失败：参数格式错误"
+	}
+
+	db := database.GetDB()
+	var id uint
+	switch v := params["id"].(type) {
+	case float64:
+		id = uint(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			id = uint(n)
+		}
+	}
+	keyword, _ := params["keyword"].(string)
+	keyword = strings.TrimSpace(keyword)
+
+	if id == 0 && keyword != "" {
+		reminders, err := database.ListActiveRemindersByDevice(db, h.deviceID)
+		if err != nil {
+			h.logger.Error("mcp_handler_cancel_reminder: %v", err)
+		}
+		matched := 0
+		for _, r := range reminders {
+			if strings.Contains(r.Content, keyword) {
+				id = r.ID
+				matched++
+			}
+		}
+		if matched > 1 {
+			h.SystemSpeak("有多个提醒包含" + keyword + "，请告诉我要取消哪一个")
+			return fmt.Sprintf("有%d个提醒包含关键词%s，需要用户确认编号", matched, keyword)
+		}
+	}
+	if id == 0 {
+		h.SystemSpeak("没有找到要取消的提醒")
+		return "取消提醒失败：没有找到对应的提醒"
+	}
+
+	r, err := database.FindReminderByIDAndDevice(db, id, h.deviceID)
+	if err != nil {
+		h.SystemSpeak("没有找到要取消的提醒")
+		return "取消提醒失败：没有找到对应的提醒"
+	}
+	if err := database.DeleteReminder(db, r.ID); err != nil {
+		h.logger.Error("mcp_handler_cancel_reminder: %v", err)
+		h.SystemSpeak("取消提醒失败")
+		return "取消提醒失败"
+	}
+
+	h.LogInfo(fmt.Sprintf("[提醒] [取消] %s", reminder.Describe(r)))
+	h.SystemSpeak("已取消提醒：" + r.Content)
+	return "取消提醒成功：" + r.Content
+}
+
+// parseReminderTime 解析工具参数中的提醒时间，只给出时分时取今天，已过去则取明天
+func parseReminderTime(params map[string]interface{}, now time.Time) (time.Time, error) {
+	switch v := params["delay_minutes"].(type) {
+	case float64:
+		if v > 0 {
+			return now.Add(time.Duration(v * float64(time.Minute))), nil
+		}
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && n > 0 {
+			return now.Add(time.Duration(n * float64(time.Minute))), nil
+		}
+	}
+
+	text, _ := params["time"].(string)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, fmt.Errorf("没有说明提醒时间")
+	}
+	for _, layout := range reminderTimeLayouts {
+		if t, err := time.ParseInLocation(layout, text, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", text, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("无法识别提醒时间 %s", text)
+}
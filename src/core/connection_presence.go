@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/models"
+)
+
+// 在线状态心跳间隔，心跳时更新设备与连接记录的最后活跃时间
+const presenceHeartbeatInterval = 60 * time.Second
+
+// 连接记录清理间隔，各连接的心跳共用，间隔内只清理一次
+const connectionCleanupInterval = time.Hour
+
+// lastConnectionCleanup 上次清理连接记录的时间（Unix秒）
+var lastConnectionCleanup atomic.Int64
+
+// 连接断开原因
+const (
+	DisconnectReasonClient = "client_closed" // 客户端断开或读取失败
+	DisconnectReasonExit   = "exit_command"  // 用户说出退出指令
+	DisconnectReasonKicked = "kicked"        // 管理员断开
+	DisconnectReasonServer = "server_closed" // 服务端关闭
+)
+
+// setCloseReason 记录断开原因，只保留第一次设置的原因
+func (h *ConnectionHandler) setCloseReason(reason string) {
+	h.closeReasonMu.Lock()
+	defer h.closeReasonMu.Unlock()
+	if h.closeReason == "" {
+		h.closeReason = reason
+	}
+}
+
+// getCloseReason 获取断开原因，未设置时视为服务端关闭
+func (h *ConnectionHandler) getCloseReason() string {
+	h.closeReasonMu.Lock()
+	defer h.closeReasonMu.Unlock()
+	if h.closeReason == "" {
+		return DisconnectReasonServer
+	}
+	return h.closeReason
+}
+
+// presenceConnected 连接建立：写入连接记录并将设备标记为在线
+func (h *ConnectionHandler) presenceConnected() {
+	db := database.GetDB()
+	if db == nil || h.deviceID == "" {
+		return
+	}
+	record := &models.DeviceConnection{
+		DeviceID:    h.deviceID,
+		UserID:      h.userID,
+		SessionID:   h.sessionID,
+		ClientIP:    h.clientIP,
+		Transport:   h.transportType,
+		ConnectedAt: h.connectedAt,
+	}
+	if err := database.AddDeviceConnection(db, record); err != nil {
+		h.LogError(fmt.Sprintf("[设备在线] 写入连接记录失败: %v", err))
+		return
+	}
+	h.presenceRecordID = record.ID
+	go h.presenceHeartbeatCoroutine()
+}
+
+// presenceHeartbeatCoroutine 定期以连接最后收到消息的时间刷新在线状态
+func (h *ConnectionHandler) presenceHeartbeatCoroutine() {
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-ticker.C:
+			lastActive := time.Now()
+			if h.conn != nil {
+				lastActive = h.conn.GetLastActiveTime()
+			}
+			if err := database.TouchDeviceConnection(database.GetDB(), h.presenceRecordID, h.deviceID, lastActive, h.currentRound()); err != nil {
+				h.LogError(fmt.Sprintf("[设备在线] 心跳更新失败: %v", err))
+			}
+			h.cleanupConnectionHistory()
+		}
+	}
+}
+
+// cleanupConnectionHistory 删除超过保留天数的连接记录，多个连接同时心跳时只有一个执行清理
+func (h *ConnectionHandler) cleanupConnectionHistory() {
+	days := h.config.Presence.RetentionDays
+	if days <= 0 {
+		return
+	}
+	now := time.Now()
+	last := lastConnectionCleanup.Load()
+	if now.Unix()-last < int64(connectionCleanupInterval/time.Second) ||
+		!lastConnectionCleanup.CompareAndSwap(last, now.Unix()) {
+		return
+	}
+	if err := database.DeleteDeviceConnectionsBefore(database.GetDB(), now.AddDate(0, 0, -days)); err != nil {
+		h.LogError(fmt.Sprintf("[设备在线] 清理连接记录失败: %v", err))
+	}
+}
+
+// presenceDisconnected 连接断开：结束连接记录，设备没有其他连接时标记为离线
+func (h *ConnectionHandler) presenceDisconnected() {
+	if h.presenceRecordID == 0 {
+		return
+	}
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	reason := h.getCloseReason()
+	if err := database.CloseDeviceConnection(db, h.presenceRecordID, h.deviceID, time.Now(), h.currentRound(), reason); err != nil {
+		h.LogError(fmt.Sprintf("[设备在线] 结束连接记录失败: %v", err))
+		return
+	}
+	h.LogInfo(fmt.Sprintf("[设备在线] [断开] 原因 %s, 时长 %s, 轮次 %d", reason, time.Since(h.connectedAt).Round(time.Second), h.currentRound()))
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupConnectionHistory(t *testing.T) {
+	db := openAnnounceDB(t)
+	now := time.Now()
+	old, recent := now.AddDate(0, 0, -40), now.AddDate(0, 0, -1)
+	require.NoError(t, database.AddDeviceConnection(db, &models.DeviceConnection{DeviceID: "dev-1", ConnectedAt: old, DisconnectedAt: &old}))
+	require.NoError(t, database.AddDeviceConnection(db, &models.DeviceConnection{DeviceID: "dev-1", ConnectedAt: recent, DisconnectedAt: &recent}))
+	require.NoError(t, database.AddDeviceConnection(db, &models.DeviceConnection{DeviceID: "dev-1", ConnectedAt: old})) // 仍在线
+
+	s := newTestSession(t, newFakeLLM())
+	s.h.config.Presence.RetentionDays = 30
+	lastConnectionCleanup.Store(0)
+	s.h.cleanupConnectionHistory()
+
+	var count int64
+	db.Model(&models.DeviceConnection{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// 清理间隔内不再重复执行
+	require.NoError(t, database.AddDeviceConnection(db, &models.DeviceConnection{DeviceID: "dev-1", ConnectedAt: old, DisconnectedAt: &old}))
+	s.h.cleanupConnectionHistory()
+	db.Model(&models.DeviceConnection{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
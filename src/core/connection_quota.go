@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"unicode/utf8"
+	"xiaozhi-server-go/src/core/billing"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/quota"
+)
+
+// addUsage 累加本连接的用量，由 flushUsage 写入数据库
+func (h *ConnectionHandler) addUsage(fn func(u *quota.Usage)) {
+	h.usageMu.Lock()
+	fn(&h.usage)
+	h.usageMu.Unlock()
+}
+
+// addProviderUsage 按当前实际使用的提供者累加用量，kind 为 llm/tts/asr
+func (h *ConnectionHandler) addProviderUsage(kind string, e billing.Entry) {
+	e.Kind = kind
+	e.Provider = h.activeProviders()[kind]
+	h.ledger.Add(e)
+}
+
+// flushUsage 把累计的用量与按提供者统计的用量写入数据库
+func (h *ConnectionHandler) flushUsage() {
+	h.usageMu.Lock()
+	usage := h.usage
+	h.usage = quota.Usage{}
+	h.usageMu.Unlock()
+	entries := h.ledger.Drain()
+	if h.deviceID == "" {
+		return
+	}
+	quota.Record(h.logger, h.userID, h.deviceID, usage)
+	if len(entries) > 0 {
+		billing.Record(h.logger, h.config.Pricing, h.userID, h.agentID, h.deviceID, entries)
+	}
+}
+
+// checkQuota 检查当天配额，用尽时播报提示并返回true
+func (h *ConnectionHandler) checkQuota(round int) bool {
+	if h.deviceID == "" {
+		return false
+	}
+	h.flushUsage() // 先写入未记录的用量，避免少算
+	metric := quota.Check(h.logger, h.userID, h.deviceID)
+	if metric == "" {
+		return false
+	}
+	h.LogInfo(fmt.Sprintf("[配额] [用尽] 用户 %d 设备 %s 今日 %s 已达上限", h.userID, h.deviceID, metric))
+	if err := h.speak(round, 1, quota.ExceededMessage(h.language)); err != nil {
+		h.LogError(fmt.Sprintf("播放配额提示失败: %v", err))
+	}
+	return true
+}
+
+// audioSeconds 计算一个上行音频包的时长，opus 按帧长计算，pcm 按16位采样计算，需持有 audioMu
+func (h *ConnectionHandler) audioSeconds(data []byte) float64 {
+	if h.clientAudioFormat == "pcm" && h.clientAudioSampleRate > 0 {
+		channels := h.clientAudioChannels
+		if channels <= 0 {
+			channels = 1
+		}
+		return float64(len(data)) / float64(h.clientAudioSampleRate*2*channels)
+	}
+	if h.clientAudioFrameDuration > 0 {
+		return float64(h.clientAudioFrameDuration) / 1000
+	}
+	return 0.06
+}
+
+// estimateLLMTokens 估算一次LLM请求的输入与输出Token数，供应商未返回用量时使用
+func estimateLLMTokens(messages []providers.Message, output string) (prompt, completion int64) {
+	for _, msg := range messages {
+		prompt += quota.EstimateTokens(msg.Content)
+	}
+	return prompt, quota.EstimateTokens(output)
+}
+
+// ttsChars TTS合成的字数
+func ttsChars(text string) int64 {
+	return int64(utf8.RuneCountInString(text))
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"xiaozhi-server-go/src/core/recording"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+/*
+* 对话录音。
+* 上行音频解码后的PCM在拾音期间累积，新一轮对话开始时作为本轮的用户语音保存；
+* 每段TTS回复发送给设备后保存为本轮的一个分段。文件写入与数据库操作在单独的协程中进行。
+ */
+
+// maxUserAudioSeconds 累积的用户语音上限，超出时丢弃最早的部分
+const maxUserAudioSeconds = 60
+
+// ttsRecordingSampleRate MP3回复音频转换为PCM后的采样率，与下发给设备的Opus一致
+const ttsRecordingSampleRate = 24000
+
+// appendUserAudio 累积用户语音PCM，需持有 audioMu
+func (h *ConnectionHandler) appendUserAudio(pcm []byte) {
+	if !h.config.SaveUserAudio {
+		h.userAudio = nil
+		return
+	}
+	h.userAudio = append(h.userAudio, pcm...)
+	limit := maxUserAudioSeconds * h.clientAudioSampleRate * h.clientAudioChannels * 2
+	if limit > 0 && len(h.userAudio) > limit {
+		h.userAudio = append([]byte(nil), h.userAudio[len(h.userAudio)-limit:]...)
+	}
+}
+
+// resetUserAudio 丢弃已累积的用户语音，客户端开始新一次拾音时调用
+func (h *ConnectionHandler) resetUserAudio() {
+	h.audioMu.Lock()
+	h.userAudio = nil
+	h.audioMu.Unlock()
+}
+
+// saveUserRecording 保存本轮的用户语音，只在会话协程中调用
+func (h *ConnectionHandler) saveUserRecording(round int, text string) {
+	h.audioMu.Lock()
+	pcm, sampleRate, channels := h.userAudio, h.clientAudioSampleRate, h.clientAudioChannels
+	h.userAudio = nil
+	h.audioMu.Unlock()
+	if len(pcm) == 0 || !h.config.SaveUserAudio {
+		return
+	}
+	meta := h.recordingMeta(round, recording.KindUser, 0, text)
+	go recording.Save(h.logger, h.config, meta, pcm, sampleRate, channels)
+}
+
+// saveTTSRecording 保存发送给设备的一段回复音频，在音频发送协程中调用，需在删除音频文件之前调用。
+// 这里只读取文件内容，解码与保存在单独的协程中进行，不阻塞下一段音频的发送
+func (h *ConnectionHandler) saveTTSRecording(round, index int, text, filepath string) {
+	if !h.config.SaveTTSAudio {
+		return
+	}
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		h.LogError("[录音] 读取回复音频失败: " + err.Error())
+		return
+	}
+	isMP3 := strings.HasSuffix(filepath, ".mp3")
+	meta := h.recordingMeta(round, recording.KindTTS, index, text)
+	go func() {
+		pcm, sampleRate, channels, err := decodeTTSAudio(data, isMP3)
+		if err != nil {
+			h.LogError(fmt.Sprintf("[录音] 回复音频转PCM失败: %s: %v", filepath, err))
+			return
+		}
+		recording.Save(h.logger, h.config, meta, pcm, sampleRate, channels)
+	}()
+}
+
+// decodeTTSAudio 将回复音频转换为PCM，WAV按文件头中的采样率和声道数保存
+func decodeTTSAudio(data []byte, isMP3 bool) ([]byte, int, int, error) {
+	if !isMP3 {
+		return utils.ParseWavData(data)
+	}
+	pcm, _, err := utils.MP3DataToPCMData(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(pcm) == 0 {
+		return nil, 0, 0, errors.New("音频为空")
+	}
+	return pcm[0], ttsRecordingSampleRate, 1, nil
+}
+
+// recordingMeta 录音所属的设备、会话、对话记录与轮次
+func (h *ConnectionHandler) recordingMeta(round int, kind string, index int, text string) recording.Meta {
+	return recording.Meta{
+		UserID:         h.userID,
+		AgentID:        h.agentID,
+		ConversationID: h.dialogID(),
+		DeviceID:       h.deviceID,
+		SessionID:      h.sessionID,
+		StartedAt:      h.connectedAt,
+		Round:          round,
+		Kind:           kind,
+		Index:          index,
+		Text:           text,
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTSRecordingKeepsWavSampleRate(t *testing.T) {
+	db := openAnnounceDB(t)
+	s := newIdleTestSession(t, newFakeLLM())
+	s.h.config.SaveTTSAudio = true
+	s.h.config.Recording.Dir = t.TempDir()
+	s.h.userID, s.h.agentID, s.h.deviceID = 1, 2, "dev-1"
+
+	// 16kHz的WAV回复，0.5秒
+	wav := filepath.Join(t.TempDir(), "reply.wav")
+	_, err := utils.SaveAudioToWavFile(make([]byte, 16000), wav, 16000, 1, 16, false)
+	require.NoError(t, err)
+
+	s.h.saveTTSRecording(1, 1, "你好", wav)
+	// 发送完成后音频文件随即被删除，录音在后台协程中保存
+	require.NoError(t, os.Remove(wav))
+
+	var record models.Recording
+	require.Eventually(t, func() bool {
+		recordings, err := database.ListRecordings(db, database.RecordingFilter{UserID: 1, AgentID: 2}, 0)
+		if err != nil || len(recordings) != 1 {
+			return false
+		}
+		record = recordings[0]
+		return true
+	}, waitTimeout, 5*time.Millisecond)
+	assert.Equal(t, 16000, record.SampleRate)
+	assert.Equal(t, int64(500), record.DurationMs)
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+/*
+* 远程控制相关方法，供Web/MCP服务等外部模块操作在线会话。
+* 这些方法只做参数检查和状态读取，具体的对话、播报流程复用连接内部逻辑。
+ */
+
+// SessionState 会话状态快照
+type SessionState struct {
+	DeviceID      string            `json:"device_id"`
+	ClientID      string            `json:"client_id"`
+	SessionID     string            `json:"session_id"`
+	UserID        uint              `json:"user_id"`
+	AgentID       uint              `json:"agent_id"`
+	TransportType string            `json:"transport_type"`
+	ClientIP      string            `json:"client_ip"`
+	ConnectedAt   time.Time         `json:"connected_at"`
+	ConnectedSecs int64             `json:"connected_seconds"`
+	ListenMode    string            `json:"listen_mode"`
+	ListenState   string            `json:"listen_state"`
+	Phase         SessionPhase      `json:"phase"`
+	TalkRound     int               `json:"talk_round"`
+	Speaking      bool              `json:"speaking"`
+	Listening     bool              `json:"listening"`
+	AudioFormat   string            `json:"audio_format"`
+	SampleRate    int               `json:"sample_rate"`
+	FrameDuration int               `json:"frame_duration"`
+	RoundStart    time.Time         `json:"round_start_time"`
+	DeviceTools   []string          `json:"device_tools"`
+	Providers     map[string]string `json:"providers"` // 当前实际使用的提供者，配置了备用提供者时随容灾切换变化
+}
+
+// GetDeviceID 获取设备ID
+func (h *ConnectionHandler) GetDeviceID() string {
+	return h.deviceID
+}
+
+// GetClientID 获取客户端ID
+func (h *ConnectionHandler) GetClientID() string {
+	return h.clientId
+}
+
+// GetSessionID 获取设备与服务端的会话ID
+func (h *ConnectionHandler) GetSessionID() string {
+	return h.sessionID
+}
+
+// GetUserID 获取设备绑定的用户ID，未绑定时为0
+func (h *ConnectionHandler) GetUserID() uint {
+	return h.userID
+}
+
+// IsClosed 连接是否已关闭
+func (h *ConnectionHandler) IsClosed() bool {
+	select {
+	case <-h.stopChan:
+		return true
+	default:
+		return h.conn == nil || h.conn.IsClosed()
+	}
+}
+
+// GetState 获取会话状态快照
+func (h *ConnectionHandler) GetState() SessionState {
+	session := h.snapshot()
+	speaking := session.speaking() && atomic.LoadInt32(&h.serverVoiceStop) == 0
+	h.audioMu.Lock()
+	audioFormat, sampleRate, frameDuration := h.clientAudioFormat, h.clientAudioSampleRate, h.clientAudioFrameDuration
+	h.audioMu.Unlock()
+	state := SessionState{
+		DeviceID:      h.deviceID,
+		ClientID:      h.clientId,
+		SessionID:     h.sessionID,
+		UserID:        h.userID,
+		AgentID:       h.agentID,
+		TransportType: h.transportType,
+		ClientIP:      h.clientIP,
+		ConnectedAt:   h.connectedAt,
+		ConnectedSecs: int64(time.Since(h.connectedAt).Seconds()),
+		ListenMode:    session.listenMode,
+		ListenState:   session.listenState,
+		Phase:         session.phase,
+		TalkRound:     session.round,
+		Speaking:      speaking,
+		Listening:     !speaking && session.listenState != "stop" && session.listenState != "",
+		AudioFormat:   audioFormat,
+		SampleRate:    sampleRate,
+		FrameDuration: frameDuration,
+		RoundStart:    session.startedAt,
+		DeviceTools:   []string{},
+		Providers:     h.activeProviders(),
+	}
+	for _, tool := range h.GetDeviceTools() {
+		state.DeviceTools = append(state.DeviceTools, tool.Function.Name)
+	}
+	return state
+}
+
+// GetDeviceTools 获取设备端上报的MCP工具
+func (h *ConnectionHandler) GetDeviceTools() []openai.Tool {
+	if h.mcpManager == nil || h.mcpManager.XiaoZhiMCPClient == nil {
+		return []openai.Tool{}
+	}
+	if !h.mcpManager.XiaoZhiMCPClient.IsReady() {
+		return []openai.Tool{}
+	}
+	return h.mcpManager.XiaoZhiMCPClient.GetAvailableTools()
+}
+
+// ListDeviceTools 获取设备端MCP工具的原始定义，包含工具名与参数Schema
+func (h *ConnectionHandler) ListDeviceTools() []mcp.Tool {
+	if h.mcpManager == nil || h.mcpManager.XiaoZhiMCPClient == nil {
+		return []mcp.Tool{}
+	}
+	if !h.mcpManager.XiaoZhiMCPClient.IsReady() {
+		return []mcp.Tool{}
+	}
+	return h.mcpManager.XiaoZhiMCPClient.GetTools()
+}
+
+// CallDeviceTool 调用设备端MCP工具，返回工具的文本结果
+func (h *ConnectionHandler) CallDeviceTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	if h.IsClosed() {
+		return "", errors.New("设备连接已关闭")
+	}
+	if h.mcpManager == nil || h.mcpManager.XiaoZhiMCPClient == nil {
+		return "", errors.New("设备MCP客户端未初始化")
+	}
+	client := h.mcpManager.XiaoZhiMCPClient
+	if !client.IsReady() {
+		return "", errors.New("设备MCP客户端尚未准备就绪")
+	}
+	name = strings.TrimSpace(name)
+	if !client.HasTool(name) {
+		return "", fmt.Errorf("设备不支持工具: %s", name)
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	h.LogInfo(fmt.Sprintf("[远程] [设备工具] 调用 %s 参数: %v", name, args))
+	result, err := client.CallTool(ctx, name, args)
+	if err != nil {
+		return "", err
+	}
+	if action, ok := result.(types.ActionResponse); ok {
+		if text, ok := action.Result.(string); ok {
+			return text, nil
+		}
+		if call, ok := action.Result.(types.ActionResponseCall); ok {
+			return fmt.Sprintf("%v", call.Args), nil
+		}
+		return fmt.Sprintf("%v", action.Result), nil
+	}
+	return fmt.Sprintf("%v", result), nil
+}
+
+// Speak 打断当前播报并在设备上播报指定文本，文本会作为助手回复写入对话历史
+func (h *ConnectionHandler) Speak(text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("播报文本不能为空")
+	}
+	return h.Announce(Announcement{Text: text, Interrupt: true})
+}
+
+// StartConversation 以指定文本作为用户输入发起一轮对话
+func (h *ConnectionHandler) StartConversation(text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("对话文本不能为空")
+	}
+	if h.IsClosed() {
+		return errors.New("设备连接已关闭")
+	}
+
+	h.LogInfo(fmt.Sprintf("[远程] [发起对话] %s", text))
+	var err error
+	if !h.inSession(func() {
+		h.stopServerSpeak()
+		err = h.handleChatMessage(h.connContext(), text)
+	}) {
+		return errors.New("设备连接已关闭")
+	}
+	if err != nil {
+		h.LogError(fmt.Sprintf("远程发起对话失败: %v", err))
+	}
+	return err
+}
+
+// AbortSpeech 中止当前播报，效果与设备端发送abort消息一致
+func (h *ConnectionHandler) AbortSpeech() error {
+	if h.IsClosed() {
+		return errors.New("设备连接已关闭")
+	}
+	h.LogInfo("[远程] [中止播报]")
+	var err error
+	if !h.inSession(func() { err = h.clientAbortChat() }) {
+		return errors.New("设备连接已关闭")
+	}
+	return err
+}
+
+// Disconnect 断开会话连接
+func (h *ConnectionHandler) Disconnect() {
+	h.LogInfo("[远程] [断开连接]")
+	h.setCloseReason(DisconnectReasonKicked)
+	h.Close()
+	if h.conn != nil {
+		if err := h.conn.Close(); err != nil {
+			h.LogError(fmt.Sprintf("关闭连接失败: %v", err))
+		}
+	}
+}
+
+// SwitchAgent 切换会话使用的智能体，更新设备绑定并重新加载提示词和模型配置
+func (h *ConnectionHandler) SwitchAgent(agentID uint) (*models.Agent, error) {
+	if h.IsClosed() {
+		return nil, errors.New("设备连接已关闭")
+	}
+	var agent *models.Agent
+	var err error
+	if !h.inSession(func() { agent, err = h.switchAgent(agentID) }) {
+		return nil, errors.New("设备连接已关闭")
+	}
+	return agent, err
+}
+
+// switchAgent 执行智能体切换，只在会话协程中调用
+func (h *ConnectionHandler) switchAgent(agentID uint) (*models.Agent, error) {
+	device, err := database.FindDeviceByID(database.GetDB(), h.deviceID)
+	if err != nil || device == nil {
+		return nil, fmt.Errorf("获取设备信息失败: %v", err)
+	}
+
+	h.agentID = agentID
+	device.AgentID = &agentID
+	if err := database.UpdateDevice(database.GetDB(), device); err != nil {
+		h.LogError(fmt.Sprintf("更新设备绑定的智能体失败: %v", err))
+	}
+	agent, prompt := h.InitWithAgent()
+	// 更新对话系统提示并保留最近上下文
+	h.dialogueManager.SetSystemMessage(prompt)
+	h.dialogueManager.KeepRecentMessages(1)
+	// 重新检查并切换提供者，正在进行的回复继续使用切换前的提供者
+	h.providersMu.Lock()
+	h.clearFailover()
+	h.checkTTSProvider(agent, h.config)
+	h.checkLLMProvider(agent, h.config)
+	h.setupFailover(agent, h.config)
+	// 托管平台的会话属于原智能体，切换后开始新会话
+	h.saveConversationID("")
+	h.setupConversation(agent)
+	h.providersMu.Unlock()
+
+	h.LogInfo(fmt.Sprintf("[远程] [切换智能体] AgentID=%d", agentID))
+	return agent, nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/iot"
+)
+
+/*
+* 断线重连的会话恢复。
+* 客户端异常断开（如WiFi抖动）时，传输层不立即释放会话，而是调用 Park 暂存会话状态并保留提供者；
+* 宽限期内同一会话ID或设备重连时，新连接通过 Resume 接管对话、音色、设备上报的工具和未播放的播报。
+* 设备端MCP工具保存在提供者集合的MCP管理器中，随提供者一起保留，重连后无需重新初始化。
+* 宽限期内到期的提醒按离线处理，暂存后在重连的 hello 中下发。
+ */
+
+// 未播完的TTS在恢复时的处理方式
+const (
+	ResumeTTSDrop   = "drop"   // 丢弃
+	ResumeTTSReplay = "replay" // 重连后重新播报
+)
+
+// ResumeState 暂存的会话状态
+type ResumeState struct {
+	SessionID string    // 会话ID
+	DeviceID  string    // 设备ID
+	AgentID   uint      // 断开时绑定的智能体
+	ParkedAt  time.Time // 暂存时间
+
+	dialogueManager *chat.DialogueManager
+	talkRound       int
+	voiceName       string
+	initialVoice    string
+	iotManager      *iot.Manager
+	pendingTTS      []string       // 未播完的TTS文本，按播放顺序
+	announcements   []Announcement // 尚未播放的服务端播报
+}
+
+// Resumable 判断断开的连接是否可以暂存等待重连：只有客户端异常断开的设备会话才保留
+func (h *ConnectionHandler) Resumable() bool {
+	return h.deviceID != "" && !h.closeAfterChat.Load() && h.getCloseReason() == DisconnectReasonClient
+}
+
+// Park 结束当前连接但保留会话状态，之后由新连接调用 Resume 恢复，或调用 Close 释放
+func (h *ConnectionHandler) Park() *ResumeState {
+	h.parked = true
+	h.closeOnce.Do(h.closeConnection)
+	h.providersMu.Lock()
+	h.clearFailover() // 备用提供者不随会话暂存，恢复后按智能体配置重新创建
+	h.providersMu.Unlock()
+
+	state := &ResumeState{
+		SessionID:       h.sessionID,
+		DeviceID:        h.deviceID,
+		AgentID:         h.agentID,
+		ParkedAt:        time.Now(),
+		dialogueManager: h.dialogueManager,
+		talkRound:       h.currentRound(),
+		voiceName:       h.voiceName,
+		initialVoice:    h.initialVoice,
+		iotManager:      h.iotManager,
+		pendingTTS:      h.drainPendingTTS(),
+	}
+	for {
+		select {
+		case a := <-h.announceQueue:
+			// 离线暂存播报尚未标记为已下发，重连后会重新从数据库取出
+			if a.StoredID == 0 {
+				state.announcements = append(state.announcements, a)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	h.LogInfo(fmt.Sprintf("[会话恢复] [暂存] 会话 %s, 轮次 %d, 未播完 %d 句, 待播报 %d 条",
+		h.sessionID, state.talkRound, len(state.pendingTTS), len(state.announcements)))
+	return state
+}
+
+// drainPendingTTS 取出队列中未播放的文本，已合成的音频文件按配置删除
+func (h *ConnectionHandler) drainPendingTTS() []string {
+	texts := make([]string, 0)
+	// 音频队列中的句子先于TTS队列中的句子播放
+	for {
+		select {
+		case task := <-h.audioMessagesQueue:
+			h.deleteAudioFileIfNeeded(task.filepath, "暂存会话时")
+			if task.text != "" {
+				texts = append(texts, task.text)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	for {
+		select {
+		case task := <-h.ttsQueue:
+			if task.text != "" {
+				texts = append(texts, task.text)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	return texts
+}
+
+// Resume 在新连接上恢复暂存的会话，需在 Handle 之前调用；replayTTS 为true时重连后重播未播完的文本
+func (h *ConnectionHandler) Resume(state *ResumeState, replayTTS bool) {
+	if state.AgentID == h.agentID {
+		h.dialogueManager = state.dialogueManager
+	} else {
+		h.LogInfo(fmt.Sprintf("[会话恢复] 设备绑定的智能体已从 %d 变更为 %d，不恢复对话", state.AgentID, h.agentID))
+	}
+	h.session.round = state.talkRound // Handle 之前调用，会话协程尚未启动
+	h.publishSession()
+	h.iotManager = state.iotManager
+
+	// 提供者在暂存期间保留了切换后的音色，但新连接初始化时已按智能体重新设置，这里恢复为断开前的音色
+	h.initialVoice = state.initialVoice
+	if state.voiceName != "" && state.voiceName != h.voiceName && h.ttsProvider() != nil {
+		if err, voice := h.ttsProvider().SetVoice(state.voiceName); err != nil {
+			h.LogError(fmt.Sprintf("[会话恢复] 恢复音色 %s 失败: %v", state.voiceName, err))
+		} else {
+			h.voiceName = voice
+		}
+	}
+
+	if replayTTS && len(state.pendingTTS) > 0 {
+		h.resumeAnnouncements = append(h.resumeAnnouncements, Announcement{
+			Text:        strings.Join(state.pendingTTS, ""),
+			SkipHistory: true, // 回复已在对话历史中
+		})
+	}
+	h.resumeAnnouncements = append(h.resumeAnnouncements, state.announcements...)
+	h.resumed = true
+
+	h.LogInfo(fmt.Sprintf("[会话恢复] [恢复] 会话 %s 断开 %s 后重连，轮次 %d",
+		state.SessionID, time.Since(state.ParkedAt).Round(time.Millisecond), state.talkRound))
+}
+
+// deliverResumedAnnouncements 重连后下发暂存会话中未播放的内容
+func (h *ConnectionHandler) deliverResumedAnnouncements() {
+	items := h.resumeAnnouncements
+	h.resumeAnnouncements = nil
+	for _, a := range items {
+		if err := h.Announce(a); err != nil {
+			h.LogError(fmt.Sprintf("[会话恢复] 下发暂存播报失败: %v", err))
+			return
+		}
+	}
+	if len(items) > 0 {
+		h.LogInfo(fmt.Sprintf("[会话恢复] 已下发 %d 条暂存播报", len(items)))
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/core/mcp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mcpResult 设备对MCP请求的响应
+func mcpResult(id interface{}, result map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "mcp",
+		"payload": map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result},
+	}
+}
+
+// newDeviceSession 创建由 Handle 的消息循环驱动的设备连接
+func newDeviceSession(t *testing.T, llm *fakeLLM, mgr *mcp.Manager) *testSession {
+	s := newIdleTestSession(t, llm)
+	s.conn.in = make(chan []byte)
+	s.conn.drop = make(chan struct{})
+	s.h.deviceID = "dev-1"
+	s.h.sessionID = "session-1"
+	s.h.mcpManager = mgr
+	return s
+}
+
+// handle 在后台运行 Handle，返回的通道在 Handle 退出后关闭
+func (s *testSession) handle() chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.h.Handle(s.conn)
+	}()
+	return done
+}
+
+func TestResumeRestoresDialogueAndDeviceTools(t *testing.T) {
+	openAnnounceDB(t) // 连接记录写入数据库
+
+	first := newDeviceSession(t, newFakeLLM("好的，小明。"), nil)
+	mgr := mcp.NewManagerForPool(first.h.logger, first.h.config)
+	first.h.mcpManager = mgr
+	firstDone := first.handle()
+
+	// 设备完成MCP握手并上报工具
+	require.Eventually(t, func() bool { return len(first.conn.mcpRequests("initialize")) == 1 }, waitTimeout, 5*time.Millisecond)
+	first.deliver(t, mcpResult(1, map[string]interface{}{"serverInfo": map[string]interface{}{"name": "dev", "version": "1.0"}}))
+	first.deliver(t, mcpResult(2, map[string]interface{}{"tools": []interface{}{
+		map[string]interface{}{"name": "self.light.set", "description": "开关灯", "inputSchema": map[string]interface{}{"type": "object"}},
+	}}))
+	require.Eventually(t, func() bool { return len(first.h.ListDeviceTools()) == 1 }, waitTimeout, 5*time.Millisecond)
+
+	first.deliver(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "我叫小明"})
+	require.Eventually(t, func() bool { return first.conn.countTTS("stop") == 1 }, waitTimeout, 5*time.Millisecond)
+	first.waitPhase(t, PhaseIdle)
+
+	// 连接异常断开，传输层暂存会话
+	close(first.conn.drop)
+	<-firstDone
+	require.True(t, first.h.Resumable())
+	state := first.h.Park()
+
+	// 宽限期内重连，新连接沿用暂存的MCP管理器
+	llm := newFakeLLM("你叫小明。")
+	second := newDeviceSession(t, llm, mgr)
+	second.h.Resume(state, false)
+	secondDone := second.handle()
+	t.Cleanup(func() {
+		second.h.Close()
+		<-secondDone
+	})
+
+	second.deliver(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "我叫什么？"})
+	require.Eventually(t, func() bool { return second.conn.countTTS("stop") == 1 }, waitTimeout, 5*time.Millisecond)
+	assert.Equal(t, 2, second.h.GetState().TalkRound)
+
+	// 对话历史随会话恢复
+	contents := make([]string, 0)
+	for _, m := range llm.lastMessages() {
+		contents = append(contents, m.Content)
+	}
+	assert.Contains(t, contents, "我叫小明")
+	assert.Contains(t, contents, "好的，小明。")
+
+	// 设备工具无需重新握手，调用请求发往新连接
+	assert.Empty(t, second.conn.mcpRequests("initialize"))
+	tools := second.h.ListDeviceTools()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "self.light.set", tools[0].Name)
+
+	type callResult struct {
+		text string
+		err  error
+	}
+	results := make(chan callResult, 1)
+	go func() {
+		text, err := second.h.CallDeviceTool(context.Background(), "self.light.set", map[string]interface{}{"on": true})
+		results <- callResult{text, err}
+	}()
+	require.Eventually(t, func() bool { return len(second.conn.mcpRequests("tools/call")) == 1 }, waitTimeout, 5*time.Millisecond)
+	assert.Empty(t, first.conn.mcpRequests("tools/call"))
+	call := second.conn.mcpRequests("tools/call")[0]
+	second.deliver(t, mcpResult(call["id"], map[string]interface{}{
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": "灯已打开"}},
+	}))
+	select {
+	case r := <-results:
+		require.NoError(t, r.err)
+		assert.Equal(t, "灯已打开", r.text)
+	case <-time.After(waitTimeout):
+		t.Fatal("设备工具调用没有返回")
+	}
+}
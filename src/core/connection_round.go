@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/*
+* 对话轮次的取消。
+* 每轮对话（用户输入、远程发起的对话、服务端播报）从连接上下文派生一个可取消的上下文，
+* LLM请求、工具调用和TTS合成都使用该上下文。客户端中止、打断、新一轮开始或连接关闭时取消当前轮次，
+* 提供者随之停止生成，不再为已被打断的回复消耗Token和接口额度。
+ */
+
+// 轮次被取消的原因
+var (
+	ErrRoundAborted     = errors.New("客户端中止")
+	ErrRoundInterrupted = errors.New("服务端打断")
+	ErrRoundReplaced    = errors.New("新一轮对话开始")
+	ErrConnectionClosed = errors.New("连接已关闭")
+)
+
+// connContext 连接的上下文，连接关闭时取消
+func (h *ConnectionHandler) connContext() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+// beginRound 取消上一轮并为轮次 round 创建可取消的上下文
+func (h *ConnectionHandler) beginRound(parent context.Context, round int) context.Context {
+	h.roundMu.Lock()
+	defer h.roundMu.Unlock()
+	if h.roundCancel != nil {
+		h.roundCancel(ErrRoundReplaced)
+	}
+	h.roundCtx, h.roundCancel = context.WithCancelCause(parent)
+	h.roundID = round
+	return h.roundCtx
+}
+
+// cancelRound 取消当前轮次，之后到达的LLM输出、工具调用和TTS任务都会被丢弃
+func (h *ConnectionHandler) cancelRound(cause error) {
+	h.roundMu.Lock()
+	defer h.roundMu.Unlock()
+	if h.roundCancel == nil || h.roundCtx.Err() != nil {
+		return
+	}
+	h.roundCancel(cause)
+	h.LogInfo(fmt.Sprintf("[对话] [轮次 %d] 已取消: %v", h.roundID, cause))
+}
+
+// roundContext 指定轮次的上下文：已被新轮次替换的旧轮次返回已取消的上下文，
+// 尚未通过 beginRound 开始的轮次（如会话恢复后的重播）使用连接上下文
+func (h *ConnectionHandler) roundContext(round int) context.Context {
+	h.roundMu.Lock()
+	defer h.roundMu.Unlock()
+	switch {
+	case h.roundCtx != nil && round == h.roundID:
+		return h.roundCtx
+	case h.roundCtx != nil && round < h.roundID:
+		ctx, cancel := context.WithCancelCause(h.connContext())
+		cancel(ErrRoundReplaced)
+		return ctx
+	}
+	return h.connContext()
+}
+
+// roundCanceled 判断上下文是否已取消，已取消时记录原因
+func (h *ConnectionHandler) roundCanceled(ctx context.Context, stage string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	h.LogInfo(fmt.Sprintf("[对话] [%s] 轮次已取消，停止处理: %v", stage, context.Cause(ctx)))
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync/atomic"
 	"time"
+	"xiaozhi-server-go/src/core/events"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -88,6 +89,7 @@ func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 	if err != nil {
 		return fmt.Errorf("序列化情绪消息失败: %v", err)
 	}
+	h.publishEvent(events.TypeEmotion, map[string]interface{}{"emotion": emotion})
 	return h.conn.WriteMessage(1, jsonData)
 }
 
@@ -98,29 +100,19 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		h.deleteAudioFileIfNeeded(filepath, "音频发送完成")
 
 		spentTime := time.Since(startTime).Milliseconds()
-		h.LogDebug(fmt.Sprintf("[TTS] [发送任务 %d/%dms/%dms] %s", textIndex, h.tts_last_text_index, spentTime, text))
-		h.providers.asr.ResetStartListenTime()
-		if textIndex == h.tts_last_text_index {
-			if round != h.talkRound {
-				h.LogInfo("sendTTSMessage stop: 跳过结束状态发送，轮次已变化")
-			} else {
-				h.sendTTSMessage("stop", "", textIndex)
-				if h.closeAfterChat {
-					h.Close()
-				} else {
-					h.clearSpeakStatus()
-				}
-			}
-		}
+		h.LogDebug(fmt.Sprintf("[TTS] [发送任务 %d/%dms] %s", textIndex, spentTime, text))
+		h.asrProvider().ResetStartListenTime()
+		// 由会话协程统计本轮的播放进度，全部播放完成后发送 tts stop
+		h.notifyAudioDone(round, textIndex)
 	}()
 
 	if len(filepath) == 0 {
 		return
 	}
 	// 检查轮次
-	if round != h.talkRound {
+	if current := h.currentRound(); round != current {
 		h.LogInfo(fmt.Sprintf("sendAudioMessage: 跳过过期轮次的音频: 任务轮次=%d, 当前轮次=%d, 文本=%s",
-			round, h.talkRound, text))
+			round, current, text))
 		// 即使跳过，也要根据配置删除音频文件
 		h.deleteAudioFileIfNeeded(filepath, "跳过过期轮次")
 		return
@@ -158,25 +150,33 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
 		return
 	}
+	h.publishEvent(events.TypeTTSStart, map[string]interface{}{
+		"round": round, "index": textIndex, "text": text, "duration": duration,
+	})
 
+	session := h.snapshot()
 	if textIndex == 1 {
 		now := time.Now()
-		spentTime := now.Sub(h.roundStartTime)
+		spentTime := now.Sub(session.startedAt)
 		h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
 	}
-	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.tts_last_text_index, duration, len(audioData))
+	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, session.lastIndex, duration, len(audioData))
 
 	// 分时发送音频数据
 	if err := h.sendAudioFrames(audioData, text, round); err != nil {
 		h.LogError(fmt.Sprintf("分时发送音频数据失败: %v", err))
 		return
 	}
+	h.saveTTSRecording(round, textIndex, text, filepath)
 
 	// 发送TTS状态结束通知
 	if err := h.sendTTSMessage("sentence_end", text, textIndex); err != nil {
 		h.LogError(fmt.Sprintf("发送TTS结束状态失败: %v", err))
 		return
 	}
+	h.publishEvent(events.TypeTTSEnd, map[string]interface{}{
+		"round": round, "index": textIndex, "text": text,
+	})
 }
 
 // sendAudioFrames 分时发送音频帧，避免撑爆客户端缓冲区
@@ -198,7 +198,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 	// 发送预缓冲帧
 	for i := 0; i < preBufferFrames; i++ {
 		// 检查是否被打断
-		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 			h.LogInfo(fmt.Sprintf("音频发送被中断(预缓冲阶段): 帧=%d/%d, 文本=%s", i+1, preBufferFrames, text))
 			return nil
 		}
@@ -213,7 +213,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 	remainingFrames := audioData[preBufferFrames:]
 	for i, chunk := range remainingFrames {
 		// 检查是否被打断或轮次变化
-		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 			h.LogInfo(fmt.Sprintf("音频发送被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
 			return nil
 		}
@@ -241,7 +241,7 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 				select {
 				case <-ticker.C:
 					// 检查中断条件
-					if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+					if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.currentRound() {
 						h.LogInfo(fmt.Sprintf("音频发送在延迟中被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
 						return nil
 					}
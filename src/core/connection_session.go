@@ -0,0 +1,244 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"xiaozhi-server-go/src/core/providers"
+)
+
+/*
+* 会话协程。
+* 会话状态（轮次、阶段、播放进度、拾音文本）只由会话协程读写，其他协程通过事件通道通知：
+*   clientTextQueue 客户端文本消息
+*   asrResults      ASR识别结果，由ASR回调发送
+*   replyEvents     回复协程生成的分段、阶段变化与结束，不带缓冲，保证分段先于其音频的播放完成到达
+*   audioDone       音频发送协程每播放完（或跳过）一句发送一次
+*   sessionCalls    远程控制、播报等需要在会话协程中执行的操作
+* 每轮回复（LLM、工具调用、快速回复、播报）在单独的回复协程中生成，会话协程不会被LLM或工具阻塞。
+ */
+
+// asrResult ASR识别结果
+type asrResult struct {
+	text  string
+	final bool
+}
+
+// replyEvent 回复协程发给会话协程的事件
+type replyEvent struct {
+	round int
+	index int          // >0 表示第 index 句回复已加入播放队列
+	phase SessionPhase // 非空表示阶段变化
+	done  bool         // 本轮回复已全部生成
+}
+
+// audioDoneEvent 一句回复播放完成或被跳过
+type audioDoneEvent struct {
+	round int
+	index int
+}
+
+// sessionSnapshot 会话协程发布的状态快照
+type sessionSnapshot struct {
+	sessionMachine
+	listenMode  string
+	listenState string
+}
+
+// processSessionEventsCoroutine 会话协程，按到达顺序处理各类事件
+func (h *ConnectionHandler) processSessionEventsCoroutine() {
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case text := <-h.clientTextQueue:
+			if err := h.processClientTextMessage(h.connContext(), text); err != nil {
+				h.LogError(fmt.Sprintf("处理文本数据失败: %v", err))
+			}
+		case r := <-h.asrResults:
+			h.handleAsrResult(r)
+		case ev := <-h.replyEvents:
+			h.handleReplyEvent(ev)
+		case ev := <-h.audioDone:
+			if h.session.audioPlayed(ev.round) {
+				h.finishReply()
+			}
+		case call := <-h.sessionCalls:
+			call()
+		}
+		h.publishSession()
+	}
+}
+
+// publishSession 发布会话状态快照
+func (h *ConnectionHandler) publishSession() {
+	h.sessionMu.Lock()
+	h.sessionView = sessionSnapshot{
+		sessionMachine: h.session,
+		listenMode:     h.clientListenMode,
+		listenState:    h.clientListenState,
+	}
+	h.sessionMu.Unlock()
+}
+
+// snapshot 读取会话状态快照，可在任意协程中调用
+func (h *ConnectionHandler) snapshot() sessionSnapshot {
+	h.sessionMu.RLock()
+	defer h.sessionMu.RUnlock()
+	return h.sessionView
+}
+
+// currentRound 当前轮次，可在任意协程中调用
+func (h *ConnectionHandler) currentRound() int {
+	return h.snapshot().round
+}
+
+// isSpeaking 是否正在生成或播放回复，可在任意协程中调用
+func (h *ConnectionHandler) isSpeaking() bool {
+	state := h.snapshot()
+	return state.speaking()
+}
+
+// inSession 在会话协程中执行 fn 并等待完成，连接关闭时返回false；不能在会话协程中调用
+func (h *ConnectionHandler) inSession(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case h.sessionCalls <- func() { defer close(done); fn() }:
+	case <-h.stopChan:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-h.stopChan:
+		return false
+	}
+}
+
+// startRound 开始新一轮对话并创建本轮的上下文，只在会话协程中调用
+func (h *ConnectionHandler) startRound(parent context.Context, userText string) (context.Context, int) {
+	// 新一轮开始时，之前未播放完的暂存播报已被打断
+	h.settleAnnouncements(h.session.round)
+	round := h.session.startRound(userText)
+	h.publishSession()
+	return h.beginRound(parent, round), round
+}
+
+// startReply 在回复协程中生成本轮回复，结束后通知会话协程
+func (h *ConnectionHandler) startReply(ctx context.Context, round int, fn func(ctx context.Context) error) {
+	go func() {
+		defer h.postReply(replyEvent{round: round, done: true})
+		if err := fn(ctx); err != nil {
+			h.LogError(fmt.Sprintf("[对话] [轮次 %d] 生成回复失败: %v", round, err))
+		}
+	}()
+}
+
+// postReply 回复协程向会话协程发送事件
+func (h *ConnectionHandler) postReply(ev replyEvent) {
+	select {
+	case h.replyEvents <- ev:
+	case <-h.stopChan:
+	}
+}
+
+// setRoundPhase 回复协程通知会话协程本轮进入新的阶段
+func (h *ConnectionHandler) setRoundPhase(round int, phase SessionPhase) {
+	h.postReply(replyEvent{round: round, phase: phase})
+}
+
+// speak 把一句回复加入本轮的播放队列
+func (h *ConnectionHandler) speak(round, index int, text string) error {
+	h.postReply(replyEvent{round: round, index: index})
+	return h.SpeakAndPlay(text, index, round)
+}
+
+// playFile 把音频文件加入本轮的播放队列
+func (h *ConnectionHandler) playFile(round, index int, path, text string) {
+	h.postReply(replyEvent{round: round, index: index})
+	h.audioMessagesQueue <- struct {
+		filepath  string
+		text      string
+		round     int
+		textIndex int
+	}{path, text, round, index}
+}
+
+// notifyAudioDone 音频发送协程通知会话协程一句回复播放完成
+func (h *ConnectionHandler) notifyAudioDone(round, index int) {
+	select {
+	case h.audioDone <- audioDoneEvent{round: round, index: index}:
+	case <-h.stopChan:
+	}
+}
+
+// handleReplyEvent 处理回复协程的事件
+func (h *ConnectionHandler) handleReplyEvent(ev replyEvent) {
+	switch {
+	case ev.index > 0:
+		h.session.segmentQueued(ev.round, ev.index)
+	case ev.phase != "":
+		if !h.session.transition(ev.round, ev.phase) {
+			h.LogDebug(fmt.Sprintf("[会话] [轮次 %d] 忽略状态转换 %s -> %s", ev.round, h.session.phase, ev.phase))
+		}
+	case ev.done:
+		if h.session.replyFinished(ev.round) {
+			h.finishReply()
+		}
+	}
+}
+
+// finishReply 本轮回复全部播放完成：通知设备停止播放，需要时结束对话
+func (h *ConnectionHandler) finishReply() {
+	round, index := h.session.round, h.session.lastIndex
+	h.session.finishRound()
+	h.publishSession()
+	h.settleAnnouncements(round)
+	h.LogInfo(fmt.Sprintf("[对话] [轮次 %d] 播放完成", round))
+	if err := h.sendTTSMessage("stop", "", index); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS结束状态失败: %v", err))
+	}
+	if h.closeAfterChat.Load() {
+		h.Close()
+		return
+	}
+	h.clearSpeakStatus()
+}
+
+// handleAsrResult 按拾音模式处理ASR识别结果
+func (h *ConnectionHandler) handleAsrResult(r asrResult) {
+	switch h.clientListenMode {
+	case "manual":
+		h.session.asrText += r.text
+		if r.final {
+			h.handleChatMessage(h.connContext(), h.session.asrText)
+		}
+	case "realtime":
+		h.stopServerSpeak()
+		h.LogInfo(fmt.Sprintf("[ASR] [识别结果 %s/%s]", h.clientListenMode, r.text))
+		h.handleChatMessage(h.connContext(), r.text)
+	default:
+		h.LogInfo(fmt.Sprintf("[ASR] [识别结果 %s/%s]", h.clientListenMode, r.text))
+		h.handleChatMessage(h.connContext(), r.text)
+	}
+}
+
+// llmProvider 当前的LLM提供者，切换智能体时会被替换
+func (h *ConnectionHandler) llmProvider() providers.LLMProvider {
+	h.providersMu.RLock()
+	defer h.providersMu.RUnlock()
+	return h.providers.llm
+}
+
+// ttsProvider 当前的TTS提供者
+func (h *ConnectionHandler) ttsProvider() providers.TTSProvider {
+	h.providersMu.RLock()
+	defer h.providersMu.RUnlock()
+	return h.providers.tts
+}
+
+// asrProvider 当前的ASR提供者
+func (h *ConnectionHandler) asrProvider() providers.ASRProvider {
+	h.providersMu.RLock()
+	defer h.providersMu.RUnlock()
+	return h.providers.asr
+}
@@ -0,0 +1,431 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/function"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const waitTimeout = 3 * time.Second
+
+// fakeConn 记录下发给设备的文本消息
+type fakeConn struct {
+	mu       sync.Mutex
+	messages []map[string]interface{}
+	closed   atomic.Bool
+	hold     chan struct{} // 非nil时写入一直阻塞到关闭，模拟写入缓慢的客户端
+	in       chan []byte   // 设备发来的文本消息，由 Handle 的消息循环读取
+	drop     chan struct{} // 关闭时读取失败，模拟连接异常断开
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	if c.hold != nil {
+		<-c.hold
+	}
+	if messageType != 1 {
+		return nil
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.messages = append(c.messages, msg)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) ReadMessage(stopChan <-chan struct{}) (int, []byte, error) {
+	select {
+	case <-stopChan:
+		return 0, nil, errors.New("closed")
+	case <-c.drop:
+		return 0, nil, errors.New("connection reset")
+	case data := <-c.in:
+		return 1, data, nil
+	}
+}
+
+func (c *fakeConn) Close() error                       { c.closed.Store(true); return nil }
+func (c *fakeConn) GetID() string                      { return "fake" }
+func (c *fakeConn) GetType() string                    { return "fake" }
+func (c *fakeConn) IsClosed() bool                     { return c.closed.Load() }
+func (c *fakeConn) GetLastActiveTime() time.Time       { return time.Now() }
+func (c *fakeConn) IsStale(timeout time.Duration) bool { return false }
+
+// ttsStates 按顺序返回下发的 tts 状态
+func (c *fakeConn) ttsStates() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make([]string, 0)
+	for _, msg := range c.messages {
+		if msg["type"] == "tts" {
+			states = append(states, msg["state"].(string))
+		}
+	}
+	return states
+}
+
+// mcpRequests 返回下发的设备MCP请求
+func (c *fakeConn) mcpRequests(method string) []map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requests := make([]map[string]interface{}, 0)
+	for _, msg := range c.messages {
+		if payload, ok := msg["payload"].(map[string]interface{}); ok && msg["type"] == "mcp" && payload["method"] == method {
+			requests = append(requests, payload)
+		}
+	}
+	return requests
+}
+
+func (c *fakeConn) countTTS(state string) int {
+	n := 0
+	for _, s := range c.ttsStates() {
+		if s == state {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeLLM 每次请求先返回 replies 中的一段，hold 为true时之后一直等到请求被取消
+type fakeLLM struct {
+	mu      sync.Mutex
+	replies []string
+	hold    bool
+	calls   int
+	last    []types.Message // 最近一次请求的对话
+	causes  chan error      // 被取消的请求的取消原因
+	started chan struct{}
+}
+
+func newFakeLLM(replies ...string) *fakeLLM {
+	return &fakeLLM{replies: replies, causes: make(chan error, 10), started: make(chan struct{}, 10)}
+}
+
+func (f *fakeLLM) Initialize() error              { return nil }
+func (f *fakeLLM) Cleanup() error                 { return nil }
+func (f *fakeLLM) GetSessionID() string           { return "" }
+func (f *fakeLLM) SetIdentityFlag(string, string) {}
+func (f *fakeLLM) Response(context.Context, string, []types.Message) (<-chan string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeLLM) ResponseWithFunctions(ctx context.Context, _ string, messages []types.Message, _ []openai.Tool) (<-chan types.Response, error) {
+	f.mu.Lock()
+	reply := f.replies[f.calls%len(f.replies)]
+	hold := f.hold
+	f.calls++
+	f.last = append([]types.Message(nil), messages...)
+	f.mu.Unlock()
+
+	ch := make(chan types.Response)
+	go func() {
+		defer close(ch)
+		f.started <- struct{}{}
+		select {
+		case ch <- types.Response{Content: reply}:
+		case <-ctx.Done():
+		}
+		if hold {
+			<-ctx.Done()
+			f.causes <- context.Cause(ctx)
+		}
+	}()
+	return ch, nil
+}
+
+func (f *fakeLLM) lastMessages() []types.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+func (f *fakeLLM) setHold(hold bool) {
+	f.mu.Lock()
+	f.hold = hold
+	f.mu.Unlock()
+}
+
+// fakeTTS 不生成音频文件，hold 为true时一直等到任务被取消
+type fakeTTS struct {
+	hold  atomic.Bool
+	texts atomic.Int32
+}
+
+func (f *fakeTTS) Initialize() error                     { return nil }
+func (f *fakeTTS) Cleanup() error                        { return nil }
+func (f *fakeTTS) SetVoice(voice string) (error, string) { return nil, voice }
+func (f *fakeTTS) ToTTS(ctx context.Context, text string) (string, error) {
+	f.texts.Add(1)
+	if f.hold.Load() {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return "", nil
+}
+
+type fakeASR struct {
+	resets atomic.Int32
+}
+
+func (f *fakeASR) Initialize() error                                  { return nil }
+func (f *fakeASR) Cleanup() error                                     { return nil }
+func (f *fakeASR) Transcribe(context.Context, []byte) (string, error) { return "", nil }
+func (f *fakeASR) AddAudio(data []byte) error                         { return nil }
+func (f *fakeASR) SendLastAudio(data []byte) error                    { return nil }
+func (f *fakeASR) SetListener(listener providers.AsrEventListener)    {}
+func (f *fakeASR) SetUserPreferences(map[string]interface{}) error    { return nil }
+func (f *fakeASR) Reset() error                                       { f.resets.Add(1); return nil }
+func (f *fakeASR) CloseConnection() error                             { return nil }
+func (f *fakeASR) GetSilenceCount() int                               { return 0 }
+func (f *fakeASR) ResetSilenceCount()                                 {}
+func (f *fakeASR) ResetStartListenTime()                              {}
+func (f *fakeASR) EnableSilenceDetection(bEnable bool)                {}
+
+type testSession struct {
+	h    *ConnectionHandler
+	conn *fakeConn
+	llm  *fakeLLM
+	tts  *fakeTTS
+	asr  *fakeASR
+}
+
+func newTestSession(t *testing.T, llm *fakeLLM) *testSession {
+	s := newIdleTestSession(t, llm)
+	s.h.startCoroutines()
+	return s
+}
+
+// newIdleTestSession 创建未启动会话协程的处理器，供通过 Handle 驱动连接的测试使用
+func newIdleTestSession(t *testing.T, llm *fakeLLM) *testSession {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+
+	s := &testSession{conn: &fakeConn{}, llm: llm, tts: &fakeTTS{}, asr: &fakeASR{}}
+	h := newConnectionHandler(&configs.Config{}, logger, context.Background())
+	h.conn = s.conn
+	h.providers.llm = s.llm
+	h.providers.tts = s.tts
+	h.providers.asr = s.asr
+	h.dialogueManager = chat.NewDialogueManager(logger, nil)
+	h.functionRegister = function.NewFunctionRegistry()
+	s.h = h
+	t.Cleanup(func() {
+		h.Close()
+		logger.Close()
+	})
+	return s
+}
+
+func (s *testSession) send(t *testing.T, msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	require.NoError(t, s.h.handleMessage(1, data))
+}
+
+// deliver 模拟设备通过连接发送消息
+func (s *testSession) deliver(t *testing.T, msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	select {
+	case s.conn.in <- data:
+	case <-time.After(waitTimeout):
+		t.Fatal("消息循环没有读取消息")
+	}
+}
+
+func (s *testSession) waitPhase(t *testing.T, phase SessionPhase) {
+	require.Eventually(t, func() bool { return s.h.snapshot().phase == phase }, waitTimeout, 5*time.Millisecond,
+		"期望进入 %s", phase)
+}
+
+func TestSessionChatRoundCompletes(t *testing.T) {
+	s := newTestSession(t, newFakeLLM("你好呀，今天想聊点什么？我可以陪你聊天。"))
+	s.send(t, map[string]interface{}{"type": "listen", "state": "start", "mode": "auto"})
+	s.waitPhase(t, PhaseListening)
+
+	s.send(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "你好"})
+	require.Eventually(t, func() bool { return s.conn.countTTS("stop") == 1 }, waitTimeout, 5*time.Millisecond)
+	s.waitPhase(t, PhaseListening)
+
+	state := s.h.GetState()
+	assert.Equal(t, 1, state.TalkRound)
+	assert.Equal(t, PhaseListening, state.Phase)
+	assert.False(t, state.Speaking)
+	assert.Equal(t, []string{"start", "stop"}, s.conn.ttsStates())
+	assert.Positive(t, s.tts.texts.Load())
+
+	dialogue := s.h.dialogueManager.GetLLMDialogue()
+	require.NotEmpty(t, dialogue)
+	assert.Equal(t, "assistant", dialogue[len(dialogue)-1].Role)
+}
+
+func TestSessionAbortCancelsRound(t *testing.T) {
+	llm := newFakeLLM("第一句话。")
+	llm.setHold(true)
+	s := newTestSession(t, llm)
+	s.tts.hold.Store(true)
+
+	s.send(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "讲个故事"})
+	<-llm.started
+	s.waitPhase(t, PhaseSpeaking)
+
+	s.send(t, map[string]interface{}{"type": "abort"})
+	select {
+	case cause := <-llm.causes:
+		assert.ErrorIs(t, cause, ErrRoundAborted)
+	case <-time.After(waitTimeout):
+		t.Fatal("中止后LLM请求没有被取消")
+	}
+	s.waitPhase(t, PhaseIdle)
+
+	// 被中止的轮次随后到达的分段与播放完成事件不影响会话状态
+	s.tts.hold.Store(false)
+	llm.setHold(false)
+	s.send(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "换一个"})
+	require.Eventually(t, func() bool { return s.conn.countTTS("stop") == 2 }, waitTimeout, 5*time.Millisecond)
+	s.waitPhase(t, PhaseIdle)
+	assert.Equal(t, 2, s.h.currentRound())
+}
+
+func TestSessionBargeInReplacesRound(t *testing.T) {
+	llm := newFakeLLM("好的，我来介绍一下。")
+	llm.setHold(true)
+	s := newTestSession(t, llm)
+	s.send(t, map[string]interface{}{"type": "listen", "state": "start", "mode": "realtime"})
+	s.waitPhase(t, PhaseListening)
+
+	go s.h.OnAsrResult("介绍一下北京", true)
+	<-llm.started
+	require.Eventually(t, s.h.isSpeaking, waitTimeout, 5*time.Millisecond)
+
+	llm.setHold(false)
+	go s.h.OnAsrResult("算了，说说上海", true) // 用户在回复时插话
+	select {
+	case cause := <-llm.causes:
+		assert.ErrorIs(t, cause, ErrRoundInterrupted)
+	case <-time.After(waitTimeout):
+		t.Fatal("插话后上一轮的LLM请求没有被取消")
+	}
+	require.Eventually(t, func() bool {
+		state := s.h.snapshot()
+		return state.round == 2 && state.phase == PhaseListening
+	}, waitTimeout, 5*time.Millisecond)
+	assert.Positive(t, s.asr.resets.Load())
+}
+
+func TestSessionStateReadsAreRaceFree(t *testing.T) {
+	s := newTestSession(t, newFakeLLM("第一句。第二句。第三句。"))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					state := s.h.GetState()
+					assert.GreaterOrEqual(t, state.TalkRound, 0)
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 5; i++ {
+		s.send(t, map[string]interface{}{"type": "listen", "state": "detect", "text": "你好"})
+		require.Eventually(t, func() bool { return s.conn.countTTS("stop") == i }, waitTimeout, 5*time.Millisecond)
+	}
+	require.NoError(t, s.h.AbortSpeech())
+	require.NoError(t, s.h.StartConversation("再见"))
+	require.Eventually(t, func() bool { return s.conn.countTTS("stop") >= 7 }, waitTimeout, 5*time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	s.waitPhase(t, PhaseIdle)
+	assert.Equal(t, 6, s.h.currentRound())
+}
+
+func TestHelloWriteDoesNotBlockAudio(t *testing.T) {
+	s := newTestSession(t, newFakeLLM())
+	s.conn.hold = make(chan struct{})
+	defer close(s.conn.hold)
+
+	go s.h.handleHelloMessage(map[string]interface{}{
+		"type":         "hello",
+		"audio_params": map[string]interface{}{"format": "pcm", "sample_rate": 16000.0, "channels": 1.0},
+	})
+	require.Eventually(t, func() bool {
+		s.h.audioMu.Lock()
+		defer s.h.audioMu.Unlock()
+		return s.h.clientAudioFormat == "pcm"
+	}, waitTimeout, 5*time.Millisecond)
+
+	// hello 回复阻塞在写入时，上行音频仍能及时处理
+	done := make(chan struct{})
+	go func() {
+		s.h.handleMessage(2, make([]byte, 640))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(waitTimeout):
+		t.Fatal("上行音频被阻塞在 hello 回复的写入上")
+	}
+}
+
+func TestSwitchAgentRunsInSession(t *testing.T) {
+	db := openAnnounceDB(t)
+	agent := &models.Agent{Name: "助手B", UserID: 1}
+	require.NoError(t, database.CreateAgent(db, agent))
+	require.NoError(t, database.AddDevice(db, &models.Device{Name: "dev", DeviceID: "dev-1", ClientID: "client-1"}))
+
+	s := newTestSession(t, newFakeLLM("好的。"))
+	s.h.deviceID = "dev-1"
+
+	// 会话协程忙碌时，切换等待其空闲后执行
+	busy, release := make(chan struct{}), make(chan struct{})
+	go s.h.inSession(func() { close(busy); <-release })
+	<-busy
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.h.SwitchAgent(agent.ID)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, s.h.agentID)
+	close(release)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(waitTimeout):
+		t.Fatal("切换智能体没有返回")
+	}
+	assert.Equal(t, agent.ID, s.h.agentID)
+
+	s.h.Close()
+	_, err := s.h.SwitchAgent(agent.ID)
+	assert.EqualError(t, err, "设备连接已关闭")
+}
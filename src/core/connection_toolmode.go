@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/quota"
+	"xiaozhi-server-go/src/core/types"
+)
+
+// toolMode 当前LLM配置的工具调用方式，未配置时使用原生 function calling
+func (h *ConnectionHandler) toolMode() string {
+	if getter, ok := h.llmProvider().(llmConfigGetter); ok {
+		switch mode := getter.Config().ToolMode; mode {
+		case llm.ToolModePrompt, llm.ToolModeNone:
+			return mode
+		}
+	}
+	return llm.ToolModeNative
+}
+
+// handleToolCalls 执行模型本轮返回的工具调用；有多个调用时依次执行，
+// 需要LLM根据结果继续回复的调用先记录结果，全部执行完后只请求一次LLM
+func (h *ConnectionHandler) handleToolCalls(ctx context.Context, round int, calls []types.ToolCall, textIndex int) {
+	if len(calls) == 1 {
+		result, functionCallData := h.executeToolCall(ctx, calls[0])
+		if h.roundCanceled(ctx, "工具调用") {
+			return
+		}
+		h.handleFunctionResult(ctx, round, result, functionCallData, textIndex)
+		return
+	}
+
+	needLLM := false
+	for _, call := range calls {
+		if h.roundCanceled(ctx, "工具调用") {
+			return // 轮次已取消，不再执行剩余调用，也不记录未完成的结果
+		}
+		result, functionCallData := h.executeToolCall(ctx, call)
+		if ctx.Err() != nil {
+			continue
+		}
+		if text, ok := result.Result.(string); ok && text != "" && result.Action == types.ActionTypeReqLLM {
+			h.addToolCallMessage(text, functionCallData)
+			needLLM = true
+			continue
+		}
+		h.handleFunctionResult(ctx, round, result, functionCallData, textIndex)
+	}
+	if needLLM && ctx.Err() == nil {
+		h.setRoundPhase(round, PhaseThinking)
+		h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), round)
+	}
+}
+
+// executeToolCall 执行单个工具调用，返回执行结果与记录对话历史用的调用信息
+func (h *ConnectionHandler) executeToolCall(ctx context.Context, call types.ToolCall) (types.ActionResponse, map[string]interface{}) {
+	functionID := call.ID
+	functionName := call.Function.Name
+	functionArguments := call.Function.Arguments
+
+	arguments := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(functionArguments), &arguments); err != nil {
+		h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+	}
+	functionCallData := map[string]interface{}{
+		"id":        functionID,
+		"name":      functionName,
+		"arguments": functionArguments,
+	}
+	h.LogInfo(fmt.Sprintf("函数调用: %s %v", functionName, arguments))
+	h.publishEvent(events.TypeToolCall, map[string]interface{}{
+		"id": functionID, "name": functionName, "arguments": arguments,
+	})
+	h.addUsage(func(u *quota.Usage) { u.ToolCalls++ })
+
+	if h.mcpManager.IsMCPTool(functionName) {
+		// 处理MCP函数调用
+		result, err := h.mcpManager.ExecuteTool(ctx, functionName, arguments)
+		if err != nil {
+			h.LogError(fmt.Sprintf("MCP函数调用失败: %v", err))
+			if result == nil {
+				result = "MCP工具调用失败"
+			}
+		}
+		// 判断result 是否是types.ActionResponse类型
+		if actionResult, ok := result.(types.ActionResponse); ok {
+			return actionResult, functionCallData
+		}
+		h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
+		return types.ActionResponse{
+			Action: types.ActionTypeReqLLM, // 动作类型
+			Result: result,                 // 动作产生的结果
+		}, functionCallData
+	}
+	if h.iotManager.IsIotTool(functionName) {
+		// 处理旧版IoT协议的设备控制
+		return h.handleIotToolCall(functionName, arguments), functionCallData
+	}
+	return types.ActionResponse{Action: types.ActionTypeNotFound, Result: functionName}, functionCallData
+}
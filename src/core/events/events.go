@@ -0,0 +1,256 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 会话事件总线。
+* 每个连接在关键节点（连接建立/关闭、hello、ASR、LLM分段、工具调用、TTS分段、情绪、错误）发布事件，
+* 控制台的实时事件流、Webhook 等通过订阅总线获取事件。
+* 发布是非阻塞的，订阅者消费不及时时丢弃事件，不影响对话流程；
+* 不能丢失事件的订阅者（如 Webhook 投递）使用 SubscribeLossless，事件在内存队列中排队等待消费。
+ */
+
+// 事件类型
+const (
+	TypeConnectionOpen  = "connection_open"
+	TypeConnectionClose = "connection_close"
+	TypeHello           = "hello"
+	TypeASRPartial      = "asr_partial"
+	TypeASRFinal        = "asr_final"
+	TypeLLMSegment      = "llm_segment"
+	TypeToolCall        = "tool_call"
+	TypeToolResult      = "tool_result"
+	TypeTTSStart        = "tts_segment_start"
+	TypeTTSEnd          = "tts_segment_end"
+	TypeEmotion         = "emotion"
+	TypeError           = "error"
+	TypeFailover        = "provider_failover"
+)
+
+// 业务事件，供 Webhook 等订阅
+const (
+	TypeRoundFinished    = "round_finished"    // 一轮对话结束，携带用户文本与回复
+	TypeDeviceRegistered = "device_registered" // 新设备通过OTA注册
+	TypeFirmwareOffered  = "firmware_offered"  // OTA向设备下发了新版本固件
+	TypeTelemetryAlert   = "telemetry_alert"   // 设备健康告警
+)
+
+// 订阅者默认缓冲大小
+const defaultBufferSize = 256
+
+// Event 会话事件
+type Event struct {
+	ID        uint64                 `json:"id"`
+	Type      string                 `json:"type"`
+	SessionID string                 `json:"session_id"`
+	DeviceID  string                 `json:"device_id"`
+	UserID    uint                   `json:"user_id"`
+	AgentID   uint                   `json:"agent_id"`
+	Time      time.Time              `json:"time"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Filter 订阅过滤器，返回true表示接收该事件
+type Filter func(e *Event) bool
+
+// Subscription 事件订阅
+type Subscription struct {
+	id      uint64
+	bus     *Bus
+	filter  Filter
+	ch      chan Event
+	dropped uint64
+	once    sync.Once
+
+	// 无损订阅：发布时追加到队列，由 pump 协程转发到 ch
+	lossless bool
+	mu       sync.Mutex
+	pending  []Event
+	notify   chan struct{}
+	done     chan struct{}
+}
+
+// push 追加到无损订阅的队列
+func (s *Subscription) push(e Event) {
+	s.mu.Lock()
+	s.pending = append(s.pending, e)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pump 按顺序把队列中的事件转发到通道，订阅关闭后关闭通道
+func (s *Subscription) pump() {
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		for _, e := range batch {
+			select {
+			case s.ch <- e:
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// C 事件通道，订阅关闭后通道会被关闭
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped 因消费不及时被丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.unsubscribe(s)
+	})
+}
+
+// Bus 事件总线
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[uint64]*Subscription
+	nextID uint64
+	seq    uint64
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[uint64]*Subscription),
+	}
+}
+
+var defaultBus = NewBus()
+
+// Default 获取全局事件总线
+func Default() *Bus {
+	return defaultBus
+}
+
+// HasSubscribers 是否有订阅者，没有订阅者时发布方可跳过事件构造
+func (b *Bus) HasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+// Publish 发布事件，非阻塞
+func (b *Bus) Publish(e Event) {
+	e.ID = atomic.AddUint64(&b.seq, 1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs {
+		if sub.filter != nil && !sub.filter(&e) {
+			continue
+		}
+		if sub.lossless {
+			sub.push(e)
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe 订阅事件，filter为nil时接收全部事件，bufferSize<=0时使用默认缓冲大小
+func (b *Bus) Subscribe(filter Filter, bufferSize int) *Subscription {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	sub := &Subscription{
+		id:     b.nextID,
+		bus:    b,
+		filter: filter,
+		ch:     make(chan Event, bufferSize),
+	}
+	b.subs[sub.id] = sub
+	return sub
+}
+
+// SubscribeLossless 订阅事件且不丢弃：消费不及时的事件在内存队列中排队，发布仍然不阻塞
+func (b *Bus) SubscribeLossless(filter Filter) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	sub := &Subscription{
+		id:       b.nextID,
+		bus:      b,
+		filter:   filter,
+		ch:       make(chan Event),
+		lossless: true,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	b.subs[sub.id] = sub
+	go sub.pump()
+	return sub
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub.id]; ok {
+		delete(b.subs, sub.id)
+		if sub.lossless {
+			close(sub.done) // 由 pump 关闭通道
+		} else {
+			close(sub.ch)
+		}
+	}
+}
+
+// Publisher 单个会话的事件发布者，自动填充会话信息
+type Publisher struct {
+	bus     *Bus
+	session func() (sessionID, deviceID string, userID, agentID uint)
+}
+
+// NewPublisher 创建会话事件发布者，session在每次发布时调用以获取最新的会话信息
+func NewPublisher(bus *Bus, session func() (sessionID, deviceID string, userID, agentID uint)) *Publisher {
+	if bus == nil {
+		bus = defaultBus
+	}
+	return &Publisher{bus: bus, session: session}
+}
+
+// Publish 发布会话事件
+func (p *Publisher) Publish(eventType string, data map[string]interface{}) {
+	if p == nil || !p.bus.HasSubscribers() {
+		return
+	}
+	e := Event{Type: eventType, Data: data}
+	if p.session != nil {
+		e.SessionID, e.DeviceID, e.UserID, e.AgentID = p.session()
+	}
+	p.bus.Publish(e)
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusPublishSubscribe(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(nil, 4)
+	defer all.Close()
+	onlyA := bus.Subscribe(func(e *Event) bool { return e.SessionID == "a" }, 4)
+	defer onlyA.Close()
+
+	bus.Publish(Event{Type: TypeHello, SessionID: "a"})
+	bus.Publish(Event{Type: TypeHello, SessionID: "b"})
+
+	require.Len(t, all.C(), 2)
+	require.Len(t, onlyA.C(), 1)
+	e := <-onlyA.C()
+	assert.Equal(t, "a", e.SessionID)
+	assert.NotZero(t, e.ID)
+	assert.False(t, e.Time.IsZero())
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(nil, 1)
+	defer sub.Close()
+
+	bus.Publish(Event{Type: TypeError})
+	bus.Publish(Event{Type: TypeError})
+
+	assert.Len(t, sub.C(), 1)
+	assert.Equal(t, uint64(1), sub.Dropped(), "Publish should never block on a slow subscriber")
+}
+
+func TestBusLosslessKeepsAllEvents(t *testing.T) {
+	bus := NewBus()
+	sub := bus.SubscribeLossless(func(e *Event) bool { return e.Type == TypeRoundFinished })
+
+	for i := 0; i < 2000; i++ {
+		bus.Publish(Event{Type: TypeRoundFinished})
+		bus.Publish(Event{Type: TypeHello})
+	}
+	var last uint64
+	for i := 0; i < 2000; i++ {
+		e := <-sub.C()
+		assert.Greater(t, e.ID, last, "events keep their publish order")
+		last = e.ID
+	}
+	assert.Zero(t, sub.Dropped())
+
+	sub.Close()
+	_, ok := <-sub.C()
+	assert.False(t, ok)
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(nil, 1)
+	assert.True(t, bus.HasSubscribers())
+
+	sub.Close()
+	sub.Close()
+	_, ok := <-sub.C()
+	assert.False(t, ok, "Channel should be closed")
+	assert.False(t, bus.HasSubscribers())
+}
+
+func TestPublisherFillsSession(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(nil, 1)
+	defer sub.Close()
+
+	p := NewPublisher(bus, func() (string, string, uint, uint) {
+		return "session-1", "aa:bb", 2, 3
+	})
+	p.Publish(TypeASRFinal, map[string]interface{}{"text": "你好"})
+
+	e := <-sub.C()
+	assert.Equal(t, TypeASRFinal, e.Type)
+	assert.Equal(t, "session-1", e.SessionID)
+	assert.Equal(t, "aa:bb", e.DeviceID)
+	assert.Equal(t, uint(2), e.UserID)
+	assert.Equal(t, uint(3), e.AgentID)
+	assert.Equal(t, "你好", e.Data["text"])
+}
@@ -0,0 +1,414 @@
+package iot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+/*
+* 旧版固件使用的IoT描述协议。
+* 设备通过 {"type":"iot","descriptors":[...]} 上报可控制的属性与方法，
+* 通过 {"type":"iot","states":[...]} 上报属性当前值，
+* 服务端通过 {"type":"iot","commands":[...]} 下发方法调用。
+* 本包负责把描述符转换为LLM可调用的工具，并维护每个会话的设备状态。
+ */
+
+const (
+	// ToolPrefix IoT工具名前缀
+	ToolPrefix = "iot_"
+	// GetStatesToolName 查询设备状态的工具名
+	GetStatesToolName = ToolPrefix + "get_states"
+)
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Property 属性/参数描述
+type Property struct {
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+// Method 方法描述
+type Method struct {
+	Description string              `json:"description"`
+	Parameters  map[string]Property `json:"parameters"`
+}
+
+// Descriptor 设备描述符
+type Descriptor struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Properties  map[string]Property `json:"properties"`
+	Methods     map[string]Method   `json:"methods"`
+}
+
+// State 设备状态
+type State struct {
+	Name  string                 `json:"name"`
+	State map[string]interface{} `json:"state"`
+}
+
+// Command 下发给设备的方法调用
+type Command struct {
+	Name       string                 `json:"name"`
+	Method     string                 `json:"method"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// methodRef 工具名到设备方法的映射
+type methodRef struct {
+	device string
+	method string
+}
+
+// Manager 单个会话的IoT设备管理器
+type Manager struct {
+	mu          sync.RWMutex
+	descriptors map[string]Descriptor
+	states      map[string]map[string]interface{}
+	methods     map[string]methodRef
+}
+
+// NewManager 创建IoT设备管理器
+func NewManager() *Manager {
+	return &Manager{
+		descriptors: make(map[string]Descriptor),
+		states:      make(map[string]map[string]interface{}),
+		methods:     make(map[string]methodRef),
+	}
+}
+
+// ParseDescriptors 解析iot消息中的descriptors字段
+func ParseDescriptors(raw interface{}) ([]Descriptor, error) {
+	var descriptors []Descriptor
+	if err := remarshal(raw, &descriptors); err != nil {
+		return nil, fmt.Errorf("解析IoT描述符失败: %v", err)
+	}
+	return descriptors, nil
+}
+
+// ParseStates 解析iot消息中的states字段
+func ParseStates(raw interface{}) ([]State, error) {
+	var states []State
+	if err := remarshal(raw, &states); err != nil {
+		return nil, fmt.Errorf("解析IoT状态失败: %v", err)
+	}
+	return states, nil
+}
+
+// UpdateDescriptors 更新设备描述符，返回当前全部IoT工具
+func (m *Manager) UpdateDescriptors(descriptors []Descriptor) []openai.Tool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range descriptors {
+		if d.Name == "" {
+			continue
+		}
+		m.descriptors[d.Name] = d
+		for methodName := range d.Methods {
+			m.methods[MethodToolName(d.Name, methodName)] = methodRef{device: d.Name, method: methodName}
+		}
+	}
+	return m.toolsLocked()
+}
+
+// UpdateStates 合并设备上报的状态
+func (m *Manager) UpdateStates(states []State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range states {
+		if s.Name == "" {
+			continue
+		}
+		current, ok := m.states[s.Name]
+		if !ok {
+			current = make(map[string]interface{})
+			m.states[s.Name] = current
+		}
+		for k, v := range s.State {
+			current[k] = v
+		}
+	}
+}
+
+// HasDevices 是否收到过设备描述符
+func (m *Manager) HasDevices() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.descriptors) > 0
+}
+
+// IsIotTool 判断是否是IoT工具
+func (m *Manager) IsIotTool(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if name == GetStatesToolName {
+		return len(m.descriptors) > 0
+	}
+	_, ok := m.methods[name]
+	return ok
+}
+
+// Tools 获取当前全部IoT工具
+func (m *Manager) Tools() []openai.Tool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.toolsLocked()
+}
+
+// BuildCommand 根据工具调用构造下发给设备的命令，并按描述符校验参数
+func (m *Manager) BuildCommand(toolName string, args map[string]interface{}) (*Command, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ref, ok := m.methods[toolName]
+	if !ok {
+		return nil, fmt.Errorf("IoT工具 %s 不存在", toolName)
+	}
+	method := m.descriptors[ref.device].Methods[ref.method]
+
+	params := make(map[string]interface{}, len(method.Parameters))
+	for name, p := range method.Parameters {
+		v, ok := args[name]
+		if !ok {
+			return nil, fmt.Errorf("缺少参数 %s", name)
+		}
+		converted, err := convertValue(v, p.Type)
+		if err != nil {
+			return nil, fmt.Errorf("参数 %s 错误: %v", name, err)
+		}
+		params[name] = converted
+	}
+
+	return &Command{
+		Name:       ref.device,
+		Method:     ref.method,
+		Parameters: params,
+	}, nil
+}
+
+// GetStates 获取设备状态，name为空时返回全部设备
+func (m *Manager) GetStates(name string) map[string]map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]map[string]interface{})
+	for device, state := range m.states {
+		if name != "" && !strings.EqualFold(device, name) {
+			continue
+		}
+		copied := make(map[string]interface{}, len(state))
+		for k, v := range state {
+			copied[k] = v
+		}
+		result[device] = copied
+	}
+	return result
+}
+
+// StatesText 将设备状态格式化为供LLM阅读的文本
+func (m *Manager) StatesText(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]string, 0, len(m.states))
+	for device := range m.states {
+		if name != "" && !strings.EqualFold(device, name) {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	if len(devices) == 0 {
+		if name != "" {
+			return fmt.Sprintf("没有设备 %s 的状态信息", name)
+		}
+		return "设备尚未上报任何状态"
+	}
+	sort.Strings(devices)
+
+	lines := make([]string, 0, len(devices))
+	for _, device := range devices {
+		state := m.states[device]
+		keys := make([]string, 0, len(state))
+		for k := range state {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		desc := m.descriptors[device]
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			label := k
+			if p, ok := desc.Properties[k]; ok && p.Description != "" {
+				label = p.Description
+			}
+			items = append(items, fmt.Sprintf("%s=%v", label, state[k]))
+		}
+		title := device
+		if desc.Description != "" {
+			title = fmt.Sprintf("%s(%s)", desc.Description, device)
+		}
+		lines = append(lines, title+": "+strings.Join(items, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewCommandMessage 构造下发给设备的iot命令消息
+func NewCommandMessage(sessionID string, commands ...Command) ([]byte, error) {
+	msg := map[string]interface{}{
+		"type":       "iot",
+		"session_id": sessionID,
+		"commands":   commands,
+	}
+	return json.Marshal(msg)
+}
+
+// MethodToolName 生成设备方法对应的工具名
+func MethodToolName(device, method string) string {
+	name := ToolPrefix + strings.ToLower(device) + "_" + strings.ToLower(method)
+	name = invalidToolNameChars.ReplaceAllString(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func (m *Manager) toolsLocked() []openai.Tool {
+	if len(m.descriptors) == 0 {
+		return []openai.Tool{}
+	}
+
+	names := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]openai.Tool, 0, len(names)+1)
+	for _, toolName := range names {
+		ref := m.methods[toolName]
+		desc := m.descriptors[ref.device]
+		method := desc.Methods[ref.method]
+
+		properties := make(map[string]interface{}, len(method.Parameters))
+		required := make([]string, 0, len(method.Parameters))
+		for name, p := range method.Parameters {
+			properties[name] = map[string]interface{}{
+				"type":        jsonSchemaType(p.Type),
+				"description": p.Description,
+			}
+			required = append(required, name)
+		}
+		sort.Strings(required)
+
+		description := method.Description
+		if desc.Description != "" {
+			description = fmt.Sprintf("%s - %s", desc.Description, method.Description)
+		}
+		tools = append(tools, openai.Tool{
+			Type: "function",
+			Function: &openai.FunctionDefinition{
+				Name:        toolName,
+				Description: description,
+				Parameters: map[string]interface{}{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+			},
+		})
+	}
+
+	deviceNames := make([]string, 0, len(m.descriptors))
+	for name := range m.descriptors {
+		deviceNames = append(deviceNames, name)
+	}
+	sort.Strings(deviceNames)
+	tools = append(tools, openai.Tool{
+		Type: "function",
+		Function: &openai.FunctionDefinition{
+			Name:        GetStatesToolName,
+			Description: "查询设备当前状态（如音量、亮度、开关等），回答设备状态相关问题前调用",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "设备名称，可选值：" + strings.Join(deviceNames, ", ") + "，为空时返回全部设备",
+					},
+				},
+				"required": []string{},
+			},
+		},
+	})
+	return tools
+}
+
+// jsonSchemaType 将IoT描述符中的类型转换为JSON Schema类型
+func jsonSchemaType(t string) string {
+	switch strings.ToLower(t) {
+	case "number", "integer", "int", "float":
+		return "number"
+	case "boolean", "bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// convertValue 按描述符类型转换LLM给出的参数值
+func convertValue(v interface{}, t string) (interface{}, error) {
+	switch jsonSchemaType(t) {
+	case "number":
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case string:
+			var f float64
+			if _, err := fmt.Sscanf(strings.TrimSpace(n), "%g", &f); err != nil {
+				return nil, fmt.Errorf("需要数字类型，实际为 %q", n)
+			}
+			return f, nil
+		default:
+			return nil, fmt.Errorf("需要数字类型，实际为 %T", v)
+		}
+	case "boolean":
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(b)) {
+			case "true", "1", "on":
+				return true, nil
+			case "false", "0", "off":
+				return false, nil
+			}
+			return nil, fmt.Errorf("需要布尔类型，实际为 %q", b)
+		default:
+			return nil, fmt.Errorf("需要布尔类型，实际为 %T", v)
+		}
+	default:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprintf("%v", v), nil
+	}
+}
+
+func remarshal(raw interface{}, out interface{}) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
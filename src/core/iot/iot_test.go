@@ -0,0 +1,189 @@
+package iot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 旧版固件上报的描述符消息
+const descriptorsPayload = `{
+	"session_id": "",
+	"type": "iot",
+	"update": true,
+	"descriptors": [
+		{
+			"name": "Speaker",
+			"description": "扬声器",
+			"properties": {
+				"volume": {"description": "当前音量值", "type": "number"}
+			},
+			"methods": {
+				"SetVolume": {
+					"description": "设置音量",
+					"parameters": {
+						"volume": {"description": "0到100之间的整数", "type": "number"}
+					}
+				}
+			}
+		},
+		{
+			"name": "Lamp",
+			"description": "一个测试用的灯",
+			"properties": {
+				"power": {"description": "灯是否打开", "type": "boolean"}
+			},
+			"methods": {
+				"TurnOn": {"description": "打开灯", "parameters": {}},
+				"TurnOff": {"description": "关闭灯", "parameters": {}}
+			}
+		}
+	]
+}`
+
+// 旧版固件上报的状态消息
+const statesPayload = `{
+	"session_id": "",
+	"type": "iot",
+	"update": true,
+	"states": [
+		{"name": "Speaker", "state": {"volume": 80}},
+		{"name": "Lamp", "state": {"power": false}}
+	]
+}`
+
+func loadMessage(t *testing.T, payload string) map[string]interface{} {
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payload), &msg))
+	return msg
+}
+
+func newLoadedManager(t *testing.T) *Manager {
+	descriptors, err := ParseDescriptors(loadMessage(t, descriptorsPayload)["descriptors"])
+	require.NoError(t, err)
+	m := NewManager()
+	m.UpdateDescriptors(descriptors)
+	return m
+}
+
+func TestParseDescriptors(t *testing.T) {
+	descriptors, err := ParseDescriptors(loadMessage(t, descriptorsPayload)["descriptors"])
+
+	require.NoError(t, err)
+	require.Len(t, descriptors, 2)
+	assert.Equal(t, "Speaker", descriptors[0].Name)
+	assert.Equal(t, "number", descriptors[0].Methods["SetVolume"].Parameters["volume"].Type)
+	assert.Len(t, descriptors[1].Methods, 2)
+}
+
+func TestUpdateDescriptors_BuildsTools(t *testing.T) {
+	m := newLoadedManager(t)
+
+	tools := m.Tools()
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Function.Name)
+	}
+	assert.ElementsMatch(t, []string{
+		"iot_speaker_setvolume",
+		"iot_lamp_turnon",
+		"iot_lamp_turnoff",
+		GetStatesToolName,
+	}, names)
+
+	for _, tool := range tools {
+		if tool.Function.Name != "iot_speaker_setvolume" {
+			continue
+		}
+		params := tool.Function.Parameters.(map[string]interface{})
+		assert.Equal(t, []string{"volume"}, params["required"])
+		volume := params["properties"].(map[string]interface{})["volume"].(map[string]interface{})
+		assert.Equal(t, "number", volume["type"])
+	}
+}
+
+func TestIsIotTool(t *testing.T) {
+	empty := NewManager()
+	assert.False(t, empty.IsIotTool(GetStatesToolName), "No devices, no state tool")
+
+	m := newLoadedManager(t)
+	assert.True(t, m.IsIotTool("iot_lamp_turnon"))
+	assert.True(t, m.IsIotTool(GetStatesToolName))
+	assert.False(t, m.IsIotTool("self_audio_speaker_set_volume"))
+}
+
+func TestBuildCommand(t *testing.T) {
+	m := newLoadedManager(t)
+
+	cmd, err := m.BuildCommand("iot_speaker_setvolume", map[string]interface{}{"volume": "30"})
+	require.NoError(t, err)
+	assert.Equal(t, "Speaker", cmd.Name)
+	assert.Equal(t, "SetVolume", cmd.Method)
+	assert.Equal(t, float64(30), cmd.Parameters["volume"])
+
+	cmd, err = m.BuildCommand("iot_lamp_turnon", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Empty(t, cmd.Parameters)
+}
+
+func TestBuildCommand_InvalidArguments(t *testing.T) {
+	m := newLoadedManager(t)
+
+	_, err := m.BuildCommand("iot_speaker_setvolume", map[string]interface{}{})
+	assert.Error(t, err, "Missing parameter should fail")
+
+	_, err = m.BuildCommand("iot_speaker_setvolume", map[string]interface{}{"volume": "loud"})
+	assert.Error(t, err, "Non-numeric value should fail")
+
+	_, err = m.BuildCommand("iot_unknown_method", nil)
+	assert.Error(t, err)
+}
+
+func TestNewCommandMessage(t *testing.T) {
+	data, err := NewCommandMessage("session-1", Command{
+		Name:       "Speaker",
+		Method:     "SetVolume",
+		Parameters: map[string]interface{}{"volume": float64(50)},
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"type": "iot",
+		"session_id": "session-1",
+		"commands": [{"name": "Speaker", "method": "SetVolume", "parameters": {"volume": 50}}]
+	}`, string(data))
+}
+
+func TestUpdateStates(t *testing.T) {
+	m := newLoadedManager(t)
+	states, err := ParseStates(loadMessage(t, statesPayload)["states"])
+	require.NoError(t, err)
+	m.UpdateStates(states)
+
+	assert.Equal(t, float64(80), m.GetStates("speaker")["Speaker"]["volume"])
+
+	m.UpdateStates([]State{{Name: "Speaker", State: map[string]interface{}{"volume": float64(20)}}})
+	all := m.GetStates("")
+	assert.Equal(t, float64(20), all["Speaker"]["volume"], "States should be merged")
+	assert.Equal(t, false, all["Lamp"]["power"])
+}
+
+func TestStatesText(t *testing.T) {
+	m := newLoadedManager(t)
+	assert.Equal(t, "设备尚未上报任何状态", m.StatesText(""))
+
+	states, err := ParseStates(loadMessage(t, statesPayload)["states"])
+	require.NoError(t, err)
+	m.UpdateStates(states)
+
+	assert.Equal(t, "扬声器(Speaker): 当前音量值=80", m.StatesText("Speaker"))
+	assert.Contains(t, m.StatesText(""), "一个测试用的灯(Lamp): 灯是否打开=false")
+	assert.Contains(t, m.StatesText("Fan"), "没有设备 Fan")
+}
+
+func TestMethodToolName(t *testing.T) {
+	assert.Equal(t, "iot_speaker_setvolume", MethodToolName("Speaker", "SetVolume"))
+	assert.Equal(t, "iot_air_conditioner_set_mode", MethodToolName("Air Conditioner", "Set.Mode"))
+}
@@ -68,6 +68,9 @@ func (c *LocalClient) RegisterTools() {
 		} else if localFunc.Name == "switch_agent" && localFunc.Enabled {
 			c.AddToolSwitchAgent()
 			c.logger.Info("RegisterTools: switch_agent tool registered")
+		} else if localFunc.Name == "reminder" && localFunc.Enabled {
+			c.AddToolReminder()
+			c.logger.Info("RegisterTools: reminder tools registered")
 		} else {
 			if localFunc.Enabled {
 				c.logger.Warn("RegisterTools: unknown function name %s", localFunc.Name)
@@ -226,3 +226,89 @@ func (c *LocalClient) AddToolSwitchAgent() error {
 
 	return nil
 }
+
+// AddToolReminder 注册提醒相关工具：设置、查看、取消提醒
+func (c *LocalClient) AddToolReminder() error {
+	setSchema := ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"content": map[string]any{
+				"type":        "string",
+				"description": "提醒内容，例如：开会、吃药",
+			},
+			"time": map[string]any{
+				"type":        "string",
+				"description": "提醒时间，格式为 YYYY-MM-DD HH:MM，与 delay_minutes 二选一",
+			},
+			"delay_minutes": map[string]any{
+				"type":        "number",
+				"description": "从现在起多少分钟后提醒，用户说'X分钟后'或'X小时后'时使用，与 time 二选一",
+			},
+			"repeat": map[string]any{
+				"type":        "string",
+				"description": "重复方式，可选：daily(每天)、weekdays(工作日)、weekends(周末)、weekly(每周)、monthly(每月)，或5段cron表达式，只提醒一次时留空",
+			},
+		},
+		Required: []string{"content"},
+	}
+
+	c.AddTool("set_reminder",
+		"当用户要求设置提醒、闹钟、定时提醒时调用，如果用户给出的是具体时间但不确定当前日期，先调用get_time获取当前时间",
+		setSchema,
+		func(ctx context.Context, args map[string]any) (interface{}, error) {
+			return types.ActionResponse{
+				Action: types.ActionTypeCallHandler,
+				Result: types.ActionResponseCall{
+					FuncName: "mcp_handler_set_reminder",
+					Args:     args,
+				},
+			}, nil
+		})
+
+	c.AddTool("list_reminders",
+		"当用户想查看已经设置的提醒或闹钟时调用",
+		ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{},
+			Required:   []string{},
+		},
+		func(ctx context.Context, args map[string]any) (interface{}, error) {
+			return types.ActionResponse{
+				Action: types.ActionTypeCallHandler,
+				Result: types.ActionResponseCall{
+					FuncName: "mcp_handler_list_reminders",
+					Args:     args,
+				},
+			}, nil
+		})
+
+	cancelSchema := ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"id": map[string]any{
+				"type":        "number",
+				"description": "要取消的提醒编号，可通过list_reminders获取",
+			},
+			"keyword": map[string]any{
+				"type":        "string",
+				"description": "提醒内容中的关键词，不知道编号时使用",
+			},
+		},
+		Required: []string{},
+	}
+
+	c.AddTool("cancel_reminder",
+		"当用户要取消或删除某个提醒、闹钟时调用，必须提供id或keyword其中之一",
+		cancelSchema,
+		func(ctx context.Context, args map[string]any) (interface{}, error) {
+			return types.ActionResponse{
+				Action: types.ActionTypeCallHandler,
+				Result: types.ActionResponseCall{
+					FuncName: "mcp_handler_cancel_reminder",
+					Args:     args,
+				},
+			}, nil
+		})
+
+	return nil
+}
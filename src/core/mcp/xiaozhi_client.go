@@ -189,6 +189,16 @@ func (c *XiaoZhiMCPClient) GetAvailableTools() []openai.Tool {
 	return result
 }
 
+// GetTools 获取设备上报的原始工具定义（未替换名称中的"."）
+func (c *XiaoZhiMCPClient) GetTools() []Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]Tool, len(c.tools))
+	copy(result, c.tools)
+	return result
+}
+
 // CallTool 调用指定的工具
 func (c *XiaoZhiMCPClient) CallTool(
 	ctx context.Context,
@@ -102,15 +102,23 @@ func NewLLMFactory(llmType string, config *configs.Config, logger *utils.Logger)
 		return &ProviderFactory{
 			providerType: "llm",
 			config: &llm.Config{
-				Name:        llmType,
-				Type:        llmCfg.Type,
-				ModelName:   llmCfg.ModelName,
-				BaseURL:     llmCfg.BaseURL,
-				APIKey:      llmCfg.APIKey,
-				Temperature: llmCfg.Temperature,
-				MaxTokens:   llmCfg.MaxTokens,
-				TopP:        llmCfg.TopP,
-				Extra:       llmCfg.Extra,
+				Name:             llmType,
+				Type:             llmCfg.Type,
+				ModelName:        llmCfg.ModelName,
+				BaseURL:          llmCfg.BaseURL,
+				APIKey:           llmCfg.APIKey,
+				Temperature:      llmCfg.Temperature,
+				MaxTokens:        llmCfg.MaxTokens,
+				TopP:             llmCfg.TopP,
+				Stop:             llmCfg.Stop,
+				Seed:             llmCfg.Seed,
+				PresencePenalty:  llmCfg.PresencePenalty,
+				FrequencyPenalty: llmCfg.FrequencyPenalty,
+				ReasoningEffort:  llmCfg.ReasoningEffort,
+				ToolMode:         llmCfg.ToolMode,
+				ContextWindow:    llmCfg.ContextWindow,
+				Tokenizer:        llmCfg.Tokenizer,
+				Extra:            llmCfg.Extra,
 			},
 			logger: logger,
 		}
@@ -0,0 +1,161 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// Ensure Provider implements asr.Provider interface
+var _ asr.Provider = (*Provider)(nil)
+
+// Provider 按脚本返回识别结果的ASR，用于测试和本地调试，不访问任何服务
+//
+// 配置示例：
+//
+//	MockASR:
+//	  type: mock
+//	  min_chunks: 5     # 收到多少个音频分片后给出一条识别结果
+//	  transcripts:
+//	    - 你好
+//	    - 现在几点了
+//
+// 识别结果按顺序循环使用，音频内容本身不参与识别
+type Provider struct {
+	*asr.BaseProvider
+	logger      *utils.Logger
+	transcripts []string
+	minChunks   int
+
+	mu       sync.Mutex
+	listener providers.AsrEventListener
+	chunks   int // 本次识别已收到的音频分片数
+	next     int // 下一条识别结果的序号
+}
+
+// NewProvider 创建Mock ASR提供者
+func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
+	provider := &Provider{
+		BaseProvider: asr.NewBaseProvider(config, deleteFile),
+		logger:       logger,
+		minChunks:    5,
+	}
+	if items, ok := config.Data["transcripts"].([]interface{}); ok {
+		for _, item := range items {
+			if text, ok := item.(string); ok && text != "" {
+				provider.transcripts = append(provider.transcripts, text)
+			}
+		}
+	}
+	if len(provider.transcripts) == 0 {
+		provider.transcripts = []string{"你好"}
+	}
+	switch v := config.Data["min_chunks"].(type) {
+	case int:
+		provider.minChunks = v
+	case float64:
+		provider.minChunks = int(v)
+	}
+	if provider.minChunks <= 0 {
+		return nil, fmt.Errorf("min_chunks 必须大于0")
+	}
+	provider.InitAudioProcessing()
+	return provider, nil
+}
+
+// nextTranscript 取出下一条识别结果
+func (p *Provider) nextTranscript() string {
+	text := p.transcripts[p.next%len(p.transcripts)]
+	p.next++
+	return text
+}
+
+// Transcribe 直接返回下一条识别结果
+func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.nextTranscript(), nil
+}
+
+// AddAudio 累计音频分片，达到 min_chunks 后回调识别结果
+func (p *Provider) AddAudio(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	p.chunks++
+	if p.chunks < p.minChunks {
+		p.mu.Unlock()
+		return nil
+	}
+	text, listener := p.takeResult()
+	p.mu.Unlock()
+
+	p.emit(listener, text)
+	return nil
+}
+
+// SendLastAudio 拾音结束，有未识别的音频时立即给出识别结果
+func (p *Provider) SendLastAudio(data []byte) error {
+	p.mu.Lock()
+	if len(data) > 0 {
+		p.chunks++
+	}
+	if p.chunks == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	text, listener := p.takeResult()
+	p.mu.Unlock()
+
+	p.emit(listener, text)
+	return nil
+}
+
+// SetListener 设置事件监听器，拾音模式变化时由会话协程调用，与音频协程并发
+func (p *Provider) SetListener(listener providers.AsrEventListener) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listener = listener
+}
+
+// takeResult 结束本次识别并取出结果与监听器，需持有 mu
+func (p *Provider) takeResult() (string, providers.AsrEventListener) {
+	p.chunks = 0
+	return p.nextTranscript(), p.listener
+}
+
+// emit 回调识别结果，监听器可能在回调中调用 Reset，因此不能持有 mu
+func (p *Provider) emit(listener providers.AsrEventListener, text string) {
+	p.logger.Debug("[ASR] [mock] 识别结果: %s", text)
+	if listener != nil {
+		listener.OnAsrResult(text, true)
+	}
+}
+
+// Reset 重置ASR状态，不影响识别结果的顺序
+func (p *Provider) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chunks = 0
+	p.InitAudioProcessing()
+	return nil
+}
+
+// CloseConnection 没有长连接，无需处理
+func (p *Provider) CloseConnection() error {
+	return nil
+}
+
+func init() {
+	// 注册Mock ASR提供者
+	asr.Register("mock", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
+		return NewProvider(config, deleteFile, logger)
+	})
+}
@@ -51,8 +51,8 @@ type ASRProvider interface {
 type TTSProvider interface {
 	Provider
 
-	// 合成音频并返回文件路径
-	ToTTS(text string) (string, error)
+	// 合成音频并返回文件路径，ctx 取消时应尽快停止合成并返回
+	ToTTS(ctx context.Context, text string) (string, error)
 
 	SetVoice(voice string) (error, string)
 }
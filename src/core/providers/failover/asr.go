@@ -0,0 +1,207 @@
+package failover
+
+import (
+	"context"
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// ASRProvider 带容灾的ASR提供者，首个提供者为主提供者，其余为备用提供者。
+// 音频只发送给当前提供者，发送失败时切换到下一个可用的提供者并重发当前音频；
+// 每次识别结束复位时，若主提供者已恢复则切换回主提供者
+type ASRProvider struct {
+	*chain
+	members []providers.ASRProvider
+
+	mu          sync.Mutex
+	listener    providers.AsrEventListener
+	preferences map[string]interface{}
+	silence     *bool
+}
+
+// NewASRProvider 创建带容灾的ASR提供者，names 与 members 一一对应
+func NewASRProvider(names []string, members []providers.ASRProvider, logger *utils.Logger, onSwitch SwitchFunc) *ASRProvider {
+	return &ASRProvider{
+		chain:   newChain(KindASR, names, logger, onSwitch),
+		members: members,
+	}
+}
+
+// asrListener 转发各提供者的识别结果，收到结果即视为该提供者工作正常
+type asrListener struct {
+	p     *ASRProvider
+	index int
+}
+
+func (l *asrListener) OnAsrResult(result string, isFinalResult bool) bool {
+	l.p.breakers[l.index].Success()
+	l.p.mu.Lock()
+	listener := l.p.listener
+	l.p.mu.Unlock()
+	if listener == nil {
+		return false
+	}
+	return listener.OnAsrResult(result, isFinalResult)
+}
+
+// Initialize 初始化提供者
+func (p *ASRProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 断开并清理备用提供者，主提供者由调用方管理
+func (p *ASRProvider) Cleanup() error {
+	for _, m := range p.members[1:] {
+		m.CloseConnection()
+		m.Cleanup()
+	}
+	return nil
+}
+
+// Primary 获取主提供者
+func (p *ASRProvider) Primary() providers.ASRProvider {
+	return p.members[0]
+}
+
+func (p *ASRProvider) current() providers.ASRProvider {
+	return p.members[p.activeIndex()]
+}
+
+// SetListener 设置识别结果监听器
+func (p *ASRProvider) SetListener(listener providers.AsrEventListener) {
+	p.mu.Lock()
+	p.listener = listener
+	p.mu.Unlock()
+	for i, m := range p.members {
+		m.SetListener(&asrListener{p: p, index: i})
+	}
+}
+
+// SetUserPreferences 设置全部提供者的用户偏好
+func (p *ASRProvider) SetUserPreferences(preferences map[string]interface{}) error {
+	p.mu.Lock()
+	p.preferences = preferences
+	p.mu.Unlock()
+	return p.current().SetUserPreferences(preferences)
+}
+
+// EnableSilenceDetection 设置静音检测
+func (p *ASRProvider) EnableSilenceDetection(bEnable bool) {
+	p.mu.Lock()
+	p.silence = &bEnable
+	p.mu.Unlock()
+	p.current().EnableSilenceDetection(bEnable)
+}
+
+// Transcribe 依次尝试各提供者直接识别音频
+func (p *ASRProvider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	var lastErr error
+	for _, i := range p.candidates() {
+		text, err := p.members[i].Transcribe(ctx, audioData)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", err
+			}
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		p.breakers[i].Success()
+		return text, nil
+	}
+	return "", p.exhausted(lastErr)
+}
+
+// AddAudio 向当前提供者发送音频，失败时切换提供者后重发
+func (p *ASRProvider) AddAudio(data []byte) error {
+	return p.send(func(m providers.ASRProvider) error { return m.AddAudio(data) })
+}
+
+// SendLastAudio 向当前提供者发送最后一块音频，失败时切换提供者后重发
+func (p *ASRProvider) SendLastAudio(data []byte) error {
+	return p.send(func(m providers.ASRProvider) error { return m.SendLastAudio(data) })
+}
+
+func (p *ASRProvider) send(fn func(providers.ASRProvider) error) error {
+	i := p.activeIndex()
+	err := fn(p.members[i])
+	if err == nil {
+		return nil
+	}
+	p.fail(i, err)
+	for _, next := range p.candidates() {
+		if next == i {
+			continue
+		}
+		p.switchTo(next, err)
+		if err = fn(p.members[next]); err == nil {
+			return nil
+		}
+		p.fail(next, err)
+		i = next
+	}
+	return p.exhausted(err)
+}
+
+// switchTo 切换到提供者 i，同步监听器、偏好和静音检测设置，并断开原提供者的连接
+func (p *ASRProvider) switchTo(i int, err error) {
+	from := p.members[p.activeIndex()]
+	to := p.members[i]
+
+	p.mu.Lock()
+	preferences := p.preferences
+	silence := p.silence
+	p.mu.Unlock()
+
+	to.SetListener(&asrListener{p: p, index: i})
+	to.Reset()
+	if preferences != nil {
+		to.SetUserPreferences(preferences)
+	}
+	if silence != nil {
+		to.EnableSilenceDetection(*silence)
+	}
+	from.CloseConnection()
+	p.setActive(i, err)
+}
+
+// Reset 复位当前提供者，优先级更高的提供者冷却结束后切换回去
+func (p *ASRProvider) Reset() error {
+	now := time.Now()
+	for i := 0; i < p.activeIndex(); i++ {
+		status := p.breakers[i].Status(now)
+		if status.State == StateHalfOpen || status.ConsecutiveFailures == 0 {
+			p.switchTo(i, nil)
+			break
+		}
+	}
+	return p.current().Reset()
+}
+
+// CloseConnection 断开全部提供者的连接
+func (p *ASRProvider) CloseConnection() error {
+	var firstErr error
+	for _, m := range p.members {
+		if err := m.CloseConnection(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// GetSilenceCount 获取当前提供者的静音计数
+func (p *ASRProvider) GetSilenceCount() int {
+	return p.current().GetSilenceCount()
+}
+
+// ResetSilenceCount 重置当前提供者的静音计数
+func (p *ASRProvider) ResetSilenceCount() {
+	p.current().ResetSilenceCount()
+}
+
+// ResetStartListenTime 重置当前提供者的开始拾音时间
+func (p *ASRProvider) ResetStartListenTime() {
+	p.current().ResetStartListenTime()
+}
@@ -0,0 +1,169 @@
+package failover
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+* 提供者容灾。
+* 智能体可以为 LLM/TTS/ASR 各配置一组按顺序排列的备用提供者，包装后的提供者依次尝试，
+* 当前提供者出错或超时时切换到下一个。
+* 每个提供者有一个全局共享的熔断器：连续失败达到阈值后熔断，冷却期内所有会话都跳过它，
+* 冷却期结束后放行请求试探，成功则恢复。
+ */
+
+// 提供者类型
+const (
+	KindLLM = "LLM"
+	KindTTS = "TTS"
+	KindASR = "ASR"
+)
+
+const (
+	// 连续失败多少次后熔断
+	FailureThreshold = 3
+	// 熔断后的冷却时长
+	CoolDown = time.Minute
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常
+	StateOpen     = "open"      // 熔断中，跳过该提供者
+	StateHalfOpen = "half_open" // 冷却结束，等待试探结果
+)
+
+// Breaker 单个提供者的熔断器
+type Breaker struct {
+	kind string
+	name string
+
+	mu            sync.Mutex
+	consecutive   int
+	openUntil     time.Time
+	requests      int64
+	failures      int64
+	lastError     string
+	lastFailureAt time.Time
+}
+
+// Status 熔断器状态快照
+type Status struct {
+	Kind                string     `json:"kind"`
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+}
+
+// Allow 判断当前是否可以向该提供者发起请求
+func (b *Breaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// Success 记录一次成功，清零连续失败并关闭熔断
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests++
+	b.consecutive = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure 记录一次失败，连续失败达到阈值时熔断；返回本次是否触发熔断
+func (b *Breaker) Failure(now time.Time, err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests++
+	b.failures++
+	b.consecutive++
+	b.lastFailureAt = now
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	if b.consecutive >= FailureThreshold {
+		// 半开状态下试探失败会重新熔断
+		opened := !now.Before(b.openUntil)
+		b.openUntil = now.Add(CoolDown)
+		return opened
+	}
+	return false
+}
+
+// Status 获取熔断器状态
+func (b *Breaker) Status(now time.Time) Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{
+		Kind:                b.kind,
+		Name:                b.name,
+		State:               StateClosed,
+		ConsecutiveFailures: b.consecutive,
+		Requests:            b.requests,
+		Failures:            b.failures,
+		LastError:           b.lastError,
+	}
+	if !b.lastFailureAt.IsZero() {
+		t := b.lastFailureAt
+		s.LastFailureAt = &t
+	}
+	if !b.openUntil.IsZero() {
+		if now.Before(b.openUntil) {
+			s.State = StateOpen
+			t := b.openUntil
+			s.OpenUntil = &t
+		} else {
+			s.State = StateHalfOpen
+		}
+	}
+	return s
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*Breaker)
+)
+
+// BreakerFor 获取提供者的熔断器，同一提供者在所有会话间共享
+func BreakerFor(kind, name string) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	key := kind + ":" + name
+	b, ok := breakers[key]
+	if !ok {
+		b = &Breaker{kind: kind, name: name}
+		breakers[key] = b
+	}
+	return b
+}
+
+// Statuses 获取全部已使用过的提供者的熔断器状态，按类型与名称排序
+func Statuses() []Status {
+	breakersMu.Lock()
+	list := make([]*Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	now := time.Now()
+	result := make([]Status, 0, len(list))
+	for _, b := range list {
+		result = append(result, b.Status(now))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
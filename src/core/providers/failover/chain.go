@@ -0,0 +1,95 @@
+package failover
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// SwitchFunc 当前使用的提供者变化时回调，from 为切换前的提供者名称
+type SwitchFunc func(kind, from, to string, err error)
+
+// chain 一组按优先级排列的提供者，记录当前使用的提供者
+type chain struct {
+	kind     string
+	names    []string
+	breakers []*Breaker
+	logger   *utils.Logger
+	onSwitch SwitchFunc
+
+	mu     sync.Mutex
+	active int
+}
+
+func newChain(kind string, names []string, logger *utils.Logger, onSwitch SwitchFunc) *chain {
+	c := &chain{kind: kind, names: names, logger: logger, onSwitch: onSwitch}
+	for _, name := range names {
+		c.breakers = append(c.breakers, BreakerFor(kind, name))
+	}
+	return c
+}
+
+// candidates 返回本次请求依次尝试的提供者下标：跳过熔断中的提供者，全部熔断时仍按顺序全部尝试
+func (c *chain) candidates() []int {
+	now := time.Now()
+	result := make([]int, 0, len(c.names))
+	for i, b := range c.breakers {
+		if b.Allow(now) {
+			result = append(result, i)
+		}
+	}
+	if len(result) == 0 {
+		for i := range c.names {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Active 当前使用的提供者名称
+func (c *chain) Active() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.names[c.active]
+}
+
+func (c *chain) activeIndex() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// succeed 记录成功，并把当前提供者切换为 i
+func (c *chain) succeed(i int, lastErr error) {
+	c.breakers[i].Success()
+	c.setActive(i, lastErr)
+}
+
+// fail 记录失败
+func (c *chain) fail(i int, err error) {
+	if c.breakers[i].Failure(time.Now(), err) {
+		c.logger.Warn("[容灾] [%s] %s 连续失败 %d 次，熔断 %s", c.kind, c.names[i], FailureThreshold, CoolDown)
+	} else {
+		c.logger.Warn("[容灾] [%s] %s 请求失败: %v", c.kind, c.names[i], err)
+	}
+}
+
+func (c *chain) setActive(i int, err error) {
+	c.mu.Lock()
+	from := c.active
+	c.active = i
+	c.mu.Unlock()
+	if from == i {
+		return
+	}
+	c.logger.Info("[容灾] [%s] 当前提供者由 %s 切换到 %s", c.kind, c.names[from], c.names[i])
+	if c.onSwitch != nil {
+		c.onSwitch(c.kind, c.names[from], c.names[i], err)
+	}
+}
+
+// exhausted 全部提供者均失败时返回的错误
+func (c *chain) exhausted(err error) error {
+	return fmt.Errorf("%s 全部提供者均不可用，最后错误: %w", c.kind, err)
+}
@@ -0,0 +1,187 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+type fakeLLM struct {
+	responses []types.Response
+	err       error
+	calls     int
+}
+
+func (f *fakeLLM) Initialize() error              { return nil }
+func (f *fakeLLM) Cleanup() error                 { return nil }
+func (f *fakeLLM) GetSessionID() string           { return "" }
+func (f *fakeLLM) SetIdentityFlag(string, string) {}
+func (f *fakeLLM) Response(context.Context, string, []types.Message) (<-chan string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeLLM) ResponseWithFunctions(context.Context, string, []types.Message, []openai.Tool) (<-chan types.Response, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	ch := make(chan types.Response, len(f.responses))
+	for _, r := range f.responses {
+		ch <- r
+	}
+	close(ch)
+	return ch, nil
+}
+
+func collect(ch <-chan types.Response) string {
+	text := ""
+	for r := range ch {
+		text += r.Content + r.Error
+	}
+	return text
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b := BreakerFor(KindLLM, t.Name())
+	now := time.Now()
+	for i := 0; i < FailureThreshold-1; i++ {
+		assert.False(t, b.Failure(now, errors.New("boom")))
+	}
+	assert.True(t, b.Failure(now, errors.New("boom")), "The threshold-th failure opens the breaker")
+	assert.False(t, b.Allow(now))
+	assert.Equal(t, StateOpen, b.Status(now).State)
+
+	later := now.Add(CoolDown)
+	assert.True(t, b.Allow(later), "Requests are let through after the cool-down")
+	assert.Equal(t, StateHalfOpen, b.Status(later).State)
+	assert.True(t, b.Failure(later, errors.New("boom")), "A failed probe opens the breaker again")
+
+	b.Success()
+	assert.Equal(t, StateClosed, b.Status(later).State)
+	assert.Equal(t, "boom", b.Status(later).LastError)
+}
+
+func TestLLMFallsBackOnError(t *testing.T) {
+	primary := &fakeLLM{responses: []types.Response{{Error: "服务响应异常"}}}
+	backup := &fakeLLM{responses: []types.Response{{Content: "你好"}, {Content: "世界"}}}
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+
+	var switched []string
+	p := NewLLMProvider(names, []providers.LLMProvider{primary, backup}, newTestLogger(t),
+		func(kind, from, to string, err error) { switched = append(switched, kind+":"+from+">"+to) })
+
+	ch, err := p.ResponseWithFunctions(context.Background(), "s", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "你好世界", collect(ch))
+	assert.Equal(t, names[1], p.Active())
+	assert.Equal(t, []string{"LLM:" + names[0] + ">" + names[1]}, switched)
+}
+
+func TestLLMSkipsOpenBreaker(t *testing.T) {
+	primary := &fakeLLM{err: errors.New("down")}
+	backup := &fakeLLM{responses: []types.Response{{Content: "ok"}}}
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+	p := NewLLMProvider(names, []providers.LLMProvider{primary, backup}, newTestLogger(t), nil)
+
+	for i := 0; i < FailureThreshold+2; i++ {
+		ch, err := p.ResponseWithFunctions(context.Background(), "s", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", collect(ch))
+	}
+	assert.Equal(t, FailureThreshold, primary.calls, "The primary is skipped once its breaker opens")
+}
+
+func TestLLMAllFail(t *testing.T) {
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+	p := NewLLMProvider(names, []providers.LLMProvider{&fakeLLM{err: errors.New("a")}, &fakeLLM{}}, newTestLogger(t), nil)
+
+	ch, err := p.ResponseWithFunctions(context.Background(), "s", nil, nil)
+	require.NoError(t, err)
+	r, ok := <-ch
+	require.True(t, ok)
+	assert.Contains(t, r.Error, "全部提供者均不可用")
+}
+
+func TestLLMFirstResponseTimeout(t *testing.T) {
+	old := FirstResponseTimeout
+	FirstResponseTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { FirstResponseTimeout = old })
+
+	stuck := &stuckLLM{release: make(chan struct{})}
+	defer close(stuck.release)
+	backup := &fakeLLM{responses: []types.Response{{Content: "ok"}}}
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+	p := NewLLMProvider(names, []providers.LLMProvider{stuck, backup}, newTestLogger(t), nil)
+
+	ch, err := p.ResponseWithFunctions(context.Background(), "s", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", collect(ch))
+}
+
+type stuckLLM struct {
+	fakeLLM
+	release chan struct{}
+}
+
+func (s *stuckLLM) ResponseWithFunctions(context.Context, string, []types.Message, []openai.Tool) (<-chan types.Response, error) {
+	ch := make(chan types.Response)
+	go func() {
+		<-s.release
+		close(ch)
+	}()
+	return ch, nil
+}
+
+type fakeTTS struct {
+	file string
+	err  error
+}
+
+func (f *fakeTTS) Initialize() error                             { return nil }
+func (f *fakeTTS) Cleanup() error                                { return nil }
+func (f *fakeTTS) ToTTS(context.Context, string) (string, error) { return f.file, f.err }
+func (f *fakeTTS) SetVoice(v string) (error, string)             { return nil, v }
+
+func TestTTSFallsBackOnError(t *testing.T) {
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+	p := NewTTSProvider(names, []providers.TTSProvider{&fakeTTS{err: errors.New("down")}, &fakeTTS{file: "b.wav"}}, newTestLogger(t), nil)
+
+	file, err := p.ToTTS(context.Background(), "你好")
+	require.NoError(t, err)
+	assert.Equal(t, "b.wav", file)
+	assert.Equal(t, names[1], p.Active())
+}
+
+// blockingTTS 合成直到 ctx 取消
+type blockingTTS struct{ fakeTTS }
+
+func (f *blockingTTS) ToTTS(ctx context.Context, _ string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTTSCanceledIsNotFailure(t *testing.T) {
+	names := []string{t.Name() + "-a", t.Name() + "-b"}
+	p := NewTTSProvider(names, []providers.TTSProvider{&blockingTTS{}, &fakeTTS{file: "b.wav"}}, newTestLogger(t), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := p.ToTTS(ctx, "你好")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, names[0], p.Active(), "取消不应切换到备用提供者")
+}
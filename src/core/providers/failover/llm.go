@@ -0,0 +1,181 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FirstResponseTimeout 等待LLM首个输出的超时时间，超时视为失败并切换到下一个提供者
+var FirstResponseTimeout = 15 * time.Second
+
+// LLM提供者在流中返回错误时使用的文本标记
+const llmErrorMarker = "服务响应异常"
+
+// LLMProvider 带容灾的LLM提供者，首个提供者为主提供者，其余为备用提供者。
+// 只有在收到首个有效输出之前的失败会切换提供者，已开始输出的回复不会重试
+type LLMProvider struct {
+	*chain
+	members []providers.LLMProvider
+}
+
+// NewLLMProvider 创建带容灾的LLM提供者，names 与 members 一一对应
+func NewLLMProvider(names []string, members []providers.LLMProvider, logger *utils.Logger, onSwitch SwitchFunc) *LLMProvider {
+	return &LLMProvider{
+		chain:   newChain(KindLLM, names, logger, onSwitch),
+		members: members,
+	}
+}
+
+// Initialize 初始化提供者
+func (p *LLMProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理备用提供者，主提供者由调用方管理
+func (p *LLMProvider) Cleanup() error {
+	for _, m := range p.members[1:] {
+		m.Cleanup()
+	}
+	return nil
+}
+
+// Primary 获取主提供者
+func (p *LLMProvider) Primary() providers.LLMProvider {
+	return p.members[0]
+}
+
+// Config 获取主提供者的配置
+func (p *LLMProvider) Config() *llm.Config {
+	if getter, ok := p.members[0].(interface{ Config() *llm.Config }); ok {
+		return getter.Config()
+	}
+	return &llm.Config{Name: p.names[0]}
+}
+
+// GetSessionID 获取当前提供者的会话ID
+func (p *LLMProvider) GetSessionID() string {
+	return p.members[p.activeIndex()].GetSessionID()
+}
+
+// SetIdentityFlag 设置全部提供者的身份标识
+func (p *LLMProvider) SetIdentityFlag(idType string, flag string) {
+	for _, m := range p.members {
+		m.SetIdentityFlag(idType, flag)
+	}
+}
+
+// ResponseWithFunctions 依次尝试各提供者，返回首个正常输出的提供者的响应流
+func (p *LLMProvider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	var lastErr error
+	for _, i := range p.candidates() {
+		stream, err := p.members[i].ResponseWithFunctions(ctx, sessionID, messages, tools)
+		if err != nil {
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		first, err := awaitFirst(ctx, stream, func(r types.Response) error {
+			if r.Error != "" {
+				return errors.New(r.Error)
+			}
+			if strings.Contains(r.Content, llmErrorMarker) {
+				return errors.New(r.Content)
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		p.succeed(i, lastErr)
+		return forward(first, stream), nil
+	}
+
+	out := make(chan types.Response, 1)
+	out <- types.Response{Error: p.exhausted(lastErr).Error()}
+	close(out)
+	return out, nil
+}
+
+// Response 依次尝试各提供者，返回首个正常输出的提供者的文本流
+func (p *LLMProvider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	var lastErr error
+	for _, i := range p.candidates() {
+		stream, err := p.members[i].Response(ctx, sessionID, messages)
+		if err != nil {
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		first, err := awaitFirst(ctx, stream, func(s string) error {
+			if strings.Contains(s, llmErrorMarker) {
+				return errors.New(s)
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		p.succeed(i, lastErr)
+		return forward(first, stream), nil
+	}
+	return nil, p.exhausted(lastErr)
+}
+
+// awaitFirst 等待响应流的首个输出并检查是否为错误；失败时在后台读完被放弃的流，避免提供者阻塞
+func awaitFirst[T any](ctx context.Context, stream <-chan T, check func(T) error) (T, error) {
+	var zero T
+	timer := time.NewTimer(FirstResponseTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case first, ok := <-stream:
+		if !ok {
+			return zero, errors.New("响应流为空")
+		}
+		if err = check(first); err == nil {
+			return first, nil
+		}
+	case <-timer.C:
+		err = fmt.Errorf("%s 内未收到响应", FirstResponseTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	go func() {
+		for range stream {
+		}
+	}()
+	return zero, err
+}
+
+// forward 把已读取的首个输出和剩余的流合并为新的流
+func forward[T any](first T, stream <-chan T) <-chan T {
+	out := make(chan T, 1)
+	out <- first
+	go func() {
+		defer close(out)
+		for item := range stream {
+			out <- item
+		}
+	}()
+	return out
+}
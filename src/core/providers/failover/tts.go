@@ -0,0 +1,102 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// TTSTimeout 单次合成的超时时间，超时视为失败并切换到下一个提供者
+var TTSTimeout = 20 * time.Second
+
+// TTSProvider 带容灾的TTS提供者，首个提供者为主提供者，其余为备用提供者
+type TTSProvider struct {
+	*chain
+	members []providers.TTSProvider
+}
+
+// NewTTSProvider 创建带容灾的TTS提供者，names 与 members 一一对应
+func NewTTSProvider(names []string, members []providers.TTSProvider, logger *utils.Logger, onSwitch SwitchFunc) *TTSProvider {
+	return &TTSProvider{
+		chain:   newChain(KindTTS, names, logger, onSwitch),
+		members: members,
+	}
+}
+
+// Initialize 初始化提供者
+func (p *TTSProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理备用提供者，主提供者由调用方管理
+func (p *TTSProvider) Cleanup() error {
+	for _, m := range p.members[1:] {
+		m.Cleanup()
+	}
+	return nil
+}
+
+// Primary 获取主提供者
+func (p *TTSProvider) Primary() providers.TTSProvider {
+	return p.members[0]
+}
+
+// Config 获取主提供者的配置
+func (p *TTSProvider) Config() *tts.Config {
+	if getter, ok := p.members[0].(interface{ Config() *tts.Config }); ok {
+		return getter.Config()
+	}
+	return &tts.Config{Name: p.names[0]}
+}
+
+// SetVoice 设置主提供者的音色，音色名称与提供者相关，备用提供者保持各自配置的音色
+func (p *TTSProvider) SetVoice(voice string) (error, string) {
+	return p.members[0].SetVoice(voice)
+}
+
+// ToTTS 依次尝试各提供者合成音频
+func (p *TTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	var lastErr error
+	for _, i := range p.candidates() {
+		file, err := toTTSWithTimeout(ctx, p.members[i], text)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err() // 调用方取消，不计为提供者失败
+			}
+			p.fail(i, err)
+			lastErr = err
+			continue
+		}
+		p.succeed(i, lastErr)
+		return file, nil
+	}
+	return "", p.exhausted(lastErr)
+}
+
+type ttsResult struct {
+	file string
+	err  error
+}
+
+func toTTSWithTimeout(ctx context.Context, provider providers.TTSProvider, text string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, TTSTimeout)
+	defer cancel()
+	done := make(chan ttsResult, 1)
+	go func() {
+		file, err := provider.ToTTS(ctx, text)
+		done <- ttsResult{file: file, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.file, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%s 内未完成合成", TTSTimeout)
+		}
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,426 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBaseURL = "https://api.anthropic.com"
+	apiVersion     = "2023-06-01"
+)
+
+// effortBudgets reasoning_effort 对应的思考Token预算
+var effortBudgets = map[string]int{
+	"low":    1024,
+	"medium": 4096,
+	"high":   16384,
+}
+
+// Provider Anthropic Messages API 提供者
+type Provider struct {
+	*llm.BaseProvider
+	client         *http.Client
+	endpoint       string
+	maxTokens      int
+	thinkingBudget int // 深度思考的Token预算，0表示不开启
+}
+
+// 注册提供者
+func init() {
+	llm.Register("anthropic", NewProvider)
+}
+
+// NewProvider 创建Anthropic提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	base := llm.NewBaseProvider(config)
+	provider := &Provider{
+		BaseProvider: base,
+		maxTokens:    config.MaxTokens,
+	}
+	if provider.maxTokens <= 0 {
+		provider.maxTokens = 1024
+	}
+
+	// 从Extra字段读取深度思考的Token预算
+	if config.Extra != nil {
+		switch v := config.Extra["thinking_budget"].(type) {
+		case int:
+			provider.thinkingBudget = v
+		case float64:
+			provider.thinkingBudget = int(v)
+		}
+	}
+	// 未指定预算时按 reasoning_effort 开启思考
+	if provider.thinkingBudget == 0 {
+		provider.thinkingBudget = effortBudgets[config.ReasoningEffort]
+	}
+	// 开启思考时 max_tokens 必须大于思考预算
+	if provider.thinkingBudget > 0 && provider.maxTokens <= provider.thinkingBudget {
+		provider.maxTokens = provider.thinkingBudget + 1024
+	}
+
+	return provider, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Anthropic API key")
+	}
+
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if strings.HasSuffix(baseURL, "/v1") {
+		p.endpoint = baseURL + "/messages"
+	} else {
+		p.endpoint = baseURL + "/v1/messages"
+	}
+	p.client = &http.Client{}
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *Provider) Cleanup() error {
+	return nil
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+
+	go func() {
+		defer close(responseChan)
+		p.stream(ctx, messages, nil, func(resp types.Response) {
+			if resp.Content != "" {
+				responseChan <- resp.Content
+			}
+		})
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+		p.stream(ctx, messages, tools, func(resp types.Response) {
+			responseChan <- resp
+		})
+	}()
+
+	return responseChan, nil
+}
+
+// messageRequest Messages API 请求体
+type messageRequest struct {
+	Model         string          `json:"model"`
+	MaxTokens     int             `json:"max_tokens"`
+	System        string          `json:"system,omitempty"`
+	Messages      []message       `json:"messages"`
+	Tools         []tool          `json:"tools,omitempty"`
+	Stream        bool            `json:"stream"`
+	Temperature   float64         `json:"temperature,omitempty"`
+	TopP          float64         `json:"top_p,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Thinking      *thinkingConfig `json:"thinking,omitempty"`
+}
+
+type thinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+// contentBlock 消息内容块：text/tool_use/tool_result
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+// streamEvent SSE事件，只解析用到的字段
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		Usage apiUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	ContentBlock *struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block,omitempty"`
+	Delta *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *apiUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type apiUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// buildRequest 把对话历史转换为 Messages API 请求：
+// system 消息合并为 system 字段，assistant 的工具调用转换为 tool_use 块，tool 消息转换为 user 的 tool_result 块，
+// 相邻的同角色消息合并为一条
+func (p *Provider) buildRequest(messages []types.Message, tools []openai.Tool) *messageRequest {
+	config := p.Config()
+	req := &messageRequest{
+		Model:     config.ModelName,
+		MaxTokens: p.maxTokens,
+		Stream:    true,
+	}
+	if p.thinkingEnabled(messages, tools) {
+		// 开启思考时不支持自定义 temperature/top_p
+		req.Thinking = &thinkingConfig{Type: "enabled", BudgetTokens: p.thinkingBudget}
+	} else {
+		req.Temperature = config.Temperature
+		req.TopP = config.TopP
+	}
+	req.StopSequences = config.Stop
+
+	var system []string
+	for _, msg := range messages {
+		var role string
+		var blocks []contentBlock
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, contentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		case "assistant":
+			role = "assistant"
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, contentBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+		default:
+			role = "user"
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+		} else {
+			req.Messages = append(req.Messages, message{Role: role, Content: blocks})
+		}
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	for _, t := range tools {
+		if t.Function == nil {
+			continue
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		req.Tools = append(req.Tools, tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return req
+}
+
+// thinkingEnabled 判断本次请求是否开启思考。
+// 开启思考时 Anthropic 要求工具调用轮次的 assistant 消息保留带签名的 thinking 块，
+// 对话历史不保存思考内容，因此携带工具或回传工具结果时不开启思考
+func (p *Provider) thinkingEnabled(messages []types.Message, tools []openai.Tool) bool {
+	if p.thinkingBudget <= 0 || len(tools) > 0 {
+		return false
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == "tool" {
+		return false
+	}
+	return true
+}
+
+// extraBody 返回合并到请求体的额外字段，开启思考时去掉不支持的 temperature/top_p
+func (p *Provider) extraBody(thinking bool) map[string]interface{} {
+	body := p.Config().ExtraBody()
+	if thinking && body != nil {
+		delete(body, "temperature")
+		delete(body, "top_p")
+	}
+	return body
+}
+
+// stream 发起流式请求，文本、思考内容、工具调用和用量逐条回调
+func (p *Provider) stream(ctx context.Context, messages []types.Message, tools []openai.Tool, emit func(types.Response)) {
+	fail := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		emit(types.Response{Content: msg, Error: msg})
+	}
+
+	jsonData, err := json.Marshal(p.buildRequest(messages, tools))
+	if err == nil {
+		jsonData, err = llm.MergeBody(jsonData, p.extraBody(p.thinkingEnabled(messages, tools))) // 如 top_k
+	}
+	if err != nil {
+		fail("【请求序列化失败: %v】", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		fail("【创建请求失败: %v】", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.Config().APIKey)
+	req.Header.Set("anthropic-version", apiVersion)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		fail("【Anthropic服务响应异常: %v】", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fail("【Anthropic服务响应异常 %d: %s】", resp.StatusCode, string(body))
+		return
+	}
+
+	var usage types.Usage
+	var stopReason string
+	toolIndex := -1 // 工具调用在本次回复中的序号
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				fail("【Anthropic服务响应异常: %v】", err)
+			}
+			return
+		}
+
+		// SSE格式: "event: xxx" 与 "data: {...}"，事件类型以 data 中的 type 为准
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		var event streamEvent
+		if err := json.Unmarshal(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:"))), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage.PromptTokens = event.Message.Usage.InputTokens
+				usage.CompletionTokens = event.Message.Usage.OutputTokens
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				toolIndex++
+				emit(types.Response{ToolCalls: []types.ToolCall{{
+					ID:       event.ContentBlock.ID,
+					Type:     string(openai.ToolTypeFunction),
+					Function: types.FunctionCall{Name: event.ContentBlock.Name},
+					Index:    toolIndex,
+				}}})
+			}
+		case "content_block_delta":
+			if event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				if event.Delta.Text != "" {
+					emit(types.Response{Content: event.Delta.Text})
+				}
+			case "thinking_delta":
+				if event.Delta.Thinking != "" {
+					emit(types.Response{ReasonContent: event.Delta.Thinking})
+				}
+			case "input_json_delta":
+				if event.Delta.PartialJSON != "" {
+					emit(types.Response{ToolCalls: []types.ToolCall{{
+						Type:     string(openai.ToolTypeFunction),
+						Function: types.FunctionCall{Arguments: event.Delta.PartialJSON},
+						Index:    toolIndex,
+					}}})
+				}
+			}
+		case "message_delta":
+			if event.Delta != nil && event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				usage.CompletionTokens = event.Usage.OutputTokens
+				if event.Usage.InputTokens > 0 {
+					usage.PromptTokens = event.Usage.InputTokens
+				}
+			}
+		case "message_stop":
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			emit(types.Response{StopReason: stopReason, Usage: &usage})
+			return
+		case "error":
+			if event.Error != nil {
+				fail("【Anthropic服务响应异常: %s: %s】", event.Error.Type, event.Error.Message)
+			} else {
+				fail("【Anthropic服务响应异常】")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayServer 回放 testdata 中录制的SSE，并记录收到的请求体
+func replayServer(t *testing.T, name string, status int, captured *messageRequest) *httptest.Server {
+	t.Helper()
+	var body []byte
+	if status == http.StatusOK {
+		var err error
+		body, err = os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+	} else {
+		body = []byte(name)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, apiVersion, r.Header.Get("anthropic-version"))
+		if captured != nil {
+			data, _ := io.ReadAll(r.Body)
+			require.NoError(t, json.Unmarshal(data, captured))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestProvider(t *testing.T, baseURL string, extra map[string]interface{}) llm.Provider {
+	t.Helper()
+	p, err := llm.Create("anthropic", &llm.Config{
+		Name:      "ClaudeLLM",
+		Type:      "anthropic",
+		ModelName: "claude-sonnet-4-5",
+		BaseURL:   baseURL,
+		APIKey:    "test-key",
+		MaxTokens: 512,
+		Extra:     extra,
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func collect(t *testing.T, ch <-chan types.Response) []types.Response {
+	t.Helper()
+	var out []types.Response
+	for r := range ch {
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestStreamTextAndThinking(t *testing.T) {
+	var req messageRequest
+	srv := replayServer(t, "text_thinking.sse", http.StatusOK, &req)
+	p := newTestProvider(t, srv.URL, map[string]interface{}{"thinking_budget": 2048})
+
+	ch, err := p.ResponseWithFunctions(context.Background(), "s1", []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "你好"},
+	}, nil)
+	require.NoError(t, err)
+	responses := collect(t, ch)
+
+	var content, reason string
+	for _, r := range responses {
+		assert.Empty(t, r.Error)
+		content += r.Content
+		reason += r.ReasonContent
+	}
+	assert.Equal(t, "你好！有什么可以帮你的吗？", content)
+	assert.Equal(t, "用户在问候，简短回应即可。", reason)
+
+	last := responses[len(responses)-1]
+	require.NotNil(t, last.Usage)
+	assert.Equal(t, types.Usage{PromptTokens: 42, CompletionTokens: 18, TotalTokens: 60}, *last.Usage)
+	assert.Equal(t, "end_turn", last.StopReason)
+
+	assert.Equal(t, "你是小智", req.System)
+	require.NotNil(t, req.Thinking)
+	assert.Equal(t, 2048, req.Thinking.BudgetTokens)
+	assert.Greater(t, req.MaxTokens, 2048)
+	require.Len(t, req.Messages, 1)
+	assert.Equal(t, "user", req.Messages[0].Role)
+}
+
+func TestStreamToolUse(t *testing.T) {
+	srv := replayServer(t, "tool_use.sse", http.StatusOK, nil)
+	p := newTestProvider(t, srv.URL+"/v1", nil)
+
+	tools := []openai.Tool{{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "get_weather",
+			Description: "查询天气",
+			Parameters:  map[string]interface{}{"type": "object"},
+		},
+	}}
+	ch, err := p.ResponseWithFunctions(context.Background(), "s1", []types.Message{
+		{Role: "user", Content: "北京天气怎么样"},
+	}, tools)
+	require.NoError(t, err)
+
+	var content, id, name, args string
+	for _, r := range collect(t, ch) {
+		content += r.Content
+		for _, tc := range r.ToolCalls {
+			assert.Equal(t, 0, tc.Index)
+			if tc.ID != "" {
+				id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				name = tc.Function.Name
+			}
+			args += tc.Function.Arguments
+		}
+	}
+	assert.Equal(t, "好的，我查一下。", content)
+	assert.Equal(t, "toolu_01T1x1fJ34qAmk2tNTrN7Up6", id)
+	assert.Equal(t, "get_weather", name)
+	assert.JSONEq(t, `{"location":"北京"}`, args)
+}
+
+func TestToolHistoryMapping(t *testing.T) {
+	var req messageRequest
+	srv := replayServer(t, "text_thinking.sse", http.StatusOK, &req)
+	p := newTestProvider(t, srv.URL, nil)
+
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get_weather"}}}
+	ch, err := p.ResponseWithFunctions(context.Background(), "s1", []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京和上海天气怎么样"},
+		{Role: "assistant", Content: "", ToolCalls: []types.ToolCall{
+			{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"location":"北京"}`}},
+			{ID: "call_2", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: ""}},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: "晴"},
+		{Role: "tool", ToolCallID: "call_2", Content: "小雨"},
+	}, tools)
+	require.NoError(t, err)
+	collect(t, ch)
+
+	assert.Equal(t, "你是小智", req.System)
+	require.Len(t, req.Messages, 3)
+
+	assistant := req.Messages[1]
+	assert.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.Content, 2)
+	assert.Equal(t, "tool_use", assistant.Content[0].Type)
+	assert.Equal(t, "call_1", assistant.Content[0].ID)
+	assert.JSONEq(t, `{"location":"北京"}`, string(assistant.Content[0].Input))
+	assert.JSONEq(t, `{}`, string(assistant.Content[1].Input)) // 参数为空时补全为空对象
+
+	results := req.Messages[2]
+	assert.Equal(t, "user", results.Role)
+	require.Len(t, results.Content, 2) // 相邻的工具结果合并为一条 user 消息
+	assert.Equal(t, "tool_result", results.Content[0].Type)
+	assert.Equal(t, "call_1", results.Content[0].ToolUseID)
+	assert.Equal(t, "小雨", results.Content[1].Content)
+
+	require.Len(t, req.Tools, 1)
+	assert.Equal(t, "get_weather", req.Tools[0].Name)
+	assert.NotNil(t, req.Tools[0].InputSchema)
+}
+
+func TestThinkingDisabledForToolRoundTrip(t *testing.T) {
+	p := func(url string) llm.Provider {
+		return newTestProvider(t, url, map[string]interface{}{"thinking_budget": 2048})
+	}
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get_weather"}}}
+	history := []types.Message{{Role: "user", Content: "北京天气怎么样"}}
+
+	// 第一次请求携带工具，不开启思考
+	var first messageRequest
+	srv := replayServer(t, "tool_use.sse", http.StatusOK, &first)
+	ch, err := p(srv.URL).ResponseWithFunctions(context.Background(), "s1", history, tools)
+	require.NoError(t, err)
+	var id, args string
+	for _, r := range collect(t, ch) {
+		assert.Empty(t, r.Error)
+		for _, tc := range r.ToolCalls {
+			if tc.ID != "" {
+				id = tc.ID
+			}
+			args += tc.Function.Arguments
+		}
+	}
+	assert.Nil(t, first.Thinking)
+	require.NotEmpty(t, id)
+
+	// 回传工具结果，assistant 消息没有 thinking 块，同样不能开启思考
+	history = append(history,
+		types.Message{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: id, Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: args}},
+		}},
+		types.Message{Role: "tool", ToolCallID: id, Content: "晴"},
+	)
+	for _, withTools := range [][]openai.Tool{tools, nil} {
+		var follow messageRequest
+		srv = replayServer(t, "text_thinking.sse", http.StatusOK, &follow)
+		ch, err = p(srv.URL).ResponseWithFunctions(context.Background(), "s1", history, withTools)
+		require.NoError(t, err)
+		for _, r := range collect(t, ch) {
+			assert.Empty(t, r.Error)
+		}
+		assert.Nil(t, follow.Thinking)
+		require.Len(t, follow.Messages, 3)
+		assert.Equal(t, "tool_use", follow.Messages[1].Content[0].Type)
+		assert.Equal(t, "tool_result", follow.Messages[2].Content[0].Type)
+	}
+
+	// 工具轮次结束后的普通对话恢复思考
+	var next messageRequest
+	srv = replayServer(t, "text_thinking.sse", http.StatusOK, &next)
+	history = append(history,
+		types.Message{Role: "assistant", Content: "北京今天晴。"},
+		types.Message{Role: "user", Content: "谢谢"},
+	)
+	ch, err = p(srv.URL).ResponseWithFunctions(context.Background(), "s1", history, nil)
+	require.NoError(t, err)
+	collect(t, ch)
+	require.NotNil(t, next.Thinking)
+	assert.Equal(t, 2048, next.Thinking.BudgetTokens)
+}
+
+func TestStreamErrors(t *testing.T) {
+	srv := replayServer(t, "overloaded.sse", http.StatusOK, nil)
+	p := newTestProvider(t, srv.URL, nil)
+	ch, err := p.ResponseWithFunctions(context.Background(), "s1", []types.Message{{Role: "user", Content: "hi"}}, nil)
+	require.NoError(t, err)
+	responses := collect(t, ch)
+	require.Len(t, responses, 1)
+	assert.Contains(t, responses[0].Error, "overloaded_error")
+	assert.Contains(t, responses[0].Content, "服务响应异常") // 容灾按该标记识别失败
+
+	srv = replayServer(t, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, http.StatusUnauthorized, nil)
+	p = newTestProvider(t, srv.URL, nil)
+	text, err := p.Response(context.Background(), "s1", []types.Message{{Role: "user", Content: "hi"}})
+	require.NoError(t, err)
+	var all []string
+	for s := range text {
+		all = append(all, s)
+	}
+	require.Len(t, all, 1)
+	assert.True(t, strings.Contains(all[0], "401") && strings.Contains(all[0], "authentication_error"))
+}
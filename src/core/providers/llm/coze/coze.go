@@ -105,57 +105,74 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 
 	go func() {
 		defer close(responseChan)
+		p.chat(ctx, sessionID, messages, func(resp types.Response) {
+			if resp.Usage == nil {
+				responseChan <- resp.Content
+			}
+		})
+	}()
 
-		var lastMsg string
-		if len(messages) > 0 {
-			lastMsg = messages[len(messages)-1].Content
-		}
+	return responseChan, nil
+}
 
-		conversationId, ok := p.sessionConversationMap.Load(sessionID)
-		if !ok {
-			conversation, err := p.client.Conversations.Create(ctx, &coze.CreateConversationsReq{
-				Messages: []*coze.Message{},
-			})
-			if err != nil {
-				responseChan <- fmt.Sprintf("【Coze服务创建会话失败: %v】", err)
-				return
-			}
-			conversationId = conversation.ID
-			p.sessionConversationMap.Store(sessionID, conversationId)
-		}
+// chat 发起一次Coze流式对话，逐条回调增量内容，对话完成时回调Token用量
+func (p *Provider) chat(ctx context.Context, sessionID string, messages []types.Message, emit func(types.Response)) {
+	var lastMsg string
+	if len(messages) > 0 {
+		lastMsg = messages[len(messages)-1].Content
+	}
 
-		stream, err := p.client.Chat.Stream(ctx, &coze.CreateChatsReq{
-			BotID:  p.botID,
-			UserID: p.userID,
-			Messages: []*coze.Message{
-				coze.BuildUserQuestionObjects([]*coze.MessageObjectString{
-					coze.NewTextMessageObject(lastMsg),
-				}, nil),
-			},
-			ConversationID: conversationId.(string),
+	conversationId, ok := p.sessionConversationMap.Load(sessionID)
+	if !ok {
+		conversation, err := p.client.Conversations.Create(ctx, &coze.CreateConversationsReq{
+			Messages: []*coze.Message{},
 		})
 		if err != nil {
-			responseChan <- fmt.Sprintf("【Coze服务响应异常: %v】", err)
+			emit(types.Response{Content: fmt.Sprintf("【Coze服务创建会话失败: %v】", err)})
 			return
 		}
-		defer stream.Close()
+		conversationId = conversation.ID
+		p.sessionConversationMap.Store(sessionID, conversationId)
+	}
 
-		for {
-			event, err := stream.Recv()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					fmt.Println("Coze Stream finished")
-				}
-				break
-			}
+	stream, err := p.client.Chat.Stream(ctx, &coze.CreateChatsReq{
+		BotID:  p.botID,
+		UserID: p.userID,
+		Messages: []*coze.Message{
+			coze.BuildUserQuestionObjects([]*coze.MessageObjectString{
+				coze.NewTextMessageObject(lastMsg),
+			}, nil),
+		},
+		ConversationID: conversationId.(string),
+	})
+	if err != nil {
+		emit(types.Response{Content: fmt.Sprintf("【Coze服务响应异常: %v】", err)})
+		return
+	}
+	defer stream.Close()
 
-			if event.Event == coze.ChatEventConversationMessageDelta {
-				responseChan <- event.Message.Content
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fmt.Println("Coze Stream finished")
 			}
+			break
 		}
-	}()
 
-	return responseChan, nil
+		switch event.Event {
+		case coze.ChatEventConversationMessageDelta:
+			emit(types.Response{Content: event.Message.Content})
+		case coze.ChatEventConversationChatCompleted:
+			if event.Chat != nil && event.Chat.Usage != nil {
+				emit(types.Response{Usage: &types.Usage{
+					PromptTokens:     event.Chat.Usage.InputCount,
+					CompletionTokens: event.Chat.Usage.OutputCount,
+					TotalTokens:      event.Chat.Usage.TokenCount,
+				}})
+			}
+		}
+	}
 }
 
 // ResponseWithFunctions types.LLMProvider接口实现
@@ -194,22 +211,10 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 			}
 		}
 
-		// 调用普通 Response 接口获取结果流
-		respChan, err := p.Response(ctx, sessionID, messages)
-		if err != nil {
-			responseChan <- types.Response{
-				Content: fmt.Sprintf("【调用Response失败: %v】", err),
-				Error:   err.Error(),
-			}
-			return
-		}
-
-		// 透传结果
-		for token := range respChan {
-			responseChan <- types.Response{
-				Content: token,
-			}
-		}
+		// 透传对话结果与用量
+		p.chat(ctx, sessionID, messages, func(resp types.Response) {
+			responseChan <- resp
+		})
 	}()
 
 	return responseChan, nil
@@ -0,0 +1,273 @@
+package dify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider Dify 对话型应用提供者，会话历史由 Dify 维护，每次只发送最后一条用户消息
+type Provider struct {
+	*llm.BaseProvider
+	client   *http.Client
+	endpoint string
+
+	mu             sync.Mutex
+	user           string                 // Dify 用户标识，未设置时使用 sessionID
+	conversationID string                 // 当前的 Dify 会话ID
+	inputs         map[string]interface{} // 应用变量，配置文件中的 inputs 与智能体变量合并
+	baseInputs     map[string]interface{}
+}
+
+// chatRequest chat-messages 请求体
+type chatRequest struct {
+	Inputs         map[string]interface{} `json:"inputs"`
+	Query          string                 `json:"query"`
+	ResponseMode   string                 `json:"response_mode"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	User           string                 `json:"user"`
+}
+
+// streamEvent SSE事件，只解析用到的字段
+type streamEvent struct {
+	Event          string `json:"event"`
+	Answer         string `json:"answer"`
+	ConversationID string `json:"conversation_id"`
+	Metadata       *struct {
+		Usage *openai.Usage `json:"usage"`
+	} `json:"metadata,omitempty"`
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errConversationNotFound Dify 侧的会话已被删除或过期
+var errConversationNotFound = fmt.Errorf("conversation not exists")
+
+// 注册提供者
+func init() {
+	llm.Register("dify", NewProvider)
+}
+
+// NewProvider 创建Dify提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	provider := &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		baseInputs:   make(map[string]interface{}),
+	}
+	// 从Extra字段读取应用变量的默认值
+	if config.Extra != nil {
+		if inputs, ok := config.Extra["inputs"].(map[string]interface{}); ok {
+			for k, v := range inputs {
+				provider.baseInputs[k] = v
+			}
+		}
+	}
+	provider.inputs = provider.baseInputs
+	return provider, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Dify API key")
+	}
+	if config.BaseURL == "" {
+		return fmt.Errorf("missing Dify API url")
+	}
+	p.endpoint = strings.TrimRight(config.BaseURL, "/") + "/chat-messages"
+	p.client = &http.Client{}
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *Provider) Cleanup() error {
+	return nil
+}
+
+// SetIdentityFlag 设置 Dify 用户标识、会话ID和应用变量
+func (p *Provider) SetIdentityFlag(idType string, flag string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch idType {
+	case llm.IdentityUser:
+		p.user = flag
+	case llm.IdentityConversation:
+		p.conversationID = flag
+	case llm.IdentityInputs:
+		inputs := make(map[string]interface{}, len(p.baseInputs))
+		for k, v := range p.baseInputs {
+			inputs[k] = v
+		}
+		var extra map[string]interface{}
+		if flag != "" && json.Unmarshal([]byte(flag), &extra) == nil {
+			for k, v := range extra {
+				inputs[k] = v
+			}
+		}
+		p.inputs = inputs
+	}
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responseChan := make(chan string, 10)
+
+	go func() {
+		defer close(responseChan)
+		p.chat(ctx, sessionID, messages, func(resp types.Response) {
+			if resp.Content != "" {
+				responseChan <- resp.Content
+			}
+		})
+	}()
+
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现，工具由 Dify 应用自行编排，tools 被忽略
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+		p.chat(ctx, sessionID, messages, func(resp types.Response) {
+			responseChan <- resp
+		})
+	}()
+
+	return responseChan, nil
+}
+
+// chat 发送最后一条用户消息；Dify 会话不存在时清空会话ID重试一次，会话ID变化时回调 UpdateConversationID
+func (p *Provider) chat(ctx context.Context, sessionID string, messages []types.Message, emit func(types.Response)) {
+	var query string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			query = messages[i].Content
+			break
+		}
+	}
+
+	p.mu.Lock()
+	req := chatRequest{
+		Inputs:         p.inputs,
+		Query:          query,
+		ResponseMode:   "streaming",
+		ConversationID: p.conversationID,
+		User:           p.user,
+	}
+	p.mu.Unlock()
+	if req.User == "" {
+		req.User = sessionID
+	}
+	if req.Inputs == nil {
+		req.Inputs = map[string]interface{}{}
+	}
+
+	err := p.stream(ctx, req, emit)
+	if err == errConversationNotFound && req.ConversationID != "" {
+		p.setConversation(req.ConversationID, "", emit)
+		req.ConversationID = ""
+		err = p.stream(ctx, req, emit)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("【Dify服务响应异常: %v】", err)
+		emit(types.Response{Content: msg, Error: msg})
+	}
+}
+
+// setConversation 会话ID变化时保存并回调
+func (p *Provider) setConversation(old, id string, emit func(types.Response)) {
+	if id == old {
+		return
+	}
+	p.mu.Lock()
+	p.conversationID = id
+	p.mu.Unlock()
+	if id != "" {
+		emit(types.Response{UpdateConversationID: id})
+	}
+}
+
+// stream 发起一次流式请求，message 事件的回答逐段回调
+func (p *Provider) stream(ctx context.Context, body chatRequest, emit func(types.Response)) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("请求序列化失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.Config().APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		var apiErr streamEvent
+		if resp.StatusCode == http.StatusNotFound && json.Unmarshal(data, &apiErr) == nil &&
+			strings.Contains(strings.ToLower(apiErr.Message), "conversation") {
+			return errConversationNotFound
+		}
+		return fmt.Errorf("%d: %s", resp.StatusCode, string(data))
+	}
+
+	conversationID := body.ConversationID
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			return nil
+		}
+
+		// SSE格式: "data: {...}"
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		var event streamEvent
+		if err := json.Unmarshal(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:"))), &event); err != nil {
+			continue
+		}
+
+		if event.ConversationID != "" && event.ConversationID != conversationID {
+			p.setConversation(conversationID, event.ConversationID, emit)
+			conversationID = event.ConversationID
+		}
+
+		switch event.Event {
+		case "message", "agent_message":
+			if event.Answer != "" {
+				emit(types.Response{Content: event.Answer})
+			}
+		case "message_end":
+			if event.Metadata != nil && event.Metadata.Usage != nil {
+				emit(types.Response{Usage: types.NewUsage(event.Metadata.Usage)})
+			}
+			return nil
+		case "error":
+			return fmt.Errorf("%s: %s", event.Code, event.Message)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chatStream = `data: {"event": "workflow_started", "conversation_id": "conv-1", "message_id": "m1"}
+
+data: {"event": "message", "conversation_id": "conv-1", "message_id": "m1", "answer": "你好，"}
+
+event: ping
+
+data: {"event": "message", "conversation_id": "conv-1", "message_id": "m1", "answer": "我是小智。"}
+
+data: {"event": "message_end", "conversation_id": "conv-1", "message_id": "m1", "metadata": {"usage": {"prompt_tokens": 30, "completion_tokens": 8, "total_tokens": 38, "currency": "USD"}}}
+
+`
+
+// fakeDify 模拟 Dify chat-messages 接口，记录收到的请求
+type fakeDify struct {
+	mu       sync.Mutex
+	requests []chatRequest
+	missing  map[string]bool // 已不存在的会话ID
+}
+
+func (f *fakeDify) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat-messages", r.URL.Path)
+		assert.Equal(t, "Bearer app-test", r.Header.Get("Authorization"))
+		var req chatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+		if f.missing[req.ConversationID] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code": "not_found", "message": "Conversation Not Exists.", "status": 404}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, chatStream)
+	}
+}
+
+func newTestProvider(t *testing.T, f *fakeDify, extra map[string]interface{}) llm.Provider {
+	t.Helper()
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	p, err := llm.Create("dify", &llm.Config{Name: "DifyLLM", Type: "dify", BaseURL: srv.URL + "/v1/", APIKey: "app-test", Extra: extra})
+	require.NoError(t, err)
+	return p
+}
+
+func collect(t *testing.T, p llm.Provider, sessionID string, messages []types.Message) (string, []string, *types.Usage) {
+	t.Helper()
+	ch, err := p.ResponseWithFunctions(context.Background(), sessionID, messages, nil)
+	require.NoError(t, err)
+	var content strings.Builder
+	var updates []string
+	var usage *types.Usage
+	for r := range ch {
+		require.Empty(t, r.Error)
+		content.WriteString(r.Content)
+		if r.UpdateConversationID != "" {
+			updates = append(updates, r.UpdateConversationID)
+		}
+		if r.Usage != nil {
+			usage = r.Usage
+		}
+	}
+	return content.String(), updates, usage
+}
+
+func TestChatStreamsAnswerAndConversation(t *testing.T) {
+	f := &fakeDify{}
+	p := newTestProvider(t, f, map[string]interface{}{"inputs": map[string]interface{}{"persona": "默认", "city": "北京"}})
+	p.SetIdentityFlag(llm.IdentityUser, "aa:bb:cc")
+	p.SetIdentityFlag(llm.IdentityInputs, `{"city": "上海"}`)
+
+	messages := []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "你是谁"},
+	}
+	content, updates, usage := collect(t, p, "s1", messages)
+	assert.Equal(t, "你好，我是小智。", content)
+	assert.Equal(t, []string{"conv-1"}, updates)
+	require.NotNil(t, usage)
+	assert.Equal(t, types.Usage{PromptTokens: 30, CompletionTokens: 8, TotalTokens: 38}, *usage)
+
+	require.Len(t, f.requests, 1)
+	req := f.requests[0]
+	assert.Equal(t, "你是谁", req.Query)
+	assert.Equal(t, "streaming", req.ResponseMode)
+	assert.Equal(t, "aa:bb:cc", req.User)
+	assert.Empty(t, req.ConversationID)
+	assert.Equal(t, map[string]interface{}{"persona": "默认", "city": "上海"}, req.Inputs)
+
+	// 第二轮沿用平台返回的会话ID，且不再回调更新
+	_, updates, _ = collect(t, p, "s1", append(messages, types.Message{Role: "assistant", Content: "你好"}, types.Message{Role: "user", Content: "再见"}))
+	assert.Empty(t, updates)
+	require.Len(t, f.requests, 2)
+	assert.Equal(t, "conv-1", f.requests[1].ConversationID)
+	assert.Equal(t, "再见", f.requests[1].Query)
+}
+
+func TestChatRestartsMissingConversation(t *testing.T) {
+	f := &fakeDify{missing: map[string]bool{"conv-old": true}}
+	p := newTestProvider(t, f, nil)
+	p.SetIdentityFlag(llm.IdentityConversation, "conv-old")
+
+	content, updates, _ := collect(t, p, "s2", []types.Message{{Role: "user", Content: "在吗"}})
+	assert.Equal(t, "你好，我是小智。", content)
+	assert.Equal(t, []string{"conv-1"}, updates)
+	require.Len(t, f.requests, 2)
+	assert.Equal(t, "conv-old", f.requests[0].ConversationID)
+	assert.Empty(t, f.requests[1].ConversationID)
+	assert.Equal(t, "s2", f.requests[1].User) // 未设置用户标识时使用 sessionID
+}
+
+func TestChatError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `data: {"event": "error", "status": 400, "code": "invalid_param", "message": "city is required"}`+"\n\n")
+	}))
+	defer srv.Close()
+	p, err := llm.Create("dify", &llm.Config{Type: "dify", BaseURL: srv.URL, APIKey: "app-test"})
+	require.NoError(t, err)
+
+	ch, err := p.ResponseWithFunctions(context.Background(), "s3", []types.Message{{Role: "user", Content: "hi"}}, nil)
+	require.NoError(t, err)
+	var responses []types.Response
+	for r := range ch {
+		responses = append(responses, r)
+	}
+	require.Len(t, responses, 1)
+	assert.Contains(t, responses[0].Error, "city is required")
+	assert.Contains(t, responses[0].Content, "服务响应异常")
+}
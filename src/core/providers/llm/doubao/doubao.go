@@ -26,14 +26,20 @@ type Provider struct {
 
 // doubaoRequest 自定义请求结构体,支持thinking参数
 type doubaoRequest struct {
-	Model       string                          `json:"model"`
-	Messages    []map[string]interface{}        `json:"messages"`
-	Stream      bool                            `json:"stream"`
-	MaxTokens   int                             `json:"max_tokens,omitempty"`
-	Temperature float64                         `json:"temperature,omitempty"`
-	TopP        float64                         `json:"top_p,omitempty"`
-	Tools       []openai.Tool                   `json:"tools,omitempty"`
-	Thinking    map[string]string               `json:"thinking,omitempty"` // 支持thinking参数
+	Model            string                   `json:"model"`
+	Messages         []map[string]interface{} `json:"messages"`
+	Stream           bool                     `json:"stream"`
+	MaxTokens        int                      `json:"max_tokens,omitempty"`
+	Temperature      float64                  `json:"temperature,omitempty"`
+	TopP             float64                  `json:"top_p,omitempty"`
+	Stop             []string                 `json:"stop,omitempty"`
+	Seed             *int                     `json:"seed,omitempty"`
+	PresencePenalty  float64                  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64                  `json:"frequency_penalty,omitempty"`
+	ReasoningEffort  string                   `json:"reasoning_effort,omitempty"`
+	Tools            []openai.Tool            `json:"tools,omitempty"`
+	Thinking         map[string]string        `json:"thinking,omitempty"`       // 支持thinking参数
+	StreamOptions    *openai.StreamOptions    `json:"stream_options,omitempty"` // 流式返回用量
 }
 
 // doubaoStreamResponse SSE响应结构
@@ -51,6 +57,7 @@ type doubaoStreamResponse struct {
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason,omitempty"`
 	} `json:"choices"`
+	Usage *openai.Usage `json:"usage,omitempty"` // 开启 include_usage 后在最后一个数据块返回
 }
 
 // 注册提供者
@@ -105,6 +112,40 @@ func (p *Provider) Cleanup() error {
 	return nil
 }
 
+// newRequest 构建流式请求，带上配置中的采样参数和thinking参数
+func (p *Provider) newRequest(messages []map[string]interface{}, tools []openai.Tool) doubaoRequest {
+	config := p.Config()
+	req := doubaoRequest{
+		Model:            config.ModelName,
+		Messages:         messages,
+		Tools:            tools,
+		Stream:           true,
+		MaxTokens:        p.maxTokens,
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		Stop:             config.Stop,
+		Seed:             config.Seed,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		ReasoningEffort:  config.ReasoningEffort,
+	}
+	if p.thinkingType != "" {
+		req.Thinking = map[string]string{
+			"type": p.thinkingType,
+		}
+	}
+	return req
+}
+
+// marshalRequest 序列化请求并合并 Extra 中白名单内的请求参数
+func (p *Provider) marshalRequest(req doubaoRequest) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return llm.MergeBody(data, p.Config().ExtraBody())
+}
+
 // Response types.LLMProvider接口实现
 func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
 	responseChan := make(chan string, 10)
@@ -122,22 +163,10 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 		}
 
 		// 构建自定义请求
-		reqBody := doubaoRequest{
-			Model:     p.Config().ModelName,
-			Messages:  reqMessages,
-			Stream:    true,
-			MaxTokens: p.maxTokens,
-		}
-
-		// 添加thinking参数
-		if p.thinkingType != "" {
-			reqBody.Thinking = map[string]string{
-				"type": p.thinkingType,
-			}
-		}
+		reqBody := p.newRequest(reqMessages, nil)
 
 		// 序列化请求
-		jsonData, err := json.Marshal(reqBody)
+		jsonData, err := p.marshalRequest(reqBody)
 		if err != nil {
 			responseChan <- fmt.Sprintf("【请求序列化失败: %v】", err)
 			return
@@ -256,22 +285,11 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		}
 
 		// 构建自定义请求
-		reqBody := doubaoRequest{
-			Model:    p.Config().ModelName,
-			Messages: reqMessages,
-			Tools:    tools,
-			Stream:   true,
-		}
-
-		// 添加thinking参数
-		if p.thinkingType != "" {
-			reqBody.Thinking = map[string]string{
-				"type": p.thinkingType,
-			}
-		}
+		reqBody := p.newRequest(reqMessages, tools)
+		reqBody.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
 		// 序列化请求
-		jsonData, err := json.Marshal(reqBody)
+		jsonData, err := p.marshalRequest(reqBody)
 		if err != nil {
 			responseChan <- types.Response{
 				Content: fmt.Sprintf("【请求序列化失败: %v】", err),
@@ -350,6 +368,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 				if err := json.Unmarshal(data, &streamResp); err != nil {
 					continue
 				}
+				if streamResp.Usage != nil {
+					responseChan <- types.Response{Usage: types.NewUsage(streamResp.Usage)}
+				}
 
 				// 提取内容和工具调用
 				if len(streamResp.Choices) > 0 {
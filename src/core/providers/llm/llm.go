@@ -2,22 +2,45 @@ package llm
 
 import (
 	"fmt"
+	"sort"
 	"xiaozhi-server-go/src/core/types"
 )
 
 // Config LLM配置结构
 type Config struct {
-	Name        string                 `yaml:"name"` // LLM提供者名称
-	Type        string                 `yaml:"type"`
-	ModelName   string                 `yaml:"model_name"`
-	BaseURL     string                 `yaml:"base_url,omitempty"`
-	APIKey      string                 `yaml:"api_key,omitempty"`
-	Temperature float64                `yaml:"temperature,omitempty"`
-	MaxTokens   int                    `yaml:"max_tokens,omitempty"`
-	TopP        float64                `yaml:"top_p,omitempty"`
-	Extra       map[string]interface{} `yaml:",inline"`
+	Name             string                 `yaml:"name"` // LLM提供者名称
+	Type             string                 `yaml:"type"`
+	ModelName        string                 `yaml:"model_name"`
+	BaseURL          string                 `yaml:"base_url,omitempty"`
+	APIKey           string                 `yaml:"api_key,omitempty"`
+	Temperature      float64                `yaml:"temperature,omitempty"`
+	MaxTokens        int                    `yaml:"max_tokens,omitempty"`
+	TopP             float64                `yaml:"top_p,omitempty"`
+	Stop             []string               `yaml:"stop,omitempty"` // 停止序列
+	Seed             *int                   `yaml:"seed,omitempty"` // 随机种子，未设置时不发送
+	PresencePenalty  float64                `yaml:"presence_penalty,omitempty"`
+	FrequencyPenalty float64                `yaml:"frequency_penalty,omitempty"`
+	ReasoningEffort  string                 `yaml:"reasoning_effort,omitempty"` // 推理模型的思考强度：low/medium/high
+	ToolMode         string                 `yaml:"tool_mode,omitempty"`        // 工具调用方式：native/prompt/none
+	ContextWindow    int                    `yaml:"context_window,omitempty"`   // 上下文窗口（Token），0表示使用全局默认值
+	Tokenizer        string                 `yaml:"tokenizer,omitempty"`        // Token估算方式
+	Extra            map[string]interface{} `yaml:",inline"`
 }
 
+// 工具调用方式
+const (
+	ToolModeNative = "native" // 使用接口原生的 function calling，默认
+	ToolModePrompt = "prompt" // 工具说明写入系统提示词，模型以 <tool_call> 文本调用工具，适用于不支持 function calling 的模型
+	ToolModeNone   = "none"   // 不向模型提供工具
+)
+
+// SetIdentityFlag 使用的身份类型，供自行维护会话的托管平台（如Dify）使用
+const (
+	IdentityUser         = "user"            // 平台侧的用户标识，一般为设备ID
+	IdentityConversation = "conversation_id" // 平台侧的会话ID，为空表示开始新会话
+	IdentityInputs       = "inputs"          // 传给平台应用的变量，JSON对象
+)
+
 // Provider LLM提供者接口
 type Provider interface {
 	types.LLMProvider
@@ -69,6 +92,16 @@ func Register(name string, factory Factory) {
 	factories[name] = factory
 }
 
+// Types 已注册的LLM提供者类型，按名称排序
+func Types() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Create 创建LLM提供者实例
 func Create(name string, config *Config) (Provider, error) {
 	factory, ok := factories[name]
@@ -0,0 +1,230 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider 按脚本返回流式回复的LLM，用于测试和本地调试，不访问任何服务
+//
+// 配置示例：
+//
+//	MockLLM:
+//	  type: mock
+//	  chunk_size: 4      # 每个流式分片的字数
+//	  delay_ms: 20       # 分片间隔
+//	  responses:
+//	    - 你好，我是测试助手。
+//	    - tool_call:
+//	        name: local_get_time
+//	        arguments: {}
+//	    - content: 现在的时间我已经查到了。
+//
+// 每次请求按顺序取一条回复，脚本用完后回显用户最后一句话
+type Provider struct {
+	*llm.BaseProvider
+	chunkSize int
+	delay     time.Duration
+
+	mu        sync.Mutex
+	responses []scriptedResponse
+	next      int
+}
+
+// scriptedResponse 一次请求的脚本回复
+type scriptedResponse struct {
+	Content  string
+	ToolCall *types.FunctionCall // 不为空时返回工具调用
+}
+
+// 注册提供者
+func init() {
+	llm.Register("mock", NewProvider)
+}
+
+// NewProvider 创建Mock LLM提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	provider := &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		chunkSize:    4,
+	}
+	if size := intValue(config.Extra["chunk_size"]); size > 0 {
+		provider.chunkSize = size
+	}
+	provider.delay = time.Duration(intValue(config.Extra["delay_ms"])) * time.Millisecond
+
+	if items, ok := config.Extra["responses"].([]interface{}); ok {
+		for i, item := range items {
+			resp, err := parseResponse(item)
+			if err != nil {
+				return nil, fmt.Errorf("mock LLM 第%d条回复配置错误: %v", i+1, err)
+			}
+			provider.responses = append(provider.responses, resp)
+		}
+	}
+	return provider, nil
+}
+
+// parseResponse 解析一条回复，可以是字符串，或包含 content / tool_call 的对象
+func parseResponse(item interface{}) (scriptedResponse, error) {
+	switch v := item.(type) {
+	case string:
+		return scriptedResponse{Content: v}, nil
+	case map[string]interface{}:
+		resp := scriptedResponse{}
+		resp.Content, _ = v["content"].(string)
+		if call, ok := v["tool_call"].(map[string]interface{}); ok {
+			name, _ := call["name"].(string)
+			if name == "" {
+				return resp, fmt.Errorf("tool_call 缺少 name")
+			}
+			args := "{}"
+			switch a := call["arguments"].(type) {
+			case string:
+				args = a
+			case nil:
+			default:
+				data, err := json.Marshal(a)
+				if err != nil {
+					return resp, fmt.Errorf("tool_call 参数序列化失败: %v", err)
+				}
+				args = string(data)
+			}
+			resp.ToolCall = &types.FunctionCall{Name: name, Arguments: args}
+		}
+		return resp, nil
+	default:
+		return scriptedResponse{}, fmt.Errorf("不支持的类型 %T", item)
+	}
+}
+
+// nextResponse 取出下一条脚本回复，脚本用完后回显用户最后一句话
+func (p *Provider) nextResponse(messages []types.Message) scriptedResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next < len(p.responses) {
+		resp := p.responses[p.next]
+		p.next++
+		return resp
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return scriptedResponse{Content: "收到：" + messages[i].Content}
+		}
+	}
+	return scriptedResponse{Content: "收到"}
+}
+
+// chunks 按字数切分回复内容，模拟流式输出
+func (p *Provider) chunks(content string) []string {
+	runes := []rune(content)
+	result := make([]string, 0, len(runes)/p.chunkSize+1)
+	for start := 0; start < len(runes); start += p.chunkSize {
+		end := start + p.chunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		result = append(result, string(runes[start:end]))
+	}
+	return result
+}
+
+// wait 模拟分片间隔，ctx 取消时返回false
+func (p *Provider) wait(ctx context.Context) bool {
+	if p.delay <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-time.After(p.delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Response 按脚本流式返回文本，工具调用被忽略
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	resp := p.nextResponse(messages)
+	responseChan := make(chan string, 10)
+	go func() {
+		defer close(responseChan)
+		for _, chunk := range p.chunks(resp.Content) {
+			if !p.wait(ctx) {
+				return
+			}
+			select {
+			case responseChan <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
+// ResponseWithFunctions 按脚本流式返回文本，脚本中的工具调用以流式分片的形式返回
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	resp := p.nextResponse(messages)
+	responseChan := make(chan types.Response, 10)
+	go func() {
+		defer close(responseChan)
+		send := func(r types.Response) bool {
+			if !p.wait(ctx) {
+				return false
+			}
+			select {
+			case responseChan <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, chunk := range p.chunks(resp.Content) {
+			if !send(types.Response{Content: chunk}) {
+				return
+			}
+		}
+		if resp.ToolCall == nil {
+			send(types.Response{StopReason: "stop"})
+			return
+		}
+
+		// 与OpenAI流式接口一致：首个分片带ID与函数名，之后的分片只带参数
+		callID := fmt.Sprintf("call_mock_%d", time.Now().UnixNano())
+		if !send(types.Response{ToolCalls: []types.ToolCall{{
+			ID:       callID,
+			Type:     "function",
+			Function: types.FunctionCall{Name: resp.ToolCall.Name},
+		}}}) {
+			return
+		}
+		for _, chunk := range p.chunks(resp.ToolCall.Arguments) {
+			if !send(types.Response{ToolCalls: []types.ToolCall{{
+				Function: types.FunctionCall{Arguments: chunk},
+			}}}) {
+				return
+			}
+		}
+		send(types.Response{StopReason: "tool_calls"})
+	}()
+	return responseChan, nil
+}
+
+// intValue 读取YAML/JSON中的整数配置
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
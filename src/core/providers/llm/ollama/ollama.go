@@ -59,6 +59,7 @@ func (p *Provider) Initialize() error {
 	// Ollama不需要真正的API key，但openai客户端需要一个值
 	clientConfig := openai.DefaultConfig("ollama")
 	clientConfig.BaseURL = baseURL
+	clientConfig.HTTPClient = llm.NewHTTPClient(config) // 透传 Extra 中白名单内的请求参数
 
 	p.client = openai.NewClientWithConfig(clientConfig)
 	return nil
@@ -90,14 +91,7 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 			}
 		}
 
-		stream, err := p.client.CreateChatCompletionStream(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Stream:   true,
-			},
-		)
+		stream, err := p.client.CreateChatCompletionStream(ctx, p.newRequest(chatMessages, nil))
 		if err != nil {
 			responseChan <- fmt.Sprintf("【Ollama服务响应异常: %v】", err)
 			return
@@ -179,15 +173,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 			chatMessages[i] = chatMessage
 		}
 
-		stream, err := p.client.CreateChatCompletionStream(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
-			},
-		)
+		req := p.newRequest(chatMessages, tools)
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true} // 最后一个数据块返回用量
+		stream, err := p.client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
 			responseChan <- types.Response{
 				Content: fmt.Sprintf("【Ollama服务响应异常: %v】", err),
@@ -206,6 +194,10 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 				break
 			}
 
+			if response.Usage != nil {
+				responseChan <- types.Response{Usage: types.NewUsage(response.Usage)}
+			}
+
 			if len(response.Choices) > 0 {
 				delta := response.Choices[0].Delta
 
@@ -251,6 +243,18 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 	return responseChan, nil
 }
 
+// newRequest 构建流式请求，带上配置中的采样参数
+func (p *Provider) newRequest(messages []openai.ChatCompletionMessage, tools []openai.Tool) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:    p.modelName,
+		Messages: messages,
+		Tools:    tools,
+		Stream:   true,
+	}
+	llm.ApplyOpenAIParams(&req, p.Config())
+	return req
+}
+
 // addNoThinkDirective 为qwen3模型在用户最后一条消息中添加/no_think指令
 func (p *Provider) addNoThinkDirective(messages []types.Message) []types.Message {
 	// 复制消息列表
@@ -49,6 +49,7 @@ func (p *Provider) Initialize() error {
 	if config.BaseURL != "" {
 		clientConfig.BaseURL = config.BaseURL
 	}
+	clientConfig.HTTPClient = llm.NewHTTPClient(config) // 透传 Extra 中白名单内的请求参数
 
 	p.client = openai.NewClientWithConfig(clientConfig)
 	return nil
@@ -75,15 +76,7 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 			}
 		}
 
-		stream, err := p.client.CreateChatCompletionStream(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:     p.Config().ModelName,
-				Messages:  chatMessages,
-				Stream:    true,
-				MaxTokens: p.maxTokens,
-			},
-		)
+		stream, err := p.client.CreateChatCompletionStream(ctx, p.newRequest(chatMessages, nil))
 		if err != nil {
 			responseChan <- p.formatProviderError("create stream", err)
 			return
@@ -157,15 +150,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 			chatMessages[i] = chatMessage
 		}
 
-		stream, err := p.client.CreateChatCompletionStream(
-			ctx,
-			openai.ChatCompletionRequest{
-				Model:    p.Config().ModelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
-			},
-		)
+		req := p.newRequest(chatMessages, tools)
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true} // 最后一个数据块返回用量
+		stream, err := p.client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
 			formattedErr := p.formatProviderError("create stream", err)
 			responseChan <- types.Response{
@@ -189,6 +176,10 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 				break
 			}
 
+			if response.Usage != nil {
+				responseChan <- types.Response{Usage: types.NewUsage(response.Usage)}
+			}
+
 			if len(response.Choices) == 0 {
 				continue
 			}
@@ -220,6 +211,19 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 	return responseChan, nil
 }
 
+// newRequest 构建流式请求，带上配置中的采样参数
+func (p *Provider) newRequest(messages []openai.ChatCompletionMessage, tools []openai.Tool) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:     p.Config().ModelName,
+		Messages:  messages,
+		Tools:     tools,
+		Stream:    true,
+		MaxTokens: p.maxTokens,
+	}
+	llm.ApplyOpenAIParams(&req, p.Config())
+	return req
+}
+
 func (p *Provider) formatProviderError(stage string, err error) string {
 	message := fmt.Sprintf("OpenAI-compatible LLM %s error: %v", stage, err)
 
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ExtraBodyKeys 允许从 Extra 透传到请求体的字段，多为推理框架或厂商特有的采样参数。
+// 其余 Extra 字段（如 thinking_budget、inputs）只供提供者自身使用，不会发送给接口
+var ExtraBodyKeys = []string{
+	"top_k",
+	"min_p",
+	"repetition_penalty",
+	"logit_bias",
+	"response_format",
+	"parallel_tool_calls",
+	"enable_thinking",
+	"chat_template_kwargs",
+	"service_tier",
+}
+
+// extraBodyKey Extra 中显式指定的请求体字段，原样合并到请求体，用于白名单之外的厂商参数
+const extraBodyKey = "extra_body"
+
+// ExtraBody 返回需要合并到请求体的额外字段，没有时返回 nil
+func (c *Config) ExtraBody() map[string]interface{} {
+	if c == nil || len(c.Extra) == 0 {
+		return nil
+	}
+	body := make(map[string]interface{})
+	for _, key := range ExtraBodyKeys {
+		if v, ok := c.Extra[key]; ok && v != nil {
+			body[key] = v
+		}
+	}
+	if extra, ok := c.Extra[extraBodyKey].(map[string]interface{}); ok {
+		for k, v := range extra {
+			body[k] = v
+		}
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return body
+}
+
+// SetExtraBody 返回在 extra_body 中写入 key 后的 Extra 副本，不修改传入的 map（可能与全局配置共享）。
+// 请求结构体的 temperature、top_p 等字段带 omitempty，显式设置的 0 需借此写入请求体
+func SetExtraBody(extra map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		out[k] = v
+	}
+	body := make(map[string]interface{})
+	if old, ok := extra[extraBodyKey].(map[string]interface{}); ok {
+		for k, v := range old {
+			body[k] = v
+		}
+	}
+	body[key] = value
+	out[extraBodyKey] = body
+	return out
+}
+
+// ApplyOpenAIParams 把配置中的采样参数写入 OpenAI 兼容的请求，请求中已设置的 MaxTokens 不覆盖
+func ApplyOpenAIParams(req *openai.ChatCompletionRequest, c *Config) {
+	if c == nil {
+		return
+	}
+	if req.MaxTokens == 0 && c.MaxTokens > 0 {
+		req.MaxTokens = c.MaxTokens
+	}
+	req.Temperature = float32(c.Temperature)
+	req.TopP = float32(c.TopP)
+	req.Stop = c.Stop
+	req.Seed = c.Seed
+	req.PresencePenalty = float32(c.PresencePenalty)
+	req.FrequencyPenalty = float32(c.FrequencyPenalty)
+	req.ReasoningEffort = c.ReasoningEffort
+}
+
+// MergeBody 把额外字段合并到JSON请求体，请求体中已有的字段不会被覆盖
+func MergeBody(body []byte, extra map[string]interface{}) ([]byte, error) {
+	if len(extra) == 0 {
+		return body, nil
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	for k, v := range extra {
+		if _, exists := data[k]; exists {
+			continue
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = raw
+	}
+	return json.Marshal(data)
+}
+
+// NewHTTPClient 创建在请求体中合并 ExtraBody 的HTTP客户端，供使用 go-openai 客户端的提供者使用
+func NewHTTPClient(c *Config) *http.Client {
+	return &http.Client{Transport: &extraBodyTransport{config: c, base: http.DefaultTransport}}
+}
+
+// extraBodyTransport 在发送前把 ExtraBody 合并到JSON请求体
+type extraBodyTransport struct {
+	config *Config
+	base   http.RoundTripper
+}
+
+func (t *extraBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	extra := t.config.ExtraBody()
+	if len(extra) == 0 || req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	merged, err := MergeBody(body, extra)
+	if err != nil {
+		merged = body // 不是JSON对象时原样发送
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(merged))
+	req.ContentLength = int64(len(merged))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(merged)), nil
+	}
+	return t.base.RoundTrip(req)
+}
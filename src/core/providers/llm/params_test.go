@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtraBody(t *testing.T) {
+	assert.Nil(t, (&Config{}).ExtraBody())
+	assert.Nil(t, (&Config{Extra: map[string]interface{}{"thinking_budget": 1024}}).ExtraBody())
+
+	c := &Config{Extra: map[string]interface{}{
+		"top_k":           20,
+		"inputs":          map[string]interface{}{"city": "北京"}, // 不在白名单内
+		"enable_thinking": false,
+		"extra_body":      map[string]interface{}{"vendor_flag": "on"},
+	}}
+	assert.Equal(t, map[string]interface{}{
+		"top_k":           20,
+		"enable_thinking": false,
+		"vendor_flag":     "on",
+	}, c.ExtraBody())
+}
+
+func TestMergeBody(t *testing.T) {
+	body, err := MergeBody([]byte(`{"model":"m","stream":true}`), map[string]interface{}{"model": "other", "top_k": 5})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"m","stream":true,"top_k":5}`, string(body)) // 已有字段不覆盖
+
+	body, err = MergeBody([]byte(`{"model":"m"}`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"model":"m"}`, string(body))
+
+	_, err = MergeBody([]byte(`[]`), map[string]interface{}{"top_k": 5})
+	assert.Error(t, err)
+}
+
+func TestOpenAIRequestParams(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[]}`))
+	}))
+	defer srv.Close()
+
+	seed := 42
+	c := &Config{
+		ModelName:        "qwen3",
+		Temperature:      0.5,
+		TopP:             0.9,
+		MaxTokens:        256,
+		Stop:             []string{"用户："},
+		Seed:             &seed,
+		PresencePenalty:  0.25,
+		FrequencyPenalty: 0.5,
+		ReasoningEffort:  "low",
+		Extra:            map[string]interface{}{"top_k": 20, "repetition_penalty": 1.05},
+	}
+	clientConfig := openai.DefaultConfig("test")
+	clientConfig.BaseURL = srv.URL
+	clientConfig.HTTPClient = NewHTTPClient(c)
+	client := openai.NewClientWithConfig(clientConfig)
+
+	req := openai.ChatCompletionRequest{
+		Model:    c.ModelName,
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "你好"}},
+	}
+	ApplyOpenAIParams(&req, c)
+	_, err := client.CreateChatCompletion(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "qwen3", got["model"])
+	assert.Equal(t, 0.5, got["temperature"])
+	assert.InDelta(t, 0.9, got["top_p"], 1e-6)
+	assert.Equal(t, float64(256), got["max_tokens"])
+	assert.Equal(t, []interface{}{"用户："}, got["stop"])
+	assert.Equal(t, float64(42), got["seed"])
+	assert.Equal(t, 0.25, got["presence_penalty"])
+	assert.Equal(t, 0.5, got["frequency_penalty"])
+	assert.Equal(t, "low", got["reasoning_effort"])
+	assert.Equal(t, float64(20), got["top_k"])
+	assert.Equal(t, 1.05, got["repetition_penalty"])
+}
+
+func TestSetExtraBodySendsZero(t *testing.T) {
+	shared := map[string]interface{}{"top_k": 20, "extra_body": map[string]interface{}{"vendor_flag": "on"}}
+	c := &Config{Extra: SetExtraBody(shared, "temperature", 0)}
+
+	// 原 map 不被修改
+	assert.Equal(t, map[string]interface{}{"vendor_flag": "on"}, shared["extra_body"])
+
+	req := openai.ChatCompletionRequest{Model: "m"}
+	ApplyOpenAIParams(&req, c)
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	body, err := MergeBody(data, c.ExtraBody())
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Contains(t, got, "temperature")
+	assert.Equal(t, float64(0), got["temperature"])
+	assert.Equal(t, "on", got["vendor_flag"])
+	assert.Equal(t, float64(20), got["top_k"])
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// PromptToolMessages 为 prompt 工具调用方式准备请求消息：工具说明写入系统提示词，
+// 历史中 assistant 的工具调用转换为 <tool_call> 文本，工具结果转换为 user 消息中的观察结果，
+// 相邻的观察结果合并为一条。原消息不会被修改
+func PromptToolMessages(messages []types.Message, tools []openai.Tool) []types.Message {
+	toolsJSON, err := json.MarshalIndent(tools, "", "  ")
+	if err != nil {
+		toolsJSON = []byte("[]")
+	}
+
+	result := make([]types.Message, 0, len(messages)+1)
+	toolNames := make(map[string]string) // tool_call_id -> 工具名称
+	hasSystem := false
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "system" && !hasSystem:
+			hasSystem = true
+			result = append(result, types.Message{
+				Role:    "system",
+				Content: utils.GetToolCallSystemPrompt(msg.Content, string(toolsJSON)),
+			})
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var sb strings.Builder
+			sb.WriteString(msg.Content)
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				args := tc.Function.Arguments
+				if !json.Valid([]byte(args)) {
+					args = "{}"
+				}
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				name, _ := json.Marshal(tc.Function.Name)
+				fmt.Fprintf(&sb, "<tool_call>\n{\"name\": %s, \"arguments\": %s}\n</tool_call>", name, args)
+			}
+			result = append(result, types.Message{Role: "assistant", Content: sb.String()})
+		case msg.Role == "tool":
+			observation := fmt.Sprintf("<tool_result name=%q>\n%s\n</tool_result>", toolNames[msg.ToolCallID], msg.Content)
+			if n := len(result); n > 0 && result[n-1].Role == "user" && strings.HasPrefix(result[n-1].Content, "<tool_result") {
+				result[n-1].Content += "\n" + observation
+			} else {
+				result = append(result, types.Message{Role: "user", Content: observation})
+			}
+		default:
+			result = append(result, types.Message{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	if !hasSystem {
+		result = append([]types.Message{{
+			Role:    "system",
+			Content: utils.GetToolCallSystemPrompt("", string(toolsJSON)),
+		}}, result...)
+	}
+	return result
+}
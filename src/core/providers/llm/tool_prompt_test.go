@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptToolMessages(t *testing.T) {
+	tools := []openai.Tool{{
+		Type:     openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{Name: "get_weather", Description: "查询天气"},
+	}}
+	history := []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "北京和上海天气怎么样"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: "c1", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+			{ID: "c2", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":`}},
+		}},
+		{Role: "tool", ToolCallID: "c1", Content: "晴"},
+		{Role: "tool", ToolCallID: "c2", Content: "小雨"},
+	}
+
+	got := PromptToolMessages(history, tools)
+	require.Len(t, got, 4)
+
+	assert.Equal(t, "system", got[0].Role)
+	assert.Contains(t, got[0].Content, `"name": "get_weather"`)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(got[0].Content), "你是小智"))
+
+	assert.Equal(t, "assistant", got[2].Role)
+	assert.Empty(t, got[2].ToolCalls)
+	calls := utils.ParseTextToolCalls(got[2].Content)
+	require.Len(t, calls, 2)
+	assert.Equal(t, `{"city":"北京"}`, calls[0].Arguments)
+	assert.Equal(t, `{}`, calls[1].Arguments) // 不完整的参数替换为空对象
+
+	assert.Equal(t, "user", got[3].Role)
+	assert.Equal(t, "<tool_result name=\"get_weather\">\n晴\n</tool_result>\n<tool_result name=\"get_weather\">\n小雨\n</tool_result>", got[3].Content)
+
+	// 原消息不被修改
+	assert.Equal(t, "你是小智", history[0].Content)
+	assert.Len(t, history[2].ToolCalls, 2)
+}
+
+func TestPromptToolMessagesWithoutSystem(t *testing.T) {
+	got := PromptToolMessages([]types.Message{{Role: "user", Content: "你好"}}, nil)
+	require.Len(t, got, 2)
+	assert.Equal(t, "system", got[0].Role)
+	assert.Contains(t, got[0].Content, "<tool_call>")
+	assert.Equal(t, types.Message{Role: "user", Content: "你好"}, got[1])
+}
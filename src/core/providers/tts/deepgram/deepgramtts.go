@@ -2,6 +2,7 @@ package deepgram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -33,14 +34,17 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 }
 
 // ToTTS 实现文本到语音的转换
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("token %s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.baseURL, header)
 	if err != nil {
 		return "", fmt.Errorf("连接Deepgram TTS服务器失败: %v", err)
 	}
 	defer conn.Close()
+	// ctx 取消时关闭连接，中断阻塞中的读取
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// 发送文本消息
 	speakRequest := map[string]string{
@@ -121,6 +125,9 @@ loop:
 			break loop
 		}
 	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
 
 	// 验证音频完整性（可选）
 	// 检查是否接收到音频数据
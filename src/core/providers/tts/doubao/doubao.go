@@ -3,6 +3,7 @@ package doubao
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -66,14 +67,17 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 }
 
 // ToTTS 实现文本到语音的转换
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer;%s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.baseURL, header)
 	if err != nil {
 		return "", fmt.Errorf("连接WebSocket服务器失败: %v", err)
 	}
 	defer conn.Close()
+	// ctx 取消时关闭连接，中断阻塞中的读取
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// 准备请求参数
 	reqParams := map[string]map[string]interface{}{
@@ -143,6 +147,9 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
 			return "", fmt.Errorf("接收响应失败: %v", err)
 		}
 
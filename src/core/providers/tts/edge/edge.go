@@ -1,6 +1,7 @@
 package edge
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,7 +26,7 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 
 // ToTTS 将文本转换为音频文件，并返回文件路径
 // 使用的edge库是github.com/wujunwei928/edge-tts-go，默认使用24k采样率
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 获取配置的声音，如果未配置则使用默认值
 	edgeTTSStartTime := time.Now()
 	voice := p.BaseProvider.Config().Voice
@@ -56,10 +57,25 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		return "", fmt.Errorf("创建 edge-tts-go Communicate 失败: %v", err)
 	}
 
-	// 获取音频流数据
-	audioData, err := conn.Stream()
-	if err != nil {
-		return "", fmt.Errorf("edge-tts-go 获取音频流失败: %v", err)
+	// 获取音频流数据，edge-tts-go 不支持取消，ctx 取消时放弃等待
+	type streamResult struct {
+		data []byte
+		err  error
+	}
+	done := make(chan streamResult, 1)
+	go func() {
+		data, err := conn.Stream()
+		done <- streamResult{data, err}
+	}()
+	var audioData []byte
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", fmt.Errorf("edge-tts-go 获取音频流失败: %v", r.err)
+		}
+		audioData = r.data
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
 
 	ttsDuration := time.Since(edgeTTSStartTime)
@@ -36,7 +36,7 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 }
 
 // ToTTS 将文本转换为音频文件，并返回文件路径
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 获取配置的声音，如果未配置则使用默认值
 	SherpaTTSStartTime := time.Now()
 
@@ -52,6 +52,10 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	// Use a unique filename
 	tempFile := filepath.Join(outputDir, fmt.Sprintf("go_sherpa_tts_%d.wav", time.Now().UnixNano()))
 
+	// 长连接上请求与响应一一对应，中途放弃读取会导致后续响应错位，只在发送前检查取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	p.conn.WriteMessage(websocket.TextMessage, []byte(text))
 	_, bytes, err := p.conn.ReadMessage()
 
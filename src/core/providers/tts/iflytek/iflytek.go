@@ -1,6 +1,7 @@
 package iflytek
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -45,7 +46,7 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 	}, nil
 }
 
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	if p.Config().AppID == "" {
 		return "", fmt.Errorf("missing iFlytek appid")
 	}
@@ -61,11 +62,14 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		return "", err
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(authURL, nil)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, authURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("connect iFlytek TTS websocket failed: %w", err)
 	}
 	defer conn.Close()
+	// close the connection on cancellation to unblock ReadMessage
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	audioEncoding, fileExt := resolveAudioFormat(p.Config().Format)
 	request := map[string]interface{}{
@@ -104,6 +108,9 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
 			return "", fmt.Errorf("read iFlytek TTS response failed: %w", err)
 		}
 
@@ -0,0 +1,97 @@
+package mock
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	sampleRate    = 24000 // 与下发音频的Opus编码采样率一致，无需重采样
+	toneFrequency = 440.0
+	toneAmplitude = 0.3
+
+	msPerRune   = 40 // 每个字对应的音频时长
+	minDuration = 120 * time.Millisecond
+	maxDuration = 2 * time.Second
+)
+
+// Provider 生成正弦波提示音的TTS，用于测试和本地调试，不访问任何服务
+//
+// 音频时长随文本长度变化，输出24kHz单声道WAV文件。
+// 仓库中没有MP3编码器，format 只支持 wav
+type Provider struct {
+	*tts.BaseProvider
+}
+
+// NewProvider 创建Mock TTS提供者
+func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
+	if config.Format != "" && config.Format != "wav" {
+		return nil, fmt.Errorf("mock TTS 只支持wav格式，不支持: %s", config.Format)
+	}
+	return &Provider{
+		BaseProvider: tts.NewBaseProvider(config, deleteFile),
+	}, nil
+}
+
+// Initialize 未配置输出目录时使用系统临时目录
+func (p *Provider) Initialize() error {
+	if p.Config().OutputDir == "" {
+		return nil
+	}
+	return p.BaseProvider.Initialize()
+}
+
+// ToTTS 按文本长度生成一段提示音，返回WAV文件路径
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	outputDir := p.Config().OutputDir
+	if outputDir == "" {
+		outputDir = os.TempDir()
+	}
+	pcm := tone(toneDuration(text))
+	file := filepath.Join(outputDir, fmt.Sprintf("mock_tts_%d.wav", time.Now().UnixNano()))
+	if _, err := utils.SaveAudioToWavFile(pcm, file, sampleRate, 1, 16, false); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+	return file, nil
+}
+
+// toneDuration 按字数计算音频时长
+func toneDuration(text string) time.Duration {
+	d := time.Duration(utf8.RuneCountInString(text)*msPerRune) * time.Millisecond
+	if d < minDuration {
+		return minDuration
+	}
+	if d > maxDuration {
+		return maxDuration
+	}
+	return d
+}
+
+// tone 生成16位小端序的正弦波PCM数据
+func tone(d time.Duration) []byte {
+	samples := int(d.Seconds() * sampleRate)
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		v := toneAmplitude * math.Sin(2*math.Pi*toneFrequency*float64(i)/sampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+func init() {
+	// 注册Mock TTS提供者
+	tts.Register("mock", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+		return NewProvider(config, deleteFile)
+	})
+}
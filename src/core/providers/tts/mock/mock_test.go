@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"context"
+	"os"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderOnlySupportsWav(t *testing.T) {
+	_, err := NewProvider(&tts.Config{Type: "mock", Format: "mp3"}, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "只支持wav")
+
+	p, err := NewProvider(&tts.Config{Type: "mock", Format: "wav", OutputDir: t.TempDir()}, true)
+	require.NoError(t, err)
+	require.NoError(t, p.Initialize())
+	file, err := p.ToTTS(context.Background(), "你好")
+	require.NoError(t, err)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	_, rate, channels, err := utils.ParseWavData(data)
+	require.NoError(t, err)
+	assert.Equal(t, sampleRate, rate)
+	assert.Equal(t, 1, channels)
+}
@@ -0,0 +1,179 @@
+package quota
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+	"xiaozhi-server-go/src/task"
+)
+
+/*
+* 用量配额。
+* 对话过程中按用户和设备记录每天的对话轮次、LLM Token、TTS字数、ASR音频秒数和工具调用次数，
+* 每轮对话开始前按用户级别对应的配额检查当天用量，超出时播报提示并结束本轮。
+* 用户级别没有配置配额时不限制；未绑定用户的设备按 basic 级别、按设备计算。
+ */
+
+// 用量项
+const (
+	MetricRounds     = "rounds"
+	MetricLLMTokens  = "llm_tokens"
+	MetricTTSChars   = "tts_chars"
+	MetricASRSeconds = "asr_seconds"
+	MetricToolCalls  = "tool_calls"
+)
+
+// DefaultLevel 未设置级别的用户与未绑定用户的设备使用的级别
+const DefaultLevel = string(task.UserLevelBasic)
+
+// Usage 一段时间内累计的用量
+type Usage struct {
+	Rounds     int64
+	LLMTokens  int64
+	TTSChars   int64
+	ASRSeconds float64
+	ToolCalls  int64
+}
+
+// IsZero 是否没有任何用量
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// Date 用量记录使用的日期
+func Date(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// Exceeded 返回当天用量已达到上限的第一项，均未达到时返回空字符串
+func Exceeded(plan *models.QuotaPlan, used *models.DailyUsage) string {
+	if plan == nil || used == nil {
+		return ""
+	}
+	switch {
+	case plan.DailyRounds > 0 && used.Rounds >= plan.DailyRounds:
+		return MetricRounds
+	case plan.DailyLLMTokens > 0 && used.LLMTokens >= plan.DailyLLMTokens:
+		return MetricLLMTokens
+	case plan.DailyTTSChars > 0 && used.TTSChars >= plan.DailyTTSChars:
+		return MetricTTSChars
+	case plan.DailyASRSeconds > 0 && used.ASRSeconds >= float64(plan.DailyASRSeconds):
+		return MetricASRSeconds
+	case plan.DailyToolCalls > 0 && used.ToolCalls >= plan.DailyToolCalls:
+		return MetricToolCalls
+	}
+	return ""
+}
+
+// userLevel 获取用户级别
+func userLevel(userID uint) string {
+	if userID == 0 {
+		return DefaultLevel
+	}
+	user, err := database.GetUserByID(database.GetDB(), userID)
+	if err != nil || user == nil || user.Level == "" {
+		return DefaultLevel
+	}
+	return user.Level
+}
+
+// Status 用户或设备当天的配额与用量
+type Status struct {
+	Level string             `json:"level"`
+	Plan  *models.QuotaPlan  `json:"plan"` // 为空表示不限制
+	Used  *models.DailyUsage `json:"used"`
+}
+
+// GetStatus 查询当天的配额与用量；配额按用户合计时 deviceID 被忽略
+func GetStatus(userID uint, deviceID string, now time.Time) (*Status, error) {
+	db := database.GetDB()
+	level := userLevel(userID)
+	plan, err := database.FindQuotaPlan(db, level)
+	if err != nil {
+		return nil, err
+	}
+	scope := deviceID
+	if userID != 0 && (plan == nil || !plan.PerDevice) {
+		scope = ""
+	}
+	used, err := database.SumDailyUsage(db, userID, scope, Date(now))
+	if err != nil {
+		return nil, err
+	}
+	return &Status{Level: level, Plan: plan, Used: used}, nil
+}
+
+// Check 检查设备当前是否还有配额，返回已超出的用量项；查询失败时不限制
+func Check(logger *utils.Logger, userID uint, deviceID string) string {
+	if database.GetDB() == nil {
+		return ""
+	}
+	status, err := GetStatus(userID, deviceID, time.Now())
+	if err != nil {
+		logger.Error("[配额] [检查] 用户 %d 设备 %s 查询用量失败: %v", userID, deviceID, err)
+		return ""
+	}
+	return Exceeded(status.Plan, status.Used)
+}
+
+// Record 累加设备当天的用量
+func Record(logger *utils.Logger, userID uint, deviceID string, usage Usage) {
+	db := database.GetDB()
+	if db == nil || usage.IsZero() {
+		return
+	}
+	now := time.Now()
+	record := &models.DailyUsage{
+		UserID:     userID,
+		DeviceID:   deviceID,
+		Date:       Date(now),
+		Rounds:     usage.Rounds,
+		LLMTokens:  usage.LLMTokens,
+		TTSChars:   usage.TTSChars,
+		ASRSeconds: usage.ASRSeconds,
+		ToolCalls:  usage.ToolCalls,
+		UpdatedAt:  now,
+	}
+	if err := database.AddDailyUsage(db, record); err != nil {
+		logger.Error("[配额] [记录] 用户 %d 设备 %s 保存用量失败: %v", userID, deviceID, err)
+	}
+}
+
+// EstimateTokens 估算文本的Token数：中日韩文字每字约1个Token，其他字符约4个字符1个Token
+func EstimateTokens(text string) int64 {
+	var cjk, other int64
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else if !unicode.IsSpace(r) {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// 配额用尽时的提示，按智能体的语言选择
+var exceededMessages = map[string]string{
+	"zh":  "今天的使用额度已经用完了，明天再来找我聊天吧。",
+	"yue": "今日嘅使用额度已经用晒喇，听日再嚟搵我倾偈啦。",
+	"en":  "You've used up today's quota. Let's chat again tomorrow.",
+	"ja":  "今日の利用上限に達しました。また明日お話ししましょう。",
+}
+
+// ExceededMessage 配额用尽时播报的提示，language 为智能体配置的语言
+func ExceededMessage(language string) string {
+	lang := strings.ToLower(language)
+	switch {
+	case strings.Contains(lang, "粤") || strings.Contains(lang, "cantonese"):
+		return exceededMessages["yue"]
+	case strings.Contains(lang, "英") || strings.HasPrefix(lang, "en"):
+		return exceededMessages["en"]
+	case strings.Contains(lang, "日") || strings.HasPrefix(lang, "ja") || strings.Contains(lang, "japanese"):
+		return exceededMessages["ja"]
+	}
+	return exceededMessages["zh"]
+}
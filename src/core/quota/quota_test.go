@@ -0,0 +1,33 @@
+package quota
+
+import (
+	"testing"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExceeded(t *testing.T) {
+	plan := &models.QuotaPlan{DailyRounds: 10, DailyASRSeconds: 60}
+
+	assert.Equal(t, "", Exceeded(nil, &models.DailyUsage{Rounds: 100}), "No plan means unlimited")
+	assert.Equal(t, "", Exceeded(plan, &models.DailyUsage{Rounds: 9, ASRSeconds: 59.9, LLMTokens: 1 << 30}))
+	assert.Equal(t, MetricRounds, Exceeded(plan, &models.DailyUsage{Rounds: 10}))
+	assert.Equal(t, MetricASRSeconds, Exceeded(plan, &models.DailyUsage{ASRSeconds: 60}))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, int64(0), EstimateTokens(""))
+	assert.Equal(t, int64(4), EstimateTokens("你好世界"))
+	assert.Equal(t, int64(3), EstimateTokens("hello world"))
+	assert.Equal(t, int64(3), EstimateTokens("你好 ok"))
+}
+
+func TestExceededMessage(t *testing.T) {
+	assert.Equal(t, exceededMessages["zh"], ExceededMessage(""))
+	assert.Equal(t, exceededMessages["zh"], ExceededMessage("普通话"))
+	assert.Equal(t, exceededMessages["yue"], ExceededMessage("粤语"))
+	assert.Equal(t, exceededMessages["en"], ExceededMessage("English"))
+	assert.Equal(t, exceededMessages["en"], ExceededMessage("英语"))
+	assert.Equal(t, exceededMessages["ja"], ExceededMessage("日语"))
+}
@@ -0,0 +1,88 @@
+package recording
+
+import (
+	"context"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	// 清理过期录音的间隔
+	cleanupInterval = time.Hour
+	// 每批清理的录音数
+	cleanupBatch = 500
+)
+
+// Cleaner 定期删除超过保留期的录音文件与索引
+type Cleaner struct {
+	logger *utils.Logger
+	config *configs.Config
+}
+
+// NewCleaner 创建录音清理器，保留期在每次清理时读取，管理后台修改配置后无需重启
+func NewCleaner(logger *utils.Logger, config *configs.Config) *Cleaner {
+	return &Cleaner{logger: logger, config: config}
+}
+
+// Run 运行清理循环，直到ctx结束
+func (c *Cleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	c.logger.Info("[录音] [清理] 录音清理器已启动")
+	c.Cleanup(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info("[录音] [清理] 录音清理器已停止")
+			return
+		case now := <-ticker.C:
+			c.Cleanup(now)
+		}
+	}
+}
+
+// Cleanup 删除早于保留期的录音，返回删除的条数
+func (c *Cleaner) Cleanup(now time.Time) int {
+	days := c.config.Recording.RetentionDays
+	db := database.GetDB()
+	if days <= 0 || db == nil {
+		return 0
+	}
+	before := now.Add(-time.Duration(days) * 24 * time.Hour)
+	dir := Dir(c.config)
+
+	total := 0
+	for {
+		records, err := database.ListRecordingsBefore(db, before, cleanupBatch)
+		if err != nil {
+			c.logger.Error("[录音] [清理] 查询过期录音失败: %v", err)
+			break
+		}
+		if len(records) == 0 {
+			break
+		}
+		ids := make([]uint, 0, len(records))
+		for i := range records {
+			if err := Remove(dir, &records[i]); err != nil {
+				// 文件删除失败时仍删除索引，避免每次清理都重复失败
+				c.logger.Warn("[录音] [清理] 删除 %s 失败: %v", records[i].FilePath, err)
+			}
+			ids = append(ids, records[i].ID)
+		}
+		if err := database.DeleteRecordings(db, ids); err != nil {
+			c.logger.Error("[录音] [清理] 删除录音索引失败: %v", err)
+			break
+		}
+		total += len(records)
+		if len(records) < cleanupBatch {
+			break
+		}
+	}
+	if total > 0 {
+		c.logger.Info("[录音] [清理] 删除 %d 条超过 %d 天的录音", total, days)
+	}
+	return total
+}
@@ -0,0 +1,148 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 对话录音。
+* 开启 save_user_audio 时保存用户每句话解码后的PCM，开启 save_tts_audio 时保存每段TTS回复发送给设备的音频，
+* 统一转为WAV文件，按 <录音目录>/<设备>/<连接时间>_<会话>/round_<轮次>/ 存放，并在数据库中记录索引，关联到智能体会话与对话轮次。
+* 未携带 Session-Id 的设备每次连接使用相同的会话ID，轮次从1开始，因此目录中带上连接时间以区分各次连接。
+* 超过保留期的录音由 Cleaner 定期删除。
+ */
+
+// 录音类型
+const (
+	KindUser = "user" // 用户语音
+	KindTTS  = "tts"  // 回复语音
+)
+
+// DefaultDir 未配置录音目录时使用的默认目录
+const DefaultDir = "data/recordings"
+
+// Dir 配置的录音目录
+func Dir(cfg *configs.Config) string {
+	if cfg == nil || cfg.Recording.Dir == "" {
+		return DefaultDir
+	}
+	return cfg.Recording.Dir
+}
+
+// Meta 一条录音所属的设备、会话、对话记录与轮次
+type Meta struct {
+	UserID         uint
+	AgentID        uint
+	ConversationID string // 对话记录ID，与 AgentDialog.Conversationid 对应
+	DeviceID       string
+	SessionID      string
+	StartedAt      time.Time // 连接建立时间
+	Round          int
+	Kind           string
+	Index          int    // TTS分段序号，用户语音为0
+	Text           string // 识别结果或TTS文本
+}
+
+// FilePath 录音文件的保存路径
+func FilePath(dir string, meta Meta) string {
+	name := "user.wav"
+	if meta.Kind == KindTTS {
+		name = fmt.Sprintf("tts_%03d.wav", meta.Index)
+	}
+	session := meta.StartedAt.Format("20060102-150405") + "_" + safeName(meta.SessionID)
+	return filepath.Join(dir, safeName(meta.DeviceID), session, fmt.Sprintf("round_%03d", meta.Round), name)
+}
+
+// safeName 把设备ID、会话ID转换为可用作目录名的字符串，MAC地址中的冒号在部分系统上不能用于文件名
+func safeName(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// Duration 16位PCM数据的时长
+func Duration(pcm []byte, sampleRate, channels int) time.Duration {
+	if sampleRate <= 0 || channels <= 0 {
+		return 0
+	}
+	samples := int64(len(pcm) / (2 * channels))
+	return time.Duration(samples) * time.Second / time.Duration(sampleRate)
+}
+
+// Save 把16位PCM数据保存为WAV文件并记录索引，在调用方的协程中执行文件与数据库操作
+func Save(logger *utils.Logger, cfg *configs.Config, meta Meta, pcm []byte, sampleRate, channels int) {
+	if len(pcm) == 0 {
+		return
+	}
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	path := FilePath(Dir(cfg), meta)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		logger.Error("[录音] [保存] 创建目录失败: %v", err)
+		return
+	}
+	// 同一段TTS因会话恢复后重播等原因再次保存时覆盖旧文件与索引
+	if _, err := utils.SaveAudioToWavFile(pcm, path, sampleRate, channels, 16, false); err != nil {
+		logger.Error("[录音] [保存] 写入 %s 失败: %v", path, err)
+		return
+	}
+
+	record := &models.Recording{
+		UserID:         meta.UserID,
+		AgentID:        meta.AgentID,
+		Conversationid: meta.ConversationID,
+		DeviceID:       meta.DeviceID,
+		SessionID:      meta.SessionID,
+		Round:          meta.Round,
+		Kind:           meta.Kind,
+		SegmentIndex:   meta.Index,
+		Text:           meta.Text,
+		FilePath:       path,
+		SampleRate:     sampleRate,
+		DurationMs:     Duration(pcm, sampleRate, channels).Milliseconds(),
+		Size:           int64(len(pcm)) + 44,
+	}
+	if err := database.SaveRecording(db, record); err != nil {
+		logger.Error("[录音] [保存] 记录索引失败: %v", err)
+		return
+	}
+	logger.Debug("[录音] [保存] %s 轮次 %d %s#%d %dms -> %s",
+		meta.DeviceID, meta.Round, meta.Kind, meta.Index, record.DurationMs, path)
+}
+
+// Remove 删除录音文件，并删除因此变空的轮次、会话和设备目录
+func Remove(dir string, record *models.Recording) error {
+	if err := os.Remove(record.FilePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	for parent := filepath.Dir(record.FilePath); ; parent = filepath.Dir(parent) {
+		abs, err := filepath.Abs(parent)
+		if err != nil || abs == root || !strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			return nil
+		}
+		if os.Remove(abs) != nil { // 目录非空时删除失败，停止向上清理
+			return nil
+		}
+	}
+}
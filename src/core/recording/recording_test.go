@@ -0,0 +1,106 @@
+package recording
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePath(t *testing.T) {
+	startedAt := time.Date(2025, 3, 1, 8, 30, 0, 0, time.Local)
+	meta := Meta{DeviceID: "aa:bb:cc:dd:ee:ff", SessionID: "s-1", StartedAt: startedAt, Round: 3, Kind: KindUser}
+	session := "20250301-083000_s-1"
+	assert.Equal(t, filepath.Join("rec", "aa-bb-cc-dd-ee-ff", session, "round_003", "user.wav"), FilePath("rec", meta))
+
+	meta.Kind, meta.Index = KindTTS, 2
+	assert.Equal(t, filepath.Join("rec", "aa-bb-cc-dd-ee-ff", session, "round_003", "tts_002.wav"), FilePath("rec", meta))
+
+	// 设备ID、会话ID不能跳出录音目录
+	meta = Meta{DeviceID: "..", SessionID: "", StartedAt: startedAt, Round: 1, Kind: KindUser}
+	assert.Equal(t, filepath.Join("rec", "--", "20250301-083000_unknown", "round_001", "user.wav"), FilePath("rec", meta))
+}
+
+func TestDuration(t *testing.T) {
+	assert.Equal(t, time.Second, Duration(make([]byte, 32000), 16000, 1))
+	assert.Equal(t, 500*time.Millisecond, Duration(make([]byte, 48000), 24000, 2))
+	assert.Equal(t, time.Duration(0), Duration(make([]byte, 100), 0, 1))
+}
+
+func TestRemoveCleansEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+	user := FilePath(dir, Meta{DeviceID: "dev", SessionID: "s", Round: 1, Kind: KindUser})
+	tts := FilePath(dir, Meta{DeviceID: "dev", SessionID: "s", Round: 1, Kind: KindTTS, Index: 1})
+	require.NoError(t, os.MkdirAll(filepath.Dir(user), 0o755))
+	require.NoError(t, os.WriteFile(user, []byte("x"), 0o644))
+	require.NoError(t, os.WriteFile(tts, []byte("x"), 0o644))
+
+	// 同一轮还有其他录音时保留目录
+	require.NoError(t, Remove(dir, &models.Recording{FilePath: user}))
+	assert.DirExists(t, filepath.Dir(tts))
+
+	require.NoError(t, Remove(dir, &models.Recording{FilePath: tts}))
+	assert.NoDirExists(t, filepath.Join(dir, "dev"))
+	assert.DirExists(t, dir)
+
+	// 文件已不存在时不报错
+	assert.NoError(t, Remove(dir, &models.Recording{FilePath: tts}))
+}
+
+func TestSaveAndCleanup(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+		logger.Close()
+	})
+
+	cfg := &configs.Config{}
+	cfg.Recording.Dir = t.TempDir()
+	cfg.Recording.RetentionDays = 7
+
+	meta := Meta{UserID: 1, AgentID: 2, ConversationID: "c-1", DeviceID: "dev", SessionID: "s", StartedAt: time.Now(), Round: 1, Kind: KindTTS, Index: 1, Text: "你好"}
+	Save(logger, cfg, meta, make([]byte, 48000), 24000, 1)
+	// 重复保存同一分段（如会话恢复后重播）时覆盖原记录
+	Save(logger, cfg, meta, make([]byte, 24000), 24000, 1)
+
+	recordings, err := database.ListRecordings(db, database.RecordingFilter{UserID: 1, AgentID: 2}, 0)
+	require.NoError(t, err)
+	require.Len(t, recordings, 1)
+	assert.Equal(t, int64(500), recordings[0].DurationMs)
+	assert.Equal(t, "你好", recordings[0].Text)
+	assert.FileExists(t, recordings[0].FilePath)
+
+	// 按对话记录ID查询
+	byDialog, err := database.ListRecordings(db, database.RecordingFilter{UserID: 1, AgentID: 2, Conversationid: "c-1"}, 0)
+	require.NoError(t, err)
+	assert.Len(t, byDialog, 1)
+	byDialog, err = database.ListRecordings(db, database.RecordingFilter{UserID: 1, AgentID: 2, Conversationid: "c-2"}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, byDialog)
+
+	pcm, err := utils.ReadPCMDataFromWavFile(recordings[0].FilePath)
+	require.NoError(t, err)
+	assert.Len(t, pcm, 24000)
+
+	cleaner := NewCleaner(logger, cfg)
+	assert.Equal(t, 0, cleaner.Cleanup(time.Now()))
+	assert.Equal(t, 1, cleaner.Cleanup(time.Now().Add(8*24*time.Hour)))
+	assert.NoFileExists(t, recordings[0].FilePath)
+
+	recordings, err = database.ListRecordings(db, database.RecordingFilter{UserID: 1}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, recordings)
+}
@@ -0,0 +1,95 @@
+package reminder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+// TimeLayout 提醒时间的文本格式
+const TimeLayout = "2006-01-02 15:04"
+
+// New 创建一条提醒，repeat可以是关键字或cron表达式，为空时只提醒一次
+func New(tx *gorm.DB, userID uint, deviceID, content string, at time.Time, repeat string) (*models.Reminder, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("提醒内容不能为空")
+	}
+	if deviceID == "" {
+		return nil, fmt.Errorf("提醒的设备不能为空")
+	}
+
+	r := &models.Reminder{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Content:  content,
+	}
+	if err := Reschedule(r, at, repeat); err != nil {
+		return nil, err
+	}
+	if err := database.AddReminder(tx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reschedule 重新设置提醒的时间与重复规则，并计算下一次提醒时间
+func Reschedule(r *models.Reminder, at time.Time, repeat string) error {
+	if at.IsZero() {
+		return fmt.Errorf("提醒时间不能为空")
+	}
+	at = at.Truncate(time.Minute)
+	cron, err := NormalizeRepeat(repeat, at)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next := at
+	if !next.After(now) {
+		if cron == "" {
+			return fmt.Errorf("提醒时间 %s 已经过去", at.Format(TimeLayout))
+		}
+		if next, err = NextRun(cron, now); err != nil {
+			return err
+		}
+	}
+
+	r.Repeat = cron
+	r.NextRunAt = next
+	r.Enabled = true
+	return nil
+}
+
+// Advance 提醒触发后计算下一次提醒时间，一次性提醒会被关闭
+func Advance(r *models.Reminder, firedAt time.Time) {
+	r.LastRunAt = &firedAt
+	if r.Repeat == "" {
+		r.Enabled = false
+		return
+	}
+	next, err := NextRun(r.Repeat, firedAt)
+	if err != nil {
+		r.Enabled = false
+		return
+	}
+	r.NextRunAt = next
+}
+
+// Describe 将提醒格式化为便于播报的文本
+func Describe(r *models.Reminder) string {
+	if r.Repeat == "" {
+		return fmt.Sprintf("编号%d，%s，%s", r.ID, r.NextRunAt.Format(TimeLayout), r.Content)
+	}
+	return fmt.Sprintf("编号%d，%s，下次%s，%s",
+		r.ID, DescribeRepeat(r.Repeat), r.NextRunAt.Format(TimeLayout), r.Content)
+}
+
+// SpeechText 提醒触发时播报的文本
+func SpeechText(r *models.Reminder) string {
+	return "提醒时间到了：" + r.Content
+}
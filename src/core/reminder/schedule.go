@@ -0,0 +1,234 @@
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+* 提醒的重复规则使用标准的5段cron表达式：分 时 日 月 周。
+* 每段支持 *、a、a-b、逗号分隔的列表以及用 /n 指定步长（* 与 a-b 均可带步长），周的取值为0-7（0和7都表示周日）。
+* 日和周同时指定时，满足其中之一即触发，与常见cron实现一致。
+* 日为29-31中的单个取值时，在没有这一天的月份于当月最后一天触发（如每月31日的提醒在4月30日、2月28日触发），
+* 避免每月提醒跳过小月。
+* 另外支持 daily/weekdays/weekends/weekly/monthly 等关键字，按首次提醒时间展开为cron表达式。
+ */
+
+// 查找下一次触发时间时最多向后搜索的天数
+const maxSearchDays = 366 * 5
+
+// Schedule 解析后的cron重复规则
+type Schedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// 日、周是否为 *，用于处理日与周同时指定时的"或"逻辑
+	domAny bool
+	dowAny bool
+	// 日为29-31中的单个取值时记录该值，当月没有这一天时在月末触发
+	domClamp int
+}
+
+type fieldRange struct {
+	name     string
+	min, max int
+}
+
+var fieldRanges = []fieldRange{
+	{"分钟", 0, 59},
+	{"小时", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"周", 0, 7},
+}
+
+// ParseSchedule 解析5段cron表达式
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("重复规则 %q 格式错误，需要5段: 分 时 日 月 周", expr)
+	}
+
+	bits := make([]uint64, 5)
+	for i, field := range fields {
+		b, err := parseField(field, fieldRanges[i])
+		if err != nil {
+			return nil, fmt.Errorf("重复规则 %q 错误: %v", expr, err)
+		}
+		bits[i] = b
+	}
+	// 7 与 0 都表示周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+		bits[4] &^= 1 << 7
+	}
+
+	domClamp := 0
+	if day, err := strconv.Atoi(fields[2]); err == nil && day >= 29 {
+		domClamp = day
+	}
+	return &Schedule{
+		minute:   bits[0],
+		hour:     bits[1],
+		dom:      bits[2],
+		month:    bits[3],
+		dow:      bits[4],
+		domAny:   fields[2] == "*",
+		dowAny:   fields[4] == "*",
+		domClamp: domClamp,
+	}, nil
+}
+
+// Next 返回严格晚于after的下一次触发时间，找不到时返回零值
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	loc := after.Location()
+
+	for day := 0; day <= maxSearchDays; day++ {
+		if s.matchDay(t) {
+			for h := t.Hour(); h < 24; h++ {
+				if s.hour&(1<<uint(h)) == 0 {
+					continue
+				}
+				startMinute := 0
+				if h == t.Hour() {
+					startMinute = t.Minute()
+				}
+				for m := startMinute; m < 60; m++ {
+					if s.minute&(1<<uint(m)) != 0 {
+						return time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, loc)
+					}
+				}
+			}
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	if !domMatch && s.domClamp > 0 {
+		lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		domMatch = t.Day() == lastDay && lastDay < s.domClamp
+	}
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dowMatch
+	case s.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+func parseField(field string, r fieldRange) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s的步长 %q 无效", r.name, part)
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		lo, hi := r.min, r.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return 0, fmt.Errorf("%s的范围 %q 无效", r.name, part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("%s的取值 %q 无效", r.name, part)
+			}
+			lo, hi = n, n
+		}
+		if lo < r.min || hi > r.max {
+			return 0, fmt.Errorf("%s的取值超出范围 %d-%d", r.name, r.min, r.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// NormalizeRepeat 将重复关键字按首次提醒时间展开为cron表达式，空字符串表示只提醒一次。
+// 每月提醒的首次时间在29-31日时，没有这一天的月份在月末提醒
+func NormalizeRepeat(repeat string, first time.Time) (string, error) {
+	repeat = strings.TrimSpace(repeat)
+	m, h := first.Minute(), first.Hour()
+	switch strings.ToLower(repeat) {
+	case "", "once", "none":
+		return "", nil
+	case "daily", "每天":
+		return fmt.Sprintf("%d %d * * *", m, h), nil
+	case "weekdays", "工作日":
+		return fmt.Sprintf("%d %d * * 1-5", m, h), nil
+	case "weekends", "周末":
+		return fmt.Sprintf("%d %d * * 0,6", m, h), nil
+	case "weekly", "每周":
+		return fmt.Sprintf("%d %d * * %d", m, h, int(first.Weekday())), nil
+	case "monthly", "每月":
+		return fmt.Sprintf("%d %d %d * *", m, h, first.Day()), nil
+	}
+	if _, err := ParseSchedule(repeat); err != nil {
+		return "", err
+	}
+	return repeat, nil
+}
+
+// NextRun 计算重复提醒在after之后的下一次触发时间，repeat为空时返回零值
+func NextRun(repeat string, after time.Time) (time.Time, error) {
+	if repeat == "" {
+		return time.Time{}, nil
+	}
+	s, err := ParseSchedule(repeat)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := s.Next(after)
+	if next.IsZero() {
+		return next, fmt.Errorf("重复规则 %q 没有可触发的时间", repeat)
+	}
+	return next, nil
+}
+
+// DescribeRepeat 将重复规则转换为便于播报的描述
+func DescribeRepeat(repeat string) string {
+	if repeat == "" {
+		return "一次"
+	}
+	fields := strings.Fields(repeat)
+	if len(fields) == 5 && fields[2] == "*" && fields[3] == "*" {
+		switch fields[4] {
+		case "*":
+			return "每天"
+		case "1-5":
+			return "工作日"
+		case "0,6", "6,0":
+			return "周末"
+		}
+	}
+	return "按规则 " + repeat
+}
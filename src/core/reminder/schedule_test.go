@@ -0,0 +1,92 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, _ := time.ParseInLocation(TimeLayout, s, time.Local)
+	return t
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		{"30 8 * * *", "2024-05-01 07:00", "2024-05-01 08:30"},
+		{"30 8 * * *", "2024-05-01 08:30", "2024-05-02 08:30"},
+		{"0 9 * * 1-5", "2024-05-03 10:00", "2024-05-06 09:00"}, // 周五之后是下周一
+		{"*/15 * * * *", "2024-05-01 10:07", "2024-05-01 10:15"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-04-30 00:00"}, // 4月没有31日，在月末触发
+		{"0 0 31 * *", "2024-04-30 00:00", "2024-05-31 00:00"},
+		{"0 12 * * 7", "2024-05-01 00:00", "2024-05-05 12:00"}, // 7 表示周日
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, date(tt.want), s.Next(date(tt.after)), tt.expr)
+	}
+}
+
+func TestScheduleNext_DomOrDow(t *testing.T) {
+	// 日与周同时指定时满足其一即可
+	s, err := ParseSchedule("0 8 15 * 1")
+	require.NoError(t, err)
+	assert.Equal(t, date("2024-05-06 08:00"), s.Next(date("2024-05-01 00:00")))
+	assert.Equal(t, date("2024-05-15 08:00"), s.Next(date("2024-05-13 09:00")))
+}
+
+func TestScheduleNext_MonthlyClampsToLastDay(t *testing.T) {
+	cron, err := NormalizeRepeat("monthly", date("2024-01-31 09:00"))
+	require.NoError(t, err)
+	s, err := ParseSchedule(cron)
+	require.NoError(t, err)
+
+	want := []string{"2024-02-29 09:00", "2024-03-31 09:00", "2024-04-30 09:00", "2024-05-31 09:00"}
+	at := date("2024-01-31 09:00")
+	for _, w := range want {
+		at = s.Next(at)
+		assert.Equal(t, date(w), at)
+	}
+
+	// 30日的提醒只在2月提前到月末，31日的月份不会触发两次
+	s, err = ParseSchedule("0 9 30 * *")
+	require.NoError(t, err)
+	assert.Equal(t, date("2023-02-28 09:00"), s.Next(date("2023-01-30 09:00")))
+	assert.Equal(t, date("2023-03-30 09:00"), s.Next(date("2023-02-28 09:00")))
+	assert.Equal(t, date("2023-04-30 09:00"), s.Next(date("2023-03-30 09:00")))
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNormalizeRepeat(t *testing.T) {
+	first := date("2024-05-01 07:45") // 周三
+
+	tests := map[string]string{
+		"":          "",
+		"daily":     "45 7 * * *",
+		"weekdays":  "45 7 * * 1-5",
+		"weekly":    "45 7 * * 3",
+		"monthly":   "45 7 1 * *",
+		"0 9 * * *": "0 9 * * *",
+	}
+	for repeat, want := range tests {
+		got, err := NormalizeRepeat(repeat, first)
+		require.NoError(t, err, repeat)
+		assert.Equal(t, want, got, repeat)
+	}
+
+	_, err := NormalizeRepeat("sometimes", first)
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package reminder
+
+import (
+	"context"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 检查到期提醒的间隔
+	checkInterval = 10 * time.Second
+	// 每次最多处理的到期提醒数量
+	dueBatchSize = 100
+	// 设备离线时暂存提醒的最长有效期
+	offlineExpire = 12 * time.Hour
+)
+
+// Notifier 将已暂存的提醒播报下发到在线设备，设备不在线或下发失败时返回false。
+// 播报完成后才会被标记为已下发，未播报的提醒在设备下次连接时重新播报
+type Notifier func(announcement *models.DeviceAnnouncement) bool
+
+// Scheduler 提醒调度器，定期从数据库取出到期提醒并下发到设备
+type Scheduler struct {
+	logger *utils.Logger
+	notify Notifier
+}
+
+// NewScheduler 创建提醒调度器
+func NewScheduler(logger *utils.Logger, notify Notifier) *Scheduler {
+	return &Scheduler{
+		logger: logger,
+		notify: notify,
+	}
+}
+
+// Run 运行调度循环，直到ctx结束
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("[提醒] [调度] 提醒调度器已启动")
+	for {
+		s.processDue(time.Now())
+		select {
+		case <-ctx.Done():
+			s.logger.Info("[提醒] [调度] 提醒调度器已停止")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue 处理到期提醒：先推进下一次提醒时间并暂存播报再下发，避免重复触发和丢失
+func (s *Scheduler) processDue(now time.Time) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	reminders, err := database.ListDueReminders(db, now, dueBatchSize)
+	if err != nil {
+		s.logger.Error("[提醒] [调度] 查询到期提醒失败: %v", err)
+		return
+	}
+
+	for i := range reminders {
+		r := &reminders[i]
+		Advance(r, now)
+		if err := database.UpdateReminder(db, r); err != nil {
+			s.logger.Error("[提醒] [调度] 更新提醒 %d 失败: %v", r.ID, err)
+			continue
+		}
+
+		announcement, err := s.store(db, r, now)
+		if err != nil {
+			s.logger.Error("[提醒] [暂存] 设备 %s 提醒 %d 暂存失败: %v", r.DeviceID, r.ID, err)
+			continue
+		}
+		if s.notify != nil && s.notify(announcement) {
+			s.logger.Info("[提醒] [下发] 设备 %s 提醒 %d: %s", r.DeviceID, r.ID, r.Content)
+			continue
+		}
+		s.logger.Info("[提醒] [暂存] 设备 %s 不在线，提醒 %d 将在设备连接后播报", r.DeviceID, r.ID)
+	}
+}
+
+// store 将提醒暂存为设备播报，播放完成后才标记为已下发
+func (s *Scheduler) store(db *gorm.DB, r *models.Reminder, now time.Time) (*models.DeviceAnnouncement, error) {
+	expireAt := now.Add(offlineExpire)
+	// 重复提醒只保留到下一次提醒之前，避免离线期间堆积
+	if r.Enabled && r.Repeat != "" && r.NextRunAt.Before(expireAt) {
+		expireAt = r.NextRunAt
+	}
+	announcement := &models.DeviceAnnouncement{
+		DeviceID: r.DeviceID,
+		UserID:   r.UserID,
+		Text:     SpeechText(r),
+		ExpireAt: expireAt,
+	}
+	if err := database.AddDeviceAnnouncement(db, announcement); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
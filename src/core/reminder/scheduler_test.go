@@ -0,0 +1,58 @@
+package reminder
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerStoresReminderBeforeNotify(t *testing.T) {
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+	})
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, database.AddReminder(db, &models.Reminder{
+		UserID: 1, DeviceID: "online", Content: "喝水", NextRunAt: now.Add(-time.Second), Enabled: true,
+	}))
+	require.NoError(t, database.AddReminder(db, &models.Reminder{
+		UserID: 1, DeviceID: "offline", Content: "开会", NextRunAt: now.Add(-time.Second), Enabled: true,
+	}))
+
+	var notified []*models.DeviceAnnouncement
+	s := NewScheduler(logger, func(a *models.DeviceAnnouncement) bool {
+		notified = append(notified, a)
+		return a.DeviceID == "online"
+	})
+	s.processDue(now)
+
+	// 在线设备收到带暂存ID的播报，播放完成前仍保持待下发
+	require.Len(t, notified, 2)
+	for _, a := range notified {
+		assert.NotZero(t, a.ID)
+	}
+	for deviceID, content := range map[string]string{"online": "喝水", "offline": "开会"} {
+		pending, err := database.ListPendingDeviceAnnouncements(db, deviceID)
+		require.NoError(t, err)
+		require.Len(t, pending, 1, deviceID)
+		assert.Contains(t, pending[0].Text, content)
+	}
+
+	// 已触发的一次性提醒不会重复下发
+	notified = nil
+	s.processDue(now.Add(time.Minute))
+	assert.Empty(t, notified)
+}
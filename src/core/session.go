@@ -0,0 +1,145 @@
+package core
+
+import "time"
+
+/*
+* 会话状态机。
+* 一次连接的对话状态由会话协程独占维护，状态转换如下：
+*
+*	idle ──拾音开始──> listening ──用户输入──> thinking ──回复分段──> speaking ──播放完成──> listening/idle
+*	                                           thinking <──────> tool_wait
+*
+* 新一轮对话、中止和打断可以发生在任意状态。ASR回调、LLM回复协程、TTS与音频发送协程只通过事件通道通知会话协程，
+* 其他协程需要读取状态时使用会话协程发布的快照，见 connection_session.go。
+ */
+
+// SessionPhase 会话所处的阶段
+type SessionPhase string
+
+const (
+	PhaseIdle      SessionPhase = "idle"      // 空闲，设备未拾音
+	PhaseListening SessionPhase = "listening" // 设备拾音中
+	PhaseThinking  SessionPhase = "thinking"  // 等待LLM回复
+	PhaseToolWait  SessionPhase = "tool_wait" // 等待工具调用结果
+	PhaseSpeaking  SessionPhase = "speaking"  // 播放回复
+)
+
+// phaseTransitions 一轮对话内允许的状态转换；开始新一轮和结束当前轮次不受此限制
+var phaseTransitions = map[SessionPhase][]SessionPhase{
+	PhaseIdle:      {PhaseListening},
+	PhaseListening: {PhaseIdle},
+	PhaseThinking:  {PhaseSpeaking, PhaseToolWait},
+	PhaseToolWait:  {PhaseThinking, PhaseSpeaking},
+	PhaseSpeaking:  {PhaseThinking, PhaseToolWait},
+}
+
+// canTransition 判断一轮对话内能否从 from 转换到 to
+func canTransition(from, to SessionPhase) bool {
+	for _, p := range phaseTransitions[from] {
+		if p == to {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionMachine 会话状态，只由会话协程修改，其他协程读取快照
+type sessionMachine struct {
+	phase     SessionPhase
+	round     int       // 轮次计数
+	startedAt time.Time // 本轮开始时间
+	userText  string    // 本轮用户输入文本
+	asrText   string    // manual 拾音模式下累计的识别文本
+
+	lastIndex int  // 本轮最后一句加入播放队列的序号，用于 tts stop 消息
+	queued    int  // 本轮加入播放队列的句数
+	played    int  // 本轮播放完成（或被跳过）的句数
+	replyDone bool // 本轮回复是否已全部生成
+
+	listening bool // 设备是否处于拾音状态
+}
+
+// newSessionMachine 创建处于空闲状态的会话状态机
+func newSessionMachine() sessionMachine {
+	return sessionMachine{phase: PhaseIdle}
+}
+
+// speaking 是否正在生成或播放回复
+func (m *sessionMachine) speaking() bool {
+	return m.phase == PhaseThinking || m.phase == PhaseToolWait || m.phase == PhaseSpeaking
+}
+
+// startRound 开始新一轮对话，返回新的轮次
+func (m *sessionMachine) startRound(userText string) int {
+	m.round++
+	m.phase = PhaseThinking
+	m.startedAt = time.Now()
+	m.userText = userText
+	m.lastIndex, m.queued, m.played, m.replyDone = 0, 0, 0, false
+	return m.round
+}
+
+// transition 当前轮次内的状态转换，轮次已过期或转换不允许时返回false
+func (m *sessionMachine) transition(round int, to SessionPhase) bool {
+	if round != m.round || !canTransition(m.phase, to) {
+		return false
+	}
+	m.phase = to
+	return true
+}
+
+// segmentQueued 当前轮次有一句回复加入播放队列
+func (m *sessionMachine) segmentQueued(round, index int) bool {
+	if round != m.round || !m.speaking() {
+		return false
+	}
+	m.queued++
+	m.lastIndex = index
+	m.phase = PhaseSpeaking
+	return true
+}
+
+// audioPlayed 当前轮次有一句回复播放完成，返回本轮是否已全部播放完成
+func (m *sessionMachine) audioPlayed(round int) bool {
+	if round != m.round || !m.speaking() {
+		return false
+	}
+	m.played++
+	return m.finished()
+}
+
+// replyFinished 当前轮次的回复已全部生成，返回本轮是否已全部播放完成
+func (m *sessionMachine) replyFinished(round int) bool {
+	if round != m.round || !m.speaking() {
+		return false
+	}
+	m.replyDone = true
+	return m.finished()
+}
+
+func (m *sessionMachine) finished() bool {
+	return m.replyDone && m.played >= m.queued
+}
+
+// finishRound 结束当前轮次（播放完成、中止或打断），回到拾音或空闲状态
+func (m *sessionMachine) finishRound() {
+	if m.listening {
+		m.phase = PhaseListening
+	} else {
+		m.phase = PhaseIdle
+	}
+	m.lastIndex, m.queued, m.played, m.replyDone = 0, 0, 0, false
+}
+
+// setListening 设备开始或停止拾音，未在回复时同步切换状态
+func (m *sessionMachine) setListening(on bool) {
+	m.listening = on
+	if m.speaking() {
+		return
+	}
+	if on {
+		m.phase = PhaseListening
+	} else {
+		m.phase = PhaseIdle
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionMachineRound(t *testing.T) {
+	m := newSessionMachine()
+	assert.Equal(t, PhaseIdle, m.phase)
+	m.setListening(true)
+	assert.Equal(t, PhaseListening, m.phase)
+
+	round := m.startRound("你好")
+	assert.Equal(t, 1, round)
+	assert.Equal(t, PhaseThinking, m.phase)
+	assert.True(t, m.speaking())
+
+	assert.True(t, m.transition(round, PhaseToolWait))
+	assert.False(t, m.transition(round, PhaseListening), "轮次内不能直接回到拾音")
+	assert.True(t, m.transition(round, PhaseThinking))
+
+	assert.True(t, m.segmentQueued(round, 1))
+	assert.True(t, m.segmentQueued(round, 2))
+	assert.Equal(t, PhaseSpeaking, m.phase)
+	assert.Equal(t, 2, m.lastIndex)
+
+	assert.False(t, m.audioPlayed(round))
+	assert.False(t, m.replyFinished(round), "还有一句没有播放")
+	assert.True(t, m.audioPlayed(round))
+
+	m.finishRound()
+	assert.Equal(t, PhaseListening, m.phase)
+	assert.Zero(t, m.queued)
+	assert.Equal(t, 1, m.round, "结束轮次不改变轮次计数")
+}
+
+func TestSessionMachineIgnoresStaleRound(t *testing.T) {
+	m := newSessionMachine()
+	old := m.startRound("第一轮")
+	assert.True(t, m.segmentQueued(old, 1))
+	current := m.startRound("第二轮")
+
+	assert.False(t, m.segmentQueued(old, 2))
+	assert.False(t, m.audioPlayed(old))
+	assert.False(t, m.replyFinished(old))
+	assert.False(t, m.transition(old, PhaseToolWait))
+	assert.Equal(t, PhaseThinking, m.phase)
+	assert.Zero(t, m.queued)
+
+	// 没有任何分段的回复在生成结束时即完成
+	assert.True(t, m.replyFinished(current))
+	m.finishRound()
+	assert.Equal(t, PhaseIdle, m.phase)
+	assert.False(t, m.audioPlayed(current), "已结束的轮次不再计数")
+}
+
+func TestSessionMachineListeningDuringReply(t *testing.T) {
+	m := newSessionMachine()
+	m.startRound("你好")
+	m.setListening(true)
+	assert.Equal(t, PhaseThinking, m.phase, "回复中开始拾音不打断回复")
+	m.finishRound()
+	assert.Equal(t, PhaseListening, m.phase)
+	m.setListening(false)
+	assert.Equal(t, PhaseIdle, m.phase)
+}
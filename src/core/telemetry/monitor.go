@@ -0,0 +1,174 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+)
+
+const (
+	// 检查静默设备的间隔
+	silentCheckInterval = 5 * time.Minute
+	// 清理过期数据的间隔
+	cleanupInterval = time.Hour
+)
+
+// Record 保存一条上报数据并检查阈值类告警规则，userID为设备所属用户
+func Record(logger *utils.Logger, sample *models.DeviceTelemetry, userID uint) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	if err := database.AddDeviceTelemetry(db, sample); err != nil {
+		logger.Error("[遥测] [记录] 设备 %s 保存上报数据失败: %v", sample.DeviceID, err)
+		return
+	}
+	if userID == 0 {
+		return
+	}
+	rules, err := database.ListEnabledTelemetryAlertRules(db, userID, sample.DeviceID)
+	if err != nil {
+		logger.Error("[遥测] [告警] 查询告警规则失败: %v", err)
+		return
+	}
+	for i := range rules {
+		rule := &rules[i]
+		value, message, triggered := Evaluate(rule, sample)
+		if !triggered {
+			continue
+		}
+		last, err := database.FindLatestTelemetryAlert(db, rule.ID, sample.DeviceID)
+		if err != nil || (last != nil && sample.RecordedAt.Sub(last.CreatedAt) < AlertCooldown) {
+			continue
+		}
+		fire(logger, rule, sample.DeviceID, value, message)
+	}
+}
+
+// fire 保存告警记录并发布告警事件
+func fire(logger *utils.Logger, rule *models.TelemetryAlertRule, deviceID string, value int64, message string) {
+	alert := &models.TelemetryAlert{
+		RuleID:   rule.ID,
+		UserID:   rule.UserID,
+		DeviceID: deviceID,
+		Type:     rule.Type,
+		Value:    value,
+		Message:  message,
+	}
+	if err := database.AddTelemetryAlert(database.GetDB(), alert); err != nil {
+		logger.Error("[遥测] [告警] 保存告警记录失败: %v", err)
+		return
+	}
+	logger.Warn("[遥测] [告警] %s", message)
+	events.Default().Publish(events.Event{
+		Type:     events.TypeTelemetryAlert,
+		DeviceID: deviceID,
+		UserID:   rule.UserID,
+		Data: map[string]interface{}{
+			"alert_id":  alert.ID,
+			"rule_id":   rule.ID,
+			"type":      rule.Type,
+			"threshold": rule.Threshold,
+			"value":     value,
+			"message":   message,
+		},
+	})
+}
+
+// Monitor 定期检查静默设备并清理过期数据
+type Monitor struct {
+	logger *utils.Logger
+	config *configs.Config
+}
+
+// NewMonitor 创建设备健康监控，保留期在每次清理时读取，管理后台修改配置后无需重启
+func NewMonitor(logger *utils.Logger, config *configs.Config) *Monitor {
+	return &Monitor{logger: logger, config: config}
+}
+
+// Run 运行监控循环，直到ctx结束
+func (m *Monitor) Run(ctx context.Context) {
+	silentTicker := time.NewTicker(silentCheckInterval)
+	defer silentTicker.Stop()
+	cleanupTicker := time.NewTicker(cleanupInterval)
+	defer cleanupTicker.Stop()
+
+	m.logger.Info("[遥测] [监控] 设备健康监控已启动")
+	m.cleanup(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Info("[遥测] [监控] 设备健康监控已停止")
+			return
+		case now := <-silentTicker.C:
+			m.checkSilent(now)
+		case now := <-cleanupTicker.C:
+			m.cleanup(now)
+		}
+	}
+}
+
+// checkSilent 检查静默规则，同一段静默期只告警一次
+func (m *Monitor) checkSilent(now time.Time) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	rules, err := database.ListEnabledTelemetryAlertRulesByType(db, RuleSilent)
+	if err != nil {
+		m.logger.Error("[遥测] [静默检查] 查询告警规则失败: %v", err)
+		return
+	}
+	for i := range rules {
+		rule := &rules[i]
+		devices, err := database.ListDevicesByUser(db, rule.UserID)
+		if err != nil {
+			m.logger.Error("[遥测] [静默检查] 查询用户 %d 设备失败: %v", rule.UserID, err)
+			continue
+		}
+		for j := range devices {
+			device := &devices[j]
+			if device.Online || (rule.DeviceID != "" && rule.DeviceID != device.DeviceID) {
+				continue
+			}
+			lastSeen := device.LastActiveTimeV2
+			if sample, err := database.FindLatestDeviceTelemetry(db, device.DeviceID); err == nil && sample != nil && sample.RecordedAt.After(lastSeen) {
+				lastSeen = sample.RecordedAt
+			}
+			value, message, triggered := EvaluateSilent(rule, device.DeviceID, lastSeen, now)
+			if !triggered {
+				continue
+			}
+			last, err := database.FindLatestTelemetryAlert(db, rule.ID, device.DeviceID)
+			if err != nil || (last != nil && last.CreatedAt.After(lastSeen)) {
+				continue
+			}
+			fire(m.logger, rule, device.DeviceID, value, message)
+		}
+	}
+}
+
+// cleanup 清理超过保留期的上报数据与告警记录
+func (m *Monitor) cleanup(now time.Time) {
+	days := m.config.Telemetry.RetentionDays
+	db := database.GetDB()
+	if days <= 0 || db == nil {
+		return
+	}
+	before := now.Add(-time.Duration(days) * 24 * time.Hour)
+	deleted, err := database.DeleteDeviceTelemetryBefore(db, before)
+	if err != nil {
+		m.logger.Error("[遥测] [清理] 清理上报数据失败: %v", err)
+		return
+	}
+	if err := database.DeleteTelemetryAlertsBefore(db, before); err != nil {
+		m.logger.Error("[遥测] [清理] 清理告警记录失败: %v", err)
+	}
+	if deleted > 0 {
+		m.logger.Info("[遥测] [清理] 删除 %d 条过期上报数据", deleted)
+	}
+}
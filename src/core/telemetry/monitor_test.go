@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+	})
+	return db
+}
+
+func addSamples(t *testing.T, db *gorm.DB, start time.Time, n int) {
+	for i := 0; i < n; i++ {
+		sample := &models.DeviceTelemetry{DeviceID: "dev-1", RecordedAt: start.Add(time.Duration(i) * time.Minute), RSSI: -40 - i}
+		require.NoError(t, database.AddDeviceTelemetry(db, sample))
+	}
+}
+
+func TestListDeviceTelemetryKeepsNewest(t *testing.T) {
+	db := openTestDB(t)
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	addSamples(t, db, start, 5)
+
+	samples, err := database.ListDeviceTelemetry(db, "dev-1", start, start.Add(time.Hour), 3)
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	for i, sample := range samples {
+		assert.True(t, sample.RecordedAt.Equal(start.Add(time.Duration(i+2)*time.Minute)), "超过条数时保留最新的数据，按时间正序")
+	}
+}
+
+func TestCleanupUsesConfiguredRetention(t *testing.T) {
+	db := openTestDB(t)
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+
+	now := time.Now()
+	addSamples(t, db, now.AddDate(0, 0, -10), 1)
+	addSamples(t, db, now.AddDate(0, 0, -3), 1)
+	count := func() int64 {
+		var n int64
+		db.Model(&models.DeviceTelemetry{}).Count(&n)
+		return n
+	}
+
+	config := &configs.Config{}
+	m := NewMonitor(logger, config)
+	m.cleanup(now)
+	assert.Equal(t, int64(2), count(), "0表示不清理")
+
+	config.Telemetry.RetentionDays = 7
+	m.cleanup(now)
+	assert.Equal(t, int64(1), count())
+}
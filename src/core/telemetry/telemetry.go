@@ -0,0 +1,154 @@
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 设备健康数据。
+* 设备每次 OTA 检查上报的信号强度、剩余堆内存等数据按时间序列保存，超过 telemetry.retention_days 后清理。
+* 告警规则：
+*   low_heap  最小剩余堆内存低于阈值（字节）
+*   weak_rssi WiFi 信号强度低于阈值（dBm，如 -75）
+*   silent    设备超过阈值小时数没有连接或上报
+* 告警写入告警记录并发布到事件总线，可通过 Webhook 推送。
+ */
+
+// 告警规则类型
+const (
+	RuleLowHeap  = "low_heap"
+	RuleWeakRSSI = "weak_rssi"
+	RuleSilent   = "silent"
+)
+
+// 同一规则对同一设备重复告警的最小间隔（low_heap/weak_rssi）
+const AlertCooldown = 6 * time.Hour
+
+// RuleTypes 支持的告警规则类型
+var RuleTypes = []string{RuleLowHeap, RuleWeakRSSI, RuleSilent}
+
+// ValidateRule 校验告警规则
+func ValidateRule(rule *models.TelemetryAlertRule) error {
+	switch rule.Type {
+	case RuleLowHeap:
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("low_heap 阈值应为正数（字节）")
+		}
+	case RuleWeakRSSI:
+		if rule.Threshold >= 0 || rule.Threshold < -120 {
+			return fmt.Errorf("weak_rssi 阈值应在 -120 到 0 之间（dBm）")
+		}
+	case RuleSilent:
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("silent 阈值应为正数（小时）")
+		}
+	default:
+		return fmt.Errorf("不支持的告警类型: %s", rule.Type)
+	}
+	return nil
+}
+
+// Evaluate 用一条上报数据判断阈值类规则是否触发，返回触发时的数值与告警内容
+func Evaluate(rule *models.TelemetryAlertRule, sample *models.DeviceTelemetry) (int64, string, bool) {
+	switch rule.Type {
+	case RuleLowHeap:
+		if sample.MinFreeHeap > 0 && sample.MinFreeHeap < rule.Threshold {
+			return sample.MinFreeHeap, fmt.Sprintf("设备 %s 最小剩余堆内存 %d 字节，低于 %d", sample.DeviceID, sample.MinFreeHeap, rule.Threshold), true
+		}
+	case RuleWeakRSSI:
+		// RSSI 为0表示未上报
+		if sample.RSSI != 0 && int64(sample.RSSI) < rule.Threshold {
+			return int64(sample.RSSI), fmt.Sprintf("设备 %s WiFi 信号 %d dBm，低于 %d", sample.DeviceID, sample.RSSI, rule.Threshold), true
+		}
+	}
+	return 0, "", false
+}
+
+// EvaluateSilent 判断设备是否超过阈值小时数没有活动，lastSeen为零值时不判断
+func EvaluateSilent(rule *models.TelemetryAlertRule, deviceID string, lastSeen, now time.Time) (int64, string, bool) {
+	if rule.Type != RuleSilent || lastSeen.IsZero() {
+		return 0, "", false
+	}
+	silent := now.Sub(lastSeen)
+	if silent < time.Duration(rule.Threshold)*time.Hour {
+		return 0, "", false
+	}
+	hours := int64(silent.Hours())
+	return hours, fmt.Sprintf("设备 %s 已 %d 小时没有连接，最后活跃于 %s", deviceID, hours, lastSeen.Format("2006-01-02 15:04")), true
+}
+
+// Stats 数值统计
+type Stats struct {
+	Min  int64   `json:"min"`
+	Max  int64   `json:"max"`
+	Avg  float64 `json:"avg"`
+	Last int64   `json:"last"`
+}
+
+// Summary 一段时间内上报数据的汇总
+type Summary struct {
+	Count       int       `json:"count"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	RSSI        *Stats    `json:"rssi,omitempty"`
+	MinFreeHeap *Stats    `json:"min_free_heap,omitempty"`
+	Versions    []string  `json:"versions"` // 期间出现过的应用版本，按出现顺序
+}
+
+type statsBuilder struct {
+	count int
+	sum   int64
+	stats Stats
+}
+
+func (b *statsBuilder) add(v int64) {
+	if b.count == 0 || v < b.stats.Min {
+		b.stats.Min = v
+	}
+	if b.count == 0 || v > b.stats.Max {
+		b.stats.Max = v
+	}
+	b.count++
+	b.sum += v
+	b.stats.Last = v
+}
+
+func (b *statsBuilder) result() *Stats {
+	if b.count == 0 {
+		return nil
+	}
+	b.stats.Avg = math.Round(float64(b.sum)/float64(b.count)*100) / 100
+	return &b.stats
+}
+
+// Summarize 汇总按时间正序排列的上报数据，未上报的数值（0）不参与统计
+func Summarize(samples []models.DeviceTelemetry) Summary {
+	summary := Summary{Count: len(samples), Versions: make([]string, 0)}
+	if len(samples) == 0 {
+		return summary
+	}
+	summary.First = samples[0].RecordedAt
+	summary.Last = samples[len(samples)-1].RecordedAt
+
+	var rssi, heap statsBuilder
+	seen := make(map[string]bool)
+	for i := range samples {
+		s := &samples[i]
+		if s.RSSI != 0 {
+			rssi.add(int64(s.RSSI))
+		}
+		if s.MinFreeHeap > 0 {
+			heap.add(s.MinFreeHeap)
+		}
+		if s.AppVersion != "" && !seen[s.AppVersion] {
+			seen[s.AppVersion] = true
+			summary.Versions = append(summary.Versions, s.AppVersion)
+		}
+	}
+	summary.RSSI = rssi.result()
+	summary.MinFreeHeap = heap.result()
+	return summary
+}
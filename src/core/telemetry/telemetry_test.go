@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRule(t *testing.T) {
+	assert.NoError(t, ValidateRule(&models.TelemetryAlertRule{Type: RuleLowHeap, Threshold: 20000}))
+	assert.NoError(t, ValidateRule(&models.TelemetryAlertRule{Type: RuleWeakRSSI, Threshold: -75}))
+	assert.NoError(t, ValidateRule(&models.TelemetryAlertRule{Type: RuleSilent, Threshold: 24}))
+
+	assert.Error(t, ValidateRule(&models.TelemetryAlertRule{Type: RuleWeakRSSI, Threshold: 75}), "RSSI thresholds are negative")
+	assert.Error(t, ValidateRule(&models.TelemetryAlertRule{Type: RuleSilent}))
+	assert.Error(t, ValidateRule(&models.TelemetryAlertRule{Type: "battery", Threshold: 1}))
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	heap := &models.TelemetryAlertRule{Type: RuleLowHeap, Threshold: 20000}
+	rssi := &models.TelemetryAlertRule{Type: RuleWeakRSSI, Threshold: -75}
+
+	value, msg, ok := Evaluate(heap, &models.DeviceTelemetry{DeviceID: "d1", MinFreeHeap: 15000})
+	assert.True(t, ok)
+	assert.Equal(t, int64(15000), value)
+	assert.Contains(t, msg, "d1")
+
+	_, _, ok = Evaluate(heap, &models.DeviceTelemetry{MinFreeHeap: 0})
+	assert.False(t, ok, "Missing heap data should not alert")
+
+	_, _, ok = Evaluate(rssi, &models.DeviceTelemetry{RSSI: -82})
+	assert.True(t, ok)
+	_, _, ok = Evaluate(rssi, &models.DeviceTelemetry{RSSI: -60})
+	assert.False(t, ok)
+	_, _, ok = Evaluate(rssi, &models.DeviceTelemetry{RSSI: 0})
+	assert.False(t, ok, "Missing RSSI should not alert")
+}
+
+func TestEvaluateSilent(t *testing.T) {
+	rule := &models.TelemetryAlertRule{Type: RuleSilent, Threshold: 12}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+
+	hours, _, ok := EvaluateSilent(rule, "d1", now.Add(-13*time.Hour), now)
+	assert.True(t, ok)
+	assert.Equal(t, int64(13), hours)
+
+	_, _, ok = EvaluateSilent(rule, "d1", now.Add(-2*time.Hour), now)
+	assert.False(t, ok)
+	_, _, ok = EvaluateSilent(rule, "d1", time.Time{}, now)
+	assert.False(t, ok, "Devices never seen should not alert")
+}
+
+func TestSummarize(t *testing.T) {
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	samples := []models.DeviceTelemetry{
+		{RecordedAt: base, RSSI: -50, MinFreeHeap: 30000, AppVersion: "1.6.0"},
+		{RecordedAt: base.Add(time.Hour), RSSI: -70, AppVersion: "1.6.0"},
+		{RecordedAt: base.Add(2 * time.Hour), RSSI: -60, MinFreeHeap: 20000, AppVersion: "1.7.0"},
+	}
+
+	s := Summarize(samples)
+	assert.Equal(t, 3, s.Count)
+	assert.Equal(t, base, s.First)
+	assert.Equal(t, base.Add(2*time.Hour), s.Last)
+	require.NotNil(t, s.RSSI)
+	assert.Equal(t, int64(-70), s.RSSI.Min)
+	assert.Equal(t, int64(-50), s.RSSI.Max)
+	assert.Equal(t, float64(-60), s.RSSI.Avg)
+	assert.Equal(t, int64(-60), s.RSSI.Last)
+	require.NotNil(t, s.MinFreeHeap)
+	assert.Equal(t, float64(25000), s.MinFreeHeap.Avg, "Samples without heap data are skipped")
+	assert.Equal(t, []string{"1.6.0", "1.7.0"}, s.Versions)
+
+	empty := Summarize(nil)
+	assert.Zero(t, empty.Count)
+	assert.Nil(t, empty.RSSI)
+}
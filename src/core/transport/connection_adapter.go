@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core"
@@ -17,12 +18,14 @@ type ConnectionContextAdapter struct {
 	handler     *core.ConnectionHandler
 	providerSet *pool.ProviderSet
 	poolManager *pool.PoolManager
+	resumer     *SessionResumer
 	clientID    string
 	logger      *utils.Logger
 	conn        Connection
 	ctx         context.Context
 	cancel      context.CancelFunc
 	closed      int32 // 原子操作标志，0=活跃，1=已关闭
+	releaseOnce sync.Once
 }
 
 // NewConnectionContextAdapter 创建新的连接上下文适配器
@@ -77,24 +80,40 @@ func (a *ConnectionContextAdapter) Close() {
 	// 取消上下文，通知所有相关操作停止
 	a.cancel()
 
-	// 先关闭连接处理器
-	if a.handler != nil {
-		a.handler.Close()
+	// 客户端异常断开时暂存会话，等待宽限期内重连
+	if a.handler != nil && a.resumer.Enabled() && a.handler.Resumable() {
+		state := a.handler.Park()
+		if a.conn != nil {
+			a.conn.Close()
+		}
+		a.resumer.Park(a, state)
+		return
 	}
+	a.release()
+}
 
-	// 关闭连接
-	if a.conn != nil {
-		a.conn.Close()
-	}
+// release 关闭连接处理器并归还资源到池中，暂存的会话超时后也通过这里释放
+func (a *ConnectionContextAdapter) release() {
+	a.releaseOnce.Do(func() {
+		// 先关闭连接处理器
+		if a.handler != nil {
+			a.handler.Close()
+		}
 
-	// 归还资源到池中
-	if a.providerSet != nil && a.poolManager != nil {
-		if err := a.poolManager.ReturnProviderSet(a.providerSet); err != nil {
-			a.logger.Error("客户端 %s 归还资源失败: %v", a.clientID, err)
-		} else {
-			a.logger.Info("客户端 %s 资源已成功归还到池中", a.clientID)
+		// 关闭连接
+		if a.conn != nil {
+			a.conn.Close()
 		}
-	}
+
+		// 归还资源到池中
+		if a.providerSet != nil && a.poolManager != nil {
+			if err := a.poolManager.ReturnProviderSet(a.providerSet); err != nil {
+				a.logger.Error("客户端 %s 归还资源失败: %v", a.clientID, err)
+			} else {
+				a.logger.Info("客户端 %s 资源已成功归还到池中", a.clientID)
+			}
+		}
+	})
 }
 
 // GetSessionID 实现ConnectionHandler接口的GetSessionID方法
@@ -147,6 +166,7 @@ func (a *ConnectionContextAdapter) CreateSafeCallback() func(func(*core.Connecti
 type DefaultConnectionHandlerFactory struct {
 	config      *configs.Config
 	poolManager *pool.PoolManager
+	resumer     *SessionResumer
 	taskMgr     *task.TaskManager
 	logger      *utils.Logger
 }
@@ -161,16 +181,40 @@ func NewDefaultConnectionHandlerFactory(
 	return &DefaultConnectionHandlerFactory{
 		config:      config,
 		poolManager: poolManager,
+		resumer:     NewSessionResumer(config, logger),
 		taskMgr:     taskMgr,
 		logger:      logger,
 	}
 }
 
+// ReleaseParkedSessions 释放全部等待重连的会话，服务关闭时调用
+func (f *DefaultConnectionHandlerFactory) ReleaseParkedSessions() {
+	f.resumer.ReleaseAll()
+}
+
 // CreateHandler 实现ConnectionHandlerFactory接口
 func (f *DefaultConnectionHandlerFactory) CreateHandler(
 	conn Connection,
 	req *http.Request,
 ) ConnectionHandler {
+	// 宽限期内重连的设备恢复暂存的会话，沿用原来的提供者集合
+	if f.resumer.Enabled() {
+		if parked, state := f.resumer.Take(req.Header.Get("Session-Id"), req.Header.Get("Device-Id")); parked != nil {
+			adapter := NewConnectionContextAdapter(
+				conn,
+				f.config,
+				parked.providerSet,
+				f.poolManager,
+				f.taskMgr,
+				f.logger,
+				req,
+			)
+			adapter.resumer = f.resumer
+			adapter.handler.Resume(state, f.resumer.replayTTS)
+			return adapter
+		}
+	}
+
 	// 从资源池获取提供者集合
 	providerSet, err := f.poolManager.GetProviderSet()
 	if err != nil {
@@ -200,6 +244,7 @@ func (f *DefaultConnectionHandlerFactory) CreateHandler(
 		f.logger,
 		req,
 	)
+	adapter.resumer = f.resumer
 
 	return adapter
 }
@@ -39,6 +39,12 @@ type ConnectionHandlerFactory interface {
 	CreateHandler(conn Connection, req *http.Request) ConnectionHandler
 }
 
+// SessionProvider 可以枚举在线会话的传输层
+type SessionProvider interface {
+	// 获取所有活跃连接的处理器
+	GetConnectionHandlers() []*core.ConnectionHandler
+}
+
 type MCPManagerHolder interface {
 	GetMCPManager() *mcp.Manager
 	SetMCPManager(*mcp.Manager)
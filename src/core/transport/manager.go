@@ -6,6 +6,7 @@ import (
 	"time"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -66,13 +67,13 @@ func (m *TransportManager) StartTicker(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				clientCnt := 0
 				sessionCnt := 0
 				for _, transport := range m.transports {
-					c, s := transport.GetActiveConnectionCount()
-					clientCnt += c
+					_, s := transport.GetActiveConnectionCount()
 					sessionCnt += s
 				}
+				// 在线设备数按设备去重，同一设备的多条连接只计一次
+				clientCnt := m.countOnlineDevices()
 				//m.logger.Info("当前活跃连接数: %d, 当前活跃会话数: %d", clientCnt, sessionCnt)
 				systemMemoryUse, _ := utils.GetSystemMemoryUsage()
 				systemCPUUse, _ := utils.GetSystemCPUUsage()
@@ -82,6 +83,18 @@ func (m *TransportManager) StartTicker(ctx context.Context) {
 	}()
 }
 
+// countOnlineDevices 统计在线设备数
+func (m *TransportManager) countOnlineDevices() int {
+	devices := make(map[string]struct{})
+	for _, handler := range m.GetConnectionHandlers() {
+		if handler.IsClosed() || handler.GetDeviceID() == "" {
+			continue
+		}
+		devices[handler.GetDeviceID()] = struct{}{}
+	}
+	return len(devices)
+}
+
 // StopAll 停止所有传输层
 func (m *TransportManager) StopAll() error {
 	m.mu.RLock()
@@ -103,3 +116,27 @@ func (m *TransportManager) GetTransport(name string) Transport {
 	defer m.mu.RUnlock()
 	return m.transports[name]
 }
+
+// GetConnectionHandlers 获取所有传输层的在线会话
+func (m *TransportManager) GetConnectionHandlers() []*core.ConnectionHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	handlers := make([]*core.ConnectionHandler, 0)
+	for _, transport := range m.transports {
+		if provider, ok := transport.(SessionProvider); ok {
+			handlers = append(handlers, provider.GetConnectionHandlers()...)
+		}
+	}
+	return handlers
+}
+
+// FindConnectionHandler 根据设备ID查找未关闭的在线会话，找不到时返回nil
+func (m *TransportManager) FindConnectionHandler(deviceID string) *core.ConnectionHandler {
+	for _, handler := range m.GetConnectionHandlers() {
+		if handler.GetDeviceID() == deviceID && !handler.IsClosed() {
+			return handler
+		}
+	}
+	return nil
+}
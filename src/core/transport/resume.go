@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// parkedSession 断线后暂存的会话
+type parkedSession struct {
+	adapter *ConnectionContextAdapter
+	state   *core.ResumeState
+	timer   *time.Timer
+}
+
+// SessionResumer 暂存异常断开的会话，宽限期内同一会话ID或设备重连时交给新连接恢复，超时后释放资源
+type SessionResumer struct {
+	grace     time.Duration
+	replayTTS bool
+	logger    *utils.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*parkedSession // 会话ID与设备ID都指向同一条暂存会话
+}
+
+// NewSessionResumer 根据配置创建会话恢复管理器
+func NewSessionResumer(config *configs.Config, logger *utils.Logger) *SessionResumer {
+	return &SessionResumer{
+		grace:     time.Duration(config.SessionResume.GraceSeconds) * time.Second,
+		replayTTS: config.SessionResume.PendingTTS == core.ResumeTTSReplay,
+		logger:    logger,
+		sessions:  make(map[string]*parkedSession),
+	}
+}
+
+// Enabled 是否启用会话恢复
+func (r *SessionResumer) Enabled() bool {
+	return r != nil && r.grace > 0
+}
+
+func sessionKey(sessionID string) string { return "session:" + sessionID }
+func deviceKey(deviceID string) string   { return "device:" + deviceID }
+
+// Park 暂存断开的会话，同一设备之前暂存的会话直接释放
+func (r *SessionResumer) Park(adapter *ConnectionContextAdapter, state *core.ResumeState) {
+	p := &parkedSession{adapter: adapter, state: state}
+
+	r.mu.Lock()
+	old := r.sessions[deviceKey(state.DeviceID)]
+	if old != nil {
+		r.removeLocked(old)
+		if !old.timer.Stop() {
+			old = nil // 已到期，由到期回调释放
+		}
+	}
+	r.sessions[deviceKey(state.DeviceID)] = p
+	if state.SessionID != "" {
+		r.sessions[sessionKey(state.SessionID)] = p
+	}
+	p.timer = time.AfterFunc(r.grace, func() { r.expire(p) })
+	r.mu.Unlock()
+
+	if old != nil {
+		old.adapter.release()
+	}
+	r.logger.Info("[会话恢复] [暂存] 设备 %s 会话 %s，%s 内重连可恢复", state.DeviceID, state.SessionID, r.grace)
+}
+
+// Take 取出可恢复的会话：优先匹配会话ID，其次匹配设备ID，会话ID匹配但设备不同时不恢复
+func (r *SessionResumer) Take(sessionID, deviceID string) (*ConnectionContextAdapter, *core.ResumeState) {
+	if r == nil {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var p *parkedSession
+	if sessionID != "" {
+		p = r.sessions[sessionKey(sessionID)]
+	}
+	if p == nil && deviceID != "" {
+		p = r.sessions[deviceKey(deviceID)]
+	}
+	if p == nil || p.state.DeviceID != deviceID {
+		return nil, nil
+	}
+	if !p.timer.Stop() {
+		// 已到期，正在释放
+		return nil, nil
+	}
+	r.removeLocked(p)
+	return p.adapter, p.state
+}
+
+// expire 宽限期结束仍未重连，释放会话
+func (r *SessionResumer) expire(p *parkedSession) {
+	r.mu.Lock()
+	r.removeLocked(p)
+	r.mu.Unlock()
+
+	r.logger.Info("[会话恢复] [超时] 设备 %s 会话 %s 未在 %s 内重连，释放资源", p.state.DeviceID, p.state.SessionID, r.grace)
+	p.adapter.release()
+}
+
+// removeLocked 删除暂存会话的索引，调用方需持有锁
+func (r *SessionResumer) removeLocked(p *parkedSession) {
+	for _, key := range []string{deviceKey(p.state.DeviceID), sessionKey(p.state.SessionID)} {
+		if r.sessions[key] == p {
+			delete(r.sessions, key)
+		}
+	}
+}
+
+// ReleaseAll 释放全部暂存会话，服务关闭时调用
+func (r *SessionResumer) ReleaseAll() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	parked := make([]*parkedSession, 0)
+	for key, p := range r.sessions {
+		delete(r.sessions, key)
+		if p.timer.Stop() {
+			parked = append(parked, p)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, p := range parked {
+		p.adapter.release()
+	}
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+func newTestResumer(t *testing.T, grace time.Duration) *SessionResumer {
+	config := &configs.Config{}
+	config.SessionResume.GraceSeconds = 1
+	r := NewSessionResumer(config, newTestLogger(t))
+	r.grace = grace
+	return r
+}
+
+func TestSessionResumerTake(t *testing.T) {
+	r := newTestResumer(t, time.Minute)
+	adapter := &ConnectionContextAdapter{}
+	r.Park(adapter, &core.ResumeState{SessionID: "s1", DeviceID: "d1"})
+
+	got, _ := r.Take("s1", "d2")
+	assert.Nil(t, got, "Session IDs must not be taken over by another device")
+
+	got, state := r.Take("other", "d1")
+	assert.Same(t, adapter, got, "Falls back to the device ID")
+	assert.Equal(t, "s1", state.SessionID)
+
+	got, _ = r.Take("s1", "d1")
+	assert.Nil(t, got, "A session can only be resumed once")
+}
+
+func TestSessionResumerReplacesOlderSession(t *testing.T) {
+	r := newTestResumer(t, time.Minute)
+	first := &ConnectionContextAdapter{}
+	second := &ConnectionContextAdapter{}
+	r.Park(first, &core.ResumeState{SessionID: "s1", DeviceID: "d1"})
+	r.Park(second, &core.ResumeState{SessionID: "s2", DeviceID: "d1"})
+
+	got, _ := r.Take("s1", "d1")
+	assert.Same(t, second, got, "Only the latest session of a device is kept")
+}
+
+func TestSessionResumerExpire(t *testing.T) {
+	r := newTestResumer(t, 20*time.Millisecond)
+	r.Park(&ConnectionContextAdapter{}, &core.ResumeState{SessionID: "s1", DeviceID: "d1"})
+
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+	got, _ := r.Take("s1", "d1")
+	assert.Nil(t, got)
+}
+
+func TestSessionResumerDisabled(t *testing.T) {
+	assert.False(t, NewSessionResumer(&configs.Config{}, newTestLogger(t)).Enabled())
+	var r *SessionResumer
+	assert.False(t, r.Enabled())
+	got, _ := r.Take("s1", "d1")
+	assert.Nil(t, got)
+}
@@ -0,0 +1,327 @@
+package websocket
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/task"
+
+	_ "xiaozhi-server-go/src/core/providers/asr/mock"
+	_ "xiaozhi-server-go/src/core/providers/llm/mock"
+	_ "xiaozhi-server-go/src/core/providers/tts/mock"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	deviceSampleRate = 16000
+	frameDuration    = 60 // 上下行音频帧时长（毫秒）
+	asrMinChunks     = 3
+	messageTimeout   = 5 * time.Second
+)
+
+// newTestConfig 全部使用 mock 提供者的配置
+func newTestConfig(t *testing.T, port int) *configs.Config {
+	config := &configs.Config{}
+	config.Transport.WebSocket.IP = "127.0.0.1"
+	config.Transport.WebSocket.Port = port
+	config.DeleteAudio = true
+	config.SelectedModule = map[string]string{"ASR": "MockASR", "LLM": "MockLLM", "TTS": "MockTTS"}
+	config.PoolConfig = configs.PoolConfig{PoolMinSize: 1, PoolMaxSize: 2, PoolRefillSize: 1}
+	config.McpPoolConfig = configs.McpPoolConfig{PoolMinSize: 1, PoolMaxSize: 2, PoolRefillSize: 1, PoolCheckInterval: 30}
+	config.LocalMCPFun = []configs.LocalMCPFun{{Name: "time", Enabled: true}}
+	config.ASR = map[string]configs.ASRConfig{
+		"MockASR": {
+			"type":        "mock",
+			"min_chunks":  asrMinChunks,
+			"transcripts": []interface{}{"你好", "现在几点了"},
+		},
+	}
+	config.LLM = map[string]configs.LLMConfig{
+		"MockLLM": {
+			Type: "mock",
+			Extra: map[string]interface{}{
+				"responses": []interface{}{
+					"你好，我是测试助手。",
+					map[string]interface{}{
+						"tool_call": map[string]interface{}{"name": "local_get_time", "arguments": map[string]interface{}{}},
+					},
+					"时间已经查到了。",
+				},
+			},
+		},
+	}
+	config.TTS = map[string]configs.TTSConfig{
+		"MockTTS": {Type: "mock", OutputDir: t.TempDir()},
+	}
+	return config
+}
+
+// freePort 取一个空闲的本地端口
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startServer 在进程内启动 WebSocket 传输层，返回服务地址
+func startServer(t *testing.T) string {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	config := newTestConfig(t, freePort(t))
+
+	// 连接处理器从数据库读取提供者与智能体配置，使用临时数据库
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	database.SetLogger(logger)
+
+	poolManager, err := pool.NewPoolManager(config, logger)
+	require.NoError(t, err)
+	taskMgr := task.NewTaskManager(task.ResourceConfig{MaxWorkers: 2, MaxTasksPerClient: 5})
+	taskMgr.Start()
+
+	ws := NewWebSocketTransport(config, logger)
+	ws.SetConnectionHandler(transport.NewDefaultConnectionHandlerFactory(config, poolManager, taskMgr, logger))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, ws.Start(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		taskMgr.Stop()
+		poolManager.Close()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+		logger.Close()
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", config.Transport.WebSocket.Port)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, messageTimeout, 10*time.Millisecond, "WebSocket服务没有启动")
+	return "ws://" + addr + "/"
+}
+
+// deviceEvent 设备收到的一条消息，文本消息解析为 msg，音频帧放在 audio
+type deviceEvent struct {
+	msg   map[string]interface{}
+	audio []byte
+}
+
+// fakeDevice 模拟设备端，按协议发送 hello/listen/音频，记录服务端下发的消息
+type fakeDevice struct {
+	conn   *websocket.Conn
+	events chan deviceEvent
+}
+
+func dialDevice(t *testing.T, url string) *fakeDevice {
+	header := http.Header{}
+	header.Set("Client-Id", "test-client")
+	header.Set("Protocol-Version", "1")
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	require.NoError(t, err)
+
+	d := &fakeDevice{conn: conn, events: make(chan deviceEvent, 1024)}
+	go func() {
+		defer close(d.events)
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				d.events <- deviceEvent{audio: data}
+				continue
+			}
+			var msg map[string]interface{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			d.events <- deviceEvent{msg: msg}
+		}
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return d
+}
+
+func (d *fakeDevice) sendJSON(t *testing.T, msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	require.NoError(t, d.conn.WriteMessage(websocket.TextMessage, data))
+}
+
+// speak 开始拾音并上传一段Opus音频，mock ASR 收到 asrMinChunks 帧后给出识别结果
+func (d *fakeDevice) speak(t *testing.T) {
+	d.sendJSON(t, map[string]interface{}{"type": "listen", "state": "start", "mode": "auto"})
+	frames, err := utils.PCMSlicesToOpusData([][]byte{sinePCM(asrMinChunks * frameDuration)}, deviceSampleRate, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, frames, asrMinChunks)
+	for _, frame := range frames {
+		require.NoError(t, d.conn.WriteMessage(websocket.BinaryMessage, frame))
+		time.Sleep(frameDuration * time.Millisecond)
+	}
+}
+
+// next 返回下一条文本消息，以及在它之前收到的音频帧；设备端 MCP 消息被忽略
+func (d *fakeDevice) next(t *testing.T) (map[string]interface{}, [][]byte) {
+	var frames [][]byte
+	timeout := time.After(messageTimeout)
+	for {
+		select {
+		case ev, ok := <-d.events:
+			require.True(t, ok, "连接被服务端关闭")
+			if ev.msg == nil {
+				frames = append(frames, ev.audio)
+				continue
+			}
+			if ev.msg["type"] == "mcp" {
+				continue
+			}
+			return ev.msg, frames
+		case <-timeout:
+			t.Fatal("等待服务端消息超时")
+			return nil, nil
+		}
+	}
+}
+
+// expect 读取下一条文本消息并检查类型与状态，之前不应收到音频
+func (d *fakeDevice) expect(t *testing.T, msgType, state string) map[string]interface{} {
+	msg, frames := d.next(t)
+	require.Equal(t, msgType, msg["type"], "消息: %v", msg)
+	if state != "" {
+		require.Equal(t, state, msg["state"], "消息: %v", msg)
+	}
+	require.Empty(t, frames, "%s 之前不应收到音频", msgType)
+	return msg
+}
+
+// sentence 一句回复：sentence_start 与 sentence_end 之间收到的音频帧
+type sentence struct {
+	text   string
+	frames [][]byte
+}
+
+// reply 读取一轮回复直到 tts stop，检查每句的消息顺序并返回各句内容
+func (d *fakeDevice) reply(t *testing.T) []sentence {
+	var sentences []sentence
+	for {
+		msg, frames := d.next(t)
+		require.Empty(t, frames, "句子之外不应收到音频")
+		if msg["type"] == "llm" {
+			continue // 回复中的情绪消息
+		}
+		require.Equal(t, "tts", msg["type"], "消息: %v", msg)
+		switch msg["state"] {
+		case "stop":
+			return sentences
+		case "sentence_start":
+			text := msg["text"].(string)
+			end, frames := d.next(t)
+			require.Equal(t, "tts", end["type"], "消息: %v", end)
+			require.Equal(t, "sentence_end", end["state"])
+			require.Equal(t, text, end["text"])
+			sentences = append(sentences, sentence{text: text, frames: frames})
+		default:
+			t.Fatalf("未预期的 tts 消息: %v", msg)
+		}
+	}
+}
+
+// sinePCM 生成设备端上传的16kHz正弦波PCM数据
+func sinePCM(ms int) []byte {
+	samples := deviceSampleRate * ms / 1000
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		v := 0.3 * math.Sin(2*math.Pi*440*float64(i)/deviceSampleRate)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+// expectedFrames mock TTS 为一句话生成的音频帧数
+func expectedFrames(text string) int {
+	ms := utf8.RuneCountInString(text) * 40
+	if ms < 120 {
+		ms = 120
+	}
+	if ms > 2000 {
+		ms = 2000
+	}
+	return (ms + frameDuration - 1) / frameDuration
+}
+
+func assertSentences(t *testing.T, sentences []sentence, want string) {
+	require.NotEmpty(t, sentences)
+	texts := make([]string, 0, len(sentences))
+	for _, s := range sentences {
+		texts = append(texts, s.text)
+		assert.Len(t, s.frames, expectedFrames(s.text), "句子: %s", s.text)
+		for _, frame := range s.frames {
+			assert.NotEmpty(t, frame)
+		}
+	}
+	assert.Equal(t, want, strings.Join(texts, ""))
+}
+
+func TestWebSocketConversation(t *testing.T) {
+	device := dialDevice(t, startServer(t))
+
+	device.sendJSON(t, map[string]interface{}{
+		"type":      "hello",
+		"version":   1,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format": "opus", "sample_rate": deviceSampleRate, "channels": 1, "frame_duration": frameDuration,
+		},
+	})
+	hello := device.expect(t, "hello", "")
+	assert.NotEmpty(t, hello["session_id"])
+	audioParams := hello["audio_params"].(map[string]interface{})
+	assert.Equal(t, "opus", audioParams["format"])
+	assert.EqualValues(t, frameDuration, audioParams["frame_duration"])
+
+	// 第一轮：普通对话
+	device.speak(t)
+	stt := device.expect(t, "stt", "")
+	assert.Equal(t, "你好", stt["text"])
+	device.expect(t, "tts", "start")
+	emotion := device.expect(t, "llm", "")
+	assert.Equal(t, "thinking", emotion["emotion"])
+	assertSentences(t, device.reply(t), "你好，我是测试助手。")
+
+	// 第二轮：LLM调用 local_get_time 工具后根据工具结果再次回复
+	device.speak(t)
+	stt = device.expect(t, "stt", "")
+	assert.Equal(t, "现在几点了", stt["text"])
+	device.expect(t, "tts", "start")
+	device.expect(t, "llm", "")
+	assertSentences(t, device.reply(t), "时间已经查到了。")
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"sync"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core"
 	"xiaozhi-server-go/src/core/transport"
 	"xiaozhi-server-go/src/core/utils"
 
@@ -96,6 +97,18 @@ func (t *WebSocketTransport) GetActiveConnectionCount() (int, int) {
 	return count, count
 }
 
+// GetConnectionHandlers 获取所有活跃连接的处理器
+func (t *WebSocketTransport) GetConnectionHandlers() []*core.ConnectionHandler {
+	handlers := make([]*core.ConnectionHandler, 0)
+	t.activeConnections.Range(func(key, value interface{}) bool {
+		if adapter, ok := value.(*transport.ConnectionContextAdapter); ok && adapter.IsActive() {
+			handlers = append(handlers, adapter.GetConnectionHandler())
+		}
+		return true
+	})
+	return handlers
+}
+
 // GetType 获取传输类型
 func (t *WebSocketTransport) GetType() string {
 	return "websocket"
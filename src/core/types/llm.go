@@ -102,6 +102,30 @@ type Response struct {
 	ToolCalls            []ToolCall `json:"tool_calls,omitempty"`
 	StopReason           string     `json:"stop_reason,omitempty"`
 	Error                string     `json:"error,omitempty"`
+	Usage                *Usage     `json:"usage,omitempty"` // 流式响应结束时返回的Token用量
+}
+
+// Usage 一次LLM请求的Token用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// NewUsage 从OpenAI兼容接口返回的用量创建Usage
+func NewUsage(u *openai.Usage) *Usage {
+	if u == nil {
+		return nil
+	}
+	usage := &Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
 }
 
 // Provider 基础提供者接口
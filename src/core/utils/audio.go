@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -222,9 +224,7 @@ func SaveAudioToWavFile(
 		}
 	}
 
-	// 打开现有文件进行追加
-	file, err = os.OpenFile(fileName, os.O_WRONLY, 0o644)
-	// 写入音频数据
+	// 写入音频数据：追加模式已定位到文件末尾，覆写模式位于文件头之后
 	_, err = file.Write(data)
 	if err != nil {
 		return "", fmt.Errorf("写入数据失败: %v", err)
@@ -340,14 +340,60 @@ func ReadPCMDataFromWavFile(filePath string) ([]byte, error) {
 	return pcmData, nil
 }
 
+// ParseWavData 解析WAV文件内容，返回PCM数据、采样率和声道数，只支持16位PCM
+func ParseWavData(data []byte) ([]byte, int, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, 0, fmt.Errorf("不是有效的WAV文件")
+	}
+	var sampleRate, channels int
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		switch id {
+		case "fmt ":
+			if size < 16 || len(body) < 16 {
+				return nil, 0, 0, fmt.Errorf("WAV格式块不完整")
+			}
+			if format := binary.LittleEndian.Uint16(body[0:2]); format != 1 {
+				return nil, 0, 0, fmt.Errorf("不支持的WAV编码格式: %d", format)
+			}
+			if bits := binary.LittleEndian.Uint16(body[14:16]); bits != 16 {
+				return nil, 0, 0, fmt.Errorf("不支持的WAV位深度: %d", bits)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+		case "data":
+			if sampleRate == 0 || channels == 0 {
+				return nil, 0, 0, fmt.Errorf("WAV缺少格式块")
+			}
+			// 流式写入的WAV数据大小可能未回填，以实际长度为准
+			if size > len(body) || size == 0 {
+				size = len(body)
+			}
+			return body[:size], sampleRate, channels, nil
+		}
+		pos += 8 + size + size%2 // 块按偶数字节对齐
+	}
+	return nil, 0, 0, fmt.Errorf("WAV缺少数据块")
+}
+
 func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
 	file, err := os.Open(audioFile)
 	if err != nil {
 		return nil, 0, fmt.Errorf("打开音频文件失败: %v", err)
 	}
 	defer file.Close()
+	return mp3ToPCMData(file)
+}
 
-	decoder, err := mp3.NewDecoder(file)
+// MP3DataToPCMData 将内存中的MP3数据转换为24kHz单声道PCM
+func MP3DataToPCMData(data []byte) ([][]byte, float64, error) {
+	return mp3ToPCMData(bytes.NewReader(data))
+}
+
+func mp3ToPCMData(r io.Reader) ([][]byte, float64, error) {
+	decoder, err := mp3.NewDecoder(r)
 	if err != nil {
 		return nil, 0, fmt.Errorf("创建MP3解码器失败: %v", err)
 	}
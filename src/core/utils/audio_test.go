@@ -262,6 +262,57 @@ func TestResamplePCM_SingleSample(t *testing.T) {
 	assert.GreaterOrEqual(t, len(result), 1)
 }
 
+func TestSaveAudioToWavFile_RoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.wav")
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	_, err := SaveAudioToWavFile(data, fileName, 16000, 1, 16, false)
+	require.NoError(t, err)
+	pcm, err := ReadPCMDataFromWavFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, data, pcm)
+
+	// 追加写入
+	_, err = SaveAudioToWavFile([]byte{9, 10}, fileName, 16000, 1, 16, true)
+	require.NoError(t, err)
+	pcm, err = ReadPCMDataFromWavFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, append(data, 9, 10), pcm)
+
+	// 覆写已存在的文件
+	_, err = SaveAudioToWavFile([]byte{11, 12}, fileName, 16000, 1, 16, false)
+	require.NoError(t, err)
+	pcm, err = ReadPCMDataFromWavFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{11, 12}, pcm)
+}
+
+func TestParseWavData(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.wav")
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	_, err := SaveAudioToWavFile(data, fileName, 16000, 2, 16, false)
+	require.NoError(t, err)
+	wav, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+
+	pcm, sampleRate, channels, err := ParseWavData(wav)
+	require.NoError(t, err)
+	assert.Equal(t, data, pcm)
+	assert.Equal(t, 16000, sampleRate)
+	assert.Equal(t, 2, channels)
+
+	// 格式块与数据块之间有其他块时跳过
+	list := append([]byte("LIST\x03\x00\x00\x00abc\x00"), wav[36:]...)
+	withList := append(append([]byte{}, wav[:36]...), list...)
+	pcm, sampleRate, _, err = ParseWavData(withList)
+	require.NoError(t, err)
+	assert.Equal(t, data, pcm)
+	assert.Equal(t, 16000, sampleRate)
+
+	_, _, _, err = ParseWavData([]byte("not a wav file"))
+	assert.Error(t, err)
+}
+
 func TestReadPCMDataFromWavFile_NotExist(t *testing.T) {
 	result, err := ReadPCMDataFromWavFile("/not/exist/file.wav")
 
@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,3 +26,85 @@ func MinDuration(a, b time.Duration) time.Duration {
 	}
 	return b
 }
+
+// trustedProxies 受信任的反向代理网段，由 SetTrustedProxies 设置
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []*net.IPNet
+)
+
+// SetTrustedProxies 设置受信任的反向代理，支持单个IP或CIDR网段，为空表示不信任任何代理头部
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("无效的代理地址: %s", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("无效的代理网段: %s", p)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxiesMu.Lock()
+	trustedProxies = nets
+	trustedProxiesMu.Unlock()
+	return nil
+}
+
+// isTrustedProxy 判断地址是否为受信任的反向代理
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClientIP 获取请求的客户端IP。只有连接来自受信任的反向代理时才使用代理设置的头部，
+// X-Forwarded-For 从右向左取第一个非受信任代理的地址，避免客户端自行伪造
+func GetClientIP(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	if ip := strings.TrimSpace(req.Header.Get("X-Real-Ip")); ip != "" {
+		return ip
+	}
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if ip != "" && (i == 0 || !isTrustedProxy(ip)) {
+				return ip
+			}
+		}
+	}
+	return host
+}
@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetProjectDir(t *testing.T) {
@@ -64,3 +66,45 @@ func TestMinDuration_NegativeDurations(t *testing.T) {
 
 	assert.Equal(t, b, result, "Should return the more negative duration")
 }
+
+func TestGetClientIP_RemoteAddr(t *testing.T) {
+	req := httptest.NewRequest("GET", "/xiaozhi/v1/", nil)
+	req.RemoteAddr = "192.168.1.10:52314"
+
+	assert.Equal(t, "192.168.1.10", GetClientIP(req), "Should strip the port")
+}
+
+func TestGetClientIP_ProxyHeaders(t *testing.T) {
+	require.NoError(t, SetTrustedProxies([]string{"127.0.0.1", "172.16.0.0/12"}))
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	req := httptest.NewRequest("GET", "/xiaozhi/v1/", nil)
+	req.RemoteAddr = "127.0.0.1:8000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.8, 172.16.0.1")
+
+	assert.Equal(t, "10.0.0.8", GetClientIP(req), "Should skip trusted proxies from the right")
+
+	req.Header.Set("X-Real-IP", "10.0.0.9")
+	assert.Equal(t, "10.0.0.9", GetClientIP(req), "X-Real-IP takes precedence")
+}
+
+func TestGetClientIP_UntrustedPeer(t *testing.T) {
+	require.NoError(t, SetTrustedProxies([]string{"127.0.0.1"}))
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	req := httptest.NewRequest("GET", "/xiaozhi/v1/", nil)
+	req.RemoteAddr = "203.0.113.5:52314"
+	req.Header.Set("X-Real-IP", "10.0.0.9")
+	req.Header.Set("X-Forwarded-For", "10.0.0.8")
+
+	assert.Equal(t, "203.0.113.5", GetClientIP(req), "Should ignore headers from untrusted peers")
+}
+
+func TestSetTrustedProxies_Invalid(t *testing.T) {
+	assert.Error(t, SetTrustedProxies([]string{"not-an-ip"}))
+	assert.Error(t, SetTrustedProxies([]string{"10.0.0.0/33"}))
+}
+
+func TestGetClientIP_NilRequest(t *testing.T) {
+	assert.Empty(t, GetClientIP(nil))
+}
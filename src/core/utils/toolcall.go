@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	toolCallOpenTag  = "<tool_call>"
+	toolCallCloseTag = "</tool_call>"
+)
+
+// TextToolCall 从模型输出的 <tool_call> 文本中解析出的工具调用
+type TextToolCall struct {
+	Name      string
+	Arguments string // JSON对象
+}
+
+// ParseTextToolCalls 解析文本中全部 <tool_call> 块，最后一块缺少结束标签时也会解析；
+// 没有标签但整段是调用JSON时按单个调用解析。JSON格式不规范时尝试修复，无法解析的块被跳过
+func ParseTextToolCalls(text string) []TextToolCall {
+	var blocks []string
+	rest := text
+	for {
+		start := strings.Index(rest, toolCallOpenTag)
+		if start == -1 {
+			break
+		}
+		rest = rest[start+len(toolCallOpenTag):]
+		end := strings.Index(rest, toolCallCloseTag)
+		if end == -1 {
+			blocks = append(blocks, rest)
+			break
+		}
+		blocks = append(blocks, rest[:end])
+		rest = rest[end+len(toolCallCloseTag):]
+	}
+	if len(blocks) == 0 && strings.HasPrefix(strings.TrimSpace(text), "{") {
+		blocks = append(blocks, text)
+	}
+
+	calls := make([]TextToolCall, 0, len(blocks))
+	for _, block := range blocks {
+		if call, ok := parseToolCallJSON(block); ok {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// parseToolCallJSON 解析单个调用的JSON，兼容 parameters 字段与字符串形式的 arguments
+func parseToolCallJSON(block string) (TextToolCall, bool) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(RepairJSON(block)), &data); err != nil {
+		return TextToolCall{}, false
+	}
+	name, _ := data["name"].(string)
+	if name == "" {
+		return TextToolCall{}, false
+	}
+	args, ok := data["arguments"]
+	if !ok {
+		args = data["parameters"]
+	}
+	if s, isStr := args.(string); isStr {
+		var decoded map[string]interface{}
+		if json.Unmarshal([]byte(RepairJSON(s)), &decoded) == nil {
+			args = decoded
+		}
+	}
+	if _, isMap := args.(map[string]interface{}); !isMap {
+		args = map[string]interface{}{}
+	}
+	argsJSON, _ := json.Marshal(args)
+	return TextToolCall{Name: name, Arguments: string(argsJSON)}, true
+}
+
+// RepairJSON 修复小模型常见的JSON格式问题：代码块标记、首个 { 之前的多余文本、// 注释、
+// 尾随逗号、未闭合的字符串和括号。无法识别时原样返回
+func RepairJSON(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	start := strings.Index(s, "{")
+	if start == -1 {
+		return s
+	}
+	s = s[start:]
+
+	var out strings.Builder
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '/':
+			if i+1 < len(s) && s[i+1] == '/' {
+				for i < len(s) && s[i] != '\n' {
+					i++
+				}
+				continue
+			}
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			trimTrailingComma(&out)
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				continue // 多余的闭合括号
+			}
+			stack = stack[:len(stack)-1]
+			out.WriteByte(c)
+			if len(stack) == 0 {
+				return out.String() // 忽略顶层对象之后的内容
+			}
+			continue
+		}
+		out.WriteByte(c)
+	}
+	if inString {
+		out.WriteByte('"')
+	}
+	for len(stack) > 0 {
+		trimTrailingComma(&out)
+		out.WriteByte(stack[len(stack)-1])
+		stack = stack[:len(stack)-1]
+	}
+	return out.String()
+}
+
+// trimTrailingComma 去掉已输出内容末尾（忽略空白）的逗号
+func trimTrailingComma(b *strings.Builder) {
+	s := strings.TrimRight(b.String(), " \t\r\n")
+	if strings.HasSuffix(s, ",") {
+		s = s[:len(s)-1]
+		b.Reset()
+		b.WriteString(s)
+	}
+}
+
+// ToolCallTextFilter 流式过滤模型输出中的 <tool_call> 文本，避免工具调用被送去TTS播报。
+// 出现 <tool_call> 后的内容全部截留，可能是标签开头的结尾片段暂存到下一段再判断
+type ToolCallTextFilter struct {
+	pending string
+	found   bool
+}
+
+// Feed 输入一段模型输出，返回可以播报的文本
+func (f *ToolCallTextFilter) Feed(chunk string) string {
+	if f.found {
+		return ""
+	}
+	text := f.pending + chunk
+	f.pending = ""
+	if idx := strings.Index(text, toolCallOpenTag); idx != -1 {
+		f.found = true
+		return text[:idx]
+	}
+	// 末尾可能是被截断的标签开头，暂存
+	for n := len(toolCallOpenTag) - 1; n > 0; n-- {
+		if strings.HasSuffix(text, toolCallOpenTag[:n]) {
+			f.pending = text[len(text)-n:]
+			return text[:len(text)-n]
+		}
+	}
+	return text
+}
+
+// Found 是否已经出现工具调用
+func (f *ToolCallTextFilter) Found() bool {
+	return f.found
+}
+
+// Flush 输出结束时返回暂存的文本
+func (f *ToolCallTextFilter) Flush() string {
+	text := f.pending
+	f.pending = ""
+	if f.found {
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseTextToolCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []TextToolCall
+	}{
+		{
+			name:     "单个调用",
+			input:    "<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"北京\"}}\n</tool_call>",
+			expected: []TextToolCall{{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+		},
+		{
+			name: "多个调用",
+			input: "<tool_call>{\"name\": \"light_on\", \"arguments\": {}}</tool_call>\n" +
+				"<tool_call>{\"name\": \"set_volume\", \"arguments\": {\"volume\": 30}}</tool_call>",
+			expected: []TextToolCall{
+				{Name: "light_on", Arguments: `{}`},
+				{Name: "set_volume", Arguments: `{"volume":30}`},
+			},
+		},
+		{
+			name:     "尾随逗号与注释",
+			input:    "<tool_call>\n{\n  \"name\": \"play_music\", // 播放\n  \"arguments\": {\"song\": \"晴天\",},\n}\n</tool_call>",
+			expected: []TextToolCall{{Name: "play_music", Arguments: `{"song":"晴天"}`}},
+		},
+		{
+			name:     "缺少结束标签和括号",
+			input:    "<tool_call>{\"name\": \"get_weather\", \"arguments\": {\"city\": \"上海",
+			expected: []TextToolCall{{Name: "get_weather", Arguments: `{"city":"上海"}`}},
+		},
+		{
+			name:     "代码块与字符串参数",
+			input:    "<tool_call>```json\n{\"name\": \"get_time\", \"parameters\": \"{\\\"zone\\\": \\\"UTC\\\"}\"}\n```</tool_call>",
+			expected: []TextToolCall{{Name: "get_time", Arguments: `{"zone":"UTC"}`}},
+		},
+		{
+			name:     "没有标签的调用JSON",
+			input:    `{"name": "handle_exit_intent", "arguments": {"say_goodbye": "再见"}}`,
+			expected: []TextToolCall{{Name: "handle_exit_intent", Arguments: `{"say_goodbye":"再见"}`}},
+		},
+		{
+			name:     "无法解析的块被跳过",
+			input:    "<tool_call>not json</tool_call><tool_call>{\"arguments\": {}}</tool_call>",
+			expected: []TextToolCall{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseTextToolCalls(tt.input)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("ParseTextToolCalls() = %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i].Name != tt.expected[i].Name || !jsonEqual(got[i].Arguments, tt.expected[i].Arguments) {
+					t.Errorf("call %d = %v, want %v", i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func jsonEqual(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
+
+func TestToolCallTextFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		expected string
+		found    bool
+	}{
+		{
+			name:     "普通文本",
+			chunks:   []string{"你好，", "今天天气不错。"},
+			expected: "你好，今天天气不错。",
+		},
+		{
+			name:     "标签前的文本可以播报",
+			chunks:   []string{"好的，", "我查一下。<tool", "_call>{\"name\":", "\"get_weather\"}</tool_call>"},
+			expected: "好的，我查一下。",
+			found:    true,
+		},
+		{
+			name:     "不是标签的尖括号",
+			chunks:   []string{"1 <", " 2，", "a <t", "ag>"},
+			expected: "1 < 2，a <tag>",
+		},
+		{
+			name:     "结束时输出暂存的文本",
+			chunks:   []string{"结尾是<tool_"},
+			expected: "结尾是<tool_",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f ToolCallTextFilter
+			var out strings.Builder
+			for _, chunk := range tt.chunks {
+				out.WriteString(f.Feed(chunk))
+			}
+			out.WriteString(f.Flush())
+			if out.String() != tt.expected {
+				t.Errorf("filtered = %q, want %q", out.String(), tt.expected)
+			}
+			if f.Found() != tt.found {
+				t.Errorf("Found() = %v, want %v", f.Found(), tt.found)
+			}
+		})
+	}
+}
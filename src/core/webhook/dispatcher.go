@@ -0,0 +1,391 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// 检查到期投递的间隔
+	checkInterval = 5 * time.Second
+	// 每次最多处理的投递数量
+	dueBatchSize = 50
+	// 单次请求超时
+	requestTimeout = 10 * time.Second
+	// 同时投递的Webhook数量上限，同一Webhook的记录始终按顺序投递
+	maxConcurrentHooks = 16
+	// 投递记录保留时长
+	deliveryRetention = 7 * 24 * time.Hour
+	// 用户Webhook缓存的有效期，Webhook变更时通过 Invalidate 立即失效
+	hookCacheTTL = time.Minute
+	// 读取并丢弃的最大响应长度，便于复用连接
+	maxResponseDrain = 64 << 10
+)
+
+// hooksVersion Webhook配置版本，增删改Webhook后递增，投递器据此丢弃缓存
+var hooksVersion atomic.Uint64
+
+// Invalidate 通知投递器重新加载Webhook配置，增删改Webhook后调用
+func Invalidate() {
+	hooksVersion.Add(1)
+}
+
+// NewClient 创建投递使用的 HTTP 客户端，连接前检查解析出的地址，域名解析到内网地址或重定向到内网时拒绝连接
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("无效的地址: %s", address)
+			}
+			return checkIP(ip)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // 经代理转发时无法检查目标地址
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: requestTimeout, Transport: transport}
+}
+
+// NewDelivery 根据事件构造投递记录
+func NewDelivery(hook *models.Webhook, payload Payload) (*models.WebhookDelivery, error) {
+	if payload.ID == "" {
+		payload.ID = uuid.New().String()
+	}
+	if payload.Time.IsZero() {
+		payload.Time = time.Now()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       payload.ID,
+		EventType:     payload.Event,
+		Payload:       string(body),
+		Status:        database.WebhookDeliveryPending,
+		NextAttemptAt: payload.Time,
+	}, nil
+}
+
+// Deliver 投递一次并更新投递记录的状态：成功标记为success，失败时按退避时间安排重试，超过最大次数标记为failed
+func Deliver(ctx context.Context, client *http.Client, hook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) error {
+	delivery.Attempts++
+	code, err := post(ctx, client, hook, delivery, now)
+	delivery.ResponseCode = code
+	if err == nil {
+		delivery.Status = database.WebhookDeliverySuccess
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return nil
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = database.WebhookDeliveryFailed
+	} else {
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+	return err
+}
+
+func post(ctx context.Context, client *http.Client, hook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := now.Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xiaozhi-webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// 响应体不保存也不返回给用户，只记录状态码
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Dispatcher 订阅事件总线，为匹配的Webhook写入投递记录，并从数据库中取出到期记录投递
+type Dispatcher struct {
+	logger *utils.Logger
+	client *http.Client
+	bus    *events.Bus
+	kick   chan struct{}
+	sem    chan struct{} // 限制同时投递的Webhook数量
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	busy map[uint]bool // 正在投递的Webhook
+
+	// 按用户缓存启用的Webhook，只在事件循环中访问
+	hooks        map[uint][]models.Webhook
+	hooksVersion uint64
+	hooksLoaded  time.Time
+}
+
+// NewDispatcher 创建Webhook投递器，bus为nil时使用全局事件总线
+func NewDispatcher(logger *utils.Logger, bus *events.Bus) *Dispatcher {
+	if bus == nil {
+		bus = events.Default()
+	}
+	return &Dispatcher{
+		logger: logger,
+		client: NewClient(),
+		bus:    bus,
+		kick:   make(chan struct{}, 1),
+		sem:    make(chan struct{}, maxConcurrentHooks),
+		busy:   make(map[uint]bool),
+		hooks:  make(map[uint][]models.Webhook),
+	}
+}
+
+// Run 运行投递循环，直到ctx结束
+func (d *Dispatcher) Run(ctx context.Context) {
+	// 无损订阅：投递记录写入前事件不会因缓冲满而丢弃
+	sub := d.bus.SubscribeLossless(func(e *events.Event) bool {
+		_, ok := MapEvent(e)
+		return ok
+	})
+	defer sub.Close()
+
+	go d.worker(ctx)
+
+	d.logger.Info("[Webhook] [投递] Webhook投递器已启动")
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("[Webhook] [投递] Webhook投递器已停止")
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if d.enqueue(&e) > 0 {
+				select {
+				case d.kick <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// enqueue 为订阅了该事件的Webhook写入投递记录，返回写入数量
+func (d *Dispatcher) enqueue(e *events.Event) int {
+	eventType, ok := MapEvent(e)
+	if !ok {
+		return 0
+	}
+	db := database.GetDB()
+	if db == nil {
+		return 0
+	}
+	userID := e.UserID
+	if userID == 0 {
+		userID = database.AdminUserID
+	}
+	hooks, err := d.enabledHooks(db, userID)
+	if err != nil {
+		d.logger.Error("[Webhook] [入队] 查询用户 %d 的Webhook失败: %v", userID, err)
+		return 0
+	}
+	if len(hooks) == 0 {
+		return 0
+	}
+
+	payload := Payload{
+		ID:        uuid.New().String(),
+		Event:     eventType,
+		Time:      e.Time,
+		DeviceID:  e.DeviceID,
+		SessionID: e.SessionID,
+		AgentID:   e.AgentID,
+		Data:      e.Data,
+	}
+	count := 0
+	for i := range hooks {
+		hook := &hooks[i]
+		if !Subscribed(hook, eventType) {
+			continue
+		}
+		delivery, err := NewDelivery(hook, payload)
+		if err != nil {
+			d.logger.Error("[Webhook] [入队] 序列化事件失败: %v", err)
+			return count
+		}
+		if err := database.AddWebhookDelivery(db, delivery); err != nil {
+			d.logger.Error("[Webhook] [入队] 保存投递记录失败: %v", err)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// enabledHooks 获取用户启用的Webhook，优先使用缓存
+func (d *Dispatcher) enabledHooks(db *gorm.DB, userID uint) ([]models.Webhook, error) {
+	version := hooksVersion.Load()
+	if version != d.hooksVersion || time.Since(d.hooksLoaded) > hookCacheTTL {
+		d.hooks = make(map[uint][]models.Webhook)
+		d.hooksVersion = version
+		d.hooksLoaded = time.Now()
+	}
+	if hooks, ok := d.hooks[userID]; ok {
+		return hooks, nil
+	}
+	hooks, err := database.ListEnabledWebhooksByUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	d.hooks[userID] = hooks
+	return hooks, nil
+}
+
+// worker 定期处理到期投递，收到新事件时立即处理
+func (d *Dispatcher) worker(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	defer d.wg.Wait()
+	lastCleanup := time.Time{}
+
+	for {
+		now := time.Now()
+		d.processDue(ctx, now)
+		if now.Sub(lastCleanup) > time.Hour {
+			if db := database.GetDB(); db != nil {
+				if err := database.DeleteWebhookDeliveriesBefore(db, now.Add(-deliveryRetention)); err != nil {
+					d.logger.Error("[Webhook] [清理] 清理投递记录失败: %v", err)
+				}
+			}
+			lastCleanup = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.kick:
+		}
+	}
+}
+
+// processDue 取出到期记录，按Webhook分组后并发投递：同一回调地址的记录按顺序投递，
+// 不同回调地址互不等待，慢速或失效的地址只会拖慢自己的投递
+func (d *Dispatcher) processDue(ctx context.Context, now time.Time) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	d.mu.Lock()
+	busy := make([]uint, 0, len(d.busy))
+	for id := range d.busy {
+		busy = append(busy, id)
+	}
+	d.mu.Unlock()
+	deliveries, err := database.ListDueWebhookDeliveries(db, now, busy, dueBatchSize)
+	if err != nil {
+		d.logger.Error("[Webhook] [投递] 查询待投递记录失败: %v", err)
+		return
+	}
+
+	groups := make(map[uint][]models.WebhookDelivery)
+	order := make([]uint, 0)
+	for _, delivery := range deliveries {
+		if _, ok := groups[delivery.WebhookID]; !ok {
+			order = append(order, delivery.WebhookID)
+		}
+		groups[delivery.WebhookID] = append(groups[delivery.WebhookID], delivery)
+	}
+	for _, id := range order {
+		d.mu.Lock()
+		if d.busy[id] {
+			d.mu.Unlock()
+			continue
+		}
+		d.busy[id] = true
+		d.mu.Unlock()
+
+		d.wg.Add(1)
+		go func(id uint, list []models.WebhookDelivery) {
+			defer d.wg.Done()
+			defer func() {
+				d.mu.Lock()
+				delete(d.busy, id)
+				d.mu.Unlock()
+				// 本批之后可能还有该地址的到期记录
+				select {
+				case d.kick <- struct{}{}:
+				default:
+				}
+			}()
+			select {
+			case d.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-d.sem }()
+			d.deliverAll(ctx, db, id, list)
+		}(id, groups[id])
+	}
+}
+
+// deliverAll 按顺序投递同一Webhook的记录
+func (d *Dispatcher) deliverAll(ctx context.Context, db *gorm.DB, webhookID uint, deliveries []models.WebhookDelivery) {
+	hook, _ := database.FindWebhookByID(db, webhookID)
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		delivery := &deliveries[i]
+		if hook == nil || !hook.Enabled {
+			delivery.Status = database.WebhookDeliveryFailed
+			delivery.LastError = "webhook已删除或已停用"
+			if err := database.UpdateWebhookDelivery(db, delivery); err != nil {
+				d.logger.Error("[Webhook] [投递] 更新投递记录 %d 失败: %v", delivery.ID, err)
+			}
+			continue
+		}
+
+		if err := Deliver(ctx, d.client, hook, delivery, time.Now()); err != nil {
+			d.logger.Warn("[Webhook] [投递] %s -> %s 第 %d 次失败: %v", delivery.EventType, hook.URL, delivery.Attempts, err)
+		} else {
+			d.logger.Info("[Webhook] [投递] %s -> %s 成功", delivery.EventType, hook.URL)
+		}
+		if err := database.UpdateWebhookDelivery(db, delivery); err != nil {
+			d.logger.Error("[Webhook] [投递] 更新投递记录 %d 失败: %v", delivery.ID, err)
+		}
+	}
+}
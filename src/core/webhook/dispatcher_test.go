@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) (*gorm.DB, *utils.Logger) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+	require.NoError(t, err)
+	db, _, err := database.OpenDB(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+		logger.Close()
+	})
+	return db, logger
+}
+
+func TestAddWebhookKeepsDisabled(t *testing.T) {
+	db, _ := openTestDB(t)
+	hook := &models.Webhook{UserID: 1, URL: "https://example.com/hook", Enabled: false}
+	require.NoError(t, database.AddWebhook(db, hook))
+	stored, err := database.FindWebhookByID(db, hook.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Enabled)
+}
+
+func TestSlowWebhookDoesNotBlockOthers(t *testing.T) {
+	db, logger := openTestDB(t)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer fast.Close()
+
+	add := func(url string) *models.WebhookDelivery {
+		hook := &models.Webhook{UserID: 1, URL: url, Enabled: true}
+		require.NoError(t, database.AddWebhook(db, hook))
+		delivery, err := NewDelivery(hook, Payload{Event: EventDeviceOnline, Time: time.Now().Add(-time.Second)})
+		require.NoError(t, err)
+		require.NoError(t, database.AddWebhookDelivery(db, delivery))
+		return delivery
+	}
+	// 慢速地址的记录先到期
+	add(slow.URL)
+	fastDelivery := add(fast.URL)
+
+	d := NewDispatcher(logger, nil)
+	d.client = &http.Client{Timeout: 5 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.processDue(ctx, time.Now())
+
+	assert.Eventually(t, func() bool {
+		deliveries, err := database.ListWebhookDeliveries(db, fastDelivery.WebhookID, 1)
+		return err == nil && len(deliveries) == 1 && deliveries[0].Status == database.WebhookDeliverySuccess
+	}, 2*time.Second, 20*time.Millisecond, "Fast webhook should be delivered while the slow one is pending")
+
+	// 慢速地址仍在投递中，下一轮不会重复取出它的记录
+	d.mu.Lock()
+	assert.Len(t, d.busy, 1)
+	d.mu.Unlock()
+
+	cancel()
+	d.wg.Wait()
+}
+
+func TestDispatcherKeepsEventBurst(t *testing.T) {
+	db, logger := openTestDB(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	require.NoError(t, database.AddWebhook(db, &models.Webhook{UserID: 1, URL: server.URL, Enabled: true}))
+
+	bus := events.NewBus()
+	d := NewDispatcher(logger, bus)
+	d.client = server.Client()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		d.wg.Wait()
+	}()
+	require.Eventually(t, bus.HasSubscribers, time.Second, 5*time.Millisecond)
+
+	// 突发事件超过任何固定缓冲，投递记录也不丢失
+	const total = 1500
+	for i := 0; i < total; i++ {
+		bus.Publish(events.Event{Type: events.TypeRoundFinished, UserID: 1})
+	}
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&models.WebhookDelivery{}).Count(&count)
+		return count == total
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestDispatcherReloadsHooksAfterInvalidate(t *testing.T) {
+	db, logger := openTestDB(t)
+	d := NewDispatcher(logger, events.NewBus())
+
+	hooks, err := d.enabledHooks(db, 1)
+	require.NoError(t, err)
+	assert.Empty(t, hooks)
+
+	require.NoError(t, database.AddWebhook(db, &models.Webhook{UserID: 1, URL: "https://example.com/hook", Enabled: true}))
+	hooks, _ = d.enabledHooks(db, 1)
+	assert.Empty(t, hooks, "cached until invalidated")
+
+	Invalidate()
+	hooks, _ = d.enabledHooks(db, 1)
+	assert.Len(t, hooks, 1)
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/models"
+)
+
+/*
+* 出站 Webhook。
+* 用户注册回调地址、签名密钥并选择事件类型，事件发生时向回调地址 POST JSON。
+* 请求头携带事件类型、事件ID、时间戳与签名：
+*   X-Xiaozhi-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+* 投递记录写入数据库作为重试队列，失败后按指数退避重试，服务重启后继续投递。
+ */
+
+// Webhook 事件类型
+const (
+	EventDeviceOnline     = "device.online"
+	EventDeviceOffline    = "device.offline"
+	EventDeviceRegistered = "device.registered"
+	EventRoundFinished    = "conversation.round_finished"
+	EventToolInvoked      = "tool.invoked"
+	EventFirmwareOffered  = "firmware.offered"
+	EventDeviceAlert      = "device.alert"
+	EventTest             = "webhook.test" // 测试投递，始终发送
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Xiaozhi-Event"
+	HeaderDelivery  = "X-Xiaozhi-Delivery"
+	HeaderTimestamp = "X-Xiaozhi-Timestamp"
+	HeaderSignature = "X-Xiaozhi-Signature"
+)
+
+const (
+	// 最大尝试次数，超过后标记为失败
+	MaxAttempts = 8
+	// 首次重试间隔
+	baseBackoff = 10 * time.Second
+	// 最大重试间隔
+	maxBackoff = time.Hour
+)
+
+// EventTypes 可订阅的事件类型
+var EventTypes = []string{
+	EventDeviceOnline,
+	EventDeviceOffline,
+	EventDeviceRegistered,
+	EventRoundFinished,
+	EventToolInvoked,
+	EventFirmwareOffered,
+	EventDeviceAlert,
+}
+
+// 会话事件到 Webhook 事件的映射
+var busEventTypes = map[string]string{
+	events.TypeConnectionOpen:   EventDeviceOnline,
+	events.TypeConnectionClose:  EventDeviceOffline,
+	events.TypeDeviceRegistered: EventDeviceRegistered,
+	events.TypeRoundFinished:    EventRoundFinished,
+	events.TypeToolCall:         EventToolInvoked,
+	events.TypeFirmwareOffered:  EventFirmwareOffered,
+	events.TypeTelemetryAlert:   EventDeviceAlert,
+}
+
+// Payload 投递的请求体
+type Payload struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	Time      time.Time              `json:"time"`
+	DeviceID  string                 `json:"device_id,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	AgentID   uint                   `json:"agent_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// MapEvent 将总线事件转换为 Webhook 事件类型，不需要推送的事件返回false
+func MapEvent(e *events.Event) (string, bool) {
+	t, ok := busEventTypes[e.Type]
+	return t, ok
+}
+
+// ParseEvents 校验并规范化事件类型列表，返回逗号分隔的字符串，为空表示订阅全部
+func ParseEvents(list []string) (string, error) {
+	valid := make(map[string]bool, len(EventTypes))
+	for _, t := range EventTypes {
+		valid[t] = true
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(list))
+	for _, t := range list {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if !valid[t] {
+			return "", fmt.Errorf("不支持的事件类型: %s", t)
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	return strings.Join(result, ","), nil
+}
+
+// ValidateURL 校验回调地址，仅支持 http/https，不允许指向本机、内网或链路本地地址。
+// 域名在投递时解析，解析结果同样会被检查，见 NewClient
+func ValidateURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("无效的回调地址: %s", raw)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("回调地址不能指向本机: %s", raw)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := checkIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIP 拒绝本机、内网、链路本地等非公网地址，防止通过Webhook访问内部服务
+func checkIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("回调地址不能指向本机或内网地址: %s", ip)
+	}
+	return nil
+}
+
+// Subscribed 判断Webhook是否订阅了该事件
+func Subscribed(hook *models.Webhook, eventType string) bool {
+	if eventType == EventTest || strings.TrimSpace(hook.Events) == "" {
+		return true
+	}
+	for _, t := range strings.Split(hook.Events, ",") {
+		if strings.TrimSpace(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign 计算签名，接收方用同样的方式计算后比对 X-Xiaozhi-Signature
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret 生成随机签名密钥
+func NewSecret() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// Verify 校验签名
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff 第attempts次失败后的重试间隔
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := baseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
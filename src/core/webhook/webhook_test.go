@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliverSignsRequest(t *testing.T) {
+	var received Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.True(t, Verify("s3cret", ts, body, r.Header.Get(HeaderSignature)), "Signature should verify")
+		assert.Equal(t, EventDeviceOnline, r.Header.Get(HeaderEvent))
+		assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	hook := &models.Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}
+	delivery, err := NewDelivery(hook, Payload{Event: EventDeviceOnline, DeviceID: "aa:bb"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, Deliver(context.Background(), server.Client(), hook, delivery, now))
+	assert.Equal(t, database.WebhookDeliverySuccess, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.ResponseCode)
+	assert.Equal(t, "aa:bb", received.DeviceID)
+	assert.Equal(t, delivery.EventID, received.ID)
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	hook := &models.Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}
+	delivery, err := NewDelivery(hook, Payload{Event: EventToolInvoked})
+	require.NoError(t, err)
+
+	now := time.Now()
+	err = Deliver(context.Background(), server.Client(), hook, delivery, now)
+	require.Error(t, err)
+	assert.Equal(t, "HTTP 503", delivery.LastError)
+	assert.NotContains(t, delivery.LastError, "busy", "Response body must not be exposed")
+	assert.Equal(t, database.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseCode)
+	assert.Equal(t, now.Add(Backoff(1)), delivery.NextAttemptAt)
+
+	for delivery.Attempts < MaxAttempts {
+		_ = Deliver(context.Background(), server.Client(), hook, delivery, now)
+	}
+	assert.Equal(t, database.WebhookDeliveryFailed, delivery.Status, "Should give up after max attempts")
+	assert.Equal(t, int32(MaxAttempts), atomic.LoadInt32(&calls))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, Backoff(0))
+	assert.Equal(t, baseBackoff, Backoff(1))
+	assert.Equal(t, 2*baseBackoff, Backoff(2))
+	assert.Equal(t, 4*baseBackoff, Backoff(3))
+	assert.Equal(t, maxBackoff, Backoff(30))
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"device.online"}`)
+	sig := Sign("key", 1700000000, body)
+	assert.True(t, Verify("key", 1700000000, body, sig))
+	assert.False(t, Verify("other", 1700000000, body, sig))
+	assert.False(t, Verify("key", 1700000001, body, sig))
+}
+
+func TestParseEventsAndSubscribed(t *testing.T) {
+	list, err := ParseEvents([]string{" device.online", "tool.invoked", "device.online", ""})
+	require.NoError(t, err)
+	assert.Equal(t, "device.online,tool.invoked", list)
+
+	_, err = ParseEvents([]string{"device.exploded"})
+	assert.Error(t, err)
+
+	hook := &models.Webhook{Events: list}
+	assert.True(t, Subscribed(hook, EventDeviceOnline))
+	assert.False(t, Subscribed(hook, EventRoundFinished))
+	assert.True(t, Subscribed(hook, EventTest), "Test deliveries are always sent")
+	assert.True(t, Subscribed(&models.Webhook{}, EventFirmwareOffered), "Empty list subscribes to all")
+}
+
+func TestMapEvent(t *testing.T) {
+	typ, ok := MapEvent(&events.Event{Type: events.TypeConnectionClose})
+	assert.True(t, ok)
+	assert.Equal(t, EventDeviceOffline, typ)
+
+	_, ok = MapEvent(&events.Event{Type: events.TypeASRPartial})
+	assert.False(t, ok)
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://example.com/hook"))
+	assert.Error(t, ValidateURL("ftp://example.com"))
+	assert.Error(t, ValidateURL("not a url"))
+
+	for _, raw := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10:8123/api",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		assert.Error(t, ValidateURL(raw), raw)
+	}
+}
+
+func TestClientRefusesPrivateAddress(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	// 绕过 ValidateURL（如域名解析到内网地址）时在连接阶段拒绝
+	hook := &models.Webhook{ID: 1, URL: server.URL, Secret: "s3cret"}
+	delivery, err := NewDelivery(hook, Payload{Event: EventTest})
+	require.NoError(t, err)
+	assert.Error(t, Deliver(context.Background(), NewClient(), hook, delivery, time.Now()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,22 @@
+package mcpserver
+
+import (
+	"context"
+	"xiaozhi-server-go/src/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MCPServerService 定义 MCP 服务端接口
+type MCPServerService interface {
+	// 将 MCP 的路由注册到 engine 与 apiGroup
+	Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error
+}
+
+// SessionManager 在线会话查询接口，由传输管理器实现
+type SessionManager interface {
+	// 获取所有在线会话
+	GetConnectionHandlers() []*core.ConnectionHandler
+	// 根据设备ID查找在线会话
+	FindConnectionHandler(deviceID string) *core.ConnectionHandler
+}
@@ -0,0 +1,273 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// 设备工具调用的默认超时时间
+	deviceToolTimeout = 30 * time.Second
+	// MCP路由前缀，挂载在 /api 之下
+	mcpBasePath = "/api/mcp"
+)
+
+// DefaultMCPServerService 将在线设备以 MCP 工具的形式暴露给外部智能体
+type DefaultMCPServerService struct {
+	logger    *utils.Logger
+	config    *configs.Config
+	sessions  SessionManager
+	mcpServer *server.MCPServer
+	sseServer *server.SSEServer
+}
+
+// NewDefaultMCPServerService 构造函数
+func NewDefaultMCPServerService(
+	config *configs.Config,
+	logger *utils.Logger,
+	sessions SessionManager,
+) (*DefaultMCPServerService, error) {
+	if sessions == nil {
+		return nil, fmt.Errorf("会话管理器未初始化")
+	}
+
+	s := &DefaultMCPServerService{
+		logger:   logger,
+		config:   config,
+		sessions: sessions,
+	}
+
+	version := config.Server.ServerVersion
+	if version == "" {
+		version = "1.0.0"
+	}
+	s.mcpServer = server.NewMCPServer(
+		"xiaozhi-server",
+		version,
+		server.WithToolCapabilities(false),
+		server.WithRecovery(),
+	)
+	s.registerTools()
+
+	s.sseServer = server.NewSSEServer(
+		s.mcpServer,
+		server.WithStaticBasePath(mcpBasePath),
+		server.WithAppendQueryToMessageEndpoint(),
+		server.WithUseFullURLForMessageEndpoint(false),
+		server.WithKeepAlive(true),
+	)
+	return s, nil
+}
+
+// Start 实现 MCPServerService 接口，注册 MCP 的 SSE 与消息路由
+func (s *DefaultMCPServerService) Start(
+	ctx context.Context,
+	engine *gin.Engine,
+	apiGroup *gin.RouterGroup,
+) error {
+	group := apiGroup.Group("/mcp", s.authMiddleware())
+	group.GET("/sse", gin.WrapH(s.sseServer.SSEHandler()))
+	group.POST("/message", gin.WrapH(s.sseServer.MessageHandler()))
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.sseServer.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("[MCP服务] 关闭SSE会话失败: %v", err)
+		}
+	}()
+
+	s.logger.Info("[MCP服务] [服务] HTTP路由注册完成 %s/sse", mcpBasePath)
+	return nil
+}
+
+// authMiddleware 校验访问令牌，支持 Authorization: Bearer <token> 与 ?token= 两种方式
+func (s *DefaultMCPServerService) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := s.config.MCPServer.Token
+		if expected == "" {
+			expected = s.config.Server.Token
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if token == "" {
+			token = c.Query("token")
+		}
+
+		if expected == "" || token == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			s.logger.Warn("[MCP服务] 访问令牌无效 %s", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "无效的访问令牌"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerTools 注册对外提供的 MCP 工具
+func (s *DefaultMCPServerService) registerTools() {
+	s.mcpServer.AddTool(mcp.NewTool("list_online_devices",
+		mcp.WithDescription("列出当前在线的所有设备及其会话状态"),
+	), s.handleListOnlineDevices)
+
+	s.mcpServer.AddTool(mcp.NewTool("speak_on_device",
+		mcp.WithDescription("打断设备当前播报，并让设备用当前音色说出指定文本"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID，通常为MAC地址")),
+		mcp.WithString("text", mcp.Required(), mcp.Description("要播报的文本")),
+	), s.handleSpeakOnDevice)
+
+	s.mcpServer.AddTool(mcp.NewTool("call_device_tool",
+		mcp.WithDescription("调用设备端上报的MCP工具，例如调节音量、控制屏幕等，可先通过get_device_state查看设备支持的工具"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID，通常为MAC地址")),
+		mcp.WithString("tool", mcp.Required(), mcp.Description("设备工具名称")),
+		mcp.WithObject("args", mcp.Description("工具参数")),
+	), s.handleCallDeviceTool)
+
+	s.mcpServer.AddTool(mcp.NewTool("get_device_state",
+		mcp.WithDescription("获取设备的在线状态、会话状态以及设备支持的工具列表"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID，通常为MAC地址")),
+	), s.handleGetDeviceState)
+
+	s.mcpServer.AddTool(mcp.NewTool("start_conversation",
+		mcp.WithDescription("以指定文本作为用户输入，在设备上发起一轮对话，回复会直接在设备上播放"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID，通常为MAC地址")),
+		mcp.WithString("text", mcp.Required(), mcp.Description("用户输入的文本")),
+	), s.handleStartConversation)
+}
+
+// findSession 根据请求参数查找在线会话
+func (s *DefaultMCPServerService) findSession(request mcp.CallToolRequest) (*core.ConnectionHandler, *mcp.CallToolResult) {
+	deviceID, err := request.RequireString("device_id")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	handler := s.sessions.FindConnectionHandler(deviceID)
+	if handler == nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("设备 %s 不在线", deviceID))
+	}
+	return handler, nil
+}
+
+func (s *DefaultMCPServerService) handleListOnlineDevices(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	devices := make([]core.SessionState, 0)
+	for _, handler := range s.sessions.GetConnectionHandlers() {
+		if handler.IsClosed() {
+			continue
+		}
+		devices = append(devices, handler.GetState())
+	}
+	return jsonResult(map[string]interface{}{
+		"count":   len(devices),
+		"devices": devices,
+	})
+}
+
+func (s *DefaultMCPServerService) handleSpeakOnDevice(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	handler, errResult := s.findSession(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	text, err := request.RequireString("text")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := handler.Speak(text); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("播报失败: %v", err)), nil
+	}
+	s.logger.Info("[MCP服务] [播报 %s] %s", handler.GetDeviceID(), text)
+	return mcp.NewToolResultText("已开始播报"), nil
+}
+
+func (s *DefaultMCPServerService) handleCallDeviceTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	handler, errResult := s.findSession(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	toolName, err := request.RequireString("tool")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	args, _ := request.GetArguments()["args"].(map[string]interface{})
+
+	callCtx, cancel := context.WithTimeout(ctx, deviceToolTimeout)
+	defer cancel()
+	result, err := handler.CallDeviceTool(callCtx, toolName, args)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("调用设备工具失败: %v", err)), nil
+	}
+	s.logger.Info("[MCP服务] [设备工具 %s] %s 调用成功", handler.GetDeviceID(), toolName)
+	return mcp.NewToolResultText(result), nil
+}
+
+func (s *DefaultMCPServerService) handleGetDeviceState(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID, err := request.RequireString("device_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	state := map[string]interface{}{
+		"device_id": deviceID,
+		"online":    false,
+	}
+	if device, err := database.FindDeviceByID(database.GetDB(), deviceID); err == nil && device != nil {
+		state["name"] = device.Name
+		state["board_type"] = device.BoardType
+		state["version"] = device.Version
+		state["last_active_time"] = device.LastActiveTimeV2
+	}
+
+	if handler := s.sessions.FindConnectionHandler(deviceID); handler != nil {
+		state["online"] = true
+		state["session"] = handler.GetState()
+		tools := make([]map[string]interface{}, 0)
+		for _, tool := range handler.GetDeviceTools() {
+			tools = append(tools, map[string]interface{}{
+				"name":        tool.Function.Name,
+				"description": tool.Function.Description,
+				"parameters":  tool.Function.Parameters,
+			})
+		}
+		state["tools"] = tools
+	}
+	return jsonResult(state)
+}
+
+func (s *DefaultMCPServerService) handleStartConversation(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	handler, errResult := s.findSession(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	text, err := request.RequireString("text")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := handler.StartConversation(text); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("发起对话失败: %v", err)), nil
+	}
+	s.logger.Info("[MCP服务] [发起对话 %s] %s", handler.GetDeviceID(), text)
+	return mcp.NewToolResultText("已发起对话"), nil
+}
+
+// jsonResult 将结果序列化为文本返回
+func jsonResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("序列化结果失败: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
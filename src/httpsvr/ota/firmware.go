@@ -0,0 +1,141 @@
+package ota
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+)
+
+// 固件存放目录，下载地址为 /ota_bin/<文件名>
+const firmwareDir = "ota_bin"
+
+var unsafeFileChars = regexp.MustCompile(`[^0-9A-Za-z._-]+`)
+
+// errFirmwareFileExists 固件目录中已存在同名文件
+var errFirmwareFileExists = errors.New("固件文件已存在")
+
+// saveFirmwareFile 将上传的固件写入固件目录，返回文件名、大小和sha256。
+// 不覆盖已有文件，同名文件存在时返回 errFirmwareFileExists
+func saveFirmwareFile(src io.Reader, version string) (string, int64, string, error) {
+	if err := os.MkdirAll(firmwareDir, 0755); err != nil {
+		return "", 0, "", err
+	}
+	tmp, err := os.CreateTemp(firmwareDir, ".upload-*")
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	fileName := fmt.Sprintf("%s-%s.bin", unsafeFileChars.ReplaceAllString(version, "_"), sum[:8])
+	// 硬链接在目标已存在时失败，临时文件由 defer 删除
+	if err := os.Link(tmp.Name(), filepath.Join(firmwareDir, fileName)); err != nil {
+		if os.IsExist(err) {
+			return "", 0, "", errFirmwareFileExists
+		}
+		return "", 0, "", err
+	}
+	return fileName, size, sum, nil
+}
+
+// removeFirmwareFile 删除固件文件，仍有其他固件记录引用该文件时保留
+func removeFirmwareFile(fileName string) {
+	if fw, err := database.FindFirmwareByFileName(database.GetDB(), fileName); err == nil && fw != nil {
+		utils.DefaultLogger.Info("[固件] [删除] 文件 %s 仍被版本 %s 使用，保留文件", fileName, fw.Version)
+		return
+	}
+	if err := os.Remove(filepath.Join(firmwareDir, fileName)); err != nil && !os.IsNotExist(err) {
+		utils.DefaultLogger.Error("[固件] [删除] 删除文件 %s 失败: %v", fileName, err)
+	}
+}
+
+// fileSHA256 计算文件的sha256
+func fileSHA256(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// importLegacyFirmware 将固件目录中尚未登记的 .bin 文件登记到固件库。
+// 这些文件以文件名作为版本号，不限主板，推送比例为0，需要管理员确认后再调整推送比例
+func importLegacyFirmware() {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	bins, _ := filepath.Glob(filepath.Join(firmwareDir, "*.bin"))
+	for _, bin := range bins {
+		fileName := filepath.Base(bin)
+		if existing, err := database.FindFirmwareByFileName(db, fileName); err == nil && existing != nil {
+			continue
+		}
+		size, sum, err := fileSHA256(bin)
+		if err != nil {
+			utils.DefaultLogger.Error("[固件] [导入] 读取 %s 失败: %v", bin, err)
+			continue
+		}
+		fw := &models.Firmware{
+			Version:        strings.TrimSuffix(fileName, ".bin"),
+			FileName:       fileName,
+			Size:           size,
+			SHA256:         sum,
+			RolloutPercent: 0,
+			Enabled:        true,
+			Notes:          "从 ota_bin 目录导入，确认后调整推送比例",
+		}
+		if err := database.AddFirmware(db, fw); err != nil {
+			utils.DefaultLogger.Error("[固件] [导入] 登记 %s 失败: %v", fileName, err)
+			continue
+		}
+		utils.DefaultLogger.Info("[固件] [导入] %s 版本 %s", fileName, fw.Version)
+	}
+}
+
+// selectFirmwareForDevice 从固件库中为设备选择要推送的固件，并记录推送
+func selectFirmwareForDevice(target DeviceTarget) *models.Firmware {
+	db := database.GetDB()
+	firmwares, err := database.ListFirmwares(db)
+	if err != nil {
+		utils.DefaultLogger.Error("[固件] 查询固件列表失败: %v", err)
+		return nil
+	}
+	policy, err := database.FindDeviceFirmwarePolicy(db, target.DeviceID)
+	if err != nil {
+		utils.DefaultLogger.Error("[固件] 查询设备 %s 固件策略失败: %v", target.DeviceID, err)
+	}
+	fw := SelectFirmware(firmwares, target, policy)
+	if fw == nil {
+		return nil
+	}
+	if err := database.RecordFirmwareOffered(db, fw.ID, target.DeviceID, target.Version, time.Now()); err != nil {
+		utils.DefaultLogger.Error("[固件] 记录推送失败: %v", err)
+	}
+	return fw
+}
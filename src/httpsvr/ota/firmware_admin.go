@@ -0,0 +1,335 @@
+package ota
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/httpsvr/webapi"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FirmwareUpdateRequest 固件定向与推送策略更新请求体
+type FirmwareUpdateRequest struct {
+	BoardTypes     *string `json:"board_types,omitempty"`
+	ChipModels     *string `json:"chip_models,omitempty"`
+	AppName        *string `json:"app_name,omitempty"`
+	RolloutPercent *int    `json:"rollout_percent,omitempty"`
+	Allowlist      *string `json:"allowlist,omitempty"`
+	Enabled        *bool   `json:"enabled,omitempty"`
+	Notes          *string `json:"notes,omitempty"`
+}
+
+// DeviceFirmwarePolicyRequest 设备固件策略请求体
+type DeviceFirmwarePolicyRequest struct {
+	PinnedVersion   string   `json:"pinned_version"`
+	BlockedVersions []string `json:"blocked_versions"`
+}
+
+// FirmwareDeploymentStats 固件推送统计
+type FirmwareDeploymentStats struct {
+	Offered    int `json:"offered"`
+	Downloaded int `json:"downloaded"`
+}
+
+// registerFirmwareRoutes 注册固件管理接口，需要管理员权限
+func (s *DefaultOTAService) registerFirmwareRoutes(apiGroup *gin.RouterGroup) {
+	group := apiGroup.Group("/admin/firmware", webapi.AuthMiddleware(), webapi.AdminMiddleware())
+	{
+		group.GET("", s.handleFirmwareList)
+		group.POST("", s.handleFirmwareUpload)
+		group.PUT("/:id", s.handleFirmwareUpdate)
+		group.DELETE("/:id", s.handleFirmwareDelete)
+		group.GET("/:id/devices", s.handleFirmwareDeployments)
+
+		group.GET("/policy/:device_id", s.handleDeviceFirmwarePolicyGet)
+		group.PUT("/policy/:device_id", s.handleDeviceFirmwarePolicySave)
+		group.DELETE("/policy/:device_id", s.handleDeviceFirmwarePolicyDelete)
+	}
+}
+
+// findFirmware 按路径参数查询固件
+func findFirmware(c *gin.Context) *models.Firmware {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid firmware id"})
+		return nil
+	}
+	fw, err := database.FindFirmwareByID(database.GetDB(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "firmware not found"})
+		return nil
+	}
+	return fw
+}
+
+// normalizeList 规范化逗号分隔的列表
+func normalizeList(list string) string {
+	return strings.Join(splitList(list), ",")
+}
+
+// handleFirmwareList 固件列表
+// @Summary 获取固件列表
+// @Tags Firmware
+// @Produce json
+// @Success 200 {object} []models.Firmware "固件列表"
+// @Router /admin/firmware [get]
+func (s *DefaultOTAService) handleFirmwareList(c *gin.Context) {
+	firmwares, err := database.ListFirmwares(database.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": firmwares})
+}
+
+// handleFirmwareUpload 上传固件
+// @Summary 上传固件
+// @Description 上传固件文件并登记到固件库，服务端计算sha256。board_types、chip_models、allowlist 为逗号分隔列表，为空表示不限；rollout_percent 默认为0，即只推送给白名单设备；版本号或sha256与已有固件重复时返回409
+// @Tags Firmware
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "固件文件"
+// @Param version formData string false "版本号，默认取文件名"
+// @Param board_types formData string false "适用的主板类型"
+// @Param chip_models formData string false "适用的芯片型号"
+// @Param app_name formData string false "适用的应用名称"
+// @Param rollout_percent formData int false "推送比例 0-100"
+// @Param allowlist formData string false "设备白名单"
+// @Param notes formData string false "更新说明"
+// @Success 200 {object} models.Firmware "固件"
+// @Router /admin/firmware [post]
+func (s *DefaultOTAService) handleFirmwareUpload(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少固件文件"})
+		return
+	}
+	version := strings.TrimSpace(c.PostForm("version"))
+	if version == "" {
+		version = strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
+	}
+	if version == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少版本号"})
+		return
+	}
+	percent, err := strconv.Atoi(c.DefaultPostForm("rollout_percent", "0"))
+	if err != nil || percent < 0 || percent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rollout_percent 应为 0-100"})
+		return
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+	fileName, size, sum, err := saveFirmwareFile(src, version)
+	if err == errFirmwareFileExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "相同版本的固件已存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存固件失败: " + err.Error()})
+		return
+	}
+	if existing, err := database.FindFirmwareByVersionOrSHA256(database.GetDB(), version, sum); err == nil && existing != nil {
+		removeFirmwareFile(fileName)
+		c.JSON(http.StatusConflict, gin.H{"error": "版本号或sha256与已有固件 " + existing.Version + " 重复"})
+		return
+	}
+
+	fw := &models.Firmware{
+		Version:        version,
+		FileName:       fileName,
+		Size:           size,
+		SHA256:         sum,
+		BoardTypes:     normalizeList(c.PostForm("board_types")),
+		ChipModels:     normalizeList(c.PostForm("chip_models")),
+		AppName:        strings.TrimSpace(c.PostForm("app_name")),
+		RolloutPercent: percent,
+		Allowlist:      normalizeList(c.PostForm("allowlist")),
+		Enabled:        true,
+		Notes:          c.PostForm("notes"),
+	}
+	if err := database.AddFirmware(database.GetDB(), fw); err != nil {
+		removeFirmwareFile(fileName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	utils.DefaultLogger.Info("[固件] [上传] 版本 %s 文件 %s sha256 %s", fw.Version, fw.FileName, fw.SHA256)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": fw})
+}
+
+// handleFirmwareUpdate 更新固件定向与推送策略
+// @Summary 更新固件
+// @Description 更新适用的主板、芯片、应用，推送比例、白名单、启用状态与说明，未填写的字段保持不变
+// @Tags Firmware
+// @Accept json
+// @Produce json
+// @Param id path int true "固件ID"
+// @Param data body FirmwareUpdateRequest true "更新参数"
+// @Success 200 {object} models.Firmware "更新后的固件"
+// @Router /admin/firmware/{id} [put]
+func (s *DefaultOTAService) handleFirmwareUpdate(c *gin.Context) {
+	var req FirmwareUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fw := findFirmware(c)
+	if fw == nil {
+		return
+	}
+
+	if req.RolloutPercent != nil {
+		if *req.RolloutPercent < 0 || *req.RolloutPercent > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rollout_percent 应为 0-100"})
+			return
+		}
+		fw.RolloutPercent = *req.RolloutPercent
+	}
+	if req.BoardTypes != nil {
+		fw.BoardTypes = normalizeList(*req.BoardTypes)
+	}
+	if req.ChipModels != nil {
+		fw.ChipModels = normalizeList(*req.ChipModels)
+	}
+	if req.AppName != nil {
+		fw.AppName = strings.TrimSpace(*req.AppName)
+	}
+	if req.Allowlist != nil {
+		fw.Allowlist = normalizeList(*req.Allowlist)
+	}
+	if req.Enabled != nil {
+		fw.Enabled = *req.Enabled
+	}
+	if req.Notes != nil {
+		fw.Notes = *req.Notes
+	}
+
+	if err := database.UpdateFirmware(database.GetDB(), fw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	utils.DefaultLogger.Info("[固件] [更新] 版本 %s 推送比例 %d%% 启用 %v", fw.Version, fw.RolloutPercent, fw.Enabled)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": fw})
+}
+
+// handleFirmwareDelete 删除固件
+// @Summary 删除固件
+// @Description 删除固件记录、推送记录与固件文件
+// @Tags Firmware
+// @Produce json
+// @Param id path int true "固件ID"
+// @Success 200 {object} map[string]string "删除成功"
+// @Router /admin/firmware/{id} [delete]
+func (s *DefaultOTAService) handleFirmwareDelete(c *gin.Context) {
+	fw := findFirmware(c)
+	if fw == nil {
+		return
+	}
+	if err := database.DeleteFirmware(database.GetDB(), fw.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	removeFirmwareFile(fw.FileName)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "删除成功"})
+}
+
+// handleFirmwareDeployments 固件推送与下载记录
+// @Summary 获取固件推送记录
+// @Description 列出被推送过该固件的设备，以及设备是否、何时下载了固件
+// @Tags Firmware
+// @Produce json
+// @Param id path int true "固件ID"
+// @Success 200 {object} []models.FirmwareDeployment "推送记录"
+// @Router /admin/firmware/{id}/devices [get]
+func (s *DefaultOTAService) handleFirmwareDeployments(c *gin.Context) {
+	fw := findFirmware(c)
+	if fw == nil {
+		return
+	}
+	deployments, err := database.ListFirmwareDeployments(database.GetDB(), fw.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var stats FirmwareDeploymentStats
+	for _, d := range deployments {
+		if d.OfferCount > 0 {
+			stats.Offered++
+		}
+		if d.DownloadedAt != nil {
+			stats.Downloaded++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": deployments, "stats": stats})
+}
+
+// handleDeviceFirmwarePolicyGet 获取设备固件策略
+// @Summary 获取设备固件策略
+// @Tags Firmware
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} models.DeviceFirmwarePolicy "设备固件策略，未设置时为null"
+// @Router /admin/firmware/policy/{device_id} [get]
+func (s *DefaultOTAService) handleDeviceFirmwarePolicyGet(c *gin.Context) {
+	policy, err := database.FindDeviceFirmwarePolicy(database.GetDB(), c.Param("device_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": policy})
+}
+
+// handleDeviceFirmwarePolicySave 设置设备固件策略
+// @Summary 设置设备固件策略
+// @Description 固定版本后设备只会被推送该版本（可用于回退），屏蔽的版本不会推送给该设备
+// @Tags Firmware
+// @Accept json
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Param data body DeviceFirmwarePolicyRequest true "设备固件策略"
+// @Success 200 {object} models.DeviceFirmwarePolicy "设备固件策略"
+// @Router /admin/firmware/policy/{device_id} [put]
+func (s *DefaultOTAService) handleDeviceFirmwarePolicySave(c *gin.Context) {
+	var req DeviceFirmwarePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy := &models.DeviceFirmwarePolicy{
+		DeviceID:        c.Param("device_id"),
+		PinnedVersion:   strings.TrimSpace(req.PinnedVersion),
+		BlockedVersions: normalizeList(strings.Join(req.BlockedVersions, ",")),
+		UpdatedAt:       time.Now(),
+	}
+	if err := database.SaveDeviceFirmwarePolicy(database.GetDB(), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	utils.DefaultLogger.Info("[固件] [策略] 设备 %s 固定 %q 屏蔽 %q", policy.DeviceID, policy.PinnedVersion, policy.BlockedVersions)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": policy})
+}
+
+// handleDeviceFirmwarePolicyDelete 清除设备固件策略
+// @Summary 清除设备固件策略
+// @Tags Firmware
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} map[string]string "清除成功"
+// @Router /admin/firmware/policy/{device_id} [delete]
+func (s *DefaultOTAService) handleDeviceFirmwarePolicyDelete(c *gin.Context) {
+	if err := database.DeleteDeviceFirmwarePolicy(database.GetDB(), c.Param("device_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "已清除"})
+}
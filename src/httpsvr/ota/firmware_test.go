@@ -0,0 +1,127 @@
+package ota
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFirmwareTest 在临时目录中准备固件目录和数据库
+func setupFirmwareTest(t *testing.T) *DefaultOTAService {
+	t.Chdir(t.TempDir())
+	db, _, err := database.OpenDB("config.db")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = nil
+	})
+	if utils.DefaultLogger == nil {
+		_, err := utils.NewLogger(&utils.LogCfg{LogLevel: "error", LogDir: t.TempDir(), LogFile: "test.log"})
+		require.NoError(t, err)
+	}
+	gin.SetMode(gin.TestMode)
+	return &DefaultOTAService{}
+}
+
+func uploadFirmware(t *testing.T, s *DefaultOTAService, version string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("version", version))
+	part, err := w.CreateFormFile("file", "firmware.bin")
+	require.NoError(t, err)
+	_, _ = part.Write(data)
+	require.NoError(t, w.Close())
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/admin/firmware", &body)
+	c.Request.Header.Set("Content-Type", w.FormDataContentType())
+	s.handleFirmwareUpload(c)
+	return rec
+}
+
+func TestFirmwareUploadRejectsDuplicates(t *testing.T) {
+	s := setupFirmwareTest(t)
+
+	rec := uploadFirmware(t, s, "1.0.0", []byte("firmware-a"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp struct {
+		Data models.Firmware `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	fileName := resp.Data.FileName
+
+	// 版本号或内容与已有固件相同时拒绝上传，已有文件保持不变
+	assert.Equal(t, http.StatusConflict, uploadFirmware(t, s, "1.0.0", []byte("firmware-a")).Code)
+	assert.Equal(t, http.StatusConflict, uploadFirmware(t, s, "1.0.1", []byte("firmware-a")).Code)
+	assert.Equal(t, http.StatusConflict, uploadFirmware(t, s, "1.0.0", []byte("firmware-b")).Code)
+
+	firmwares, err := database.ListFirmwares(database.GetDB())
+	require.NoError(t, err)
+	assert.Len(t, firmwares, 1)
+	bins, _ := filepath.Glob(filepath.Join(firmwareDir, "*.bin"))
+	assert.Equal(t, []string{filepath.Join(firmwareDir, fileName)}, bins)
+}
+
+func TestFirmwareDeleteKeepsSharedFile(t *testing.T) {
+	s := setupFirmwareTest(t)
+	require.Equal(t, http.StatusOK, uploadFirmware(t, s, "1.0.0", []byte("firmware-a")).Code)
+	firmwares, err := database.ListFirmwares(database.GetDB())
+	require.NoError(t, err)
+	require.Len(t, firmwares, 1)
+	first := firmwares[0]
+
+	// 旧数据中两条记录引用同一文件
+	second := first
+	second.ID = 0
+	second.Version = "1.0.0-copy"
+	require.NoError(t, database.AddFirmware(database.GetDB(), &second))
+
+	deleteFirmware := func(id uint) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(id))}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/admin/firmware/"+strconv.Itoa(int(id)), nil)
+		s.handleFirmwareDelete(c)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+	path := filepath.Join(firmwareDir, first.FileName)
+
+	deleteFirmware(first.ID)
+	assert.FileExists(t, path, "仍被引用的文件不能删除")
+	deleteFirmware(second.ID)
+	assert.NoFileExists(t, path)
+}
+
+func TestImportLegacyFirmwareStartsAtZeroRollout(t *testing.T) {
+	setupFirmwareTest(t)
+	require.NoError(t, os.MkdirAll(firmwareDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(firmwareDir, "1.5.0.bin"), []byte("legacy"), 0644))
+
+	importLegacyFirmware()
+	importLegacyFirmware() // 已登记的文件不重复导入
+
+	firmwares, err := database.ListFirmwares(database.GetDB())
+	require.NoError(t, err)
+	require.Len(t, firmwares, 1)
+	assert.Equal(t, "1.5.0", firmwares[0].Version)
+	assert.Equal(t, 0, firmwares[0].RolloutPercent)
+
+	target := DeviceTarget{DeviceID: "aa:bb:cc:dd:ee:01", Version: "1.0.0"}
+	assert.Nil(t, SelectFirmware(firmwares, target, nil), "导入的固件未调整推送比例前不推送")
+}
@@ -4,15 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
 	"xiaozhi-server-go/src/core/utils"
 	"xiaozhi-server-go/src/httpsvr/webapi"
 	"xiaozhi-server-go/src/models"
@@ -244,22 +245,33 @@ func (s *DefaultOTAService) handlePostOTA(c *gin.Context) {
 		version = "1.0.0"
 	}
 
-	otaDir := filepath.Join(".", "ota_bin")
-	_ = os.MkdirAll(otaDir, 0755)
-	bins, _ := filepath.Glob(filepath.Join(otaDir, "*.bin"))
-	firmwareURL := ""
-	if len(bins) > 0 {
-		sort.Slice(bins, func(i, j int) bool {
-			return versionLess(bins[j], bins[i])
-		})
-		latest := filepath.Base(bins[0])
-		version = strings.TrimSuffix(latest, ".bin")
-		firmwareURL = "/ota_bin/" + latest
-	}
 	cfg := configs.Cfg
 	updateURL := cfg.Web.Websocket
 	deviceName := req.Board.Name
-	s.CheckAndUpdateDevice(c, cfg, req, deviceID, client_id, deviceName, version)
+	device := s.CheckAndUpdateDevice(c, cfg, req, deviceID, client_id, deviceName, version)
+	recordTelemetry(deviceID, device, req)
+
+	// 从固件库中按主板、芯片、应用与推送策略选择固件
+	firmwareURL := ""
+	fw := selectFirmwareForDevice(DeviceTarget{
+		DeviceID:  deviceID,
+		BoardType: req.Board.Type,
+		ChipModel: req.ChipModelName,
+		AppName:   req.Application.Name,
+		Version:   req.Application.Version,
+	})
+	if fw != nil {
+		version = fw.Version
+		firmwareURL = "/ota_bin/" + fw.FileName + "?device_id=" + url.QueryEscape(deviceID)
+		publishDeviceEvent(events.TypeFirmwareOffered, device, deviceID, map[string]interface{}{
+			"current_version": req.Application.Version,
+			"offered_version": fw.Version,
+			"firmware_id":     fw.ID,
+			"sha256":          fw.SHA256,
+			"url":             firmwareURL,
+		})
+		utils.DefaultLogger.Info("[固件] [推送] 设备 %s %s -> %s", deviceID, req.Application.Version, fw.Version)
+	}
 	resp := OtaFirmwareResponse{}
 	resp.ServerTime.Timestamp = time.Now().UnixNano() / 1e6
 	resp.ServerTime.TimezoneOffset = 8 * 60
@@ -331,6 +343,12 @@ func (s *DefaultOTAService) CheckAndUpdateDevice(
 				return err
 			} else {
 				utils.DefaultLogger.Info("新设备注册成功: %s", deviceID)
+				publishDeviceEvent(events.TypeDeviceRegistered, device, deviceID, map[string]interface{}{
+					"name":       device.Name,
+					"board_type": device.BoardType,
+					"chip_model": device.ChipModelName,
+					"version":    device.Version,
+				})
 			}
 		}
 
@@ -347,6 +365,20 @@ func (s *DefaultOTAService) CheckAndUpdateDevice(
 	return resultDevice
 }
 
+// publishDeviceEvent 发布设备相关的业务事件，未绑定用户的设备归属管理员
+func publishDeviceEvent(eventType string, device *models.Device, deviceID string, data map[string]interface{}) {
+	e := events.Event{Type: eventType, DeviceID: deviceID, UserID: database.AdminUserID, Data: data}
+	if device != nil {
+		if device.UserID != nil && *device.UserID != 0 {
+			e.UserID = *device.UserID
+		}
+		if device.AgentID != nil {
+			e.AgentID = *device.AgentID
+		}
+	}
+	events.Default().Publish(e)
+}
+
 // HandleFirmwareDownload 处理 /ota_bin/:filename 下载
 func (s *DefaultOTAService) HandleFirmwareDownload() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -366,7 +398,7 @@ func (s *DefaultOTAService) HandleFirmwareDownload() gin.HandlerFunc {
 			return
 		}
 
-		p := filepath.Join("ota_bin", filepath.FromSlash(clean))
+		p := filepath.Join(firmwareDir, filepath.FromSlash(clean))
 		//fmt.Println("Firmware download requested:", clean, "full path:", p)
 
 		fi, err := os.Stat(p)
@@ -375,12 +407,39 @@ func (s *DefaultOTAService) HandleFirmwareDownload() gin.HandlerFunc {
 			return
 		}
 
+		recordFirmwareDownload(c, filepath.Base(p))
+
 		c.Header("Content-Type", "application/octet-stream")
 		// 使用 gin 的 File 来处理范围请求与高效传输
 		c.File(p)
 	}
 }
 
+// recordFirmwareDownload 记录设备下载固件，设备ID来自推送地址中的 device_id 参数或 device-id 请求头
+func recordFirmwareDownload(c *gin.Context, fileName string) {
+	// 断点续传的后续分段不重复计数
+	if rng := c.GetHeader("Range"); rng != "" && !strings.HasPrefix(rng, "bytes=0-") {
+		return
+	}
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = c.GetHeader("device-id")
+	}
+	db := database.GetDB()
+	if deviceID == "" || db == nil {
+		return
+	}
+	fw, err := database.FindFirmwareByFileName(db, fileName)
+	if err != nil {
+		return
+	}
+	if err := database.RecordFirmwareDownloaded(db, fw.ID, deviceID, time.Now()); err != nil {
+		utils.DefaultLogger.Error("[固件] 记录下载失败: %v", err)
+		return
+	}
+	utils.DefaultLogger.Info("[固件] [下载] 设备 %s 版本 %s", deviceID, fw.Version)
+}
+
 // 按语义比较两个版本号 a < b
 func versionLess(a, b string) bool {
 	av := strings.Split(strings.TrimSuffix(filepath.Base(a), ".bin"), ".")
@@ -0,0 +1,118 @@
+package ota
+
+import (
+	"hash/fnv"
+	"strings"
+	"xiaozhi-server-go/src/models"
+)
+
+// DeviceTarget 选择固件时使用的设备信息，来自 OTA 请求体
+type DeviceTarget struct {
+	DeviceID  string
+	BoardType string
+	ChipModel string
+	AppName   string
+	Version   string // 设备当前固件版本
+}
+
+// splitList 解析逗号分隔的列表
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matchList 列表为空表示不限，否则不区分大小写匹配
+func matchList(list, value string) bool {
+	items := splitList(list)
+	if len(items) == 0 {
+		return true
+	}
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesTarget 判断固件是否适用于该设备的主板类型、芯片型号与应用名称
+func MatchesTarget(fw *models.Firmware, target DeviceTarget) bool {
+	if !matchList(fw.BoardTypes, target.BoardType) || !matchList(fw.ChipModels, target.ChipModel) {
+		return false
+	}
+	return fw.AppName == "" || strings.EqualFold(fw.AppName, target.AppName)
+}
+
+// RolloutBucket 设备在该版本推送中的分桶（0-99）。
+// 同一设备对同一版本的分桶固定，推送比例调大时已推送的设备保持在范围内
+func RolloutBucket(deviceID, version string) int {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	h.Write([]byte{0})
+	h.Write([]byte(version))
+	return int(h.Sum32() % 100)
+}
+
+// InRollout 判断设备是否在固件的推送范围内：白名单内的设备始终推送，其余按比例分桶
+func InRollout(fw *models.Firmware, deviceID string) bool {
+	for _, id := range splitList(fw.Allowlist) {
+		if strings.EqualFold(id, deviceID) {
+			return true
+		}
+	}
+	return RolloutBucket(deviceID, fw.Version) < fw.RolloutPercent
+}
+
+// isBlocked 判断版本是否被设备策略屏蔽
+func isBlocked(policy *models.DeviceFirmwarePolicy, version string) bool {
+	if policy == nil {
+		return false
+	}
+	for _, v := range splitList(policy.BlockedVersions) {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectFirmware 为设备选择要推送的固件，没有可推送的固件时返回nil。
+// 设备固定了版本时只推送该版本（可用于降级），不受推送比例与启用状态限制；
+// 否则在已启用、适用于该设备、未被屏蔽且在推送范围内的固件中选择高于当前版本的最新版本
+func SelectFirmware(firmwares []models.Firmware, target DeviceTarget, policy *models.DeviceFirmwarePolicy) *models.Firmware {
+	if policy != nil && policy.PinnedVersion != "" {
+		if policy.PinnedVersion == target.Version {
+			return nil
+		}
+		for i := range firmwares {
+			fw := &firmwares[i]
+			if fw.Version == policy.PinnedVersion && MatchesTarget(fw, target) {
+				return fw
+			}
+		}
+		return nil
+	}
+
+	var best *models.Firmware
+	for i := range firmwares {
+		fw := &firmwares[i]
+		if !fw.Enabled || !MatchesTarget(fw, target) || isBlocked(policy, fw.Version) {
+			continue
+		}
+		if target.Version != "" && !versionLess(target.Version, fw.Version) {
+			continue
+		}
+		if !InRollout(fw, target.DeviceID) {
+			continue
+		}
+		if best == nil || versionLess(best.Version, fw.Version) {
+			best = fw
+		}
+	}
+	return best
+}
@@ -0,0 +1,78 @@
+package ota
+
+import (
+	"fmt"
+	"testing"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFirmwares() []models.Firmware {
+	return []models.Firmware{
+		{ID: 1, Version: "1.6.0", BoardTypes: "lichuang-dev", RolloutPercent: 100, Enabled: true},
+		{ID: 2, Version: "1.7.0", BoardTypes: "lichuang-dev,bread-compact-wifi", RolloutPercent: 0, Allowlist: "aa:bb:cc:dd:ee:01", Enabled: true},
+		{ID: 3, Version: "1.8.0", BoardTypes: "atk-dnesp32s3-box", RolloutPercent: 100, Enabled: true},
+		{ID: 4, Version: "1.9.0", RolloutPercent: 100, Enabled: false},
+	}
+}
+
+func TestSelectFirmwareTargetsBoard(t *testing.T) {
+	target := DeviceTarget{DeviceID: "aa:bb:cc:dd:ee:99", BoardType: "lichuang-dev", Version: "1.5.0"}
+
+	fw := SelectFirmware(testFirmwares(), target, nil)
+	require.NotNil(t, fw)
+	assert.Equal(t, "1.6.0", fw.Version, "Other boards' and disabled firmware should be skipped")
+
+	target.Version = "1.6.0"
+	assert.Nil(t, SelectFirmware(testFirmwares(), target, nil), "Already up to date")
+}
+
+func TestSelectFirmwareAllowlist(t *testing.T) {
+	target := DeviceTarget{DeviceID: "AA:BB:CC:DD:EE:01", BoardType: "lichuang-dev", Version: "1.5.0"}
+
+	fw := SelectFirmware(testFirmwares(), target, nil)
+	require.NotNil(t, fw)
+	assert.Equal(t, "1.7.0", fw.Version, "Allowlisted device gets the staged version")
+}
+
+func TestSelectFirmwarePolicy(t *testing.T) {
+	target := DeviceTarget{DeviceID: "aa:bb:cc:dd:ee:01", BoardType: "lichuang-dev", Version: "1.7.0"}
+
+	pinned := &models.DeviceFirmwarePolicy{PinnedVersion: "1.6.0"}
+	fw := SelectFirmware(testFirmwares(), target, pinned)
+	require.NotNil(t, fw)
+	assert.Equal(t, "1.6.0", fw.Version, "Pinning allows rolling back")
+
+	target.Version = "1.5.0"
+	blocked := &models.DeviceFirmwarePolicy{BlockedVersions: "1.7.0"}
+	fw = SelectFirmware(testFirmwares(), target, blocked)
+	require.NotNil(t, fw)
+	assert.Equal(t, "1.6.0", fw.Version, "Blocked version should be skipped")
+}
+
+func TestMatchesTarget(t *testing.T) {
+	fw := &models.Firmware{ChipModels: "esp32s3", AppName: "xiaozhi"}
+	assert.True(t, MatchesTarget(fw, DeviceTarget{ChipModel: "ESP32S3", AppName: "xiaozhi"}))
+	assert.False(t, MatchesTarget(fw, DeviceTarget{ChipModel: "esp32c3", AppName: "xiaozhi"}))
+	assert.False(t, MatchesTarget(fw, DeviceTarget{ChipModel: "esp32s3", AppName: "other"}))
+}
+
+func TestRolloutPercentIsStable(t *testing.T) {
+	fw := &models.Firmware{Version: "2.0.0", RolloutPercent: 30}
+	included := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		if InRollout(fw, id) {
+			included[id] = true
+		}
+	}
+	assert.InDelta(t, 300, len(included), 60, "Roughly the requested share of devices")
+
+	fw.RolloutPercent = 60
+	for id := range included {
+		assert.True(t, InRollout(fw, id), "Raising the percentage keeps earlier devices in the rollout")
+	}
+	assert.False(t, InRollout(&models.Firmware{Version: "2.0.0"}, "device-1"))
+}
@@ -22,5 +22,9 @@ func (s *DefaultOTAService) Start(ctx context.Context, engine *gin.Engine, apiGr
 
 	apiGroup.GET("/ota_bin/*filepath", s.HandleFirmwareDownload())
 
+	// 固件管理
+	s.registerFirmwareRoutes(apiGroup)
+	importLegacyFirmware()
+
 	return nil
 }
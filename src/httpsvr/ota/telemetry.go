@@ -0,0 +1,48 @@
+package ota
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/core/telemetry"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+)
+
+// telemetrySample 从 OTA 请求体中提取设备健康数据
+func telemetrySample(deviceID string, req OTARequestBody) *models.DeviceTelemetry {
+	sample := &models.DeviceTelemetry{
+		DeviceID:   deviceID,
+		RecordedAt: time.Now(),
+		AppName:    req.Application.Name,
+		AppVersion: req.Application.Version,
+		IDFVersion: req.Application.IDFVersion,
+		BoardType:  req.Board.Type,
+		ChipModel:  req.ChipModelName,
+		IP:         req.Board.IP,
+		SSID:       req.Board.SSID,
+		Channel:    req.Board.Channel,
+		RSSI:       req.Board.RSSI,
+		FlashSize:  int64(req.FlashSize),
+		OTALabel:   req.OTA.Label,
+	}
+	if heap, err := strconv.ParseFloat(strings.TrimSpace(string(req.MinimumFreeHeapSize)), 64); err == nil {
+		sample.MinFreeHeap = int64(heap)
+	}
+	if len(req.PartitionTable) > 0 {
+		if data, err := json.Marshal(req.PartitionTable); err == nil {
+			sample.PartitionTable = string(data)
+		}
+	}
+	return sample
+}
+
+// recordTelemetry 保存本次 OTA 检查上报的健康数据，并检查设备所属用户的告警规则
+func recordTelemetry(deviceID string, device *models.Device, req OTARequestBody) {
+	var userID uint
+	if device != nil && device.UserID != nil {
+		userID = *device.UserID
+	}
+	telemetry.Record(utils.DefaultLogger, telemetrySample(deviceID, req), userID)
+}
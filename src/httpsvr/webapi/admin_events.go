@@ -0,0 +1,215 @@
+package webapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 事件流心跳间隔，避免代理因空闲断开连接
+const sseKeepAliveInterval = 15 * time.Second
+
+// 事件流token的有效期，token只能使用一次
+const streamTokenTTL = 30 * time.Second
+
+// streamToken 事件流专用的一次性token
+type streamToken struct {
+	userID   uint
+	username string
+	expireAt time.Time
+}
+
+var (
+	streamTokensMu sync.Mutex
+	streamTokens   = make(map[string]streamToken)
+)
+
+// issueStreamToken 为用户签发事件流token，同时清理已过期的token
+func issueStreamToken(userID uint, username string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	now := time.Now()
+
+	streamTokensMu.Lock()
+	defer streamTokensMu.Unlock()
+	for t, st := range streamTokens {
+		if now.After(st.expireAt) {
+			delete(streamTokens, t)
+		}
+	}
+	streamTokens[token] = streamToken{userID: userID, username: username, expireAt: now.Add(streamTokenTTL)}
+	return token, nil
+}
+
+// consumeStreamToken 校验并作废事件流token
+func consumeStreamToken(token string) (streamToken, bool) {
+	streamTokensMu.Lock()
+	defer streamTokensMu.Unlock()
+	st, ok := streamTokens[token]
+	if !ok {
+		return streamToken{}, false
+	}
+	delete(streamTokens, token)
+	return st, time.Now().Before(st.expireAt)
+}
+
+// StreamTokenMiddleware 浏览器 EventSource 无法设置请求头，允许通过 ?stream_token= 传递事件流token。
+// 事件流token有效期短且只能使用一次，出现在访问日志中也无法复用；未携带时按请求头认证
+func StreamTokenMiddleware() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		token := c.Query("stream_token")
+		if token == "" {
+			auth(c)
+			return
+		}
+		st, ok := consumeStreamToken(token)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "无效或已过期的事件流token"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", st.userID)
+		c.Set("username", st.username)
+		c.Next()
+	}
+}
+
+// handleStreamToken 签发事件流token
+// @Summary 获取事件流token
+// @Description 签发用于 ?stream_token= 的一次性token，有效期30秒。EventSource 断线重连前需要重新获取
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string]interface{} "token与有效期（秒）"
+// @Router /admin/sessions/events/token [post]
+func (s *DefaultAdminService) handleStreamToken(c *gin.Context) {
+	token, err := issueStreamToken(c.GetUint("user_id"), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": gin.H{
+		"token":      token,
+		"expires_in": int(streamTokenTTL.Seconds()),
+	}})
+}
+
+// handleAllSessionEvents 全部会话的实时事件流
+// @Summary 全部会话实时事件流(SSE)
+// @Description 管理员和观察员可接收全部会话的事件，普通用户只能接收自己设备的会话事件。可通过 types 参数按事件类型过滤，多个类型用逗号分隔
+// @Tags Admin
+// @Produce text/event-stream
+// @Param stream_token query string false "事件流token，无法设置请求头时使用"
+// @Param types query string false "事件类型过滤"
+// @Success 200 {object} events.Event "事件"
+// @Router /admin/sessions/events [get]
+func (s *DefaultAdminService) handleAllSessionEvents(c *gin.Context) {
+	s.streamSessionEvents(c, "")
+}
+
+// handleSessionEvents 单个会话的实时事件流
+// @Summary 会话实时事件流(SSE)
+// @Description 接收指定会话的连接、hello、ASR、LLM分段、工具调用、TTS分段、情绪与错误等事件，普通用户只能查看自己设备的会话
+// @Tags Admin
+// @Produce text/event-stream
+// @Param id path string true "会话ID或设备ID"
+// @Param stream_token query string false "事件流token，无法设置请求头时使用"
+// @Param types query string false "事件类型过滤"
+// @Success 200 {object} events.Event "事件"
+// @Router /admin/sessions/{id}/events [get]
+func (s *DefaultAdminService) handleSessionEvents(c *gin.Context) {
+	s.streamSessionEvents(c, c.Param("id"))
+}
+
+// streamSessionEvents 订阅事件总线并以SSE格式推送，sessionID为空时推送全部会话
+func (s *DefaultAdminService) streamSessionEvents(c *gin.Context, sessionID string) {
+	userID := c.GetUint("user_id")
+	user, err := database.GetUserByID(database.GetDB(), userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "权限不足"})
+		return
+	}
+	viewAll := user.Role == "admin" || user.Role == "observer"
+
+	if sessionID != "" && !viewAll && !s.ownsSession(sessionID, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "无权查看该会话"})
+		return
+	}
+
+	types := make(map[string]bool)
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+
+	sub := events.Default().Subscribe(func(e *events.Event) bool {
+		if sessionID != "" && e.SessionID != sessionID && e.DeviceID != sessionID {
+			return false
+		}
+		if !viewAll && e.UserID != userID {
+			return false
+		}
+		return len(types) == 0 || types[e.Type]
+	}, 0)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	s.logger.Info("[事件流] [订阅] 用户 %s 会话 %s", user.Username, sessionID)
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			s.logger.Info("[事件流] [断开] 用户 %s 会话 %s 丢弃 %d 条事件", user.Username, sessionID, sub.Dropped())
+			return
+		case <-ticker.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				s.logger.Error("[事件流] 序列化事件失败: %v", err)
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			c.Writer.Flush()
+		}
+	}
+}
+
+// ownsSession 判断会话对应的设备是否属于该用户，会话不在线时按设备ID判断
+func (s *DefaultAdminService) ownsSession(id string, userID uint) bool {
+	if s.sessions != nil {
+		for _, handler := range s.sessions.GetConnectionHandlers() {
+			if handler.GetSessionID() == id || handler.GetDeviceID() == id {
+				return handler.GetUserID() == userID
+			}
+		}
+	}
+	_, err := database.FindDeviceByIDAndUser(database.GetDB(), id, userID)
+	return err == nil
+}
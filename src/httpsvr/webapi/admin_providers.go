@@ -0,0 +1,62 @@
+package webapi
+
+import (
+	"net/http"
+	"sort"
+	"xiaozhi-server-go/src/core/providers/failover"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProviderHealth 提供者的熔断状态与当前使用该提供者的在线会话数
+type ProviderHealth struct {
+	failover.Status
+	ActiveSessions int `json:"active_sessions"`
+}
+
+type providerKey struct {
+	kind string
+	name string
+}
+
+// handleProviderHealth 提供者健康状态
+// @Summary 获取提供者容灾状态
+// @Description 列出LLM/TTS/ASR提供者的熔断状态、请求与失败次数、最近错误，以及当前使用各提供者的在线会话数
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} []ProviderHealth "提供者状态列表"
+// @Router /admin/providers/health [get]
+func (s *DefaultAdminService) handleProviderHealth(c *gin.Context) {
+	active := make(map[providerKey]int)
+	if s.sessions != nil {
+		for _, handler := range s.sessions.GetConnectionHandlers() {
+			if handler.IsClosed() {
+				continue
+			}
+			for kind, name := range handler.GetState().Providers {
+				active[providerKey{kind, name}]++
+			}
+		}
+	}
+
+	result := make([]ProviderHealth, 0)
+	for _, status := range failover.Statuses() {
+		key := providerKey{status.Kind, status.Name}
+		result = append(result, ProviderHealth{Status: status, ActiveSessions: active[key]})
+		delete(active, key)
+	}
+	// 未配置备用提供者的会话没有经过熔断器，同样列出使用情况
+	for key, count := range active {
+		result = append(result, ProviderHealth{
+			Status:         failover.Status{Kind: key.kind, Name: key.name, State: failover.StateClosed},
+			ActiveSessions: count,
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": result})
+}
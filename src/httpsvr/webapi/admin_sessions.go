@@ -0,0 +1,203 @@
+package webapi
+
+import (
+	"net/http"
+	"strings"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminSessionInfo 在线会话信息，在会话状态基础上补充设备、用户和智能体名称
+type AdminSessionInfo struct {
+	core.SessionState
+	DeviceName string `json:"device_name"`
+	Username   string `json:"username"`
+	AgentName  string `json:"agent_name"`
+}
+
+// AdminSessionTextRequest 注入文本请求体
+type AdminSessionTextRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// AdminSessionAgentRequest 切换智能体请求体
+type AdminSessionAgentRequest struct {
+	AgentID uint `json:"agent_id" binding:"required"`
+}
+
+// findSession 按会话ID或设备ID查找在线会话
+func (s *DefaultAdminService) findSession(c *gin.Context) *core.ConnectionHandler {
+	id := c.Param("id")
+	if s.sessions != nil && id != "" {
+		for _, handler := range s.sessions.GetConnectionHandlers() {
+			if handler.IsClosed() {
+				continue
+			}
+			if handler.GetSessionID() == id || handler.GetDeviceID() == id {
+				return handler
+			}
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	return nil
+}
+
+// handleSessionList 在线会话列表
+// @Summary 获取在线会话列表
+// @Description 列出所有在线会话的设备、用户、智能体、传输方式、拾音模式、对话轮次、播报状态、音频格式、连接时长与客户端IP
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} []AdminSessionInfo "在线会话列表"
+// @Router /admin/sessions [get]
+func (s *DefaultAdminService) handleSessionList(c *gin.Context) {
+	sessions := make([]AdminSessionInfo, 0)
+	if s.sessions == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": sessions})
+		return
+	}
+
+	db := database.GetDB()
+	usernames := make(map[uint]string)
+	agentNames := make(map[uint]string)
+	for _, handler := range s.sessions.GetConnectionHandlers() {
+		if handler.IsClosed() {
+			continue
+		}
+		info := AdminSessionInfo{SessionState: handler.GetState()}
+
+		if device, err := database.FindDeviceByID(db, info.DeviceID); err == nil {
+			info.DeviceName = device.Name
+		}
+		if info.UserID != 0 {
+			if _, ok := usernames[info.UserID]; !ok {
+				if user, err := database.GetUserByID(db, info.UserID); err == nil {
+					usernames[info.UserID] = user.Username
+				}
+			}
+			info.Username = usernames[info.UserID]
+		}
+		if info.AgentID != 0 {
+			if _, ok := agentNames[info.AgentID]; !ok {
+				if agent, err := database.GetAgentByID(db, info.AgentID); err == nil {
+					agentNames[info.AgentID] = agent.Name
+				}
+			}
+			info.AgentName = agentNames[info.AgentID]
+		}
+		sessions = append(sessions, info)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": sessions})
+}
+
+// handleSessionGet 在线会话详情
+// @Summary 获取在线会话详情
+// @Tags Admin
+// @Produce json
+// @Param id path string true "会话ID或设备ID"
+// @Success 200 {object} core.SessionState "会话状态"
+// @Router /admin/sessions/{id} [get]
+func (s *DefaultAdminService) handleSessionGet(c *gin.Context) {
+	handler := s.findSession(c)
+	if handler == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": handler.GetState()})
+}
+
+// handleSessionDisconnect 断开会话
+// @Summary 断开在线会话
+// @Tags Admin
+// @Produce json
+// @Param id path string true "会话ID或设备ID"
+// @Success 200 {object} map[string]string "断开成功"
+// @Router /admin/sessions/{id} [delete]
+func (s *DefaultAdminService) handleSessionDisconnect(c *gin.Context) {
+	handler := s.findSession(c)
+	if handler == nil {
+		return
+	}
+	handler.Disconnect()
+	s.logger.Info("[会话管理] [断开] 设备 %s 会话 %s", handler.GetDeviceID(), handler.GetSessionID())
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "会话已断开"})
+}
+
+// handleSessionInjectText 以用户身份注入一轮文本对话
+// @Summary 注入文本对话
+// @Description 将文本作为用户说的话发起一轮对话，回复会在设备上播放
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "会话ID或设备ID"
+// @Param data body AdminSessionTextRequest true "文本"
+// @Success 200 {object} map[string]string "已发起对话"
+// @Router /admin/sessions/{id}/text [post]
+func (s *DefaultAdminService) handleSessionInjectText(c *gin.Context) {
+	var req AdminSessionTextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	handler := s.findSession(c)
+	if handler == nil {
+		return
+	}
+	if err := handler.StartConversation(req.Text); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Info("[会话管理] [注入文本] 设备 %s: %s", handler.GetDeviceID(), strings.TrimSpace(req.Text))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "已发起对话"})
+}
+
+// handleSessionSwitchAgent 切换会话智能体
+// @Summary 切换会话智能体
+// @Description 立即切换在线会话使用的智能体，并更新设备绑定
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "会话ID或设备ID"
+// @Param data body AdminSessionAgentRequest true "智能体ID"
+// @Success 200 {object} core.SessionState "切换后的会话状态"
+// @Router /admin/sessions/{id}/agent [put]
+func (s *DefaultAdminService) handleSessionSwitchAgent(c *gin.Context) {
+	var req AdminSessionAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := database.GetAgentByID(database.GetDB(), req.AgentID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	handler := s.findSession(c)
+	if handler == nil {
+		return
+	}
+	if _, err := handler.SwitchAgent(req.AgentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Info("[会话管理] [切换智能体] 设备 %s -> %d", handler.GetDeviceID(), req.AgentID)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": handler.GetState()})
+}
+
+// handleSessionAbort 中止会话当前播报
+// @Summary 中止当前播报
+// @Tags Admin
+// @Produce json
+// @Param id path string true "会话ID或设备ID"
+// @Success 200 {object} map[string]string "已中止"
+// @Router /admin/sessions/{id}/abort [post]
+func (s *DefaultAdminService) handleSessionAbort(c *gin.Context) {
+	handler := s.findSession(c)
+	if handler == nil {
+		return
+	}
+	if err := handler.AbortSpeech(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "已中止播报"})
+}
@@ -1,8 +1,11 @@
 package webapi
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 	"xiaozhi-server-go/src/configs/database"
 	"xiaozhi-server-go/src/models"
@@ -13,15 +16,85 @@ import (
 
 // 创建Agent请求体
 type AgentCreateRequest struct {
-	Prompt     string `json:"prompt"`
-	Name       string `json:"name"` // 智能体名称
-	LLM        string `json:"LLM"`
-	Language   string `json:"language"`   // 语言，默认为中文
-	Voice      string `json:"voice"`      // 语音，默认为湾湾小何的音色id
-	VoiceName  string `json:"voiceName"`  // 语音名称，默认为湾湾小何
-	ASRSpeed   int    `json:"asrSpeed"`   // ASR 语音识别速度，1=耐心，2=正常，3=快速
-	SpeakSpeed int    `json:"speakSpeed"` // TTS 角色语速，1=慢速，2=正常，3=快速
-	Tone       int    `json:"tone"`       // TTS 角色音调，1-100，低音-高音
+	Prompt       string                 `json:"prompt"`
+	Name         string                 `json:"name"` // 智能体名称
+	LLM          string                 `json:"LLM"`
+	Language     string                 `json:"language"`     // 语言，默认为中文
+	Voice        string                 `json:"voice"`        // 语音，默认为湾湾小何的音色id
+	VoiceName    string                 `json:"voiceName"`    // 语音名称，默认为湾湾小何
+	ASRSpeed     int                    `json:"asrSpeed"`     // ASR 语音识别速度，1=耐心，2=正常，3=快速
+	SpeakSpeed   int                    `json:"speakSpeed"`   // TTS 角色语速，1=慢速，2=正常，3=快速
+	Tone         int                    `json:"tone"`         // TTS 角色音调，1-100，低音-高音
+	LLMFallbacks []string               `json:"llmFallbacks"` // 备用LLM配置名称，按优先级排列
+	TTSFallbacks []string               `json:"ttsFallbacks"` // 备用TTS配置名称，按优先级排列
+	ASRFallbacks []string               `json:"asrFallbacks"` // 备用ASR配置名称，按优先级排列
+	LLMParams    *models.AgentLLMParams `json:"llmParams"`    // 覆盖的模型名称与采样参数，更新时为空表示保持不变
+}
+
+// joinFallbacks 备用提供者列表转换为逗号分隔的字符串，去除空白和重复项
+func joinFallbacks(names []string) string {
+	result := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return strings.Join(result, ",")
+}
+
+// setAgentLLMParams 校验模型覆盖参数并写入 Agent.Extra 的 llm_params，保留 Extra 中的其他字段
+func setAgentLLMParams(agent *models.Agent, params *models.AgentLLMParams) error {
+	if params == nil {
+		return nil
+	}
+	inRange := func(name string, v *float64, min, max float64) error {
+		if v != nil && (*v < min || *v > max) {
+			return fmt.Errorf("%s 取值范围为 %v~%v", name, min, max)
+		}
+		return nil
+	}
+	if err := inRange("temperature", params.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := inRange("top_p", params.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := inRange("presence_penalty", params.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := inRange("frequency_penalty", params.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if params.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens 不能为负数")
+	}
+	switch params.ReasoningEffort {
+	case "", "low", "medium", "high":
+	default:
+		return fmt.Errorf("reasoning_effort 只能为 low/medium/high")
+	}
+
+	extra := make(map[string]interface{})
+	if agent.Extra != "" {
+		if err := json.Unmarshal([]byte(agent.Extra), &extra); err != nil {
+			return fmt.Errorf("智能体 extra 字段格式错误: %v", err)
+		}
+	}
+	if data, _ := json.Marshal(params); string(data) == "{}" {
+		delete(extra, "llm_params") // 全部为空表示恢复使用LLM配置
+	} else {
+		extra["llm_params"] = params
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+	agent.Extra = string(data)
+	return nil
 }
 
 // handleAgentCreate 创建Agent请求体
@@ -41,18 +114,25 @@ func (s *DefaultUserService) handleAgentCreate(c *gin.Context) {
 		return
 	}
 	agent := &models.Agent{
-		Prompt:     req.Prompt,
-		Name:       req.Name,
-		LLM:        req.LLM,
-		Language:   req.Language,
-		Voice:      req.Voice,
-		VoiceName:  req.VoiceName,
-		ASRSpeed:   req.ASRSpeed,
-		SpeakSpeed: req.SpeakSpeed,
-		Tone:       req.Tone,
-		UserID:     userID,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		Prompt:       req.Prompt,
+		Name:         req.Name,
+		LLM:          req.LLM,
+		Language:     req.Language,
+		Voice:        req.Voice,
+		VoiceName:    req.VoiceName,
+		ASRSpeed:     req.ASRSpeed,
+		SpeakSpeed:   req.SpeakSpeed,
+		Tone:         req.Tone,
+		LLMFallbacks: joinFallbacks(req.LLMFallbacks),
+		TTSFallbacks: joinFallbacks(req.TTSFallbacks),
+		ASRFallbacks: joinFallbacks(req.ASRFallbacks),
+		UserID:       userID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := setAgentLLMParams(agent, req.LLMParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	WithTx(c, func(tx *gorm.DB) error {
 		if err := database.CreateAgent(tx, agent); err != nil {
@@ -161,6 +241,13 @@ func (s *DefaultUserService) handleAgentUpdate(c *gin.Context) {
 		agent.ASRSpeed = req.ASRSpeed
 		agent.SpeakSpeed = req.SpeakSpeed
 		agent.Tone = req.Tone
+		agent.LLMFallbacks = joinFallbacks(req.LLMFallbacks)
+		agent.TTSFallbacks = joinFallbacks(req.TTSFallbacks)
+		agent.ASRFallbacks = joinFallbacks(req.ASRFallbacks)
+		if err := setAgentLLMParams(agent, req.LLMParams); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return err
+		}
 		agent.UpdatedAt = time.Now() // 更新修改时间
 		if agent.CreatedAt.IsZero() {
 			agent.CreatedAt = time.Now() // 如果没有设置创建时间，则设置为当前时间
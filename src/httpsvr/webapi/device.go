@@ -107,6 +107,40 @@ func (s *DefaultUserService) handleDeviceGet(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": device})
 }
 
+// handleDeviceConnections 设备连接历史
+// @Summary 获取设备连接历史
+// @Description 按连接时间倒序返回设备的连接记录，包括连接时间、时长、对话轮次与断开原因，disconnectedAt 为空表示当前在线
+// @Tags Device
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param limit query int false "条数，默认50"
+// @Success 200 {object} []models.DeviceConnection "连接记录"
+// @Router /user/device/{id}/connections [get]
+func (s *DefaultUserService) handleDeviceConnections(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	db := database.GetDB()
+	device, err := database.FindDeviceByIDAndUser(db, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	conns, err := database.ListDeviceConnections(db, device.DeviceID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "ok",
+		"data":           conns,
+		"online":         device.Online,
+		"lastActiveTime": device.LastActiveTimeV2,
+	})
+}
+
 // handleDeviceUpdate 设备更新
 // @Summary 更新设备信息
 // @Description 更新指定ID的设备信息
@@ -0,0 +1,351 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 单次设备工具调用的超时时间
+	deviceToolCallTimeout = 30 * time.Second
+	// 单个预设最多包含的工具调用数
+	maxPresetActions = 20
+)
+
+// DeviceToolCallRequest 设备工具调用请求体
+// @Description name 为设备上报的工具名，如 self.audio_speaker.set_volume
+type DeviceToolCallRequest struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// PresetAction 预设中的一次工具调用
+type PresetAction struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// DevicePresetRequest 设备预设创建/更新请求体
+// @Description device_id 为空表示预设可用于全部设备；actions 按顺序执行
+type DevicePresetRequest struct {
+	Name        string         `json:"name"`
+	DeviceID    *string        `json:"device_id,omitempty"`
+	Description *string        `json:"description,omitempty"`
+	Actions     []PresetAction `json:"actions"`
+}
+
+// PresetActionResult 预设中单次工具调用的结果
+type PresetActionResult struct {
+	Tool    string `json:"tool"`
+	Success bool   `json:"success"`
+	Result  string `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// findOnlineDevice 校验设备归属并获取在线会话，失败时已写入响应
+func (s *DefaultUserService) findOnlineDevice(c *gin.Context) *core.ConnectionHandler {
+	deviceID := c.Param("id")
+	if _, err := database.FindDeviceByIDAndUser(database.GetDB(), deviceID, c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return nil
+	}
+	var handler *core.ConnectionHandler
+	if s.sessions != nil {
+		handler = s.sessions.FindConnectionHandler(deviceID)
+	}
+	if handler == nil {
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "code": sayStatusOffline, "message": "设备不在线"})
+		return nil
+	}
+	return handler
+}
+
+// handleDeviceTools 设备工具列表
+// @Summary 获取设备MCP工具
+// @Description 返回在线设备上报的MCP工具及其参数Schema，如音量、亮度等控制工具
+// @Tags Device
+// @Produce json
+// @Param id path string true "设备ID"
+// @Success 200 {object} []map[string]interface{} "工具列表"
+// @Failure 409 {object} map[string]string "设备不在线"
+// @Router /user/device/{id}/tools [get]
+func (s *DefaultUserService) handleDeviceTools(c *gin.Context) {
+	handler := s.findOnlineDevice(c)
+	if handler == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": handler.ListDeviceTools()})
+}
+
+// handleDeviceToolCall 调用设备工具
+// @Summary 调用设备MCP工具
+// @Description 直接调用在线设备的MCP工具并同步返回结果，不经过对话
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param data body DeviceToolCallRequest true "工具调用参数"
+// @Success 200 {object} PresetActionResult "调用结果"
+// @Failure 409 {object} map[string]string "设备不在线"
+// @Router /user/device/{id}/tools/call [post]
+func (s *DefaultUserService) handleDeviceToolCall(c *gin.Context) {
+	var req DeviceToolCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name 不能为空"})
+		return
+	}
+	handler := s.findOnlineDevice(c)
+	if handler == nil {
+		return
+	}
+
+	result := s.callDeviceTool(c.Request.Context(), handler, PresetAction{Tool: req.Name, Arguments: req.Arguments})
+	if !result.Success {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "code": "tool_error", "message": result.Error})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": result})
+}
+
+// callDeviceTool 调用一次设备工具并记录日志
+func (s *DefaultUserService) callDeviceTool(ctx context.Context, handler *core.ConnectionHandler, action PresetAction) PresetActionResult {
+	callCtx, cancel := context.WithTimeout(ctx, deviceToolCallTimeout)
+	defer cancel()
+
+	result := PresetActionResult{Tool: action.Tool}
+	text, err := handler.CallDeviceTool(callCtx, action.Tool, action.Arguments)
+	if err != nil {
+		result.Error = err.Error()
+		s.logger.Warn("[设备控制] [%s] 调用 %s 失败: %v", handler.GetDeviceID(), action.Tool, err)
+		return result
+	}
+	result.Success = true
+	result.Result = text
+	s.logger.Info("[设备控制] [%s] 调用 %s 成功", handler.GetDeviceID(), action.Tool)
+	return result
+}
+
+// handleDevicePresetList 设备预设列表
+// @Summary 获取设备预设
+// @Tags Device
+// @Produce json
+// @Param device_id query string false "只返回适用于该设备的预设"
+// @Success 200 {object} []models.DevicePreset "预设列表"
+// @Router /user/device/presets [get]
+func (s *DefaultUserService) handleDevicePresetList(c *gin.Context) {
+	presets, err := database.ListDevicePresetsByUser(database.GetDB(), c.GetUint("user_id"), c.Query("device_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": presets})
+}
+
+// handleDevicePresetCreate 创建设备预设
+// @Summary 创建设备预设
+// @Description 保存一组设备工具调用，如“夜间模式”同时调低音量和屏幕亮度
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param data body DevicePresetRequest true "预设参数"
+// @Success 200 {object} models.DevicePreset "预设"
+// @Router /user/device/presets [post]
+func (s *DefaultUserService) handleDevicePresetCreate(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req DevicePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	preset := &models.DevicePreset{UserID: userID}
+	if !s.savePreset(c, preset, &req, true) {
+		return
+	}
+	s.logger.Info("[设备控制] [预设] 用户 %d 创建预设 %s", userID, preset.Name)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": preset})
+}
+
+// handleDevicePresetUpdate 更新设备预设
+// @Summary 更新设备预设
+// @Description 未填写的字段保持不变
+// @Tags Device
+// @Accept json
+// @Produce json
+// @Param preset_id path int true "预设ID"
+// @Param data body DevicePresetRequest true "预设参数"
+// @Success 200 {object} models.DevicePreset "预设"
+// @Router /user/device/presets/{preset_id} [put]
+func (s *DefaultUserService) handleDevicePresetUpdate(c *gin.Context) {
+	var req DevicePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	preset := findDevicePreset(c)
+	if preset == nil {
+		return
+	}
+	if !s.savePreset(c, preset, &req, false) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": preset})
+}
+
+// handleDevicePresetDelete 删除设备预设
+// @Summary 删除设备预设
+// @Tags Device
+// @Produce json
+// @Param preset_id path int true "预设ID"
+// @Success 200 {object} map[string]string "删除成功"
+// @Router /user/device/presets/{preset_id} [delete]
+func (s *DefaultUserService) handleDevicePresetDelete(c *gin.Context) {
+	preset := findDevicePreset(c)
+	if preset == nil {
+		return
+	}
+	if err := database.DeleteDevicePreset(database.GetDB(), preset.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "删除成功"})
+}
+
+// handleDevicePresetApply 应用设备预设
+// @Summary 在设备上应用预设
+// @Description 按顺序调用预设中的设备工具，某一步失败不影响后续步骤，返回每一步的结果
+// @Tags Device
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param preset_id path int true "预设ID"
+// @Success 200 {object} []PresetActionResult "各步骤结果"
+// @Failure 409 {object} map[string]string "设备不在线"
+// @Router /user/device/{id}/presets/{preset_id}/apply [post]
+func (s *DefaultUserService) handleDevicePresetApply(c *gin.Context) {
+	preset := findDevicePreset(c)
+	if preset == nil {
+		return
+	}
+	if preset.DeviceID != "" && preset.DeviceID != c.Param("id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "预设不适用于该设备"})
+		return
+	}
+	var actions []PresetAction
+	if err := json.Unmarshal(preset.Actions, &actions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("预设内容解析失败: %v", err)})
+		return
+	}
+	handler := s.findOnlineDevice(c)
+	if handler == nil {
+		return
+	}
+
+	results := make([]PresetActionResult, 0, len(actions))
+	succeeded := 0
+	for _, action := range actions {
+		result := s.callDeviceTool(c.Request.Context(), handler, action)
+		if result.Success {
+			succeeded++
+		}
+		results = append(results, result)
+	}
+	s.logger.Info("[设备控制] [预设] 设备 %s 应用预设 %s，成功 %d/%d", handler.GetDeviceID(), preset.Name, succeeded, len(actions))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": results, "succeeded": succeeded, "total": len(actions)})
+}
+
+// findDevicePreset 按路径参数查询当前用户的设备预设
+func findDevicePreset(c *gin.Context) *models.DevicePreset {
+	id, err := strconv.Atoi(c.Param("preset_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid preset id"})
+		return nil
+	}
+	preset, err := database.FindDevicePresetByIDAndUser(database.GetDB(), uint(id), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "preset not found"})
+		return nil
+	}
+	return preset
+}
+
+// savePreset 将请求合并到预设中，校验后保存，失败时已写入响应
+func (s *DefaultUserService) savePreset(c *gin.Context, preset *models.DevicePreset, req *DevicePresetRequest, create bool) bool {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		preset.Name = name
+	}
+	if req.DeviceID != nil {
+		preset.DeviceID = strings.TrimSpace(*req.DeviceID)
+	}
+	if req.Description != nil {
+		preset.Description = *req.Description
+	}
+	if req.Actions != nil || create {
+		actions, err := normalizePresetActions(req.Actions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		data, err := json.Marshal(actions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		preset.Actions = data
+	}
+	if preset.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name 不能为空"})
+		return false
+	}
+
+	db := database.GetDB()
+	if preset.DeviceID != "" {
+		if _, err := database.FindDeviceByIDAndUser(db, preset.DeviceID, preset.UserID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			return false
+		}
+	}
+	var err error
+	if create {
+		err = database.AddDevicePreset(db, preset)
+	} else {
+		err = database.UpdateDevicePreset(db, preset)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// normalizePresetActions 校验预设的工具调用列表
+func normalizePresetActions(actions []PresetAction) ([]PresetAction, error) {
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("actions 不能为空")
+	}
+	if len(actions) > maxPresetActions {
+		return nil, fmt.Errorf("单个预设最多包含 %d 个工具调用", maxPresetActions)
+	}
+	result := make([]PresetAction, 0, len(actions))
+	for i, action := range actions {
+		action.Tool = strings.TrimSpace(action.Tool)
+		if action.Tool == "" {
+			return nil, fmt.Errorf("第 %d 个工具调用缺少 tool", i+1)
+		}
+		result = append(result, action)
+	}
+	return result, nil
+}
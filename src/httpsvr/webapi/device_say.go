@@ -0,0 +1,299 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 播报音频的保存目录
+	announceAudioDir = "tmp/announce"
+	// 离线暂存播报的默认有效期
+	defaultAnnounceExpire = 24 * time.Hour
+	// 播报音频文件大小上限
+	maxAnnounceAudioSize = 10 << 20
+)
+
+// 单个设备的播报结果
+const (
+	sayStatusPlayed  = "played"  // 已下发到在线设备
+	sayStatusQueued  = "queued"  // 设备离线，已暂存待下次连接时播报
+	sayStatusOffline = "offline" // 设备离线且未暂存
+	sayStatusError   = "error"   // 下发失败
+)
+
+// DeviceSayRequest 设备播报请求体
+// @Description 让设备播报一段文本，multipart 方式可上传 audio 音频文件(wav/mp3)代替文本
+type DeviceSayRequest struct {
+	Text           string `json:"text"             form:"text"`
+	Interrupt      bool   `json:"interrupt"        form:"interrupt"`        // 打断当前播报，否则排队等待当前播报结束
+	QueueIfOffline bool   `json:"queue_if_offline" form:"queue_if_offline"` // 设备离线时暂存，下次连接时播报
+	ExpireMinutes  int    `json:"expire_minutes"   form:"expire_minutes"`   // 暂存有效期（分钟），默认24小时
+}
+
+// DeviceBroadcastRequest 设备组播报请求体
+// @Description 向多个设备播报，device_ids 与 agent_id 二选一，agent_id 表示该智能体下的全部设备
+type DeviceBroadcastRequest struct {
+	DeviceSayRequest
+	DeviceIDs []string `json:"device_ids" form:"device_ids"`
+	AgentID   uint     `json:"agent_id"   form:"agent_id"`
+}
+
+// DeviceSayResult 单个设备的播报结果
+type DeviceSayResult struct {
+	DeviceID string `json:"device_id"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+}
+
+// handleDeviceSay 让单个设备播报
+// @Summary 设备播报
+// @Description 让在线设备播报文本或音频，设备离线时可选择暂存到下次连接时播报
+// @Tags Device
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param data body DeviceSayRequest true "播报参数"
+// @Success 200 {object} DeviceSayResult "播报结果"
+// @Failure 409 {object} map[string]string "设备不在线"
+// @Router /user/device/{id}/say [post]
+func (s *DefaultUserService) handleDeviceSay(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	deviceID := c.Param("id")
+
+	var req DeviceSayRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audioPath, err := s.saveAnnounceAudio(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" && audioPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text 和 audio 不能同时为空"})
+		return
+	}
+
+	if _, err := database.FindDeviceByIDAndUser(database.GetDB(), deviceID, userID); err != nil {
+		removeAnnounceAudio(audioPath)
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return
+	}
+
+	result := s.sayToDevice(userID, deviceID, req, audioPath)
+	switch result.Status {
+	case sayStatusOffline:
+		removeAnnounceAudio(audioPath)
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "code": sayStatusOffline, "message": "设备不在线"})
+	case sayStatusError:
+		removeAnnounceAudio(audioPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "code": sayStatusError, "message": result.Message})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": result})
+	}
+}
+
+// handleDeviceBroadcast 向设备组播报
+// @Summary 设备组播报
+// @Description 向指定的多个设备或某个智能体下的全部设备播报文本或音频，返回每个设备的播报结果
+// @Tags Device
+// @Accept json,mpfd
+// @Produce json
+// @Param data body DeviceBroadcastRequest true "播报参数"
+// @Success 200 {object} []DeviceSayResult "各设备播报结果"
+// @Router /user/device/broadcast [post]
+func (s *DefaultUserService) handleDeviceBroadcast(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req DeviceBroadcastRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audioPath, err := s.saveAnnounceAudio(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 每个设备使用独立的音频副本，原始上传文件处理完后删除
+	defer removeAnnounceAudio(audioPath)
+
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" && audioPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text 和 audio 不能同时为空"})
+		return
+	}
+
+	deviceIDs, err := s.resolveBroadcastDevices(userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]DeviceSayResult, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		devicePath := ""
+		if audioPath != "" {
+			devicePath = announceAudioPath(deviceID, filepath.Ext(audioPath))
+			if err := utils.CopyAudioFile(audioPath, devicePath); err != nil {
+				results = append(results, DeviceSayResult{DeviceID: deviceID, Status: sayStatusError, Message: err.Error()})
+				continue
+			}
+		}
+		result := s.sayToDevice(userID, deviceID, req.DeviceSayRequest, devicePath)
+		if result.Status == sayStatusOffline || result.Status == sayStatusError {
+			removeAnnounceAudio(devicePath)
+		}
+		results = append(results, result)
+	}
+
+	s.logger.Info("[播报] [广播] 用户 %d 向 %d 个设备播报", userID, len(results))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": results})
+}
+
+// resolveBroadcastDevices 解析广播目标，只保留属于当前用户的设备
+func (s *DefaultUserService) resolveBroadcastDevices(userID uint, req DeviceBroadcastRequest) ([]string, error) {
+	db := database.GetDB()
+	deviceIDs := make([]string, 0)
+
+	if len(req.DeviceIDs) > 0 {
+		seen := make(map[string]bool)
+		for _, id := range req.DeviceIDs {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if _, err := database.FindDeviceByIDAndUser(db, id, userID); err != nil {
+				return nil, fmt.Errorf("设备 %s 不存在", id)
+			}
+			deviceIDs = append(deviceIDs, id)
+		}
+	} else if req.AgentID != 0 {
+		if _, err := database.GetAgentByIDAndUser(db, req.AgentID, userID); err != nil {
+			return nil, fmt.Errorf("智能体 %d 不存在", req.AgentID)
+		}
+		devices, err := database.ListDevicesByAgent(db, req.AgentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if device.UserID != nil && *device.UserID == userID {
+				deviceIDs = append(deviceIDs, device.DeviceID)
+			}
+		}
+	}
+
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("device_ids 和 agent_id 至少需要指定一个有效目标")
+	}
+	return deviceIDs, nil
+}
+
+// sayToDevice 向单个设备下发播报，设备离线时按请求决定是否暂存
+func (s *DefaultUserService) sayToDevice(userID uint, deviceID string, req DeviceSayRequest, audioPath string) DeviceSayResult {
+	result := DeviceSayResult{DeviceID: deviceID}
+
+	if s.sessions != nil {
+		if handler := s.sessions.FindConnectionHandler(deviceID); handler != nil {
+			err := handler.Announce(core.Announcement{
+				Text:      req.Text,
+				AudioPath: audioPath,
+				Interrupt: req.Interrupt,
+			})
+			if err == nil {
+				s.logger.Info("[播报] [设备 %s] text=%s audio=%s", deviceID, req.Text, audioPath)
+				result.Status = sayStatusPlayed
+				return result
+			}
+			if !handler.IsClosed() {
+				result.Status = sayStatusError
+				result.Message = err.Error()
+				return result
+			}
+			// 连接在下发前已关闭，按离线处理
+		}
+	}
+
+	if !req.QueueIfOffline {
+		result.Status = sayStatusOffline
+		return result
+	}
+
+	expire := defaultAnnounceExpire
+	if req.ExpireMinutes > 0 {
+		expire = time.Duration(req.ExpireMinutes) * time.Minute
+	}
+	announcement := &models.DeviceAnnouncement{
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Text:      req.Text,
+		AudioPath: audioPath,
+		ExpireAt:  time.Now().Add(expire),
+	}
+	if err := database.AddDeviceAnnouncement(database.GetDB(), announcement); err != nil {
+		result.Status = sayStatusError
+		result.Message = err.Error()
+		return result
+	}
+	s.logger.Info("[播报] [设备 %s] 设备离线，已暂存播报 %d", deviceID, announcement.ID)
+	result.Status = sayStatusQueued
+	return result
+}
+
+// saveAnnounceAudio 保存上传的播报音频，未上传时返回空路径
+func (s *DefaultUserService) saveAnnounceAudio(c *gin.Context) (string, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return "", nil
+	}
+	file, err := c.FormFile("audio")
+	if err != nil {
+		if err == http.ErrMissingFile {
+			return "", nil
+		}
+		return "", err
+	}
+	if file.Size > maxAnnounceAudioSize {
+		return "", fmt.Errorf("音频文件不能超过 %dMB", maxAnnounceAudioSize>>20)
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".wav" && ext != ".mp3" {
+		return "", fmt.Errorf("仅支持 wav 和 mp3 格式的音频")
+	}
+
+	if err := os.MkdirAll(announceAudioDir, 0o755); err != nil {
+		return "", fmt.Errorf("创建音频目录失败: %v", err)
+	}
+	path := announceAudioPath("upload", ext)
+	if err := c.SaveUploadedFile(file, path); err != nil {
+		return "", fmt.Errorf("保存音频文件失败: %v", err)
+	}
+	return path, nil
+}
+
+// announceAudioPath 生成播报音频的保存路径
+func announceAudioPath(prefix, ext string) string {
+	name := strings.NewReplacer(":", "_", "/", "_").Replace(prefix)
+	return filepath.Join(announceAudioDir,
+		name+"_"+strconv.FormatInt(time.Now().UnixNano(), 10)+ext)
+}
+
+func removeAnnounceAudio(path string) {
+	if path != "" {
+		os.Remove(path)
+	}
+}
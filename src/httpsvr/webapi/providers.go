@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/providers/llm"
 
 	"github.com/gin-gonic/gin"
 )
@@ -144,6 +145,14 @@ func (s *DefaultAdminService) handleSystemProvidersCreate(c *gin.Context) {
 		return
 	}
 
+	if err := validateLLMType(requestData.Type, requestData.Data); err != nil {
+		c.JSON(400, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 检查是否已存在相同名称的Provider
 	existingProvider, err := database.GetProviderByName(requestData.Type, requestData.Name)
 	if err == nil && existingProvider != "" {
@@ -216,6 +225,14 @@ func (s *DefaultAdminService) handleSystemProvidersUpdate(c *gin.Context) {
 		return
 	}
 
+	if err := validateLLMType(providerType, requestData.Data); err != nil {
+		c.JSON(400, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	s.logger.Info("Updating provider: type=%s, name=%s", providerType, name)
 
 	if err := database.UpdateProvider(providerType, name, requestData.Data, database.AdminUserID); err != nil {
@@ -356,6 +373,14 @@ func (s *DefaultUserService) handleUserProvidersCreate(c *gin.Context) {
 		return
 	}
 
+	if err := validateLLMType(requestData.Type, requestData.Data); err != nil {
+		c.JSON(400, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 检查是否已存在相同名称的Provider
 	existingProvider, err := database.GetProviderByName(requestData.Type, requestData.Name)
 	if err == nil && existingProvider != "" {
@@ -498,6 +523,14 @@ func (s *DefaultUserService) handleUserProvidersUpdate(c *gin.Context) {
 		return
 	}
 
+	if err := validateLLMType(providerType, requestData.Data); err != nil {
+		c.JSON(400, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	updataUserID := user.ID
 	if user.Role == "admin" {
 		updataUserID = 1
@@ -519,3 +552,21 @@ func (s *DefaultUserService) handleUserProvidersUpdate(c *gin.Context) {
 		"message": fmt.Sprintf("Provider %s/%s updated successfully", providerType, name),
 	})
 }
+
+// validateLLMType 检查LLM提供者配置中的 type 是否为已注册的LLM类型，如 openai/anthropic
+func validateLLMType(providerType string, data interface{}) error {
+	if providerType != "LLM" {
+		return nil
+	}
+	config, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	subType, _ := config["type"].(string)
+	for _, t := range llm.Types() {
+		if t == subType {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的LLM类型: %s，可选: %v", subType, llm.Types())
+}
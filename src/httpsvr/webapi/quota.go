@@ -0,0 +1,238 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/quota"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// 用量明细默认查询的天数
+	defaultUsageDays = 7
+	// 用量明细最多查询的天数
+	maxUsageDays = 90
+)
+
+// QuotaPlanRequest 用户级别配额请求体，各项为0表示不限制
+type QuotaPlanRequest struct {
+	PerDevice       bool  `json:"perDevice"`
+	DailyRounds     int64 `json:"dailyRounds"`
+	DailyLLMTokens  int64 `json:"dailyLLMTokens"`
+	DailyTTSChars   int64 `json:"dailyTTSChars"`
+	DailyASRSeconds int64 `json:"dailyASRSeconds"`
+	DailyToolCalls  int64 `json:"dailyToolCalls"`
+}
+
+// UserLevelRequest 设置用户级别请求体
+type UserLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// UserQuotaResponse 用户当天的配额与用量，以及每台设备每天的用量明细
+type UserQuotaResponse struct {
+	quota.Status
+	Exceeded string              `json:"exceeded,omitempty"` // 已用尽的用量项
+	Daily    []models.DailyUsage `json:"daily"`
+}
+
+// userQuota 查询用户的配额状态与最近若干天的用量明细
+func userQuota(userID uint, days int) (*UserQuotaResponse, error) {
+	now := time.Now()
+	status, err := quota.GetStatus(userID, "", now)
+	if err != nil {
+		return nil, err
+	}
+	from := quota.Date(now.AddDate(0, 0, 1-days))
+	daily, err := database.ListDailyUsage(database.GetDB(), userID, from, quota.Date(now))
+	if err != nil {
+		return nil, err
+	}
+	resp := &UserQuotaResponse{Status: *status, Daily: daily}
+	if status.Plan == nil || !status.Plan.PerDevice {
+		resp.Exceeded = quota.Exceeded(status.Plan, status.Used)
+	}
+	return resp, nil
+}
+
+// parseUsageDays 解析查询的天数
+func parseUsageDays(c *gin.Context) int {
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days <= 0 {
+		return defaultUsageDays
+	}
+	if days > maxUsageDays {
+		return maxUsageDays
+	}
+	return days
+}
+
+// handleUserQuota 当前用户的配额与用量
+// @Summary 获取当前用户的配额与用量
+// @Description 返回用户级别对应的每日配额、今日用量（配额按设备计算时为全部设备合计）以及每台设备每天的用量明细，plan 为空表示不限制
+// @Tags User
+// @Produce json
+// @Param days query int false "用量明细天数，默认7，最多90"
+// @Success 200 {object} UserQuotaResponse "配额与用量"
+// @Router /user/quota [get]
+func (s *DefaultUserService) handleUserQuota(c *gin.Context) {
+	resp, err := userQuota(c.GetUint("user_id"), parseUsageDays(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": resp})
+}
+
+// handleQuotaPlanList 配额列表
+// @Summary 获取各用户级别的配额
+// @Description 未配置配额的级别不限制用量
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} []models.QuotaPlan "配额列表"
+// @Router /admin/quota/plans [get]
+func (s *DefaultAdminService) handleQuotaPlanList(c *gin.Context) {
+	WithTx(c, func(tx *gorm.DB) error {
+		plans, err := database.ListQuotaPlans(tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": plans})
+		return nil
+	})
+}
+
+// handleQuotaPlanSave 设置配额
+// @Summary 设置用户级别的配额
+// @Description 创建或覆盖指定用户级别的每日配额，如 basic/premium/business
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param level path string true "用户级别"
+// @Param data body QuotaPlanRequest true "配额"
+// @Success 200 {object} models.QuotaPlan "保存后的配额"
+// @Router /admin/quota/plans/{level} [put]
+func (s *DefaultAdminService) handleQuotaPlanSave(c *gin.Context) {
+	level := strings.TrimSpace(c.Param("level"))
+	var req QuotaPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DailyRounds < 0 || req.DailyLLMTokens < 0 || req.DailyTTSChars < 0 ||
+		req.DailyASRSeconds < 0 || req.DailyToolCalls < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配额不能为负数"})
+		return
+	}
+	plan := &models.QuotaPlan{
+		Level:           level,
+		PerDevice:       req.PerDevice,
+		DailyRounds:     req.DailyRounds,
+		DailyLLMTokens:  req.DailyLLMTokens,
+		DailyTTSChars:   req.DailyTTSChars,
+		DailyASRSeconds: req.DailyASRSeconds,
+		DailyToolCalls:  req.DailyToolCalls,
+		UpdatedAt:       time.Now(),
+	}
+	WithTx(c, func(tx *gorm.DB) error {
+		if err := database.SaveQuotaPlan(tx, plan); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		saved, err := database.FindQuotaPlan(tx, level)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": saved})
+		return nil
+	})
+}
+
+// handleQuotaPlanDelete 删除配额
+// @Summary 删除用户级别的配额
+// @Description 删除后该级别的用户不限制用量
+// @Tags Admin
+// @Produce json
+// @Param level path string true "用户级别"
+// @Success 200 {object} map[string]interface{} "删除结果"
+// @Router /admin/quota/plans/{level} [delete]
+func (s *DefaultAdminService) handleQuotaPlanDelete(c *gin.Context) {
+	WithTx(c, func(tx *gorm.DB) error {
+		if err := database.DeleteQuotaPlan(tx, c.Param("level")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return nil
+	})
+}
+
+// handleUserLevelUpdate 设置用户级别
+// @Summary 设置用户级别
+// @Description 用户级别决定适用的每日配额
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param data body UserLevelRequest true "用户级别"
+// @Success 200 {object} map[string]interface{} "设置结果"
+// @Router /admin/users/{id}/level [put]
+func (s *DefaultAdminService) handleUserLevelUpdate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req UserLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Level) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level 不能为空"})
+		return
+	}
+	WithTx(c, func(tx *gorm.DB) error {
+		user, err := database.GetUserByID(tx, uint(id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		if user == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return nil
+		}
+		if err := database.UpdateUserLevel(tx, user.ID, strings.TrimSpace(req.Level)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return nil
+	})
+}
+
+// handleUserQuotaAdmin 查看用户的配额与用量
+// @Summary 查看指定用户的配额与用量
+// @Tags Admin
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param days query int false "用量明细天数，默认7，最多90"
+// @Success 200 {object} UserQuotaResponse "配额与用量"
+// @Router /admin/users/{id}/quota [get]
+func (s *DefaultAdminService) handleUserQuotaAdmin(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	resp, err := userQuota(uint(id), parseUsageDays(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": resp})
+}
@@ -0,0 +1,153 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/recording"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次查询返回的最大录音数
+const maxRecordingList = 500
+
+// handleAgentHistoryDialogRecordings 获取对话记录的录音列表
+// @Summary 获取对话记录的录音
+// @Description 返回该对话记录各轮的用户语音与TTS回复录音，可按 round 对应到对话轮次，需在应用配置中开启保存用户音频/TTS音频
+// @Tags Agent
+// @Produce json
+// @Param dialog_id path int true "对话ID"
+// @Success 200 {object} []models.Recording "录音列表"
+// @Router /user/agent/history_dialog/{dialog_id}/recordings [get]
+func (s *DefaultUserService) handleAgentHistoryDialogRecordings(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("dialog_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dialog id"})
+		return
+	}
+	userID := c.GetUint("user_id")
+	db := database.GetDB()
+	dialog, err := database.GetAgentDialogByID(db, uint(id))
+	if err != nil || dialog.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dialog not found"})
+		return
+	}
+	if dialog.Conversationid == "" {
+		// 没有对话ID的记录无法关联录音，不能按空条件返回智能体的全部录音
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "data": []models.Recording{}})
+		return
+	}
+	recordings, err := database.ListRecordings(db, database.RecordingFilter{
+		UserID:         userID,
+		AgentID:        dialog.AgentID,
+		Conversationid: dialog.Conversationid,
+	}, maxRecordingList)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": recordings})
+}
+
+// handleAgentRecordings 获取智能体的录音列表
+// @Summary 获取智能体的录音
+// @Description 按设备、会话和轮次筛选智能体的录音，按时间倒序返回
+// @Tags Agent
+// @Produce json
+// @Param id path int true "Agent ID"
+// @Param device_id query string false "设备ID"
+// @Param session_id query string false "会话ID"
+// @Param round query int false "对话轮次"
+// @Param limit query int false "返回条数，默认且最多500"
+// @Success 200 {object} []models.Recording "录音列表"
+// @Router /user/agent/{id}/recordings [get]
+func (s *DefaultUserService) handleAgentRecordings(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agent id"})
+		return
+	}
+	round, _ := strconv.Atoi(c.Query("round"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(maxRecordingList)))
+	if err != nil || limit <= 0 || limit > maxRecordingList {
+		limit = maxRecordingList
+	}
+	recordings, err := database.ListRecordings(database.GetDB(), database.RecordingFilter{
+		UserID:    c.GetUint("user_id"),
+		AgentID:   uint(id),
+		DeviceID:  c.Query("device_id"),
+		SessionID: c.Query("session_id"),
+		Round:     round,
+	}, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": recordings})
+}
+
+// handleRecordingStream 在线播放录音
+// @Summary 在线播放录音
+// @Description 返回WAV音频，支持 Range 请求
+// @Tags Agent
+// @Produce audio/wav
+// @Param recording_id path int true "录音ID"
+// @Success 200 {file} file "WAV音频"
+// @Router /user/agent/recording/{recording_id}/stream [get]
+func (s *DefaultUserService) handleRecordingStream(c *gin.Context) {
+	rec, ok := s.findRecordingFile(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Type", "audio/wav")
+	c.File(rec.FilePath)
+}
+
+// handleRecordingDownload 下载录音
+// @Summary 下载录音
+// @Tags Agent
+// @Produce audio/wav
+// @Param recording_id path int true "录音ID"
+// @Success 200 {file} file "WAV音频"
+// @Router /user/agent/recording/{recording_id}/download [get]
+func (s *DefaultUserService) handleRecordingDownload(c *gin.Context) {
+	rec, ok := s.findRecordingFile(c)
+	if !ok {
+		return
+	}
+	c.FileAttachment(rec.FilePath, recordingFileName(rec))
+}
+
+// findRecordingFile 查询当前用户的录音并检查文件是否存在，失败时已写入响应
+func (s *DefaultUserService) findRecordingFile(c *gin.Context) (*models.Recording, bool) {
+	id, err := strconv.Atoi(c.Param("recording_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recording id"})
+		return nil, false
+	}
+	rec, err := database.FindRecordingByIDAndUser(database.GetDB(), uint(id), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return nil, false
+	}
+	if _, err := os.Stat(rec.FilePath); err != nil {
+		s.logger.Warn("录音文件不存在: %s", rec.FilePath)
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording file not found"})
+		return nil, false
+	}
+	return rec, true
+}
+
+// recordingFileName 下载时的文件名：设备_会话_轮次_类型.wav
+func recordingFileName(r *models.Recording) string {
+	name := fmt.Sprintf("%s_%s_round%d_%s", r.DeviceID, r.SessionID, r.Round, r.Kind)
+	if r.Kind == recording.KindTTS {
+		name += fmt.Sprintf("_%d", r.SegmentIndex)
+	}
+	return strings.NewReplacer(":", "-", "/", "-", "\\", "-").Replace(name) + ".wav"
+}
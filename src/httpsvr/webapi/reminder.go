@@ -0,0 +1,197 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/reminder"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReminderRequest 提醒创建/更新请求体
+// @Description time 支持 "2006-01-02 15:04" 与 RFC3339 格式；repeat 支持 daily/weekdays/weekends/weekly/monthly 或5段cron表达式，为空表示只提醒一次
+type ReminderRequest struct {
+	DeviceID string `json:"device_id"`
+	Content  string `json:"content"`
+	Time     string `json:"time"`
+	Repeat   string `json:"repeat"`
+	Enabled  *bool  `json:"enabled,omitempty"` // 仅更新时有效
+}
+
+// handleReminderList 提醒列表
+// @Summary 获取提醒列表
+// @Description 获取当前用户的提醒，可通过 device_id 过滤
+// @Tags Reminder
+// @Produce json
+// @Param device_id query string false "设备ID"
+// @Success 200 {object} []models.Reminder "提醒列表"
+// @Router /user/reminder/list [get]
+func (s *DefaultUserService) handleReminderList(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	reminders, err := database.ListRemindersByUser(database.GetDB(), userID, c.Query("device_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": reminders})
+}
+
+// handleReminderCreate 创建提醒
+// @Summary 创建提醒
+// @Description 为当前用户的设备创建提醒，到期时在设备上播报，设备离线时在下次连接后播报
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Param data body ReminderRequest true "提醒参数"
+// @Success 200 {object} models.Reminder "创建的提醒"
+// @Router /user/reminder/create [post]
+func (s *DefaultUserService) handleReminderCreate(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	if _, err := database.FindDeviceByIDAndUser(db, req.DeviceID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return
+	}
+	at, err := parseReminderRequestTime(req.Time)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, err := reminder.New(db, userID, req.DeviceID, req.Content, at, req.Repeat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Info("[提醒] [创建] 用户 %d 设备 %s: %s", userID, req.DeviceID, reminder.Describe(r))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": r})
+}
+
+// handleReminderUpdate 更新提醒
+// @Summary 更新提醒
+// @Description 更新提醒内容、时间、重复规则或启用状态，未填写的字段保持不变；重新启用已过期的重复提醒时从当前时间起计算下一次提醒
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Param id path int true "提醒ID"
+// @Param data body ReminderRequest true "提醒参数"
+// @Success 200 {object} models.Reminder "更新后的提醒"
+// @Router /user/reminder/{id} [put]
+func (s *DefaultUserService) handleReminderUpdate(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reminder id"})
+		return
+	}
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	r, err := database.FindReminderByIDAndUser(db, uint(id), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reminder not found"})
+		return
+	}
+
+	if content := strings.TrimSpace(req.Content); content != "" {
+		r.Content = content
+	}
+	if req.Time != "" || req.Repeat != "" {
+		at := r.NextRunAt
+		if req.Time != "" {
+			if at, err = parseReminderRequestTime(req.Time); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		repeat := r.Repeat
+		if req.Repeat != "" {
+			repeat = req.Repeat
+		}
+		if err := reminder.Reschedule(r, at, repeat); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Enabled != nil {
+		now := time.Now()
+		if *req.Enabled && !r.Enabled && !r.NextRunAt.After(now) {
+			// 重复提醒从当前时间起计算下一次提醒时间，一次性提醒需要重新设置时间
+			if r.Repeat == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "提醒时间已经过去，请重新设置时间"})
+				return
+			}
+			next, err := reminder.NextRun(r.Repeat, now)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			r.NextRunAt = next
+		}
+		r.Enabled = *req.Enabled
+	}
+
+	if err := database.UpdateReminder(db, r); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": r})
+}
+
+// handleReminderDelete 删除提醒
+// @Summary 删除提醒
+// @Description 删除指定ID的提醒
+// @Tags Reminder
+// @Produce json
+// @Param id path int true "提醒ID"
+// @Success 200 {object} map[string]string "删除成功"
+// @Router /user/reminder/{id} [delete]
+func (s *DefaultUserService) handleReminderDelete(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reminder id"})
+		return
+	}
+
+	db := database.GetDB()
+	r, err := database.FindReminderByIDAndUser(db, uint(id), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reminder not found"})
+		return
+	}
+	if err := database.DeleteReminder(db, r.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "删除成功"})
+}
+
+// parseReminderRequestTime 解析请求中的提醒时间
+func parseReminderRequestTime(text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, fmt.Errorf("提醒时间不能为空")
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t.Local(), nil
+	}
+	if t, err := time.ParseInLocation(reminder.TimeLayout, text, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("提醒时间 %s 格式错误，应为 %s 或 RFC3339", text, reminder.TimeLayout)
+}
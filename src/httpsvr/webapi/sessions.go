@@ -0,0 +1,11 @@
+package webapi
+
+import "xiaozhi-server-go/src/core"
+
+// SessionManager 在线会话查询接口，由传输层管理器实现
+type SessionManager interface {
+	// GetConnectionHandlers 获取全部在线会话
+	GetConnectionHandlers() []*core.ConnectionHandler
+	// FindConnectionHandler 根据设备ID查找在线会话，不在线时返回nil
+	FindConnectionHandler(deviceID string) *core.ConnectionHandler
+}
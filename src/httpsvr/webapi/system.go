@@ -11,18 +11,21 @@ import (
 )
 
 type DefaultAdminService struct {
-	logger *utils.Logger
-	config *configs.Config
+	logger   *utils.Logger
+	config   *configs.Config
+	sessions SessionManager
 }
 
 // NewDefaultAdminService 构造函数
 func NewDefaultAdminService(
 	config *configs.Config,
 	logger *utils.Logger,
+	sessions SessionManager,
 ) (*DefaultAdminService, error) {
 	service := &DefaultAdminService{
-		logger: logger,
-		config: config,
+		logger:   logger,
+		config:   config,
+		sessions: sessions,
 	}
 
 	return service, nil
@@ -36,6 +39,14 @@ func (s *DefaultAdminService) Start(
 ) error {
 	apiGroup.GET("/admin", s.handleGet)
 
+	// 会话实时事件流：普通用户可查看自己设备的会话，支持通过 ?stream_token= 认证
+	apiGroup.POST("/admin/sessions/events/token", AuthMiddleware(), s.handleStreamToken)
+	eventGroup := apiGroup.Group("/admin/sessions", StreamTokenMiddleware())
+	{
+		eventGroup.GET("/events", s.handleAllSessionEvents)
+		eventGroup.GET("/:id/events", s.handleSessionEvents)
+	}
+
 	// 需要登录和管理员权限的分组
 	adminGroup := apiGroup.Group("")
 	// 查看模型不需要管理员权限
@@ -56,6 +67,27 @@ func (s *DefaultAdminService) Start(
 		adminGroup.POST("/admin/system/providers/create", s.handleSystemProvidersCreate)
 		adminGroup.PUT("/admin/system/providers/:type/:name", s.handleSystemProvidersUpdate)
 		adminGroup.DELETE("/admin/system/providers/:type/:name", s.handleSystemProvidersDelete)
+
+		// 在线会话管理
+		adminGroup.GET("/admin/sessions", s.handleSessionList)
+		adminGroup.GET("/admin/sessions/:id", s.handleSessionGet)
+		adminGroup.DELETE("/admin/sessions/:id", s.handleSessionDisconnect)
+		adminGroup.POST("/admin/sessions/:id/text", s.handleSessionInjectText)
+		adminGroup.PUT("/admin/sessions/:id/agent", s.handleSessionSwitchAgent)
+		adminGroup.POST("/admin/sessions/:id/abort", s.handleSessionAbort)
+
+		// 提供者容灾状态
+		adminGroup.GET("/admin/providers/health", s.handleProviderHealth)
+
+		// 用量配额
+		adminGroup.GET("/admin/quota/plans", s.handleQuotaPlanList)
+		adminGroup.PUT("/admin/quota/plans/:level", s.handleQuotaPlanSave)
+		adminGroup.DELETE("/admin/quota/plans/:level", s.handleQuotaPlanDelete)
+		adminGroup.PUT("/admin/users/:id/level", s.handleUserLevelUpdate)
+		adminGroup.GET("/admin/users/:id/quota", s.handleUserQuotaAdmin)
+
+		// 用量计费报表
+		adminGroup.GET("/admin/usage", s.handleAdminUsage)
 	}
 
 	s.logger.Info("Admin HTTP服务路由注册完成")
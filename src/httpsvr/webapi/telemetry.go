@@ -0,0 +1,272 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/telemetry"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 未指定时间范围时默认查询最近的时长
+	defaultTelemetryRange = 24 * time.Hour
+	// 单次最多返回的上报数据条数
+	maxTelemetrySamples = 5000
+	// 告警记录默认条数
+	telemetryAlertListLimit = 100
+)
+
+// TelemetryAlertRuleRequest 告警规则创建/更新请求体
+// @Description type 可选 low_heap（阈值为字节）/weak_rssi（阈值为dBm，如 -75）/silent（阈值为小时）；device_id 为空表示适用于全部设备
+type TelemetryAlertRuleRequest struct {
+	DeviceID  *string `json:"device_id,omitempty"`
+	Type      string  `json:"type"`
+	Threshold *int64  `json:"threshold,omitempty"`
+	Enabled   *bool   `json:"enabled,omitempty"`
+}
+
+// parseTelemetryTime 解析查询参数中的时间，为空时返回默认值
+func parseTelemetryTime(text string, def time.Time) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", text, time.Local); err == nil {
+		return t, nil
+	}
+	if ts, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("时间 %s 格式错误，应为 RFC3339、\"2006-01-02 15:04\" 或秒级时间戳", text)
+}
+
+// handleDeviceTelemetry 设备健康数据
+// @Summary 获取设备健康数据
+// @Description 按时间范围返回设备每次 OTA 检查上报的信号强度、剩余堆内存、版本等数据，以及信号强度与堆内存的最小/最大/平均值。默认查询最近24小时
+// @Tags Device
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param from query string false "开始时间"
+// @Param to query string false "结束时间"
+// @Param limit query int false "最多返回条数"
+// @Success 200 {object} []models.DeviceTelemetry "上报数据"
+// @Router /user/device/{id}/telemetry [get]
+func (s *DefaultUserService) handleDeviceTelemetry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	db := database.GetDB()
+	device, err := database.FindDeviceByIDAndUser(db, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return
+	}
+
+	now := time.Now()
+	to, err := parseTelemetryTime(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTelemetryTime(c.Query("from"), to.Add(-defaultTelemetryRange))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间应早于结束时间"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(maxTelemetrySamples)))
+	if err != nil || limit <= 0 || limit > maxTelemetrySamples {
+		limit = maxTelemetrySamples
+	}
+
+	samples, err := database.ListDeviceTelemetry(db, device.DeviceID, from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"data":    samples,
+		"summary": telemetry.Summarize(samples),
+		"from":    from,
+		"to":      to,
+	})
+}
+
+// handleTelemetryRuleList 告警规则列表
+// @Summary 获取设备健康告警规则
+// @Tags Telemetry
+// @Produce json
+// @Success 200 {object} []models.TelemetryAlertRule "告警规则"
+// @Router /user/telemetry/rules [get]
+func (s *DefaultUserService) handleTelemetryRuleList(c *gin.Context) {
+	rules, err := database.ListTelemetryAlertRulesByUser(database.GetDB(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": rules, "types": telemetry.RuleTypes})
+}
+
+// handleTelemetryRuleCreate 创建告警规则
+// @Summary 创建设备健康告警规则
+// @Description 告警触发时写入告警记录，并以 device.alert 事件推送到订阅的 Webhook
+// @Tags Telemetry
+// @Accept json
+// @Produce json
+// @Param data body TelemetryAlertRuleRequest true "告警规则"
+// @Success 200 {object} models.TelemetryAlertRule "告警规则"
+// @Router /user/telemetry/rules [post]
+func (s *DefaultUserService) handleTelemetryRuleCreate(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req TelemetryAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := &models.TelemetryAlertRule{
+		UserID:  userID,
+		Type:    req.Type,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if req.Threshold != nil {
+		rule.Threshold = *req.Threshold
+	}
+	if req.DeviceID != nil {
+		rule.DeviceID = strings.TrimSpace(*req.DeviceID)
+	}
+	if !s.saveTelemetryRule(c, rule, true) {
+		return
+	}
+	s.logger.Info("[遥测] [告警规则] 用户 %d 创建 %s 阈值 %d 设备 %q", userID, rule.Type, rule.Threshold, rule.DeviceID)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": rule})
+}
+
+// handleTelemetryRuleUpdate 更新告警规则
+// @Summary 更新设备健康告警规则
+// @Description 未填写的字段保持不变
+// @Tags Telemetry
+// @Accept json
+// @Produce json
+// @Param id path int true "规则ID"
+// @Param data body TelemetryAlertRuleRequest true "告警规则"
+// @Success 200 {object} models.TelemetryAlertRule "告警规则"
+// @Router /user/telemetry/rules/{id} [put]
+func (s *DefaultUserService) handleTelemetryRuleUpdate(c *gin.Context) {
+	var req TelemetryAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := findTelemetryRule(c)
+	if rule == nil {
+		return
+	}
+	if req.Type != "" {
+		rule.Type = req.Type
+	}
+	if req.Threshold != nil {
+		rule.Threshold = *req.Threshold
+	}
+	if req.DeviceID != nil {
+		rule.DeviceID = strings.TrimSpace(*req.DeviceID)
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if !s.saveTelemetryRule(c, rule, false) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": rule})
+}
+
+// handleTelemetryRuleDelete 删除告警规则
+// @Summary 删除设备健康告警规则
+// @Tags Telemetry
+// @Produce json
+// @Param id path int true "规则ID"
+// @Success 200 {object} map[string]string "删除成功"
+// @Router /user/telemetry/rules/{id} [delete]
+func (s *DefaultUserService) handleTelemetryRuleDelete(c *gin.Context) {
+	rule := findTelemetryRule(c)
+	if rule == nil {
+		return
+	}
+	if err := database.DeleteTelemetryAlertRule(database.GetDB(), rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "删除成功"})
+}
+
+// handleTelemetryAlertList 告警记录
+// @Summary 获取设备健康告警记录
+// @Tags Telemetry
+// @Produce json
+// @Param device_id query string false "设备ID"
+// @Param limit query int false "条数，默认100"
+// @Success 200 {object} []models.TelemetryAlert "告警记录"
+// @Router /user/telemetry/alerts [get]
+func (s *DefaultUserService) handleTelemetryAlertList(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(telemetryAlertListLimit)))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = telemetryAlertListLimit
+	}
+	alerts, err := database.ListTelemetryAlertsByUser(database.GetDB(), c.GetUint("user_id"), c.Query("device_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": alerts})
+}
+
+// findTelemetryRule 按路径参数查询当前用户的告警规则
+func findTelemetryRule(c *gin.Context) *models.TelemetryAlertRule {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id"})
+		return nil
+	}
+	rule, err := database.FindTelemetryAlertRuleByIDAndUser(database.GetDB(), uint(id), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return nil
+	}
+	return rule
+}
+
+// saveTelemetryRule 校验并保存告警规则，失败时已写入响应
+func (s *DefaultUserService) saveTelemetryRule(c *gin.Context, rule *models.TelemetryAlertRule, create bool) bool {
+	if err := telemetry.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	db := database.GetDB()
+	if rule.DeviceID != "" {
+		if _, err := database.FindDeviceByIDAndUser(db, rule.DeviceID, rule.UserID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			return false
+		}
+	}
+	var err error
+	if create {
+		err = database.AddTelemetryAlertRule(db, rule)
+	} else {
+		err = database.UpdateTelemetryAlertRule(db, rule)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
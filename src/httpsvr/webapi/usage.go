@@ -0,0 +1,128 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/quota"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageReport 按提供者统计的用量与费用报表
+type UsageReport struct {
+	From    string                 `json:"from"`
+	To      string                 `json:"to"`
+	GroupBy string                 `json:"groupBy"`
+	Total   models.ProviderUsage   `json:"total"` // 全部分组的合计
+	Rows    []models.ProviderUsage `json:"rows"`  // 各分组的合计，只填充分组字段与用量字段
+}
+
+// parseUsageQuery 解析报表的日期范围与分组，未指定 from/to 时按 days 取最近若干天
+func parseUsageQuery(c *gin.Context) (database.ProviderUsageQuery, error) {
+	now := time.Now()
+	q := database.ProviderUsageQuery{
+		From:    c.Query("from"),
+		To:      c.DefaultQuery("to", quota.Date(now)),
+		Kind:    c.Query("kind"),
+		GroupBy: c.DefaultQuery("group_by", "date"),
+	}
+	if q.From == "" {
+		q.From = quota.Date(now.AddDate(0, 0, 1-parseUsageDays(c)))
+	}
+	for _, d := range []string{q.From, q.To} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return q, fmt.Errorf("日期格式应为 2006-01-02: %s", d)
+		}
+	}
+	return q, nil
+}
+
+// usageReport 查询用量报表并计算合计
+func usageReport(q database.ProviderUsageQuery) (*UsageReport, error) {
+	rows, err := database.SumProviderUsage(database.GetDB(), q)
+	if err != nil {
+		return nil, err
+	}
+	report := &UsageReport{From: q.From, To: q.To, GroupBy: q.GroupBy, Rows: rows}
+	for _, r := range rows {
+		report.Total.Requests += r.Requests
+		report.Total.PromptTokens += r.PromptTokens
+		report.Total.CompletionTokens += r.CompletionTokens
+		report.Total.Chars += r.Chars
+		report.Total.AudioSeconds += r.AudioSeconds
+		report.Total.Cost += r.Cost
+	}
+	return report, nil
+}
+
+// handleUserUsage 当前用户的用量与费用
+// @Summary 获取当前用户按提供者统计的用量与费用
+// @Description 统计LLM输入/输出Token、TTS字数、ASR音频秒数，费用按配置文件 pricing 中的单价计算
+// @Tags User
+// @Produce json
+// @Param from query string false "起始日期，格式 2006-01-02"
+// @Param to query string false "结束日期，默认今天"
+// @Param days query int false "未指定起始日期时统计最近的天数，默认7，最多90"
+// @Param kind query string false "提供者类型：llm/tts/asr"
+// @Param group_by query string false "分组方式：date/provider/agent/device，默认date"
+// @Success 200 {object} UsageReport "用量报表"
+// @Router /user/usage [get]
+func (s *DefaultUserService) handleUserUsage(c *gin.Context) {
+	q, err := parseUsageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.GroupBy == "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的分组方式: user"})
+		return
+	}
+	userID := c.GetUint("user_id")
+	q.UserID = &userID
+	report, err := usageReport(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": report})
+}
+
+// handleAdminUsage 全部用户的用量与费用
+// @Summary 获取按提供者统计的用量与费用
+// @Description 统计全部用户或指定用户的用量与费用，费用按配置文件 pricing 中的单价计算
+// @Tags Admin
+// @Produce json
+// @Param user_id query int false "用户ID，为空时统计全部用户"
+// @Param from query string false "起始日期，格式 2006-01-02"
+// @Param to query string false "结束日期，默认今天"
+// @Param days query int false "未指定起始日期时统计最近的天数，默认7，最多90"
+// @Param kind query string false "提供者类型：llm/tts/asr"
+// @Param group_by query string false "分组方式：date/provider/agent/device/user，默认date"
+// @Success 200 {object} UsageReport "用量报表"
+// @Router /admin/usage [get]
+func (s *DefaultAdminService) handleAdminUsage(c *gin.Context) {
+	q, err := parseUsageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID := uint(id)
+		q.UserID = &userID
+	}
+	report, err := usageReport(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": report})
+}
@@ -13,18 +13,21 @@ import (
 )
 
 type DefaultUserService struct {
-	logger *utils.Logger
-	config *configs.Config
+	logger   *utils.Logger
+	config   *configs.Config
+	sessions SessionManager
 }
 
 // NewDefaultUserService 构造函数
 func NewDefaultUserService(
 	config *configs.Config,
 	logger *utils.Logger,
+	sessions SessionManager,
 ) (*DefaultUserService, error) {
 	service := &DefaultUserService{
-		logger: logger,
-		config: config,
+		logger:   logger,
+		config:   config,
+		sessions: sessions,
 	}
 	return service, nil
 }
@@ -47,6 +50,8 @@ func (s *DefaultUserService) Start(
 		authGroup.POST("/change-password", s.handleChangePassword)
 
 		authGroup.GET("/summary", s.handleSystemSummary) // 获取用户汇总信息
+		authGroup.GET("/quota", s.handleUserQuota)       // 获取配额与用量
+		authGroup.GET("/usage", s.handleUserUsage)       // 获取按提供者统计的用量与费用
 
 		authGroup.POST("/agent/create", s.handleAgentCreate)
 		authGroup.GET("/agent/list", s.handleAgentList)
@@ -57,12 +62,46 @@ func (s *DefaultUserService) Start(
 		authGroup.POST("/agent/history_dialog_list/:id", s.handleAgentHistoryDialogList)
 		authGroup.GET("/agent/history_dialog/:dialog_id", s.handleAgentGetHistoryDialog)
 		authGroup.DELETE("/agent/history_dialog/:dialog_id", s.handleAgentDeleteHistoryDialog)
+		authGroup.GET("/agent/history_dialog/:dialog_id/recordings", s.handleAgentHistoryDialogRecordings)
+		authGroup.GET("/agent/:id/recordings", s.handleAgentRecordings)
+		authGroup.GET("/agent/recording/:recording_id/stream", s.handleRecordingStream)
+		authGroup.GET("/agent/recording/:recording_id/download", s.handleRecordingDownload)
 
 		authGroup.GET("/device/list/:id", s.handleDeviceList)
 		authGroup.GET("/device/list", s.handleDeviceListByUser)
 		authGroup.GET("/device/:id", s.handleDeviceGet)
+		authGroup.GET("/device/:id/connections", s.handleDeviceConnections)
+		authGroup.GET("/device/:id/telemetry", s.handleDeviceTelemetry)
 		authGroup.PUT("/device/:id", s.handleDeviceUpdate)
 		authGroup.DELETE("/device", s.handleDeviceDelete)
+		authGroup.POST("/device/:id/say", s.handleDeviceSay)
+		authGroup.POST("/device/broadcast", s.handleDeviceBroadcast)
+		authGroup.GET("/device/:id/tools", s.handleDeviceTools)
+		authGroup.POST("/device/:id/tools/call", s.handleDeviceToolCall)
+		authGroup.POST("/device/:id/presets/:preset_id/apply", s.handleDevicePresetApply)
+		authGroup.GET("/device/presets", s.handleDevicePresetList)
+		authGroup.POST("/device/presets", s.handleDevicePresetCreate)
+		authGroup.PUT("/device/presets/:preset_id", s.handleDevicePresetUpdate)
+		authGroup.DELETE("/device/presets/:preset_id", s.handleDevicePresetDelete)
+
+		authGroup.GET("/reminder/list", s.handleReminderList)
+		authGroup.POST("/reminder/create", s.handleReminderCreate)
+		authGroup.PUT("/reminder/:id", s.handleReminderUpdate)
+		authGroup.DELETE("/reminder/:id", s.handleReminderDelete)
+
+		authGroup.GET("/webhooks", s.handleWebhookList)
+		authGroup.POST("/webhooks", s.handleWebhookCreate)
+		authGroup.PUT("/webhooks/:id", s.handleWebhookUpdate)
+		authGroup.DELETE("/webhooks/:id", s.handleWebhookDelete)
+		authGroup.POST("/webhooks/:id/secret", s.handleWebhookRotateSecret)
+		authGroup.POST("/webhooks/:id/test", s.handleWebhookTest)
+		authGroup.GET("/webhooks/:id/deliveries", s.handleWebhookDeliveries)
+
+		authGroup.GET("/telemetry/rules", s.handleTelemetryRuleList)
+		authGroup.POST("/telemetry/rules", s.handleTelemetryRuleCreate)
+		authGroup.PUT("/telemetry/rules/:id", s.handleTelemetryRuleUpdate)
+		authGroup.DELETE("/telemetry/rules/:id", s.handleTelemetryRuleDelete)
+		authGroup.GET("/telemetry/alerts", s.handleTelemetryAlertList)
 
 		// providers
 		authGroup.GET("/providers/:type", s.handleUserProvidersType)
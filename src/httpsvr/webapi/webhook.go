@@ -0,0 +1,259 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/webhook"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 投递记录查询默认条数
+const webhookDeliveryListLimit = 50
+
+// WebhookRequest Webhook 创建/更新请求体
+// @Description events 可选 device.online/device.offline/device.registered/conversation.round_finished/tool.invoked/firmware.offered/device.alert，为空表示订阅全部；secret 为空时创建会自动生成
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+}
+
+// findUserWebhook 按路径参数查询当前用户的Webhook
+func findUserWebhook(c *gin.Context) *models.Webhook {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+		return nil
+	}
+	hook, err := database.FindWebhookByIDAndUser(database.GetDB(), uint(id), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return nil
+	}
+	return hook
+}
+
+// handleWebhookList Webhook列表
+// @Summary 获取Webhook列表
+// @Tags Webhook
+// @Produce json
+// @Success 200 {object} []models.Webhook "Webhook列表"
+// @Router /user/webhooks [get]
+func (s *DefaultUserService) handleWebhookList(c *gin.Context) {
+	hooks, err := database.ListWebhooksByUser(database.GetDB(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": hooks, "events": webhook.EventTypes})
+}
+
+// handleWebhookCreate 创建Webhook
+// @Summary 创建Webhook
+// @Description 注册回调地址，事件发生时以 POST JSON 推送，请求头 X-Xiaozhi-Signature 为 sha256=HMAC-SHA256(secret, timestamp + "." + body)
+// @Description 响应中的 secret 为签名密钥，只在创建时返回一次，之后只能通过重置密钥接口获取新的密钥
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param data body WebhookRequest true "Webhook参数"
+// @Success 200 {object} models.Webhook "创建的Webhook"
+// @Router /user/webhooks [post]
+func (s *DefaultUserService) handleWebhookCreate(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhook.ValidateURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	eventList, err := webhook.ParseEvents(req.Events)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook := &models.Webhook{
+		UserID:      userID,
+		URL:         strings.TrimSpace(req.URL),
+		Secret:      strings.TrimSpace(req.Secret),
+		Events:      eventList,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if hook.Secret == "" {
+		hook.Secret = webhook.NewSecret()
+	}
+	if err := database.AddWebhook(database.GetDB(), hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	webhook.Invalidate()
+	s.logger.Info("[Webhook] [创建] 用户 %d: %s [%s]", userID, hook.URL, hook.Events)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": hook, "secret": hook.Secret})
+}
+
+// handleWebhookUpdate 更新Webhook
+// @Summary 更新Webhook
+// @Description 更新回调地址、密钥、订阅事件、备注或启用状态，未填写的字段保持不变
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param data body WebhookRequest true "Webhook参数"
+// @Success 200 {object} models.Webhook "更新后的Webhook"
+// @Router /user/webhooks/{id} [put]
+func (s *DefaultUserService) handleWebhookUpdate(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hook := findUserWebhook(c)
+	if hook == nil {
+		return
+	}
+
+	if req.URL != "" {
+		if err := webhook.ValidateURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hook.URL = strings.TrimSpace(req.URL)
+	}
+	if req.Events != nil {
+		eventList, err := webhook.ParseEvents(req.Events)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hook.Events = eventList
+	}
+	if secret := strings.TrimSpace(req.Secret); secret != "" {
+		hook.Secret = secret
+	}
+	if req.Description != "" {
+		hook.Description = req.Description
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+
+	if err := database.UpdateWebhook(database.GetDB(), hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	webhook.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": hook})
+}
+
+// handleWebhookDelete 删除Webhook
+// @Summary 删除Webhook
+// @Description 删除Webhook及其投递记录
+// @Tags Webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]string "删除成功"
+// @Router /user/webhooks/{id} [delete]
+func (s *DefaultUserService) handleWebhookDelete(c *gin.Context) {
+	hook := findUserWebhook(c)
+	if hook == nil {
+		return
+	}
+	if err := database.DeleteWebhook(database.GetDB(), hook.ID, hook.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	webhook.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "删除成功"})
+}
+
+// handleWebhookRotateSecret 重置签名密钥
+// @Summary 重置Webhook签名密钥
+// @Description 生成新的签名密钥并在响应中返回，旧密钥立即失效，尚未投递的记录使用新密钥签名
+// @Tags Webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]string "新的签名密钥"
+// @Router /user/webhooks/{id}/secret [post]
+func (s *DefaultUserService) handleWebhookRotateSecret(c *gin.Context) {
+	hook := findUserWebhook(c)
+	if hook == nil {
+		return
+	}
+	hook.Secret = webhook.NewSecret()
+	if err := database.UpdateWebhook(database.GetDB(), hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Info("[Webhook] [密钥] 用户 %d 重置了 %s 的签名密钥", hook.UserID, hook.URL)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "secret": hook.Secret})
+}
+
+// handleWebhookTest 测试投递
+// @Summary 测试Webhook
+// @Description 立即向回调地址发送一条 webhook.test 事件并返回投递结果，测试投递失败不会重试
+// @Tags Webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.WebhookDelivery "投递记录"
+// @Router /user/webhooks/{id}/test [post]
+func (s *DefaultUserService) handleWebhookTest(c *gin.Context) {
+	hook := findUserWebhook(c)
+	if hook == nil {
+		return
+	}
+	delivery, err := webhook.NewDelivery(hook, webhook.Payload{
+		Event: webhook.EventTest,
+		Data:  map[string]interface{}{"message": "这是一条测试消息"},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = webhook.Deliver(c.Request.Context(), webhook.NewClient(), hook, delivery, time.Now())
+	if err != nil {
+		delivery.Status = database.WebhookDeliveryFailed
+		s.logger.Warn("[Webhook] [测试] %s 失败: %v", hook.URL, err)
+	}
+	if err := database.AddWebhookDelivery(database.GetDB(), delivery); err != nil {
+		s.logger.Error("[Webhook] [测试] 保存投递记录失败: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": delivery})
+}
+
+// handleWebhookDeliveries 投递记录
+// @Summary 获取Webhook投递记录
+// @Description 按时间倒序返回最近的投递记录，包括待重试、成功与失败的记录
+// @Tags Webhook
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "条数，默认50"
+// @Success 200 {object} []models.WebhookDelivery "投递记录"
+// @Router /user/webhooks/{id}/deliveries [get]
+func (s *DefaultUserService) handleWebhookDeliveries(c *gin.Context) {
+	hook := findUserWebhook(c)
+	if hook == nil {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(webhookDeliveryListLimit)))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = webhookDeliveryListLimit
+	}
+	deliveries, err := database.ListWebhookDeliveries(database.GetDB(), hook.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "data": deliveries})
+}
@@ -18,15 +18,22 @@ import (
 
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/auth/store"
 	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/recording"
+	"xiaozhi-server-go/src/core/reminder"
+	"xiaozhi-server-go/src/core/telemetry"
 	"xiaozhi-server-go/src/core/transport"
 	"xiaozhi-server-go/src/core/transport/websocket"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/core/webhook"
 	_ "xiaozhi-server-go/src/docs"
+	"xiaozhi-server-go/src/httpsvr/mcpserver"
 	"xiaozhi-server-go/src/httpsvr/ota"
 	"xiaozhi-server-go/src/httpsvr/vision"
+	"xiaozhi-server-go/src/models"
 	"xiaozhi-server-go/src/task"
 
 	_ "xiaozhi-server-go/src/docs"
@@ -44,9 +51,13 @@ import (
 	_ "xiaozhi-server-go/src/core/providers/asr/doubao"
 	_ "xiaozhi-server-go/src/core/providers/asr/gosherpa"
 	_ "xiaozhi-server-go/src/core/providers/asr/iflytek"
+	_ "xiaozhi-server-go/src/core/providers/asr/mock"
 	_ "xiaozhi-server-go/src/core/providers/asr/stepfun"
+	_ "xiaozhi-server-go/src/core/providers/llm/anthropic"
 	_ "xiaozhi-server-go/src/core/providers/llm/coze"
+	_ "xiaozhi-server-go/src/core/providers/llm/dify"
 	_ "xiaozhi-server-go/src/core/providers/llm/doubao"
+	_ "xiaozhi-server-go/src/core/providers/llm/mock"
 	_ "xiaozhi-server-go/src/core/providers/llm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/llm/openai"
 	_ "xiaozhi-server-go/src/core/providers/tts/deepgram"
@@ -54,6 +65,7 @@ import (
 	_ "xiaozhi-server-go/src/core/providers/tts/edge"
 	_ "xiaozhi-server-go/src/core/providers/tts/gosherpa"
 	_ "xiaozhi-server-go/src/core/providers/tts/iflytek"
+	_ "xiaozhi-server-go/src/core/providers/tts/mock"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/openai"
 
@@ -88,6 +100,10 @@ func LoadConfigAndLogger() (*configs.Config, *utils.Logger, error) {
 	utils.DefaultLogger = logger
 	logger.Info("日志系统初始化成功,level:%s 配置文件路径: %s", config.Log.LogLevel, configPath)
 
+	if err := utils.SetTrustedProxies(config.Server.TrustedProxies); err != nil {
+		return nil, nil, fmt.Errorf("受信任代理配置错误: %v", err)
+	}
+
 	database.SetLogger(logger)
 	database.InsertDefaultConfigIfNeeded(database.GetDB())
 
@@ -174,6 +190,7 @@ func StartTransportServer(
 			} else {
 				logger.Info("所有传输层已优雅关闭")
 			}
+			handlerFactory.ReleaseParkedSessions()
 		}()
 
 		// 使用传输管理器启动服务
@@ -194,6 +211,7 @@ func StartTransportServer(
 func StartHttpServer(
 	config *configs.Config,
 	logger *utils.Logger,
+	transportManager *transport.TransportManager,
 	g *errgroup.Group,
 	groupCtx context.Context,
 ) (*http.Server, error) {
@@ -265,7 +283,7 @@ func StartHttpServer(
 		return nil, err
 	}
 
-	cfgServer, err := cfg.NewDefaultAdminService(config, logger)
+	cfgServer, err := cfg.NewDefaultAdminService(config, logger, transportManager)
 	if err != nil {
 		logger.Error("Admin 服务初始化失败 %v", err)
 		return nil, err
@@ -275,7 +293,7 @@ func StartHttpServer(
 		return nil, err
 	}
 
-	userServer, err := cfg.NewDefaultUserService(config, logger)
+	userServer, err := cfg.NewDefaultUserService(config, logger, transportManager)
 	if err != nil {
 		logger.Error("用户服务初始化失败 %v", err)
 		return nil, err
@@ -285,6 +303,19 @@ func StartHttpServer(
 		return nil, err
 	}
 
+	// 启动MCP服务端，供外部智能体控制在线设备
+	if config.MCPServer.Enabled {
+		mcpService, err := mcpserver.NewDefaultMCPServerService(config, logger, transportManager)
+		if err != nil {
+			logger.Error("MCP 服务初始化失败 %v", err)
+			return nil, err
+		}
+		if err := mcpService.Start(groupCtx, router, apiGroup); err != nil {
+			logger.Error("MCP 服务启动失败 %v", err)
+			return nil, err
+		}
+	}
+
 	// 启动系统配置服务
 	systemConfigService := cfg.NewSystemConfigService(logger, database.GetDB())
 	systemConfigService.RegisterRoutes(apiGroup)
@@ -366,19 +397,77 @@ func startServices(
 	g *errgroup.Group,
 	groupCtx context.Context,
 ) error {
+	// 清理上次异常退出遗留的设备在线状态，需在接受新连接之前完成
+	if closed, err := database.ReconcileDevicePresence(database.GetDB()); err != nil {
+		logger.Error("[设备在线] [启动校准] 失败: %v", err)
+	} else if closed > 0 {
+		logger.Info("[设备在线] [启动校准] 关闭 %d 条未结束的连接记录", closed)
+	}
+
 	// 启动传输层服务
-	if _, err := StartTransportServer(config, logger, authManager, g, groupCtx); err != nil {
+	transportManager, err := StartTransportServer(config, logger, authManager, g, groupCtx)
+	if err != nil {
 		return fmt.Errorf("启动传输层服务失败: %w", err)
 	}
 
 	// 启动 Http 服务
-	if _, err := StartHttpServer(config, logger, g, groupCtx); err != nil {
+	if _, err := StartHttpServer(config, logger, transportManager, g, groupCtx); err != nil {
 		return fmt.Errorf("启动 Http 服务失败: %w", err)
 	}
 
+	// 启动提醒调度
+	StartReminderScheduler(logger, transportManager, g, groupCtx)
+
+	// 启动 Webhook 投递
+	StartWebhookDispatcher(logger, g, groupCtx)
+
+	// 启动设备健康监控
+	monitor := telemetry.NewMonitor(logger, config)
+	g.Go(func() error {
+		monitor.Run(groupCtx)
+		return nil
+	})
+
+	// 启动录音清理
+	cleaner := recording.NewCleaner(logger, config)
+	g.Go(func() error {
+		cleaner.Run(groupCtx)
+		return nil
+	})
+
 	return nil
 }
 
+// StartWebhookDispatcher 启动 Webhook 投递器，订阅会话事件并投递到用户注册的回调地址
+func StartWebhookDispatcher(logger *utils.Logger, g *errgroup.Group, groupCtx context.Context) {
+	dispatcher := webhook.NewDispatcher(logger, nil)
+	g.Go(func() error {
+		dispatcher.Run(groupCtx)
+		return nil
+	})
+}
+
+// StartReminderScheduler 启动提醒调度器，到期提醒通过在线会话播报，设备离线时暂存到下次连接
+func StartReminderScheduler(
+	logger *utils.Logger,
+	transportManager *transport.TransportManager,
+	g *errgroup.Group,
+	groupCtx context.Context,
+) {
+	scheduler := reminder.NewScheduler(logger, func(a *models.DeviceAnnouncement) bool {
+		handler := transportManager.FindConnectionHandler(a.DeviceID)
+		if handler == nil {
+			return false
+		}
+		// 携带暂存ID，播放完成后才标记为已下发，超时未播放的提醒下次连接时重播
+		return handler.Announce(core.Announcement{Text: a.Text, StoredID: a.ID}) == nil
+	})
+	g.Go(func() error {
+		scheduler.Run(groupCtx)
+		return nil
+	})
+}
+
 func main() {
 	// 加载配置和初始化日志系统
 	config, logger, err := LoadConfigAndLogger()
@@ -4,6 +4,7 @@ import (
 	//"gorm.io/gorm"
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -30,7 +31,24 @@ type Agent struct {
 	Description        string    `gorm:"type:text"            json:"description"`        // 智能体描述
 	CatalogyID         uint      `                            json:"catalogy_id"`        // 分类ID
 	Extra              string    `gorm:"type:text"            json:"extra"`              // 额外信息，JSON格式
+	LLMFallbacks       string    `gorm:"type:text"            json:"llmFallbacks"`       // 备用LLM列表，按优先级排列，如 "llm1,llm2"
+	TTSFallbacks       string    `gorm:"type:text"            json:"ttsFallbacks"`       // 备用TTS列表，按优先级排列
+	ASRFallbacks       string    `gorm:"type:text"            json:"asrFallbacks"`       // 备用ASR列表，按优先级排列
 }
+
+// AgentLLMParams 智能体覆盖的模型名称与采样参数，保存在 Agent.Extra 的 llm_params 中，未设置的字段沿用LLM配置
+type AgentLLMParams struct {
+	ModelName        string   `json:"model_name,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	ReasoningEffort  string   `json:"reasoning_effort,omitempty"` // low/medium/high
+}
+
 type AgentDialog struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	Conversationid string    `                  json:"conversationId"`
@@ -84,6 +102,7 @@ type User struct {
 	Status      uint      `gorm:"default:1"                              json:"status"` // 用户状态，1=正常，0=禁用
 	PhoneNumber string    `gorm:"type:varchar(20);" json:"phoneNumber"`                 // 手机号码
 	Extra       string    `gorm:"type:text"                              json:"extra"`  // 额外信息，JSON格式
+	Level       string    `gorm:"type:varchar(32);default:'basic'"       json:"level"`  // 用户级别：basic/premium/business，决定每日用量配额
 }
 
 type ServerConfig struct {
@@ -99,3 +118,235 @@ type ServerStatus struct {
 	MemoryUsage      string    `json:"memoryUsage"`      // 内存使用率
 	UpdatedAt        time.Time `json:"updatedAt"`
 }
+
+// 设备播报消息：设备离线时暂存，设备下次连接时下发
+type DeviceAnnouncement struct {
+	ID          uint       `gorm:"primaryKey"                json:"id"`
+	DeviceID    string     `gorm:"type:varchar(255);index"   json:"deviceId"`    // 设备ID
+	UserID      uint       `gorm:"index"                     json:"userID"`      // 发起用户
+	Text        string     `gorm:"type:text"                 json:"text"`        // 播报文本
+	AudioPath   string     `gorm:"type:varchar(512)"         json:"audioPath"`   // 音频文件路径，为空时使用TTS合成文本
+	Delivered   bool       `gorm:"index;default:false"       json:"delivered"`   // 是否已下发
+	CreatedAt   time.Time  `                                 json:"createdAt"`   // 创建时间
+	ExpireAt    time.Time  `                                 json:"expireAt"`    // 过期时间，过期后不再下发
+	DeliveredAt *time.Time `                                 json:"deliveredAt"` // 下发时间
+}
+
+// 定时提醒：Repeat为空时只提醒一次，否则为5段cron表达式
+type Reminder struct {
+	ID        uint       `gorm:"primaryKey"                  json:"id"`
+	UserID    uint       `gorm:"index"                       json:"userID"`    // 所属用户
+	DeviceID  string     `gorm:"type:varchar(255);index"     json:"deviceId"`  // 提醒的设备
+	Content   string     `gorm:"type:text"                   json:"content"`   // 提醒内容
+	Repeat    string     `gorm:"type:varchar(64)"            json:"repeat"`    // 重复规则（cron表达式），为空表示只提醒一次
+	NextRunAt time.Time  `gorm:"index"                       json:"nextRunAt"` // 下一次提醒时间
+	Enabled   bool       `gorm:"index;default:true"          json:"enabled"`   // 是否启用，一次性提醒触发后自动关闭
+	LastRunAt *time.Time `                                   json:"lastRunAt"` // 上一次提醒时间
+	CreatedAt time.Time  `                                   json:"createdAt"`
+	UpdatedAt time.Time  `                                   json:"updatedAt"`
+}
+
+// Webhook 用户注册的事件回调地址，Events为逗号分隔的事件类型，为空表示订阅全部
+type Webhook struct {
+	ID          uint      `gorm:"primaryKey"               json:"id"`
+	UserID      uint      `gorm:"index"                    json:"userID"`      // 所属用户
+	URL         string    `gorm:"type:varchar(1024)"       json:"url"`         // 回调地址
+	Secret      string    `gorm:"type:varchar(255)"        json:"-"`           // 签名密钥
+	Events      string    `gorm:"type:varchar(512)"        json:"events"`      // 订阅的事件类型
+	Description string    `gorm:"type:varchar(255)"        json:"description"` // 备注
+	Enabled     bool      `gorm:"index"                    json:"enabled"`     // 是否启用，创建时由调用方指定
+	CreatedAt   time.Time `                                json:"createdAt"`
+	UpdatedAt   time.Time `                                json:"updatedAt"`
+}
+
+// WebhookDelivery Webhook 投递记录，同时作为持久化的重试队列
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey"                json:"id"`
+	WebhookID     uint       `gorm:"index"                     json:"webhookID"`     // 所属Webhook
+	EventID       string     `gorm:"type:varchar(64);index"    json:"eventID"`       // 事件ID，重试时保持不变，便于接收方去重
+	EventType     string     `gorm:"type:varchar(64)"          json:"eventType"`     // 事件类型
+	Payload       string     `gorm:"type:text"                 json:"payload"`       // 请求体
+	Status        string     `gorm:"type:varchar(16);index"    json:"status"`        // pending/success/failed
+	Attempts      int        `gorm:"default:0"                 json:"attempts"`      // 已尝试次数
+	NextAttemptAt time.Time  `gorm:"index"                     json:"nextAttemptAt"` // 下一次尝试时间
+	ResponseCode  int        `                                 json:"responseCode"`  // 最后一次响应状态码
+	LastError     string     `gorm:"type:text"                 json:"lastError"`     // 最后一次错误信息
+	CreatedAt     time.Time  `                                 json:"createdAt"`
+	DeliveredAt   *time.Time `                                 json:"deliveredAt"` // 投递成功时间
+}
+
+// DeviceConnection 设备连接历史，每次连接一条记录，DisconnectedAt为空表示连接尚未结束
+type DeviceConnection struct {
+	ID               uint       `gorm:"primaryKey"                json:"id"`
+	DeviceID         string     `gorm:"type:varchar(255);index"   json:"deviceId"`         // 设备ID
+	UserID           uint       `gorm:"index"                     json:"userID"`           // 设备所属用户
+	SessionID        string     `gorm:"type:varchar(64)"          json:"sessionId"`        // 会话ID
+	ClientIP         string     `gorm:"type:varchar(64)"          json:"clientIp"`         // 客户端IP
+	Transport        string     `gorm:"type:varchar(32)"          json:"transport"`        // 传输方式
+	ConnectedAt      time.Time  `gorm:"index"                     json:"connectedAt"`      // 连接时间
+	LastSeenAt       time.Time  `                                 json:"lastSeenAt"`       // 最后一次心跳时间
+	DisconnectedAt   *time.Time `gorm:"index"                     json:"disconnectedAt"`   // 断开时间
+	Duration         int64      `                                 json:"duration"`         // 连接时长（秒）
+	Rounds           int        `                                 json:"rounds"`           // 对话轮次
+	DisconnectReason string     `gorm:"type:varchar(64)"          json:"disconnectReason"` // 断开原因
+}
+
+// Firmware OTA固件，按主板类型、芯片型号与应用名称定向，并按比例或设备白名单分阶段推送
+type Firmware struct {
+	ID             uint      `gorm:"primaryKey"               json:"id"`
+	Version        string    `gorm:"type:varchar(64);index"   json:"version"`        // 固件版本号
+	FileName       string    `gorm:"type:varchar(255)"        json:"fileName"`       // ota_bin 目录下的文件名
+	Size           int64     `                                json:"size"`           // 文件大小
+	SHA256         string    `gorm:"type:varchar(64)"         json:"sha256"`         // 文件sha256
+	BoardTypes     string    `gorm:"type:varchar(512)"        json:"boardTypes"`     // 适用的主板类型，逗号分隔，为空表示不限
+	ChipModels     string    `gorm:"type:varchar(255)"        json:"chipModels"`     // 适用的芯片型号，逗号分隔，为空表示不限
+	AppName        string    `gorm:"type:varchar(128)"        json:"appName"`        // 适用的应用名称，为空表示不限
+	RolloutPercent int       `gorm:"default:0"                json:"rolloutPercent"` // 推送比例 0-100
+	Allowlist      string    `gorm:"type:text"                json:"allowlist"`      // 设备白名单，逗号分隔，不受推送比例限制
+	Enabled        bool      `gorm:"index;default:true"       json:"enabled"`        // 是否启用
+	Notes          string    `gorm:"type:text"                json:"notes"`          // 更新说明
+	CreatedAt      time.Time `                                json:"createdAt"`
+	UpdatedAt      time.Time `                                json:"updatedAt"`
+}
+
+// DeviceFirmwarePolicy 单个设备的固件策略：固定版本或屏蔽版本
+type DeviceFirmwarePolicy struct {
+	ID              uint      `gorm:"primaryKey"                      json:"id"`
+	DeviceID        string    `gorm:"type:varchar(255);uniqueIndex"   json:"deviceId"`        // 设备ID
+	PinnedVersion   string    `gorm:"type:varchar(64)"                json:"pinnedVersion"`   // 固定版本，设置后只推送该版本
+	BlockedVersions string    `gorm:"type:varchar(512)"               json:"blockedVersions"` // 屏蔽的版本，逗号分隔
+	UpdatedAt       time.Time `                                       json:"updatedAt"`
+}
+
+// FirmwareDeployment 固件推送记录：设备何时被推送、何时下载了该固件
+type FirmwareDeployment struct {
+	ID            uint       `gorm:"primaryKey"                                        json:"id"`
+	FirmwareID    uint       `gorm:"uniqueIndex:idx_firmware_device"                   json:"firmwareID"`    // 固件ID
+	DeviceID      string     `gorm:"type:varchar(255);uniqueIndex:idx_firmware_device" json:"deviceId"`      // 设备ID
+	FromVersion   string     `gorm:"type:varchar(64)"                                  json:"fromVersion"`   // 推送时设备的版本
+	OfferedAt     time.Time  `                                                         json:"offeredAt"`     // 首次推送时间
+	LastOfferedAt time.Time  `                                                         json:"lastOfferedAt"` // 最近一次推送时间
+	OfferCount    int        `                                                         json:"offerCount"`    // 推送次数
+	DownloadedAt  *time.Time `                                                         json:"downloadedAt"`  // 最近一次下载时间
+	DownloadCount int        `                                                         json:"downloadCount"` // 下载次数
+}
+
+// DeviceTelemetry 设备每次 OTA 检查上报的健康数据
+type DeviceTelemetry struct {
+	ID             uint      `gorm:"primaryKey"                                 json:"id"`
+	DeviceID       string    `gorm:"type:varchar(255);index:idx_telemetry_time" json:"deviceId"`       // 设备ID
+	RecordedAt     time.Time `gorm:"index:idx_telemetry_time"                   json:"recordedAt"`     // 上报时间
+	AppName        string    `gorm:"type:varchar(128)"                          json:"appName"`        // 应用名称
+	AppVersion     string    `gorm:"type:varchar(64)"                           json:"appVersion"`     // 应用版本
+	IDFVersion     string    `gorm:"type:varchar(64)"                           json:"idfVersion"`     // IDF版本
+	BoardType      string    `gorm:"type:varchar(128)"                          json:"boardType"`      // 主板类型
+	ChipModel      string    `gorm:"type:varchar(64)"                           json:"chipModel"`      // 芯片型号
+	IP             string    `gorm:"type:varchar(64)"                           json:"ip"`             // 设备局域网IP
+	SSID           string    `gorm:"type:varchar(128)"                          json:"ssid"`           // WiFi SSID
+	Channel        int       `                                                  json:"channel"`        // WiFi 频道
+	RSSI           int       `                                                  json:"rssi"`           // WiFi 信号强度(dBm)
+	MinFreeHeap    int64     `                                                  json:"minFreeHeap"`    // 最小剩余堆内存(字节)
+	FlashSize      int64     `                                                  json:"flashSize"`      // Flash大小(字节)
+	OTALabel       string    `gorm:"type:varchar(32)"                           json:"otaLabel"`       // 当前运行的OTA分区
+	PartitionTable string    `gorm:"type:text"                                  json:"partitionTable"` // 分区表，JSON格式
+}
+
+// TelemetryAlertRule 设备健康告警规则，DeviceID为空表示适用于用户的全部设备
+type TelemetryAlertRule struct {
+	ID        uint      `gorm:"primaryKey"               json:"id"`
+	UserID    uint      `gorm:"index"                    json:"userID"`    // 所属用户
+	DeviceID  string    `gorm:"type:varchar(255);index"  json:"deviceId"`  // 设备ID，为空表示全部设备
+	Type      string    `gorm:"type:varchar(32)"         json:"type"`      // low_heap/weak_rssi/silent
+	Threshold int64     `                                json:"threshold"` // 阈值：堆内存字节数/信号强度dBm/静默小时数
+	Enabled   bool      `                                json:"enabled"`   // 是否启用，创建时由调用方指定
+	CreatedAt time.Time `                                json:"createdAt"`
+	UpdatedAt time.Time `                                json:"updatedAt"`
+}
+
+// TelemetryAlert 触发的告警记录
+type TelemetryAlert struct {
+	ID        uint      `gorm:"primaryKey"                                    json:"id"`
+	RuleID    uint      `gorm:"index:idx_alert_rule_device"                   json:"ruleID"`    // 规则ID
+	UserID    uint      `gorm:"index"                                         json:"userID"`    // 所属用户
+	DeviceID  string    `gorm:"type:varchar(255);index:idx_alert_rule_device" json:"deviceId"`  // 设备ID
+	Type      string    `gorm:"type:varchar(32)"                              json:"type"`      // 告警类型
+	Value     int64     `                                                     json:"value"`     // 触发时的数值
+	Message   string    `gorm:"type:varchar(512)"                             json:"message"`   // 告警内容
+	CreatedAt time.Time `gorm:"index"                                         json:"createdAt"` // 触发时间
+}
+
+// DevicePreset 设备预设，保存一组设备端MCP工具调用，应用时按顺序执行
+type DevicePreset struct {
+	ID          uint           `gorm:"primaryKey"               json:"id"`
+	UserID      uint           `gorm:"index"                    json:"userID"`      // 所属用户
+	DeviceID    string         `gorm:"type:varchar(255);index"  json:"deviceId"`    // 适用设备，为空表示可用于全部设备
+	Name        string         `gorm:"type:varchar(64)"         json:"name"`        // 预设名称
+	Actions     datatypes.JSON `                                json:"actions"`     // 工具调用列表：[{"tool":"...","arguments":{...}}]
+	Description string         `gorm:"type:varchar(255)"        json:"description"` // 备注
+	CreatedAt   time.Time      `                                json:"createdAt"`
+	UpdatedAt   time.Time      `                                json:"updatedAt"`
+}
+
+// QuotaPlan 用户级别对应的每日用量配额，各项为0表示不限制
+type QuotaPlan struct {
+	ID              uint      `gorm:"primaryKey"                   json:"id"`
+	Level           string    `gorm:"type:varchar(32);uniqueIndex" json:"level"`           // 用户级别
+	PerDevice       bool      `                                    json:"perDevice"`       // true=配额按设备分别计算，false=按用户全部设备合计
+	DailyRounds     int64     `                                    json:"dailyRounds"`     // 每日对话轮次
+	DailyLLMTokens  int64     `                                    json:"dailyLLMTokens"`  // 每日LLM Token数
+	DailyTTSChars   int64     `                                    json:"dailyTTSChars"`   // 每日TTS合成字数
+	DailyASRSeconds int64     `                                    json:"dailyASRSeconds"` // 每日ASR识别音频秒数
+	DailyToolCalls  int64     `                                    json:"dailyToolCalls"`  // 每日工具调用次数
+	UpdatedAt       time.Time `                                    json:"updatedAt"`
+}
+
+// DailyUsage 用户每台设备每天的用量
+type DailyUsage struct {
+	ID         uint      `gorm:"primaryKey"                                         json:"id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_usage_daily"                        json:"userID"`     // 所属用户，未绑定用户的设备为0
+	DeviceID   string    `gorm:"type:varchar(255);uniqueIndex:idx_usage_daily"      json:"deviceId"`   // 设备ID
+	Date       string    `gorm:"type:varchar(10);uniqueIndex:idx_usage_daily;index" json:"date"`       // 日期，格式 2006-01-02
+	Rounds     int64     `                                                          json:"rounds"`     // 对话轮次
+	LLMTokens  int64     `                                                          json:"llmTokens"`  // LLM Token数
+	TTSChars   int64     `                                                          json:"ttsChars"`   // TTS合成字数
+	ASRSeconds float64   `                                                          json:"asrSeconds"` // ASR识别音频秒数
+	ToolCalls  int64     `                                                          json:"toolCalls"`  // 工具调用次数
+	UpdatedAt  time.Time `                                                          json:"updatedAt"`
+}
+
+// ProviderUsage 每天按提供者、智能体和设备统计的用量与费用
+type ProviderUsage struct {
+	ID               uint      `gorm:"primaryKey"                                            json:"id"`
+	Date             string    `gorm:"type:varchar(10);uniqueIndex:idx_provider_usage;index" json:"date"`             // 日期，格式 2006-01-02
+	UserID           uint      `gorm:"uniqueIndex:idx_provider_usage;index"                  json:"userID"`           // 所属用户，未绑定用户的设备为0
+	AgentID          uint      `gorm:"uniqueIndex:idx_provider_usage"                        json:"agentID"`          // 智能体ID，未绑定智能体为0
+	DeviceID         string    `gorm:"type:varchar(255);uniqueIndex:idx_provider_usage"      json:"deviceId"`         // 设备ID
+	Kind             string    `gorm:"type:varchar(16);uniqueIndex:idx_provider_usage"       json:"kind"`             // 提供者类型：llm/tts/asr
+	Provider         string    `gorm:"type:varchar(100);uniqueIndex:idx_provider_usage"      json:"provider"`         // 提供者配置名称
+	Requests         int64     `                                                             json:"requests"`         // 请求次数
+	PromptTokens     int64     `                                                             json:"promptTokens"`     // LLM输入Token数
+	CompletionTokens int64     `                                                             json:"completionTokens"` // LLM输出Token数
+	Chars            int64     `                                                             json:"chars"`            // TTS合成字数
+	AudioSeconds     float64   `                                                             json:"audioSeconds"`     // ASR识别音频秒数
+	Cost             float64   `                                                             json:"cost"`             // 按单价计算的费用
+	UpdatedAt        time.Time `                                                             json:"updatedAt"`
+}
+
+// Recording 对话录音，用户每句话与每段TTS回复各一条，音频以WAV文件保存在录音目录下
+type Recording struct {
+	ID             uint      `gorm:"primaryKey"                                     json:"id"`
+	UserID         uint      `gorm:"index"                                          json:"userID"`         // 所属用户，未绑定用户的设备为0
+	AgentID        uint      `gorm:"index:idx_recording_dialog"                     json:"agentID"`        // 智能体ID
+	Conversationid string    `gorm:"type:varchar(255);index:idx_recording_dialog"   json:"conversationId"` // 对话记录ID，与 AgentDialog.Conversationid 对应，同一对话按 Round 区分轮次
+	DeviceID       string    `gorm:"type:varchar(255);index"                        json:"deviceId"`       // 设备ID
+	SessionID      string    `gorm:"type:varchar(64);index:idx_recording_round"     json:"sessionId"`      // 连接会话ID
+	Round          int       `gorm:"index:idx_recording_round"                      json:"round"`          // 对话轮次
+	Kind           string    `gorm:"type:varchar(16)"                               json:"kind"`           // user 用户语音 / tts 回复语音
+	SegmentIndex   int       `                                                      json:"segmentIndex"`   // TTS分段序号，用户语音为0
+	Text           string    `gorm:"type:text"                                      json:"text"`           // 识别结果或TTS文本
+	FilePath       string    `gorm:"type:varchar(512);index"                        json:"-"`              // WAV文件路径
+	SampleRate     int       `                                                      json:"sampleRate"`     // 采样率
+	DurationMs     int64     `                                                      json:"durationMs"`     // 时长（毫秒）
+	Size           int64     `                                                      json:"size"`           // 文件大小（字节）
+	CreatedAt      time.Time `gorm:"index"                                          json:"createdAt"`
+}